@@ -8,6 +8,7 @@ import (
 
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/ledger"
 )
 
 type Account struct {
@@ -26,6 +27,26 @@ func (cbs *ChainBrokerService) GetAccountBalance(ctx context.Context, req *pb.Ad
 
 	account := cbs.api.Account().GetAccount(addr)
 
+	return accountResponse(account)
+}
+
+// GetAccountBalanceAt returns the account as of the block of the given height
+func (cbs *ChainBrokerService) GetAccountBalanceAt(ctx context.Context, req *GetAccountBalanceRequest) (*pb.Response, error) {
+	if !types.IsValidAddressByte([]byte(req.Address)) {
+		return nil, fmt.Errorf("invalid account address: %v", req.Address)
+	}
+
+	addr := types.NewAddressByStr(req.Address)
+
+	account, err := cbs.api.Account().GetAccountAt(addr, req.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	return accountResponse(account)
+}
+
+func accountResponse(account *ledger.Account) (*pb.Response, error) {
 	hash := types.NewHash(account.CodeHash())
 
 	typ := "normal"
@@ -71,6 +71,7 @@ func (cbs *ChainBrokerService) Start() error {
 	}
 
 	pb.RegisterChainBrokerServer(cbs.server, cbs)
+	RegisterChainBrokerExtensionServer(cbs.server, cbs)
 
 	cbs.logger.WithFields(logrus.Fields{
 		"port": cbs.config.Port.Grpc,
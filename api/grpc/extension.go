@@ -0,0 +1,344 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/meshplus/bitxhub-model/pb"
+	"google.golang.org/grpc"
+)
+
+// The ChainBroker protocol is defined in bitxhub-model. Queries served by the
+// node which are not part of the protocol yet are exposed by the
+// ChainBrokerExtension service below, with messages declared by hand.
+
+// ChainBrokerExtensionServer is the server API for ChainBrokerExtension service.
+type ChainBrokerExtensionServer interface {
+	GetStateProof(context.Context, *GetStateProofRequest) (*pb.Response, error)
+	GetTransactionProof(context.Context, *pb.TransactionHashMsg) (*pb.Response, error)
+	GetReceiptProof(context.Context, *pb.TransactionHashMsg) (*pb.Response, error)
+	GetAccountBalanceAt(context.Context, *GetAccountBalanceRequest) (*pb.Response, error)
+	SendViewAt(context.Context, *SendViewRequest) (*pb.Receipt, error)
+	GetInterchainTxs(context.Context, *GetInterchainTxsRequest) (*pb.Response, error)
+}
+
+// ChainBrokerExtensionClient is the client API for ChainBrokerExtension service.
+type ChainBrokerExtensionClient interface {
+	GetStateProof(ctx context.Context, in *GetStateProofRequest, opts ...grpc.CallOption) (*pb.Response, error)
+	GetTransactionProof(ctx context.Context, in *pb.TransactionHashMsg, opts ...grpc.CallOption) (*pb.Response, error)
+	GetReceiptProof(ctx context.Context, in *pb.TransactionHashMsg, opts ...grpc.CallOption) (*pb.Response, error)
+	GetAccountBalanceAt(ctx context.Context, in *GetAccountBalanceRequest, opts ...grpc.CallOption) (*pb.Response, error)
+	SendViewAt(ctx context.Context, in *SendViewRequest, opts ...grpc.CallOption) (*pb.Receipt, error)
+	GetInterchainTxs(ctx context.Context, in *GetInterchainTxsRequest, opts ...grpc.CallOption) (*pb.Response, error)
+}
+
+type chainBrokerExtensionClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChainBrokerExtensionClient(cc grpc.ClientConnInterface) ChainBrokerExtensionClient {
+	return &chainBrokerExtensionClient{cc}
+}
+
+func (c *chainBrokerExtensionClient) GetStateProof(ctx context.Context, in *GetStateProofRequest, opts ...grpc.CallOption) (*pb.Response, error) {
+	out := new(pb.Response)
+	err := c.cc.Invoke(ctx, "/pb.ChainBrokerExtension/GetStateProof", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chainBrokerExtensionClient) GetTransactionProof(ctx context.Context, in *pb.TransactionHashMsg, opts ...grpc.CallOption) (*pb.Response, error) {
+	out := new(pb.Response)
+	err := c.cc.Invoke(ctx, "/pb.ChainBrokerExtension/GetTransactionProof", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chainBrokerExtensionClient) GetReceiptProof(ctx context.Context, in *pb.TransactionHashMsg, opts ...grpc.CallOption) (*pb.Response, error) {
+	out := new(pb.Response)
+	err := c.cc.Invoke(ctx, "/pb.ChainBrokerExtension/GetReceiptProof", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chainBrokerExtensionClient) GetAccountBalanceAt(ctx context.Context, in *GetAccountBalanceRequest, opts ...grpc.CallOption) (*pb.Response, error) {
+	out := new(pb.Response)
+	err := c.cc.Invoke(ctx, "/pb.ChainBrokerExtension/GetAccountBalanceAt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chainBrokerExtensionClient) SendViewAt(ctx context.Context, in *SendViewRequest, opts ...grpc.CallOption) (*pb.Receipt, error) {
+	out := new(pb.Receipt)
+	err := c.cc.Invoke(ctx, "/pb.ChainBrokerExtension/SendViewAt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chainBrokerExtensionClient) GetInterchainTxs(ctx context.Context, in *GetInterchainTxsRequest, opts ...grpc.CallOption) (*pb.Response, error) {
+	out := new(pb.Response)
+	err := c.cc.Invoke(ctx, "/pb.ChainBrokerExtension/GetInterchainTxs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func RegisterChainBrokerExtensionServer(s *grpc.Server, srv ChainBrokerExtensionServer) {
+	s.RegisterService(&chainBrokerExtensionServiceDesc, srv)
+}
+
+func chainBrokerExtensionGetStateProofHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStateProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainBrokerExtensionServer).GetStateProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChainBrokerExtension/GetStateProof",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainBrokerExtensionServer).GetStateProof(ctx, req.(*GetStateProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func chainBrokerExtensionGetTransactionProofHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.TransactionHashMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainBrokerExtensionServer).GetTransactionProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChainBrokerExtension/GetTransactionProof",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainBrokerExtensionServer).GetTransactionProof(ctx, req.(*pb.TransactionHashMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func chainBrokerExtensionGetReceiptProofHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.TransactionHashMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainBrokerExtensionServer).GetReceiptProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChainBrokerExtension/GetReceiptProof",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainBrokerExtensionServer).GetReceiptProof(ctx, req.(*pb.TransactionHashMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func chainBrokerExtensionGetAccountBalanceAtHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAccountBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainBrokerExtensionServer).GetAccountBalanceAt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChainBrokerExtension/GetAccountBalanceAt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainBrokerExtensionServer).GetAccountBalanceAt(ctx, req.(*GetAccountBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func chainBrokerExtensionSendViewAtHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendViewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainBrokerExtensionServer).SendViewAt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChainBrokerExtension/SendViewAt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainBrokerExtensionServer).SendViewAt(ctx, req.(*SendViewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func chainBrokerExtensionGetInterchainTxsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInterchainTxsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainBrokerExtensionServer).GetInterchainTxs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChainBrokerExtension/GetInterchainTxs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainBrokerExtensionServer).GetInterchainTxs(ctx, req.(*GetInterchainTxsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var chainBrokerExtensionServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.ChainBrokerExtension",
+	HandlerType: (*ChainBrokerExtensionServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStateProof",
+			Handler:    chainBrokerExtensionGetStateProofHandler,
+		},
+		{
+			MethodName: "GetTransactionProof",
+			Handler:    chainBrokerExtensionGetTransactionProofHandler,
+		},
+		{
+			MethodName: "GetReceiptProof",
+			Handler:    chainBrokerExtensionGetReceiptProofHandler,
+		},
+		{
+			MethodName: "GetAccountBalanceAt",
+			Handler:    chainBrokerExtensionGetAccountBalanceAtHandler,
+		},
+		{
+			MethodName: "SendViewAt",
+			Handler:    chainBrokerExtensionSendViewAtHandler,
+		},
+		{
+			MethodName: "GetInterchainTxs",
+			Handler:    chainBrokerExtensionGetInterchainTxsHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "extension.proto",
+}
+
+type GetStateProofRequest struct {
+	Address string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Key     []byte `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Height  uint64 `protobuf:"varint,3,opt,name=height,proto3" json:"height,omitempty"`
+}
+
+func (m *GetStateProofRequest) Reset()         { *m = GetStateProofRequest{} }
+func (m *GetStateProofRequest) String() string { return proto.CompactTextString(m) }
+func (*GetStateProofRequest) ProtoMessage()    {}
+
+type GetAccountBalanceRequest struct {
+	Address string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Height  uint64 `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+}
+
+func (m *GetAccountBalanceRequest) Reset()         { *m = GetAccountBalanceRequest{} }
+func (m *GetAccountBalanceRequest) String() string { return proto.CompactTextString(m) }
+func (*GetAccountBalanceRequest) ProtoMessage()    {}
+
+type GetInterchainTxsRequest struct {
+	From   string `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To     string `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	Status string `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Offset uint64 `protobuf:"varint,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	Limit  uint64 `protobuf:"varint,5,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (m *GetInterchainTxsRequest) Reset()         { *m = GetInterchainTxsRequest{} }
+func (m *GetInterchainTxsRequest) String() string { return proto.CompactTextString(m) }
+func (*GetInterchainTxsRequest) ProtoMessage()    {}
+
+type SendViewRequest struct {
+	Tx     *pb.Transaction `protobuf:"bytes,1,opt,name=tx,proto3" json:"tx,omitempty"`
+	Height uint64          `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+}
+
+func (m *SendViewRequest) Reset()         { *m = SendViewRequest{} }
+func (m *SendViewRequest) String() string { return proto.CompactTextString(m) }
+func (*SendViewRequest) ProtoMessage()    {}
+
+// Marshal encodes the request by hand, the transaction holds gogo custom
+// types which the reflection based codec can not handle.
+func (m *SendViewRequest) Marshal() ([]byte, error) {
+	buf := proto.NewBuffer(nil)
+	if m.Tx != nil {
+		data, err := m.Tx.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		if err := buf.EncodeVarint(1<<3 | proto.WireBytes); err != nil {
+			return nil, err
+		}
+		if err := buf.EncodeRawBytes(data); err != nil {
+			return nil, err
+		}
+	}
+	if m.Height != 0 {
+		if err := buf.EncodeVarint(2<<3 | proto.WireVarint); err != nil {
+			return nil, err
+		}
+		if err := buf.EncodeVarint(m.Height); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (m *SendViewRequest) Unmarshal(data []byte) error {
+	m.Reset()
+	for len(data) > 0 {
+		key, n := proto.DecodeVarint(data)
+		if n == 0 {
+			return fmt.Errorf("invalid SendViewRequest")
+		}
+		data = data[n:]
+
+		switch key {
+		case 1<<3 | proto.WireBytes:
+			size, n := proto.DecodeVarint(data)
+			if n == 0 || uint64(len(data)-n) < size {
+				return fmt.Errorf("invalid tx of SendViewRequest")
+			}
+			m.Tx = &pb.Transaction{}
+			if err := m.Tx.Unmarshal(data[n : n+int(size)]); err != nil {
+				return err
+			}
+			data = data[n+int(size):]
+		case 2<<3 | proto.WireVarint:
+			height, n := proto.DecodeVarint(data)
+			if n == 0 {
+				return fmt.Errorf("invalid height of SendViewRequest")
+			}
+			m.Height = height
+			data = data[n:]
+		default:
+			return fmt.Errorf("unknown field %d of SendViewRequest", key>>3)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/meshplus/bitxhub-model/constant"
+	"github.com/meshplus/bitxhub-model/pb"
+)
+
+// GetInterchainTxs returns a page of the interchain transactions matching the
+// source chain, destination chain and status in the request, empty conditions
+// match any transaction
+func (cbs *ChainBrokerService) GetInterchainTxs(ctx context.Context, req *GetInterchainTxsRequest) (*pb.Response, error) {
+	invokePayload := &pb.InvokePayload{
+		Method: "ListTransactions",
+		Args: []*pb.Arg{
+			pb.String(req.From),
+			pb.String(req.To),
+			pb.String(req.Status),
+			pb.Uint64(req.Offset),
+			pb.Uint64(req.Limit),
+		},
+	}
+	invokeData, err := invokePayload.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	data := &pb.TransactionData{
+		Type:    pb.TransactionData_INVOKE,
+		VmType:  pb.TransactionData_BVM,
+		Payload: invokeData,
+	}
+	payload, err := data.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &pb.Transaction{
+		From:      constant.InterchainContractAddr.Address(),
+		To:        constant.TransactionMgrContractAddr.Address(),
+		Timestamp: time.Now().UnixNano(),
+		Payload:   payload,
+	}
+
+	receipt, err := cbs.api.Broker().HandleView(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !receipt.IsSuccess() {
+		return nil, fmt.Errorf("%s", receipt.Ret)
+	}
+
+	return &pb.Response{
+		Data: receipt.Ret,
+	}, nil
+}
@@ -0,0 +1,110 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/pkg/trie"
+)
+
+type StateProof struct {
+	Height    uint64      `json:"height"`
+	StateRoot *types.Hash `json:"state_root"`
+	Proof     *trie.Proof `json:"proof"`
+}
+
+// GetStateProof returns the state value of the account with the proof of it
+// against the state root of the block at the given height, an empty key
+// proves the account itself
+func (cbs *ChainBrokerService) GetStateProof(ctx context.Context, req *GetStateProofRequest) (*pb.Response, error) {
+	if !types.IsValidAddressByte([]byte(req.Address)) {
+		return nil, fmt.Errorf("invalid account address: %v", req.Address)
+	}
+
+	height := req.Height
+	if height == 0 {
+		meta, err := cbs.api.Chain().Meta()
+		if err != nil {
+			return nil, err
+		}
+		height = meta.Height
+	}
+
+	block, err := cbs.api.Broker().GetBlock("HEIGHT", strconv.FormatUint(height, 10))
+	if err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	if len(req.Key) != 0 {
+		key = req.Key
+	}
+
+	proof, err := cbs.api.Account().GetStateProof(types.NewAddressByStr(req.Address), key, height)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(&StateProof{
+		Height:    height,
+		StateRoot: block.BlockHeader.StateRoot,
+		Proof:     proof,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Response{
+		Data: data,
+	}, nil
+}
+
+// GetTransactionProof returns the merkle proof of the transaction against the
+// tx root of the block it is committed in
+func (cbs *ChainBrokerService) GetTransactionProof(ctx context.Context, req *pb.TransactionHashMsg) (*pb.Response, error) {
+	hash := types.NewHashByStr(req.TxHash)
+	if hash == nil {
+		return nil, fmt.Errorf("invalid format of tx hash for querying transaction proof")
+	}
+
+	proof, err := cbs.api.Broker().GetTransactionProof(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(proof)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Response{
+		Data: data,
+	}, nil
+}
+
+// GetReceiptProof returns the receipt of the transaction with the block header
+// and the merkle path of the receipt to the receipt root of the header
+func (cbs *ChainBrokerService) GetReceiptProof(ctx context.Context, req *pb.TransactionHashMsg) (*pb.Response, error) {
+	hash := types.NewHashByStr(req.TxHash)
+	if hash == nil {
+		return nil, fmt.Errorf("invalid format of tx hash for querying receipt proof")
+	}
+
+	proof, err := cbs.api.Broker().GetReceiptProof(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(proof)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Response{
+		Data: data,
+	}, nil
+}
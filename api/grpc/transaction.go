@@ -9,6 +9,7 @@ import (
 	"github.com/meshplus/bitxhub-kit/crypto/asym"
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 )
 
 // SendTransaction handles transaction sent by the client.
@@ -44,6 +45,19 @@ func (cbs *ChainBrokerService) SendView(_ context.Context, tx *pb.Transaction) (
 	return result, nil
 }
 
+// SendViewAt executes the view transaction against the state after the block of the given height
+func (cbs *ChainBrokerService) SendViewAt(_ context.Context, req *SendViewRequest) (*pb.Receipt, error) {
+	if req.Tx == nil {
+		return nil, fmt.Errorf("tx is nil")
+	}
+
+	if err := cbs.checkTransaction(req.Tx); err != nil {
+		return nil, err
+	}
+
+	return cbs.api.Broker().HandleViewAt(req.Tx, req.Height)
+}
+
 func (cbs *ChainBrokerService) checkTransaction(tx *pb.Transaction) error {
 	if tx.Payload == nil && tx.IBTP == nil {
 		return fmt.Errorf("tx payload and ibtp can't both be nil")
@@ -81,6 +95,10 @@ func (cbs *ChainBrokerService) checkTransaction(tx *pb.Transaction) error {
 		return fmt.Errorf("signature can't be empty")
 	}
 
+	if _, err := gas.TxGasLimit(tx); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -24,8 +24,9 @@ var clientCMD = cli.Command{
 		receiptCMD(),
 		txCMD(),
 		validatorsCMD(),
-		delVPNodeCMD(),
+		nodeCMD(),
 		governanceCMD(),
+		interchainCMD(),
 	},
 }
 
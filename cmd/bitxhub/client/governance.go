@@ -47,6 +47,18 @@ func governanceCMD() cli.Command {
 				},
 				Action: vote,
 			},
+			cli.Command{
+				Name:  "withdraw",
+				Usage: "withdraw a proposal submitted by the account",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:     "id",
+						Usage:    "proposal id",
+						Required: true,
+					},
+				},
+				Action: withdraw,
+			},
 			cli.Command{
 				Name:  "proposals",
 				Usage: "query proposals based on the condition",
@@ -58,12 +70,12 @@ func governanceCMD() cli.Command {
 					},
 					cli.StringFlag{
 						Name:     "type",
-						Usage:    "proposal type, currently only AppchainMgr is supported",
+						Usage:    "proposal type, one of AppchainMgr, RuleMgr, NodeMgr, ServiceMgr, RoleMgr or PermissionMgr",
 						Required: false,
 					},
 					cli.StringFlag{
 						Name:     "status",
-						Usage:    "proposal status, one of proposed, approve or reject",
+						Usage:    "proposal status, one of proposed, approve, reject, expired or withdrawn",
 						Required: false,
 					},
 					cli.StringFlag{
@@ -86,6 +98,42 @@ func governanceCMD() cli.Command {
 				},
 				Action: getChainStatusById,
 			},
+			cli.Command{
+				Name:  "freeze",
+				Usage: "propose to freeze an appchain",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:     "id",
+						Usage:    "chain id",
+						Required: true,
+					},
+				},
+				Action: freezeAppchain,
+			},
+			cli.Command{
+				Name:  "activate",
+				Usage: "propose to activate a frozen appchain",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:     "id",
+						Usage:    "chain id",
+						Required: true,
+					},
+				},
+				Action: activateAppchain,
+			},
+			cli.Command{
+				Name:  "relay-validators",
+				Usage: "propose to update the validators and the threshold policy of the relay chain of the account",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:     "validators",
+						Usage:    "validators in json, e.g. {\"validators\":[{\"address\":\"0x...\",\"weight\":1}],\"policy\":\"bft_2f+1\"}, policy is one of bft_f+1, bft_2f+1 or custom with the weight in threshold",
+						Required: true,
+					},
+				},
+				Action: updateRelayValidators,
+			},
 		},
 	}
 }
@@ -99,16 +147,77 @@ func vote(ctx *cli.Context) error {
 		return fmt.Errorf("the info parameter can only have a value of \"approve\" or \"reject\"")
 	}
 
-	repoRoot, err := repo.PathRootWithDefault(ctx.GlobalString("repo"))
+	receipt, err := invokeGovernance(ctx, "Vote", pb.String(id), pb.String(info), pb.String(reason))
+	if err != nil {
+		return err
+	}
+
+	if receipt.IsSuccess() {
+		color.Green("vote successfully!\n")
+	} else {
+		color.Red("vote error: %s\n", string(receipt.Ret))
+	}
+	return nil
+}
+
+func withdraw(ctx *cli.Context) error {
+	id := ctx.String("id")
+
+	receipt, err := invokeGovernance(ctx, "WithdrawProposal", pb.String(id))
+	if err != nil {
+		return err
+	}
+
+	if receipt.IsSuccess() {
+		color.Green("withdraw proposal successfully!\n")
+	} else {
+		color.Red("withdraw proposal error: %s\n", string(receipt.Ret))
+	}
+	return nil
+}
+
+func freezeAppchain(ctx *cli.Context) error {
+	return proposeAppchainStatus(ctx, "FreezeAppchain", ctx.String("id"))
+}
+
+func activateAppchain(ctx *cli.Context) error {
+	return proposeAppchainStatus(ctx, "ActivateAppchain", ctx.String("id"))
+}
+
+func updateRelayValidators(ctx *cli.Context) error {
+	return proposeAppchainStatus(ctx, "UpdateRelayValidators", ctx.String("validators"))
+}
+
+func proposeAppchainStatus(ctx *cli.Context, method, id string) error {
+	receipt, err := invokeBoltContract(ctx, constant.AppchainMgrContractAddr.String(), method, pb.String(id))
 	if err != nil {
 		return err
 	}
+
+	if receipt.IsSuccess() {
+		color.Green("proposal id is %s\n", string(receipt.Ret))
+	} else {
+		color.Red("%s error: %s\n", method, string(receipt.Ret))
+	}
+	return nil
+}
+
+// invokeGovernance sends a transaction invoking the governance contract and waits for its receipt
+func invokeGovernance(ctx *cli.Context, method string, args ...*pb.Arg) (*pb.Receipt, error) {
+	return invokeBoltContract(ctx, constant.GovernanceContractAddr.String(), method, args...)
+}
+
+// invokeBoltContract sends a transaction invoking the bolt contract and waits for its receipt
+func invokeBoltContract(ctx *cli.Context, address, method string, args ...*pb.Arg) (*pb.Receipt, error) {
+	repoRoot, err := repo.PathRootWithDefault(ctx.GlobalString("repo"))
+	if err != nil {
+		return nil, err
+	}
 	keyPath := repo.GetKeyPath(repoRoot)
 
-	resp, err := sendTx(ctx, constant.GovernanceContractAddr.String(), 0, uint64(pb.TransactionData_INVOKE), keyPath, uint64(pb.TransactionData_BVM), "Vote",
-		pb.String(id), pb.String(info), pb.String(reason))
+	resp, err := sendTx(ctx, address, 0, uint64(pb.TransactionData_INVOKE), keyPath, uint64(pb.TransactionData_BVM), method, args...)
 	if err != nil {
-		return fmt.Errorf("send transaction error: %s", err.Error())
+		return nil, fmt.Errorf("send transaction error: %s", err.Error())
 	}
 	hash := gjson.Get(string(resp), "tx_hash").String()
 
@@ -138,15 +247,10 @@ func vote(ctx *cli.Context) error {
 	m := &runtime.JSONPb{OrigName: true, EmitDefaults: true, EnumsAsInts: true}
 	receipt := &pb.Receipt{}
 	if err = m.Unmarshal(data, receipt); err != nil {
-		return fmt.Errorf("jsonpb unmarshal receipt error: %w", err)
+		return nil, fmt.Errorf("jsonpb unmarshal receipt error: %w", err)
 	}
 
-	if receipt.IsSuccess() {
-		color.Green("vote successfully!\n")
-	} else {
-		color.Red("vote error: %s\n", string(receipt.Ret))
-	}
-	return nil
+	return receipt, nil
 }
 
 func getProposals(ctx *cli.Context) error {
@@ -217,13 +321,17 @@ func checkArgs(id, typ, status, from string) error {
 		typ != string(contracts.AppchainMgr) &&
 		typ != string(contracts.RuleMgr) &&
 		typ != string(contracts.NodeMgr) &&
-		typ != string(contracts.ServiceMgr) {
+		typ != string(contracts.ServiceMgr) &&
+		typ != string(contracts.RoleMgr) &&
+		typ != string(contracts.PermissionMgr) {
 		return fmt.Errorf("illegal proposal type")
 	}
 	if status != "" &&
 		status != string(contracts.PROPOSED) &&
 		status != string(contracts.APPOVED) &&
-		status != string(contracts.REJECTED) {
+		status != string(contracts.REJECTED) &&
+		status != string(contracts.EXPIRED) &&
+		status != string(contracts.WITHDRAWN) {
 		return fmt.Errorf("illegal proposal status")
 	}
 	return nil
@@ -307,7 +415,7 @@ func getProposalsByConditions(ctx *cli.Context, keyPath string, menthod string,
 
 func printProposal(proposals []contracts.Proposal) {
 	var table [][]string
-	table = append(table, []string{"Id", "Type", "Status", "ApproveNum", "RejectNum", "ElectorateNum", "ThresholdNum", "Des"})
+	table = append(table, []string{"Id", "Type", "Status", "ApproveNum", "RejectNum", "ElectorateNum", "ThresholdNum", "ExpireHeight", "Des"})
 
 	for _, pro := range proposals {
 		table = append(table, []string{
@@ -318,6 +426,7 @@ func printProposal(proposals []contracts.Proposal) {
 			strconv.Itoa(int(pro.AgainstNum)),
 			strconv.Itoa(int(pro.ElectorateNum)),
 			strconv.Itoa(int(pro.ThresholdNum)),
+			strconv.FormatUint(pro.ExpireHeight, 10),
 			pro.Des,
 		})
 	}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/meshplus/bitxhub-model/constant"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/executor/contracts"
+	"github.com/meshplus/bitxhub/internal/repo"
+	"github.com/urfave/cli"
+)
+
+func interchainCMD() cli.Command {
+	return cli.Command{
+		Name:  "interchain",
+		Usage: "Interchain transaction manipulation",
+		Subcommands: cli.Commands{
+			cli.Command{
+				Name:  "list",
+				Usage: "List interchain transactions by source chain, destination chain and status",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "from",
+						Usage: "Source appchain id",
+					},
+					cli.StringFlag{
+						Name:  "to",
+						Usage: "Destination appchain id",
+					},
+					cli.StringFlag{
+						Name:  "status",
+						Usage: "Transaction status, one of begin, success or failure",
+					},
+					cli.Uint64Flag{
+						Name:  "offset",
+						Usage: "Number of transactions to skip",
+					},
+					cli.Uint64Flag{
+						Name:  "limit",
+						Usage: "Max number of transactions to list",
+						Value: contracts.DefaultTxListLimit,
+					},
+				},
+				Action: listInterchainTxs,
+			},
+		},
+	}
+}
+
+func listInterchainTxs(ctx *cli.Context) error {
+	status := ctx.String("status")
+	if status != "" {
+		if _, err := contracts.ParseTransactionStatus(status); err != nil {
+			return err
+		}
+	}
+
+	repoRoot, err := repo.PathRootWithDefault(ctx.GlobalString("repo"))
+	if err != nil {
+		return err
+	}
+	keyPath := repo.GetKeyPath(repoRoot)
+
+	data, err := sendView(ctx, constant.TransactionMgrContractAddr.String(), keyPath, "ListTransactions",
+		pb.String(ctx.String("from")),
+		pb.String(ctx.String("to")),
+		pb.String(status),
+		pb.Uint64(ctx.Uint64("offset")),
+		pb.Uint64(ctx.Uint64("limit")),
+	)
+	if err != nil {
+		return fmt.Errorf("send view error: %w", err)
+	}
+
+	m := &runtime.JSONPb{OrigName: true, EmitDefaults: true, EnumsAsInts: true}
+	receipt := &pb.Receipt{}
+	if err := m.Unmarshal(data, receipt); err != nil {
+		return fmt.Errorf("jsonpb unmarshal receipt error: %w", err)
+	}
+	if !receipt.IsSuccess() {
+		return fmt.Errorf("list interchain transactions error: %s", receipt.Ret)
+	}
+
+	page := &contracts.InterchainTxPage{}
+	if err := json.Unmarshal(receipt.Ret, page); err != nil {
+		return fmt.Errorf("unmarshal interchain transactions error: %w", err)
+	}
+
+	printInterchainTxs(page)
+
+	return nil
+}
+
+func printInterchainTxs(page *contracts.InterchainTxPage) {
+	var table [][]string
+	table = append(table, []string{"Id", "From", "To", "Status", "RolledBack", "BeginHeight", "TimeoutHeight", "GlobalId"})
+
+	for _, tx := range page.Txs {
+		table = append(table, []string{
+			tx.Id,
+			tx.From,
+			tx.To,
+			contracts.TransactionStatusName(tx.Status),
+			strconv.FormatBool(tx.RolledBack),
+			strconv.FormatUint(tx.BeginHeight, 10),
+			strconv.FormatUint(tx.TimeoutHeight, 10),
+			tx.GlobalId,
+		})
+	}
+
+	PrintTable(table, true)
+	fmt.Printf("total: %d\n", page.Total)
+}
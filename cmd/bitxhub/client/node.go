@@ -1,10 +1,11 @@
 package client
 
 import (
-	"encoding/json"
 	"fmt"
 
+	"github.com/fatih/color"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/executor/contracts"
 	"github.com/urfave/cli"
 )
 
@@ -42,38 +43,90 @@ func getValidators(ctx *cli.Context) error {
 	return nil
 }
 
-func delVPNodeCMD() cli.Command {
+func nodeCMD() cli.Command {
 	return cli.Command{
-		Name:  "delVPNode",
-		Usage: "delete a vp node",
-		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:  "pid",
-				Usage: "pid of vp node",
+		Name:  "node",
+		Usage: "propose the changes of the vp nodes",
+		Subcommands: cli.Commands{
+			cli.Command{
+				Name:  "add",
+				Usage: "propose to add a vp node",
+				Flags: []cli.Flag{
+					cli.Uint64Flag{
+						Name:     "id",
+						Usage:    "id of vp node",
+						Required: true,
+					},
+					cli.StringFlag{
+						Name:     "pid",
+						Usage:    "pid of vp node",
+						Required: true,
+					},
+					cli.StringFlag{
+						Name:     "account",
+						Usage:    "account of vp node",
+						Required: true,
+					},
+					cli.StringFlag{
+						Name:     "hosts",
+						Usage:    "comma separated multiaddrs of vp node",
+						Required: true,
+					},
+				},
+				Action: addNode,
+			},
+			cli.Command{
+				Name:  "remove",
+				Usage: "propose to remove a vp node",
+				Flags: []cli.Flag{
+					cli.Uint64Flag{
+						Name:  "id",
+						Usage: "id of vp node, required if the node is not added by proposal",
+					},
+					cli.StringFlag{
+						Name:     "pid",
+						Usage:    "pid of vp node",
+						Required: true,
+					},
+				},
+				Action: removeNode,
 			},
 		},
-		Action: delVPNode,
 	}
 }
 
-func delVPNode(ctx *cli.Context) error {
-	pid := ctx.String("pid")
-	if pid == "" {
-		return fmt.Errorf("please input pid")
-	}
-
-	url, err := getURL(ctx, "delvpnode")
+func addNode(ctx *cli.Context) error {
+	receipt, err := invokeBoltContract(ctx, contracts.NodeManagerContractAddr.String(), "AddNode",
+		pb.Uint64(ctx.Uint64("id")),
+		pb.String(ctx.String("pid")),
+		pb.String(ctx.String("account")),
+		pb.String(ctx.String("hosts")),
+	)
 	if err != nil {
 		return err
 	}
 
-	p := pb.DelVPNodeRequest{Pid: pid}
-	reqData, err := json.Marshal(p)
-	data, err := httpPost(ctx, url, reqData)
+	if receipt.IsSuccess() {
+		color.Green("proposal id is %s\n", string(receipt.Ret))
+	} else {
+		color.Red("propose to add node error: %s\n", string(receipt.Ret))
+	}
+	return nil
+}
+
+func removeNode(ctx *cli.Context) error {
+	receipt, err := invokeBoltContract(ctx, contracts.NodeManagerContractAddr.String(), "RemoveNode",
+		pb.Uint64(ctx.Uint64("id")),
+		pb.String(ctx.String("pid")),
+	)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(string(data))
+	if receipt.IsSuccess() {
+		color.Green("proposal id is %s\n", string(receipt.Ret))
+	} else {
+		color.Red("propose to remove node error: %s\n", string(receipt.Ret))
+	}
 	return nil
 }
@@ -97,7 +97,16 @@ func sendTransaction(ctx *cli.Context) error {
 }
 
 func sendTx(ctx *cli.Context, toString string, amount uint64, txType uint64, keyPath string, vmType uint64, method string, args ...*pb.Arg) ([]byte, error) {
+	return postTx(ctx, "transaction", toString, amount, txType, keyPath, vmType, method, args...)
+}
+
+// sendView executes the bolt contract method without committing it and
+// returns the receipt responded by the gateway
+func sendView(ctx *cli.Context, toString string, keyPath string, method string, args ...*pb.Arg) ([]byte, error) {
+	return postTx(ctx, "view", toString, 0, uint64(pb.TransactionData_INVOKE), keyPath, uint64(pb.TransactionData_BVM), method, args...)
+}
 
+func postTx(ctx *cli.Context, path string, toString string, amount uint64, txType uint64, keyPath string, vmType uint64, method string, args ...*pb.Arg) ([]byte, error) {
 	key, err := repo.LoadKey(keyPath)
 	if err != nil {
 		return nil, fmt.Errorf("wrong key: %w", err)
@@ -167,7 +176,7 @@ func sendTx(ctx *cli.Context, toString string, amount uint64, txType uint64, key
 		return nil, err
 	}
 
-	url, err := getURL(ctx, "transaction")
+	url, err := getURL(ctx, path)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+
+	"github.com/meshplus/bitxhub-kit/log"
+	"github.com/meshplus/bitxhub-kit/storage"
+	"github.com/meshplus/bitxhub-kit/storage/blockfile"
+	"github.com/meshplus/bitxhub-kit/storage/leveldb"
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/ledger"
+	"github.com/meshplus/bitxhub/internal/repo"
+	"github.com/meshplus/bitxhub/internal/storages"
+	"github.com/meshplus/bitxhub/pkg/proof"
+	"github.com/urfave/cli"
+)
+
+func ledgerCMD() cli.Command {
+	return cli.Command{
+		Name:  "ledger",
+		Usage: "Ledger maintenance of a stopped node",
+		Subcommands: []cli.Command{
+			{
+				Name:  "export",
+				Usage: "Export the ledger state at a block height as a snapshot",
+				Flags: []cli.Flag{
+					cli.Uint64Flag{
+						Name:  "height",
+						Usage: "Block height of the snapshot, the latest block by default",
+					},
+					cli.StringFlag{
+						Name:     "file",
+						Usage:    "Snapshot file path",
+						Required: true,
+					},
+				},
+				Action: exportLedger,
+			},
+			{
+				Name:  "import",
+				Usage: "Import a ledger snapshot into a new repo",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:     "file",
+						Usage:    "Snapshot file path",
+						Required: true,
+					},
+					cli.StringFlag{
+						Name:     "block-hash",
+						Usage:    "Trusted hash of the snapshot block, got from the chain out of band",
+						Required: true,
+					},
+				},
+				Action: importLedger,
+			},
+			{
+				Name:  "rollback",
+				Usage: "Rollback the ledger state and blocks to a block height",
+				Flags: []cli.Flag{
+					cli.Uint64Flag{
+						Name:     "height",
+						Usage:    "Block height to rollback to",
+						Required: true,
+					},
+				},
+				Action: rollbackLedger,
+			},
+			{
+				Name:   "verify",
+				Usage:  "Verify the block links, merkle roots and state journals of the ledger",
+				Action: verifyLedger,
+			},
+			{
+				Name:  "inspect",
+				Usage: "Inspect the data in the ledger",
+				Subcommands: []cli.Command{
+					{
+						Name:  "block",
+						Usage: "Show a block by height or hash",
+						Flags: []cli.Flag{
+							cli.Uint64Flag{
+								Name:  "height",
+								Usage: "Block height",
+							},
+							cli.StringFlag{
+								Name:  "hash",
+								Usage: "Block hash",
+							},
+						},
+						Action: inspectBlock,
+					},
+					{
+						Name:  "receipt",
+						Usage: "Show the receipt of a transaction",
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:     "hash",
+								Usage:    "Transaction hash",
+								Required: true,
+							},
+						},
+						Action: inspectReceipt,
+					},
+					{
+						Name:  "account",
+						Usage: "Show the balance, nonce and code hash of an account",
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:     "address",
+								Usage:    "Account address",
+								Required: true,
+							},
+						},
+						Action: inspectAccount,
+					},
+					{
+						Name:  "state",
+						Usage: "Show the value of a state key of an account",
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:     "address",
+								Usage:    "Account address",
+								Required: true,
+							},
+							cli.StringFlag{
+								Name:     "key",
+								Usage:    "State key",
+								Required: true,
+							},
+						},
+						Action: inspectState,
+					},
+				},
+			},
+		},
+	}
+}
+
+// ledgerStorages are the storages of the ledger in the repo, they can not
+// be opened while the node is running
+type ledgerStorages struct {
+	repo            *repo.Repo
+	blockchainStore storage.Storage
+	ldb             storage.Storage
+	bf              *blockfile.BlockFile
+}
+
+func openLedgerStorages(ctx *cli.Context) (*ledgerStorages, error) {
+	repoRoot, err := repo.PathRootWithDefault(ctx.GlobalString("repo"))
+	if err != nil {
+		return nil, fmt.Errorf("get repo path: %w", err)
+	}
+
+	rep, err := repo.Load(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("repo load: %w", err)
+	}
+
+	if err := storages.Initialize(repoRoot); err != nil {
+		return nil, fmt.Errorf("storages initialize: %w", err)
+	}
+
+	bcStorage, err := storages.Get(storages.BlockChain)
+	if err != nil {
+		return nil, fmt.Errorf("create blockchain storage: %w", err)
+	}
+
+	ldb, err := leveldb.New(repo.GetStoragePath(repoRoot, "ledger"))
+	if err != nil {
+		return nil, fmt.Errorf("create tm-leveldb: %w", err)
+	}
+
+	bf, err := blockfile.NewBlockFile(repoRoot, log.NewWithModule("blockfile"))
+	if err != nil {
+		return nil, fmt.Errorf("blockfile initialize: %w", err)
+	}
+
+	return &ledgerStorages{
+		repo:            rep,
+		blockchainStore: bcStorage,
+		ldb:             ldb,
+		bf:              bf,
+	}, nil
+}
+
+func (s *ledgerStorages) newLedger() (*ledger.ChainLedger, error) {
+	return ledger.New(s.repo, s.blockchainStore, s.ldb, s.bf, nil, log.NewWithModule("ledger"))
+}
+
+func (s *ledgerStorages) close() {
+	_ = s.blockchainStore.Close()
+	_ = s.ldb.Close()
+	_ = s.bf.Close()
+}
+
+func exportLedger(ctx *cli.Context) error {
+	s, err := openLedgerStorages(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	ldg, err := s.newLedger()
+	if err != nil {
+		return fmt.Errorf("create ledger: %w", err)
+	}
+
+	file, err := os.Create(ctx.String("file"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if err := ldg.ExportSnapshot(ctx.Uint64("height"), w); err != nil {
+		return fmt.Errorf("export snapshot: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("ledger snapshot is exported to %s\n", ctx.String("file"))
+
+	return nil
+}
+
+func importLedger(ctx *cli.Context) error {
+	trustedHash := types.NewHashByStr(ctx.String("block-hash"))
+	if trustedHash == nil {
+		return fmt.Errorf("invalid block hash: %s", ctx.String("block-hash"))
+	}
+
+	s, err := openLedgerStorages(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	file, err := os.Open(ctx.String("file"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	meta, err := ledger.ImportSnapshot(bufio.NewReader(file), trustedHash, s.blockchainStore, s.ldb, s.bf)
+	if err != nil {
+		return fmt.Errorf("import snapshot: %w", err)
+	}
+
+	fmt.Printf("ledger snapshot is imported at height %d, block hash %s\n", meta.Height, meta.BlockHash)
+
+	return nil
+}
+
+func rollbackLedger(ctx *cli.Context) error {
+	s, err := openLedgerStorages(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	ldg, err := s.newLedger()
+	if err != nil {
+		return fmt.Errorf("create ledger: %w", err)
+	}
+
+	height := ctx.Uint64("height")
+	current := ldg.GetChainMeta().Height
+	if height >= current {
+		return fmt.Errorf("rollback height %d should be less than the current height %d", height, current)
+	}
+
+	fmt.Printf("rollback would remove blocks %d to %d, Y/N?\n", height+1, current)
+	input := bufio.NewScanner(os.Stdin)
+	input.Scan()
+	if input.Text() != "Y" && input.Text() != "y" {
+		return nil
+	}
+
+	if err := ldg.Rollback(height); err != nil {
+		return fmt.Errorf("rollback ledger: %w", err)
+	}
+
+	fmt.Printf("ledger is rolled back to height %d\n", height)
+
+	return nil
+}
+
+func verifyLedger(ctx *cli.Context) error {
+	s, err := openLedgerStorages(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	ldg, err := s.newLedger()
+	if err != nil {
+		return fmt.Errorf("create ledger: %w", err)
+	}
+
+	meta := ldg.GetChainMeta()
+
+	// blocks before an imported snapshot are not available
+	start := uint64(1)
+	for ; start <= meta.Height; start++ {
+		if _, err := ldg.GetBlock(start); err == nil {
+			break
+		}
+	}
+	if start > 1 {
+		fmt.Printf("blocks before %d are not available\n", start)
+	}
+
+	var parentHash *types.Hash
+	for i := start; i <= meta.Height; i++ {
+		block, err := ldg.GetBlock(i)
+		if err != nil {
+			return fmt.Errorf("get block %d: %w", i, err)
+		}
+
+		if block.BlockHeader.Number != i {
+			return fmt.Errorf("block %d has number %d", i, block.BlockHeader.Number)
+		}
+		if hashString(block.Hash()) != hashString(block.BlockHash) {
+			return fmt.Errorf("block %d hash mismatch: %s, expected %s", i, block.BlockHash, block.Hash())
+		}
+		if parentHash != nil && hashString(block.BlockHeader.ParentHash) != hashString(parentHash) {
+			return fmt.Errorf("block %d parent hash mismatch: %s, expected %s", i, block.BlockHeader.ParentHash, parentHash)
+		}
+		parentHash = block.BlockHash
+
+		// the genesis block has no transactions and the snapshot block keeps
+		// the header only
+		if i == 1 || i == start && start > 1 {
+			continue
+		}
+
+		if err := verifyBlockRoots(ldg, block); err != nil {
+			return fmt.Errorf("block %d: %w", i, err)
+		}
+	}
+	if meta.Height != 0 && hashString(parentHash) != hashString(meta.BlockHash) {
+		return fmt.Errorf("chain meta block hash %s does not match the latest block %s", meta.BlockHash, parentHash)
+	}
+
+	if err := ldg.VerifyJournals(); err != nil {
+		return fmt.Errorf("verify journals: %w", err)
+	}
+
+	fmt.Printf("ledger is verified at height %d\n", meta.Height)
+
+	return nil
+}
+
+func verifyBlockRoots(ldg *ledger.ChainLedger, block *pb.Block) error {
+	interchainMeta, err := ldg.GetInterchainMeta(block.BlockHeader.Number)
+	if err != nil {
+		return fmt.Errorf("get interchain meta: %w", err)
+	}
+
+	txRoot, err := proof.TxRoot(block, interchainMeta)
+	if err != nil {
+		return fmt.Errorf("calculate tx root: %w", err)
+	}
+	if hashString(txRoot) != hashString(block.BlockHeader.TxRoot) {
+		return fmt.Errorf("tx root mismatch: %s, expected %s", block.BlockHeader.TxRoot, txRoot)
+	}
+
+	receipts := make([]*pb.Receipt, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		receipt, err := ldg.GetReceipt(tx.TransactionHash)
+		if err != nil {
+			return fmt.Errorf("get receipt of %s: %w", tx.TransactionHash, err)
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	receiptRoot, err := proof.ReceiptRoot(receipts)
+	if err != nil {
+		return fmt.Errorf("calculate receipt root: %w", err)
+	}
+	if hashString(receiptRoot) != hashString(block.BlockHeader.ReceiptRoot) {
+		return fmt.Errorf("receipt root mismatch: %s, expected %s", block.BlockHeader.ReceiptRoot, receiptRoot)
+	}
+
+	return nil
+}
+
+func hashString(hash *types.Hash) string {
+	if hash == nil {
+		return (&types.Hash{}).String()
+	}
+
+	return hash.String()
+}
+
+func inspectBlock(ctx *cli.Context) error {
+	s, err := openLedgerStorages(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	ldg, err := s.newLedger()
+	if err != nil {
+		return fmt.Errorf("create ledger: %w", err)
+	}
+
+	var block *pb.Block
+	if ctx.IsSet("hash") {
+		hash := types.NewHashByStr(ctx.String("hash"))
+		if hash == nil {
+			return fmt.Errorf("invalid block hash: %s", ctx.String("hash"))
+		}
+		block, err = ldg.GetBlockByHash(hash)
+	} else {
+		height := ctx.Uint64("height")
+		if height == 0 {
+			height = ldg.GetChainMeta().Height
+		}
+		block, err = ldg.GetBlock(height)
+	}
+	if err != nil {
+		return fmt.Errorf("get block: %w", err)
+	}
+
+	return printPB(block)
+}
+
+func inspectReceipt(ctx *cli.Context) error {
+	s, err := openLedgerStorages(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	ldg, err := s.newLedger()
+	if err != nil {
+		return fmt.Errorf("create ledger: %w", err)
+	}
+
+	hash := types.NewHashByStr(ctx.String("hash"))
+	if hash == nil {
+		return fmt.Errorf("invalid transaction hash: %s", ctx.String("hash"))
+	}
+
+	receipt, err := ldg.GetReceipt(hash)
+	if err != nil {
+		return fmt.Errorf("get receipt: %w", err)
+	}
+
+	return printPB(receipt)
+}
+
+func inspectAccount(ctx *cli.Context) error {
+	s, err := openLedgerStorages(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	ldg, err := s.newLedger()
+	if err != nil {
+		return fmt.Errorf("create ledger: %w", err)
+	}
+
+	addr := types.NewAddressByStr(ctx.String("address"))
+	if addr == nil {
+		return fmt.Errorf("invalid address: %s", ctx.String("address"))
+	}
+
+	account := ldg.GetAccount(addr)
+	data, err := json.MarshalIndent(struct {
+		Address  string `json:"address"`
+		Balance  uint64 `json:"balance"`
+		Nonce    uint64 `json:"nonce"`
+		CodeHash string `json:"code_hash"`
+	}{
+		Address:  addr.String(),
+		Balance:  account.GetBalance(),
+		Nonce:    account.GetNonce(),
+		CodeHash: hex.EncodeToString(account.CodeHash()),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(data))
+
+	return nil
+}
+
+func inspectState(ctx *cli.Context) error {
+	s, err := openLedgerStorages(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	ldg, err := s.newLedger()
+	if err != nil {
+		return fmt.Errorf("create ledger: %w", err)
+	}
+
+	addr := types.NewAddressByStr(ctx.String("address"))
+	if addr == nil {
+		return fmt.Errorf("invalid address: %s", ctx.String("address"))
+	}
+
+	ok, val := ldg.GetState(addr, []byte(ctx.String("key")))
+	if !ok {
+		return fmt.Errorf("state key %s of %s not found", ctx.String("key"), addr)
+	}
+
+	fmt.Println(string(val))
+
+	return nil
+}
+
+func printPB(msg proto.Message) error {
+	m := &runtime.JSONPb{OrigName: true, EmitDefaults: true, EnumsAsInts: true, Indent: "  "}
+	data, err := m.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(data))
+
+	return nil
+}
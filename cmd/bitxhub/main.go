@@ -33,6 +33,8 @@ func main() {
 		startCMD(),
 		keyCMD(),
 		versionCMD(),
+		ledgerCMD(),
+		replayCMD(),
 		certCMD,
 		client.LoadClientCMD(),
 	}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/meshplus/bitxhub-kit/log"
+	"github.com/meshplus/bitxhub-kit/storage/blockfile"
+	"github.com/meshplus/bitxhub-kit/storage/leveldb"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/executor"
+	"github.com/meshplus/bitxhub/internal/ledger"
+	"github.com/urfave/cli"
+)
+
+func replayCMD() cli.Command {
+	return cli.Command{
+		Name:  "replay",
+		Usage: "Replay committed blocks of a stopped node and compare the results",
+		Flags: []cli.Flag{
+			cli.Uint64Flag{
+				Name:     "from",
+				Usage:    "First block height to replay",
+				Required: true,
+			},
+			cli.Uint64Flag{
+				Name:  "to",
+				Usage: "Last block height to replay, the latest block by default",
+			},
+		},
+		Action: replay,
+	}
+}
+
+func replay(ctx *cli.Context) error {
+	s, err := openLedgerStorages(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	ldg, err := s.newLedger()
+	if err != nil {
+		return fmt.Errorf("create ledger: %w", err)
+	}
+
+	from := ctx.Uint64("from")
+	to := ctx.Uint64("to")
+	height := ldg.GetChainMeta().Height
+	if to == 0 {
+		to = height
+	}
+	if from < 2 {
+		return fmt.Errorf("replay starts from block 2, block 1 is the genesis block")
+	}
+	if from > to || to > height {
+		return fmt.Errorf("invalid replay range [%d, %d], current height is %d", from, to, height)
+	}
+
+	return replayBlocks(ldg, s, from, to)
+}
+
+// replayBlocks executes the blocks in [from, to] over a copy of the state
+// after block from-1 and stops at the first block whose results diverge
+func replayBlocks(ldg *ledger.ChainLedger, s *ledgerStorages, from, to uint64) error {
+	dir, err := ioutil.TempDir("", "bitxhub-replay")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	replayLdg, closeReplay, err := copyLedger(ldg, s, from-1, dir)
+	if err != nil {
+		return err
+	}
+	defer closeReplay()
+
+	exec, err := executor.New(replayLdg, log.NewWithModule("executor"), s.repo.Config.Executor.Type)
+	if err != nil {
+		return fmt.Errorf("create executor: %w", err)
+	}
+
+	for i := from; i <= to; i++ {
+		expected, err := ldg.GetBlock(i)
+		if err != nil {
+			return fmt.Errorf("get block %d: %w", i, err)
+		}
+		// Replay rewrites the header and the transactions of the block
+		block, err := cloneBlock(expected)
+		if err != nil {
+			return fmt.Errorf("clone block %d: %w", i, err)
+		}
+		expectedMeta, err := ldg.GetInterchainMeta(i)
+		if err != nil {
+			return fmt.Errorf("get interchain meta of block %d: %w", i, err)
+		}
+
+		blockData := exec.Replay(block)
+
+		mismatches := compareReplay(expected, expectedMeta, blockData)
+		if len(mismatches) == 0 {
+			continue
+		}
+
+		fmt.Printf("block %d diverges:\n", i)
+		for _, mismatch := range mismatches {
+			fmt.Printf("  %s\n", mismatch)
+		}
+
+		expectedState, err := ldg.StateAt(i)
+		if err != nil {
+			return fmt.Errorf("get state of block %d: %w", i, err)
+		}
+		journal := ldg.GetBlockJournal(i)
+		if journal == nil {
+			fmt.Printf("journal of block %d is removed, only the replayed changes are compared\n", i)
+		}
+
+		diffs, err := ledger.DiffStates(expectedState, replayLdg, blockData.Journal, journal)
+		if err == nil {
+			err = expectedState.StateErr()
+		}
+		if err != nil {
+			return fmt.Errorf("diff states of block %d: %w", i, err)
+		}
+		for _, diff := range diffs {
+			if diff.Key == "" {
+				fmt.Printf("  account %s: %s, replayed %s\n", diff.Address, diff.Expected, diff.Actual)
+			} else {
+				fmt.Printf("  state %s %q: %q, replayed %q\n", diff.Address, diff.Key, diff.Expected, diff.Actual)
+			}
+		}
+
+		return fmt.Errorf("replay diverges at block %d", i)
+	}
+
+	fmt.Printf("blocks %d to %d are replayed without divergence\n", from, to)
+
+	return nil
+}
+
+// copyLedger copies the state after the block of the given height to new
+// storages in dir through a ledger snapshot
+func copyLedger(ldg *ledger.ChainLedger, s *ledgerStorages, height uint64, dir string) (*ledger.ChainLedger, func(), error) {
+	block, err := ldg.GetBlock(height)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get block %d: %w", height, err)
+	}
+
+	blockchainStore, err := leveldb.New(filepath.Join(dir, "storage"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("create blockchain storage: %w", err)
+	}
+	ldb, err := leveldb.New(filepath.Join(dir, "ledger"))
+	if err != nil {
+		_ = blockchainStore.Close()
+		return nil, nil, fmt.Errorf("create tm-leveldb: %w", err)
+	}
+	bf, err := blockfile.NewBlockFile(dir, log.NewWithModule("blockfile"))
+	if err != nil {
+		_ = blockchainStore.Close()
+		_ = ldb.Close()
+		return nil, nil, fmt.Errorf("blockfile initialize: %w", err)
+	}
+	closeAll := func() {
+		_ = blockchainStore.Close()
+		_ = ldb.Close()
+		_ = bf.Close()
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		bw := bufio.NewWriter(w)
+		err := ldg.ExportSnapshot(height, bw)
+		if err == nil {
+			err = bw.Flush()
+		}
+		w.CloseWithError(err)
+	}()
+
+	_, err = ledger.ImportSnapshot(bufio.NewReader(r), block.BlockHash, blockchainStore, ldb, bf)
+	_ = r.Close()
+	if err != nil {
+		closeAll()
+		return nil, nil, fmt.Errorf("copy state of block %d: %w", height, err)
+	}
+
+	replayLdg, err := ledger.New(s.repo, blockchainStore, ldb, bf, nil, log.NewWithModule("ledger"))
+	if err != nil {
+		closeAll()
+		return nil, nil, fmt.Errorf("create replay ledger: %w", err)
+	}
+
+	return replayLdg, closeAll, nil
+}
+
+func cloneBlock(block *pb.Block) (*pb.Block, error) {
+	data, err := block.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	clone := &pb.Block{}
+	if err := clone.Unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	return clone, nil
+}
+
+func compareReplay(expected *pb.Block, expectedMeta *pb.InterchainMeta, blockData *ledger.BlockData) []string {
+	var mismatches []string
+
+	header := blockData.Block.BlockHeader
+	if hashString(header.StateRoot) != hashString(expected.BlockHeader.StateRoot) {
+		mismatches = append(mismatches, fmt.Sprintf("state root %s, replayed %s", expected.BlockHeader.StateRoot, header.StateRoot))
+	}
+	if hashString(header.ReceiptRoot) != hashString(expected.BlockHeader.ReceiptRoot) {
+		mismatches = append(mismatches, fmt.Sprintf("receipt root %s, replayed %s", expected.BlockHeader.ReceiptRoot, header.ReceiptRoot))
+	}
+
+	meta := blockData.InterchainMeta
+	dests := make(map[string]bool)
+	for dest := range expectedMeta.Counter {
+		dests[dest] = true
+	}
+	for dest := range meta.Counter {
+		dests[dest] = true
+	}
+	sortedDests := make([]string, 0, len(dests))
+	for dest := range dests {
+		sortedDests = append(sortedDests, dest)
+	}
+	sort.Strings(sortedDests)
+	for _, dest := range sortedDests {
+		var expectedIndexes, indexes []uint64
+		if slice := expectedMeta.Counter[dest]; slice != nil {
+			expectedIndexes = slice.Slice
+		}
+		if slice := meta.Counter[dest]; slice != nil {
+			indexes = slice.Slice
+		}
+		if fmt.Sprint(expectedIndexes) != fmt.Sprint(indexes) {
+			mismatches = append(mismatches, fmt.Sprintf("interchain txs to %s %v, replayed %v", dest, expectedIndexes, indexes))
+		}
+	}
+
+	expectedRoots := make([]string, 0, len(expectedMeta.L2Roots))
+	for _, root := range expectedMeta.L2Roots {
+		expectedRoots = append(expectedRoots, root.String())
+	}
+	roots := make([]string, 0, len(meta.L2Roots))
+	for _, root := range meta.L2Roots {
+		roots = append(roots, root.String())
+	}
+	if fmt.Sprint(expectedRoots) != fmt.Sprint(roots) {
+		mismatches = append(mismatches, fmt.Sprintf("interchain l2 roots %v, replayed %v", expectedRoots, roots))
+	}
+
+	return mismatches
+}
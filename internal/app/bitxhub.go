@@ -31,6 +31,7 @@ type BitXHub struct {
 	Router        router.Router
 	Order         order.Order
 	PeerMgr       peermgr.PeerManager
+	Pruner        *ledger.Pruner
 
 	repo   *repo.Repo
 	logger logrus.FieldLogger
@@ -126,6 +127,11 @@ func GenerateBitXHubWithoutOrder(rep *repo.Repo) (*BitXHub, error) {
 		return nil, fmt.Errorf("create readonly ledger: %w", err)
 	}
 
+	pruner, err := ledger.NewPruner(rwLdg, rep.Config.Ledger, loggers.Logger(loggers.Executor))
+	if err != nil {
+		return nil, fmt.Errorf("create ledger pruner: %w", err)
+	}
+
 	// 1. create executor and view executor
 	txExec, err := executor.New(rwLdg, loggers.Logger(loggers.Executor), rep.Config.Executor.Type)
 	if err != nil {
@@ -149,6 +155,7 @@ func GenerateBitXHubWithoutOrder(rep *repo.Repo) (*BitXHub, error) {
 		BlockExecutor: txExec,
 		ViewExecutor:  viewExec,
 		PeerMgr:       peerMgr,
+		Pruner:        pruner,
 	}, nil
 }
 
@@ -180,6 +187,10 @@ func (bxh *BitXHub) Start() error {
 		return fmt.Errorf("router start: %w", err)
 	}
 
+	if err := bxh.Pruner.Start(); err != nil {
+		return fmt.Errorf("ledger pruner start: %w", err)
+	}
+
 	bxh.start()
 
 	bxh.printLogo()
@@ -200,6 +211,10 @@ func (bxh *BitXHub) Stop() error {
 		return fmt.Errorf("InterchainRouter stop: %w", err)
 	}
 
+	if err := bxh.Pruner.Stop(); err != nil {
+		return fmt.Errorf("ledger pruner stop: %w", err)
+	}
+
 	if !bxh.repo.Config.Solo {
 		if err := bxh.PeerMgr.Stop(); err != nil {
 			return fmt.Errorf("network stop: %w", err)
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"github.com/meshplus/bitxhub/internal/executor/contracts"
 	"github.com/meshplus/bitxhub/internal/model/events"
 	"github.com/sirupsen/logrus"
 )
@@ -26,11 +27,14 @@ func (bxh *BitXHub) start() {
 
 func (bxh *BitXHub) listenEvent() {
 	blockCh := make(chan events.ExecutedEvent)
+	nodeCh := make(chan events.NodeEvent)
 	orderMsgCh := make(chan events.OrderMessageEvent)
 	blockSub := bxh.BlockExecutor.SubscribeBlockEvent(blockCh)
+	nodeSub := bxh.BlockExecutor.SubscribeNodeEvent(nodeCh)
 	orderMsgSub := bxh.PeerMgr.SubscribeOrderMessage(orderMsgCh)
 
 	defer blockSub.Unsubscribe()
+	defer nodeSub.Unsubscribe()
 	defer orderMsgSub.Unsubscribe()
 
 	for {
@@ -38,6 +42,8 @@ func (bxh *BitXHub) listenEvent() {
 		case ev := <-blockCh:
 			go bxh.Order.ReportState(ev.Block.BlockHeader.Number, ev.Block.BlockHash, ev.TxHashList)
 			go bxh.Router.PutBlockAndMeta(ev.Block, ev.InterchainMeta)
+		case ev := <-nodeCh:
+			bxh.applyNodeEvent(ev)
 		case ev := <-orderMsgCh:
 			go func() {
 				if err := bxh.Order.Step(ev.Data); err != nil {
@@ -49,3 +55,22 @@ func (bxh *BitXHub) listenEvent() {
 		}
 	}
 }
+
+// applyNodeEvent applies the node change approved by the governance to the
+// routing table and the consensus membership
+func (bxh *BitXHub) applyNodeEvent(ev events.NodeEvent) {
+	switch ev.Operation {
+	case contracts.NodeAdd:
+		// the new node must be routable before the consensus talks to it
+		bxh.PeerMgr.AddNode(ev.VpInfo.Id, ev.VpInfo)
+		if err := bxh.Order.AddNode(ev.VpInfo.Id); err != nil {
+			bxh.logger.Errorf("Add node %d to order failed: %s", ev.VpInfo.Id, err)
+		}
+	case contracts.NodeRemove:
+		if err := bxh.Order.DelNode(ev.VpInfo.Id); err != nil {
+			bxh.logger.Errorf("Delete node %d from order failed: %s", ev.VpInfo.Id, err)
+			return
+		}
+		bxh.PeerMgr.DelNode(ev.VpInfo.Id)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub/internal/coreapi/api"
 	"github.com/meshplus/bitxhub/internal/ledger"
+	"github.com/meshplus/bitxhub/pkg/trie"
 )
 
 type AccountAPI CoreAPI
@@ -13,3 +14,37 @@ var _ api.AccountAPI = (*AccountAPI)(nil)
 func (api *AccountAPI) GetAccount(addr *types.Address) *ledger.Account {
 	return api.bxh.Ledger.GetAccount(addr)
 }
+
+// GetAccountAt returns the account as of the block of the given height
+func (api *AccountAPI) GetAccountAt(addr *types.Address, height uint64) (*ledger.Account, error) {
+	ldg, err := api.bxh.Ledger.StateAt(height)
+	if err != nil {
+		return nil, err
+	}
+
+	account := ldg.GetAccount(addr)
+	if err := ldg.StateErr(); err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// GetStateAt returns the state value of the account as of the block of the given height
+func (api *AccountAPI) GetStateAt(addr *types.Address, key []byte, height uint64) (bool, []byte, error) {
+	ldg, err := api.bxh.Ledger.StateAt(height)
+	if err != nil {
+		return false, nil, err
+	}
+
+	ok, val := ldg.GetState(addr, key)
+	if err := ldg.StateErr(); err != nil {
+		return false, nil, err
+	}
+
+	return ok, val, nil
+}
+
+func (api *AccountAPI) GetStateProof(addr *types.Address, key []byte, height uint64) (*trie.Proof, error) {
+	return api.bxh.Ledger.GetStateProof(addr, key, height)
+}
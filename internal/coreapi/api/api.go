@@ -7,6 +7,8 @@ import (
 	"github.com/meshplus/bitxhub/internal/ledger"
 	"github.com/meshplus/bitxhub/internal/model/events"
 	"github.com/meshplus/bitxhub/pkg/peermgr"
+	"github.com/meshplus/bitxhub/pkg/proof"
+	"github.com/meshplus/bitxhub/pkg/trie"
 )
 
 //go:generate mockgen -destination mock_api/mock_api.go -package mock_api -source api.go
@@ -21,9 +23,12 @@ type CoreAPI interface {
 type BrokerAPI interface {
 	HandleTransaction(tx *pb.Transaction) error
 	HandleView(tx *pb.Transaction) (*pb.Receipt, error)
+	HandleViewAt(tx *pb.Transaction, height uint64) (*pb.Receipt, error)
 	GetTransaction(*types.Hash) (*pb.Transaction, error)
 	GetTransactionMeta(*types.Hash) (*pb.TransactionMeta, error)
 	GetReceipt(*types.Hash) (*pb.Receipt, error)
+	GetTransactionProof(*types.Hash) (*proof.TxProof, error)
+	GetReceiptProof(*types.Hash) (*ledger.ReceiptProof, error)
 	GetBlock(mode string, key string) (*pb.Block, error)
 	GetBlocks(start uint64, end uint64) ([]*pb.Block, error)
 	GetPendingNonceByAccount(account string) uint64
@@ -41,9 +46,6 @@ type BrokerAPI interface {
 	// OrderReady
 	OrderReady() error
 
-	// DelVPNode delete a vp node by given id.
-	DelVPNode(delID uint64) error
-
 	FetchSignsFromOtherPeers(content string, typ pb.GetMultiSignsRequest_Type) map[string][]byte
 	GetSign(content string, typ pb.GetMultiSignsRequest_Type) (string, []byte, error)
 	GetBlockHeaders(start uint64, end uint64) ([]*pb.BlockHeader, error)
@@ -66,4 +68,7 @@ type FeedAPI interface {
 
 type AccountAPI interface {
 	GetAccount(addr *types.Address) *ledger.Account
+	GetAccountAt(addr *types.Address, height uint64) (*ledger.Account, error)
+	GetStateAt(addr *types.Address, key []byte, height uint64) (bool, []byte, error)
+	GetStateProof(addr *types.Address, key []byte, height uint64) (*trie.Proof, error)
 }
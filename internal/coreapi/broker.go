@@ -12,7 +12,9 @@ import (
 	"github.com/meshplus/bitxhub-model/pb"
 	"github.com/meshplus/bitxhub/internal/coreapi/api"
 	"github.com/meshplus/bitxhub/internal/executor/contracts"
+	"github.com/meshplus/bitxhub/internal/ledger"
 	"github.com/meshplus/bitxhub/internal/model"
+	"github.com/meshplus/bitxhub/pkg/proof"
 	"github.com/sirupsen/logrus"
 )
 
@@ -60,6 +62,29 @@ func (b *BrokerAPI) HandleView(tx *pb.Transaction) (*pb.Receipt, error) {
 	return receipts[0], nil
 }
 
+// HandleViewAt executes the view transaction against the state after the block of the given height
+func (b *BrokerAPI) HandleViewAt(tx *pb.Transaction, height uint64) (*pb.Receipt, error) {
+	if tx.TransactionHash == nil {
+		if tx.Hash() != nil {
+			tx.TransactionHash = tx.Hash()
+		} else {
+			return nil, fmt.Errorf("transaction hash is nil")
+		}
+	}
+
+	b.logger.WithFields(logrus.Fields{
+		"hash":   tx.TransactionHash.String(),
+		"height": height,
+	}).Debugf("Receive view")
+
+	receipts, err := b.bxh.ViewExecutor.ApplyReadonlyTransactionsAt([]*pb.Transaction{tx}, height)
+	if err != nil {
+		return nil, err
+	}
+
+	return receipts[0], nil
+}
+
 func (b *BrokerAPI) GetTransaction(hash *types.Hash) (*pb.Transaction, error) {
 	return b.bxh.Ledger.GetTransaction(hash)
 }
@@ -72,6 +97,29 @@ func (b *BrokerAPI) GetReceipt(hash *types.Hash) (*pb.Receipt, error) {
 	return b.bxh.Ledger.GetReceipt(hash)
 }
 
+func (b *BrokerAPI) GetReceiptProof(hash *types.Hash) (*ledger.ReceiptProof, error) {
+	return b.bxh.Ledger.GetReceiptProof(hash)
+}
+
+func (b *BrokerAPI) GetTransactionProof(hash *types.Hash) (*proof.TxProof, error) {
+	meta, err := b.bxh.Ledger.GetTransactionMeta(hash)
+	if err != nil {
+		return nil, fmt.Errorf("get transaction meta: %w", err)
+	}
+
+	block, err := b.bxh.Ledger.GetBlock(meta.BlockHeight)
+	if err != nil {
+		return nil, fmt.Errorf("get block %d: %w", meta.BlockHeight, err)
+	}
+
+	interchainMeta, err := b.bxh.Ledger.GetInterchainMeta(meta.BlockHeight)
+	if err != nil {
+		return nil, fmt.Errorf("get interchain meta of block %d: %w", meta.BlockHeight, err)
+	}
+
+	return proof.NewTxProof(block, interchainMeta, meta.Index)
+}
+
 func (b *BrokerAPI) AddPier(pid string, isUnion bool) (chan *pb.InterchainTxWrappers, error) {
 	return b.bxh.Router.AddPier(pid, isUnion)
 }
@@ -313,7 +361,3 @@ func (b *BrokerAPI) getSign(content string) (string, []byte, error) {
 func (b BrokerAPI) GetPendingNonceByAccount(account string) uint64 {
 	return b.bxh.Order.GetPendingNonceByAccount(account)
 }
-
-func (b BrokerAPI) DelVPNode(delID uint64) error {
-	return b.bxh.Order.DelNode(delID)
-}
@@ -21,7 +21,13 @@ type RegisterResult struct {
 	ProposalID string `json:"proposal_id"`
 }
 
+// Manager changes the status of the appchain in the extra of a closed
+// AppchainMgr proposal, it is only callable from the governance contract
 func (am *AppchainManager) Manager(des string, proposalResult string, extra []byte) *boltvm.Response {
+	if res := checkGovernance(am.Stub); !res.Ok {
+		return res
+	}
+
 	am.AppchainManager.Persister = am.Stub
 	chain := &appchainMgr.Appchain{}
 	if err := json.Unmarshal(extra, chain); err != nil {
@@ -49,6 +55,16 @@ func (am *AppchainManager) Manager(des string, proposalResult string, extra []by
 // manager address return appchain id and error
 func (am *AppchainManager) Register(validators string, consensusType int32, chainType, name, desc, version, pubkey string) *boltvm.Response {
 	am.AppchainManager.Persister = am.Stub
+	if chainType == appchainMgr.RelaychainType {
+		if _, err := ParseBxhValidators(validators); err != nil {
+			return boltvm.Error(fmt.Sprintf("invalid relay chain validators: %s", err.Error()))
+		}
+	}
+
+	if res := am.clearStaleRegistration(am.Caller()); !res.Ok {
+		return res
+	}
+
 	ok, idData := am.AppchainManager.Register(am.Caller(), validators, consensusType, chainType, name, desc, version, pubkey)
 	if ok {
 		return boltvm.Error("appchain has registered, chain id: " + string(idData))
@@ -81,12 +97,161 @@ func (am *AppchainManager) Register(validators string, consensusType int32, chai
 	return boltvm.Success(resData)
 }
 
-// UpdateAppchain updates approved appchain
+// clearStaleRegistration closes the expired registration proposal of the
+// appchain, and removes the appchain if it is unavailable so that it can be
+// registered again
+func (am *AppchainManager) clearStaleRegistration(id string) *boltvm.Response {
+	chain := &appchainMgr.Appchain{}
+	if !am.GetObject(appchainMgr.PREFIX+id, chain) {
+		return boltvm.Success(nil)
+	}
+
+	if chain.Status == appchainMgr.AppchainRegisting {
+		res := am.CrossInvoke(constant.GovernanceContractAddr.String(), "CloseExpiredProposals",
+			pb.String(id),
+			pb.String(string(AppchainMgr)),
+		)
+		if !res.Ok {
+			return res
+		}
+		am.GetObject(appchainMgr.PREFIX+id, chain)
+	}
+
+	if chain.Status == appchainMgr.AppchainUnavailable {
+		am.AppchainManager.DeleteAppchain(id)
+	}
+
+	return boltvm.Success(nil)
+}
+
+// UpdateAppchain updates approved appchain, the validators of a relay chain
+// can only be updated through UpdateRelayValidators
 func (am *AppchainManager) UpdateAppchain(validators string, consensusType int32, chainType, name, desc, version, pubkey string) *boltvm.Response {
 	am.AppchainManager.Persister = am.Stub
+	if ok, data := am.AppchainManager.GetAppchain(am.Caller()); ok {
+		chain := &appchainMgr.Appchain{}
+		if err := json.Unmarshal(data, chain); err != nil {
+			return boltvm.Error(err.Error())
+		}
+		if (chain.ChainType == appchainMgr.RelaychainType || chainType == appchainMgr.RelaychainType) &&
+			chain.Validators != validators {
+			return boltvm.Error("validators of relay chain can only be updated through governance")
+		}
+	}
+
 	return responseWrapper(am.AppchainManager.UpdateAppchain(am.Caller(), validators, consensusType, chainType, name, desc, version, pubkey))
 }
 
+// UpdateRelayValidators proposes to replace the validator set and the threshold
+// policy of the relay chain of the caller, the union IBTPs are verified with
+// them once the proposal is approved
+func (am *AppchainManager) UpdateRelayValidators(validators string) *boltvm.Response {
+	am.AppchainManager.Persister = am.Stub
+	ok, data := am.AppchainManager.GetAppchain(am.Caller())
+	if !ok {
+		return boltvm.Error("get appchain error: " + string(data))
+	}
+
+	chain := &appchainMgr.Appchain{}
+	if err := json.Unmarshal(data, chain); err != nil {
+		return boltvm.Error(err.Error())
+	}
+	if chain.ChainType != appchainMgr.RelaychainType {
+		return boltvm.Error(fmt.Sprintf("appchain %s is not a relay chain", chain.ID))
+	}
+	if _, err := ParseBxhValidators(validators); err != nil {
+		return boltvm.Error(fmt.Sprintf("invalid relay chain validators: %s", err.Error()))
+	}
+
+	chain.Validators = validators
+	extra, err := json.Marshal(chain)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	appchainMgr.SetFSM(chain)
+	if !chain.FSM.Can(appchainMgr.EventUpdate) {
+		return boltvm.Error(fmt.Sprintf("this appchain is %s, can not %s", chain.Status, appchainMgr.EventUpdate))
+	}
+
+	res := am.CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(am.Caller()),
+		pb.String(appchainMgr.EventUpdate),
+		pb.String(string(AppchainMgr)),
+		pb.Bytes(extra),
+	)
+	if !res.Ok {
+		return res
+	}
+
+	if ok, data := am.AppchainManager.ChangeStatus(chain.ID, appchainMgr.EventUpdate); !ok {
+		return boltvm.Error(string(data))
+	}
+
+	return boltvm.Success(res.Result)
+}
+
+// FreezeAppchain proposes to freeze the appchain, the interchain txs from or
+// to a frozen appchain are rejected until it is activated
+func (am *AppchainManager) FreezeAppchain(id string) *boltvm.Response {
+	if res := am.IsAdmin(); !res.Ok {
+		return res
+	}
+
+	return am.proposeStatusChange(id, appchainMgr.EventFreeze)
+}
+
+// ActivateAppchain proposes to activate the frozen appchain
+func (am *AppchainManager) ActivateAppchain(id string) *boltvm.Response {
+	if res := am.IsAdmin(); !res.Ok {
+		return res
+	}
+
+	return am.proposeStatusChange(id, appchainMgr.EventActivate)
+}
+
+// LogoutAppchain proposes to logout the appchain of the caller, the records of
+// a logged out appchain are kept
+func (am *AppchainManager) LogoutAppchain() *boltvm.Response {
+	return am.proposeStatusChange(am.Caller(), appchainMgr.EventLogout)
+}
+
+// proposeStatusChange submits the proposal of the status event and moves the
+// appchain into the intermediate status until the proposal is closed
+func (am *AppchainManager) proposeStatusChange(id, event string) *boltvm.Response {
+	am.AppchainManager.Persister = am.Stub
+	ok, data := am.AppchainManager.GetAppchain(id)
+	if !ok {
+		return boltvm.Error("get appchain error: " + string(data))
+	}
+
+	chain := &appchainMgr.Appchain{}
+	if err := json.Unmarshal(data, chain); err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	appchainMgr.SetFSM(chain)
+	if !chain.FSM.Can(event) {
+		return boltvm.Error(fmt.Sprintf("this appchain is %s, can not %s", chain.Status, event))
+	}
+
+	res := am.CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(am.Caller()),
+		pb.String(event),
+		pb.String(string(AppchainMgr)),
+		pb.Bytes(data),
+	)
+	if !res.Ok {
+		return res
+	}
+
+	if ok, data := am.AppchainManager.ChangeStatus(id, event); !ok {
+		return boltvm.Error(string(data))
+	}
+
+	return boltvm.Success(res.Result)
+}
+
 // CountApprovedAppchains counts all approved appchains
 func (am *AppchainManager) CountAvailableAppchains() *boltvm.Response {
 	am.AppchainManager.Persister = am.Stub
@@ -148,6 +313,15 @@ func (am *AppchainManager) IsAdmin() *boltvm.Response {
 	return boltvm.Success([]byte("1"))
 }
 
+// IsInterchainDisabled returns whether the appchain of the status is not
+// allowed to send or receive interchain txs, a frozen appchain stays disabled
+// until its activation is approved
+func IsInterchainDisabled(status appchainMgr.AppchainStatus) bool {
+	return status == appchainMgr.AppchainFrozen ||
+		status == appchainMgr.AppchainActivating ||
+		status == appchainMgr.AppchainUnavailable
+}
+
 func responseWrapper(ok bool, data []byte) *boltvm.Response {
 	if ok {
 		return boltvm.Success(data)
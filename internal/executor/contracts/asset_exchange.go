@@ -1,10 +1,16 @@
 package contracts
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strconv"
 
+	appchainMgr "github.com/meshplus/bitxhub-core/appchain-mgr"
 	"github.com/meshplus/bitxhub-core/boltvm"
+	"github.com/meshplus/bitxhub-model/constant"
 	"github.com/meshplus/bitxhub-model/pb"
 )
 
@@ -20,6 +26,33 @@ type AssetExchangeRecord struct {
 	Chain1 string
 	Status AssetExchangeStatus
 	Info   pb.AssetExchangeInfo
+	// HashLock is the hex encoded sha256 hash of the secret revealed on redeem,
+	// empty if the exchange is not hash locked
+	HashLock string
+	// ExpiryHeight is the last height the exchange can be redeemed at, only
+	// refund is allowed after it. It is 0 in the records stored before
+	// exchanges expire, which expire DefaultAssetExchangeTimeout blocks after
+	// they are first redeemed or refunded
+	ExpiryHeight uint64
+}
+
+// AssetExchangeLock is the extra of the init IBTP locking the exchange with a
+// hash lock and a timeout, a plain marshaled pb.AssetExchangeInfo is also
+// accepted and locked with the default timeout only
+type AssetExchangeLock struct {
+	Info     []byte `json:"info"`
+	HashLock string `json:"hash_lock"`
+	Timeout  uint64 `json:"timeout"`
+}
+
+// AssetExchangeProof is the extra of the redeem and refund IBTPs, a plain
+// exchange id is also accepted for refunds. Redeeming a hash locked exchange
+// requires the preimage, otherwise the proof of the counter chain locking its
+// assets which is verified by the rule bound to the counter chain
+type AssetExchangeProof struct {
+	Id       string `json:"id"`
+	Preimage string `json:"preimage"`
+	Proof    []byte `json:"proof"`
 }
 
 const (
@@ -27,11 +60,30 @@ const (
 	AssetExchangeInit   AssetExchangeStatus = 0
 	AssetExchangeRedeem AssetExchangeStatus = 1
 	AssetExchangeRefund AssetExchangeStatus = 2
+
+	assetOpenLenPrefix   = "asset-open-len-"
+	assetOpenEntryPrefix = "asset-open-idx-"
+	assetOpenPosPrefix   = "asset-open-pos-"
+
+	// MaxOpenExchangesPerQuery bounds the records returned by OpenExchanges
+	MaxOpenExchangesPerQuery uint64 = 100
+
+	// DefaultAssetExchangeTimeout is the number of blocks an exchange can be
+	// redeemed in if the init IBTP does not specify the timeout
+	DefaultAssetExchangeTimeout uint64 = 1000
+	// MaxAssetExchangeTimeout is the max number of blocks an exchange can be
+	// redeemed in
+	MaxAssetExchangeTimeout uint64 = 1000000
 )
 
 func (t *AssetExchange) Init(from, to string, info []byte) *boltvm.Response {
+	lock, err := parseAssetExchangeLock(info)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
 	aei := pb.AssetExchangeInfo{}
-	if err := aei.Unmarshal(info); err != nil {
+	if err := aei.Unmarshal(lock.Info); err != nil {
 		return boltvm.Error(err.Error())
 	}
 
@@ -44,56 +96,142 @@ func (t *AssetExchange) Init(from, to string, info []byte) *boltvm.Response {
 	}
 
 	aer := AssetExchangeRecord{
-		Chain0: from,
-		Chain1: to,
-		Status: AssetExchangeInit,
-		Info:   aei,
+		Chain0:       from,
+		Chain1:       to,
+		Status:       AssetExchangeInit,
+		Info:         aei,
+		HashLock:     lock.HashLock,
+		ExpiryHeight: currentHeight(t.Stub) + lock.Timeout,
 	}
 	t.SetObject(AssetExchangeKey(aei.Id), aer)
+	t.addOpenExchange(from, aei.Id)
+	t.addOpenExchange(to, aei.Id)
 
 	return boltvm.Success(nil)
 }
 
+// Redeem closes the exchange once the counter chain locks its assets, it must
+// be sent by the counter chain and carry the secret of the hash lock if the
+// exchange is hash locked, or the proof of the lock verified by its rule
 func (t *AssetExchange) Redeem(from, to string, info []byte) *boltvm.Response {
-	if err := t.confirm(from, to, info, AssetExchangeRedeem); err != nil {
+	proof, err := parseAssetExchangeProof(info)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	aer, err := t.getOpenExchange(from, to, proof.Id)
+	if err != nil {
 		return boltvm.Error(err.Error())
 	}
 
+	if from != aer.Chain1 {
+		return boltvm.Error(fmt.Sprintf("asset exchange %s can only be redeemed by the counter chain %s", proof.Id, aer.Chain1))
+	}
+	if height := currentHeight(t.Stub); height > aer.ExpiryHeight {
+		return boltvm.Error(fmt.Sprintf("asset exchange %s expired at height %d", proof.Id, aer.ExpiryHeight))
+	}
+	if aer.HashLock != "" {
+		if err := checkHashLock(aer.HashLock, proof.Preimage); err != nil {
+			return boltvm.Error(err.Error())
+		}
+	} else if err := t.checkLockProof(aer, proof.Proof); err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	t.closeExchange(aer, AssetExchangeRedeem)
+
 	return boltvm.Success(nil)
 }
 
+// Refund closes the exchange without transferring the assets, the counter
+// chain can refuse the exchange at any time while the initiator can only
+// refund after the exchange expires
 func (t *AssetExchange) Refund(from, to string, info []byte) *boltvm.Response {
-	if err := t.confirm(from, to, info, AssetExchangeRefund); err != nil {
+	proof, err := parseAssetExchangeProof(info)
+	if err != nil {
 		return boltvm.Error(err.Error())
 	}
 
+	aer, err := t.getOpenExchange(from, to, proof.Id)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	if from == aer.Chain0 && currentHeight(t.Stub) <= aer.ExpiryHeight {
+		return boltvm.Error(fmt.Sprintf("asset exchange %s can not be refunded by the initiator before height %d", proof.Id, aer.ExpiryHeight))
+	}
+
+	t.closeExchange(aer, AssetExchangeRefund)
+
 	return boltvm.Success(nil)
 }
 
-func (t *AssetExchange) confirm(from, to string, payload []byte, status AssetExchangeStatus) error {
-	id := string(payload)
-	aer := AssetExchangeRecord{}
-	ok := t.GetObject(AssetExchangeKey(id), &aer)
+func (t *AssetExchange) getOpenExchange(from, to, id string) (*AssetExchangeRecord, error) {
+	aer := &AssetExchangeRecord{}
+	ok := t.GetObject(AssetExchangeKey(id), aer)
 	if !ok {
-		return fmt.Errorf("asset exchange record does not exist")
+		return nil, fmt.Errorf("asset exchange record does not exist")
 	}
 
 	if aer.Status != AssetExchangeInit {
-		return fmt.Errorf("asset exchange status for this id is not 'Init'")
+		return nil, fmt.Errorf("asset exchange status for this id is not 'Init'")
 	}
 
 	if !(aer.Chain0 == from && aer.Chain1 == to) && !(aer.Chain0 == to && aer.Chain1 == from) {
-		return fmt.Errorf("invalid participator of asset exchange id %s", id)
+		return nil, fmt.Errorf("invalid participator of asset exchange id %s", id)
 	}
 
-	// TODO: verify proof
+	if aer.ExpiryHeight == 0 {
+		aer.ExpiryHeight = currentHeight(t.Stub) + DefaultAssetExchangeTimeout
+		t.SetObject(AssetExchangeKey(id), *aer)
+	}
 
-	aer.Status = status
-	t.SetObject(AssetExchangeKey(id), aer)
+	return aer, nil
+}
+
+// checkLockProof verifies the proof of the counter chain locking its assets
+// of the exchange with the rule bound to the counter chain
+func (t *AssetExchange) checkLockProof(aer *AssetExchangeRecord, proof []byte) error {
+	if len(proof) == 0 {
+		return fmt.Errorf("proof of the counter chain lock is required")
+	}
+
+	res := t.CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(aer.Chain1))
+	if !res.Ok {
+		return fmt.Errorf("get counter chain %s: %s", aer.Chain1, res.Result)
+	}
+	app := &appchainMgr.Appchain{}
+	if err := json.Unmarshal(res.Result, app); err != nil {
+		return fmt.Errorf("unmarshal counter chain %s: %w", aer.Chain1, err)
+	}
+
+	res = t.CrossInvoke(constant.RuleManagerContractAddr.String(), "GetRuleAddress", pb.String(aer.Chain1), pb.String(app.ChainType))
+	if !res.Ok {
+		return fmt.Errorf("get rule of counter chain %s: %s", aer.Chain1, res.Result)
+	}
+
+	info, err := aer.Info.Marshal()
+	if err != nil {
+		return err
+	}
+	ok, err := t.ValidationEngine().Validate(string(res.Result), aer.Chain1, proof, info, app.Validators)
+	if err != nil {
+		return fmt.Errorf("verify proof of the counter chain lock: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("invalid proof of the counter chain lock")
+	}
 
 	return nil
 }
 
+func (t *AssetExchange) closeExchange(aer *AssetExchangeRecord, status AssetExchangeStatus) {
+	aer.Status = status
+	t.SetObject(AssetExchangeKey(aer.Info.Id), *aer)
+	t.removeOpenExchange(aer.Chain0, aer.Info.Id)
+	t.removeOpenExchange(aer.Chain1, aer.Info.Id)
+}
+
 func (t *AssetExchange) GetStatus(id string) *boltvm.Response {
 	aer := AssetExchangeRecord{}
 	ok := t.GetObject(AssetExchangeKey(id), &aer)
@@ -104,10 +242,169 @@ func (t *AssetExchange) GetStatus(id string) *boltvm.Response {
 	return boltvm.Success([]byte(strconv.Itoa(int(aer.Status))))
 }
 
+// OpenExchanges returns the records of the exchanges of the chain which are
+// neither redeemed nor refunded, including the expired ones, skipping offset
+// records. Closing an exchange moves the last open one into its place, limit 0
+// means MaxOpenExchangesPerQuery.
+func (t *AssetExchange) OpenExchanges(chainID string, offset, limit uint64) *boltvm.Response {
+	if limit == 0 {
+		limit = MaxOpenExchangesPerQuery
+	}
+	if limit > MaxOpenExchangesPerQuery {
+		return boltvm.Error(fmt.Sprintf("query %d records exceeds the max limit %d", limit, MaxOpenExchangesPerQuery))
+	}
+
+	length := t.openExchangesLen(chainID)
+	records := make([]*AssetExchangeRecord, 0)
+	for seq := offset; seq < length && seq-offset < limit; seq++ {
+		ok, id := t.Get(assetOpenEntryKey(chainID, seq))
+		if !ok {
+			return boltvm.Error(fmt.Sprintf("open exchange %d of chain %s does not exist", seq, chainID))
+		}
+		aer := &AssetExchangeRecord{}
+		if !t.GetObject(AssetExchangeKey(string(id)), aer) {
+			return boltvm.Error(fmt.Sprintf("asset exchange record %s does not exist", id))
+		}
+		records = append(records, aer)
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return boltvm.Success(data)
+}
+
+// addOpenExchange appends the exchange to the open exchanges of the chain, the
+// positions of the exchange in the lists of its chains are kept to close it
+func (t *AssetExchange) addOpenExchange(chainID, id string) {
+	positions := make(map[string]uint64)
+	t.GetObject(assetOpenPosKey(id), &positions)
+	if _, ok := positions[chainID]; ok {
+		return
+	}
+
+	length := t.openExchangesLen(chainID)
+	t.Set(assetOpenEntryKey(chainID, length), []byte(id))
+	t.SetObject(assetOpenLenKey(chainID), length+1)
+	positions[chainID] = length
+	t.SetObject(assetOpenPosKey(id), positions)
+}
+
+// removeOpenExchange removes the exchange from the open exchanges of the chain
+// by moving the last open exchange into its place
+func (t *AssetExchange) removeOpenExchange(chainID, id string) {
+	positions := make(map[string]uint64)
+	t.GetObject(assetOpenPosKey(id), &positions)
+	seq, ok := positions[chainID]
+	if !ok {
+		return
+	}
+
+	last := t.openExchangesLen(chainID) - 1
+	if seq != last {
+		_, lastID := t.Get(assetOpenEntryKey(chainID, last))
+		t.Set(assetOpenEntryKey(chainID, seq), lastID)
+
+		lastPositions := make(map[string]uint64)
+		t.GetObject(assetOpenPosKey(string(lastID)), &lastPositions)
+		lastPositions[chainID] = seq
+		t.SetObject(assetOpenPosKey(string(lastID)), lastPositions)
+	}
+	t.Delete(assetOpenEntryKey(chainID, last))
+	t.SetObject(assetOpenLenKey(chainID), last)
+
+	delete(positions, chainID)
+	if len(positions) == 0 {
+		t.Delete(assetOpenPosKey(id))
+	} else {
+		t.SetObject(assetOpenPosKey(id), positions)
+	}
+}
+
+func (t *AssetExchange) openExchangesLen(chainID string) uint64 {
+	var length uint64
+	t.GetObject(assetOpenLenKey(chainID), &length)
+	return length
+}
+
 func AssetExchangeKey(id string) string {
 	return fmt.Sprintf("%s-%s", ASSET_PREFIX, id)
 }
 
+func assetOpenLenKey(chainID string) string {
+	return assetOpenLenPrefix + chainID
+}
+
+func assetOpenEntryKey(chainID string, seq uint64) string {
+	return fmt.Sprintf("%s%s-%d", assetOpenEntryPrefix, chainID, seq)
+}
+
+func assetOpenPosKey(id string) string {
+	return assetOpenPosPrefix + id
+}
+
+func parseAssetExchangeLock(data []byte) (*AssetExchangeLock, error) {
+	// a marshaled pb.AssetExchangeInfo starts with the tag of the id field
+	if len(data) == 0 || data[0] != '{' {
+		return &AssetExchangeLock{Info: data, Timeout: DefaultAssetExchangeTimeout}, nil
+	}
+
+	lock := &AssetExchangeLock{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("unmarshal asset exchange lock: %w", err)
+	}
+	if lock.HashLock != "" {
+		hash, err := hex.DecodeString(lock.HashLock)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid hash lock %s", lock.HashLock)
+		}
+	}
+	if lock.Timeout == 0 {
+		lock.Timeout = DefaultAssetExchangeTimeout
+	}
+	if lock.Timeout > MaxAssetExchangeTimeout {
+		return nil, fmt.Errorf("timeout %d exceeds the max timeout %d", lock.Timeout, MaxAssetExchangeTimeout)
+	}
+
+	return lock, nil
+}
+
+func parseAssetExchangeProof(data []byte) (*AssetExchangeProof, error) {
+	if len(data) == 0 || data[0] != '{' {
+		return &AssetExchangeProof{Id: string(data)}, nil
+	}
+
+	proof := &AssetExchangeProof{}
+	if err := json.Unmarshal(data, proof); err != nil {
+		return nil, fmt.Errorf("unmarshal asset exchange proof: %w", err)
+	}
+
+	return proof, nil
+}
+
+func checkHashLock(hashLock, preimage string) error {
+	if preimage == "" {
+		return fmt.Errorf("preimage of the hash lock is required")
+	}
+
+	secret, err := hex.DecodeString(preimage)
+	if err != nil {
+		return fmt.Errorf("invalid preimage: %w", err)
+	}
+	lock, err := hex.DecodeString(hashLock)
+	if err != nil {
+		return fmt.Errorf("invalid hash lock: %w", err)
+	}
+	hash := sha256.Sum256(secret)
+	if !bytes.Equal(hash[:], lock) {
+		return fmt.Errorf("preimage does not match the hash lock")
+	}
+
+	return nil
+}
+
 func checkAssetExchangeInfo(aei *pb.AssetExchangeInfo) error {
 	if aei.Id == "" ||
 		aei.SenderOnDst == "" ||
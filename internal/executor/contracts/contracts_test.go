@@ -2,9 +2,12 @@ package contracts
 
 import (
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +16,7 @@ import (
 	"github.com/meshplus/bitxhub-core/boltvm"
 	"github.com/meshplus/bitxhub-core/boltvm/mock_stub"
 	"github.com/meshplus/bitxhub-core/validator"
+	"github.com/meshplus/bitxhub-core/validator/mock_validator"
 	"github.com/meshplus/bitxhub-kit/crypto"
 	"github.com/meshplus/bitxhub-kit/crypto/asym"
 	"github.com/meshplus/bitxhub-kit/log"
@@ -106,6 +110,7 @@ func TestAppchainManager_Appchains(t *testing.T) {
 	mockStub.EXPECT().Get(gomock.Any()).Return(true, chainsData[0]).AnyTimes()
 	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(boltvm.Success(nil))
 	mockStub.EXPECT().Has(AppchainKey(caller)).Return(false).MaxTimes(3)
+	mockStub.EXPECT().GetObject(AppchainKey(caller), gomock.Any()).Return(false)
 	am.Register(chains[0].Validators, chains[0].ConsensusType, chains[0].ChainType,
 		chains[0].Name, chains[0].Desc, chains[0].Version, chains[0].PublicKey)
 
@@ -170,7 +175,7 @@ func TestAppchainManager_Manager(t *testing.T) {
 	mockCtl := gomock.NewController(t)
 	mockStub := mock_stub.NewMockStub(mockCtl)
 	am := &AppchainManager{
-		Stub: mockStub,
+		Stub: &callerMockStub{MockStub: mockStub, caller: constant.GovernanceContractAddr.Address().String()},
 	}
 
 	chain := &appchainMgr.Appchain{
@@ -214,7 +219,9 @@ func TestAppchainManager_Manager(t *testing.T) {
 			return true
 		})
 
-	res := am.Manager(appchainMgr.EventUpdate, string(APPOVED), data1)
+	res := (&AppchainManager{Stub: &callerMockStub{MockStub: mockStub, caller: caller}}).Manager(appchainMgr.EventUpdate, string(APPOVED), data)
+	assert.False(t, res.Ok)
+	res = am.Manager(appchainMgr.EventUpdate, string(APPOVED), data1)
 	assert.False(t, res.Ok)
 	res = am.Manager(appchainMgr.EventUpdate, string(REJECTED), data1)
 	assert.False(t, res.Ok)
@@ -231,11 +238,470 @@ func TestAppchainManager_Manager(t *testing.T) {
 	assert.True(t, res.Ok)
 }
 
+func TestAppchainManager_Lifecycle(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	admin := types.NewAddress([]byte{2}).String()
+	chain := &appchainMgr.Appchain{
+		ID:        caller,
+		Name:      "appchain",
+		Status:    appchainMgr.AppchainAvailable,
+		ChainType: "fabric",
+	}
+	data, err := json.Marshal(chain)
+	assert.Nil(t, err)
+
+	state := map[string][]byte{AppchainKey(caller): data}
+	statusOf := func() appchainMgr.AppchainStatus {
+		c := &appchainMgr.Appchain{}
+		assert.Nil(t, json.Unmarshal(state[AppchainKey(caller)], c))
+		return c.Status
+	}
+
+	mockStub.EXPECT().Get(gomock.Any()).DoAndReturn(func(key string) (bool, []byte) {
+		v, ok := state[key]
+		return ok, v
+	}).AnyTimes()
+	mockStub.EXPECT().SetObject(gomock.Any(), gomock.Any()).Do(func(key string, value interface{}) {
+		v, err := json.Marshal(value)
+		assert.Nil(t, err)
+		state[key] = v
+	}).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.RoleContractAddr.String(), "IsAdmin", pb.String(admin)).Return(boltvm.Success([]byte("true"))).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.RoleContractAddr.String(), "IsAdmin", gomock.Any()).Return(boltvm.Success([]byte("false"))).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		gomock.Any(), pb.String(appchainMgr.EventActivate), gomock.Any(), gomock.Any()).Return(boltvm.Error("submit error"))
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		gomock.Any(), gomock.Any(), pb.String(string(AppchainMgr)), gomock.Any()).Return(boltvm.Success([]byte("proposal"))).AnyTimes()
+
+	callerC := mockStub.EXPECT().Caller().Return(caller).Times(1)
+	adminC := mockStub.EXPECT().Caller().Return(admin).AnyTimes()
+	gomock.InOrder(callerC, adminC)
+
+	am := &AppchainManager{Stub: &callerMockStub{MockStub: mockStub, caller: constant.GovernanceContractAddr.Address().String()}}
+
+	// only admins can freeze appchains
+	res := am.FreezeAppchain(caller)
+	assert.False(t, res.Ok)
+
+	res = am.FreezeAppchain(caller)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "proposal", string(res.Result))
+	assert.Equal(t, appchainMgr.AppchainFreezing, statusOf())
+
+	res = am.FreezeAppchain(caller)
+	assert.False(t, res.Ok)
+
+	res = am.Manager(appchainMgr.EventFreeze, string(APPOVED), data)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, appchainMgr.AppchainFrozen, statusOf())
+	assert.True(t, IsInterchainDisabled(statusOf()))
+
+	// the status stays unchanged if the proposal is not submitted
+	res = am.ActivateAppchain(caller)
+	assert.False(t, res.Ok)
+	assert.Equal(t, appchainMgr.AppchainFrozen, statusOf())
+
+	res = am.ActivateAppchain(caller)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, appchainMgr.AppchainActivating, statusOf())
+	res = am.Manager(appchainMgr.EventActivate, string(REJECTED), data)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, appchainMgr.AppchainFrozen, statusOf())
+
+	res = am.ActivateAppchain(caller)
+	assert.True(t, res.Ok, string(res.Result))
+	res = am.Manager(appchainMgr.EventActivate, string(APPOVED), data)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, appchainMgr.AppchainAvailable, statusOf())
+	assert.False(t, IsInterchainDisabled(statusOf()))
+
+	res = am.LogoutAppchain()
+	assert.False(t, res.Ok)
+	state[AppchainKey(admin)] = state[AppchainKey(caller)]
+	res = am.LogoutAppchain()
+	assert.True(t, res.Ok, string(res.Result))
+}
+
+func TestAppchainManager_RegisterStale(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+	state := mockStubState(t, mockStub)
+
+	setStatus := func(status appchainMgr.AppchainStatus) {
+		data, err := json.Marshal(&appchainMgr.Appchain{ID: caller, Status: status, ChainType: "fabric"})
+		assert.Nil(t, err)
+		state[AppchainKey(caller)] = data
+	}
+	statusOf := func() appchainMgr.AppchainStatus {
+		c := &appchainMgr.Appchain{}
+		assert.Nil(t, json.Unmarshal(state[AppchainKey(caller)], c))
+		return c.Status
+	}
+
+	mockStub.EXPECT().Caller().Return(caller).AnyTimes()
+	mockStub.EXPECT().Logger().Return(log.NewWithModule("contracts")).AnyTimes()
+	mockStub.EXPECT().Has(gomock.Any()).DoAndReturn(func(key string) bool {
+		_, ok := state[key]
+		return ok
+	}).AnyTimes()
+	mockStub.EXPECT().Delete(gomock.Any()).Do(func(key string) {
+		delete(state, key)
+	}).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(boltvm.Success([]byte("proposal"))).AnyTimes()
+	// the first registration proposal is still open, the second one has expired
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "CloseExpiredProposals",
+		pb.String(caller), pb.String(string(AppchainMgr))).Return(boltvm.Success([]byte("0")))
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "CloseExpiredProposals",
+		pb.String(caller), pb.String(string(AppchainMgr))).DoAndReturn(func(string, string, ...*pb.Arg) *boltvm.Response {
+		setStatus(appchainMgr.AppchainUnavailable)
+		return boltvm.Success([]byte("1"))
+	})
+
+	am := &AppchainManager{Stub: mockStub}
+	register := func() *boltvm.Response {
+		return am.Register("", 0, "fabric", "appchain", "", "", "")
+	}
+
+	res := register()
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, appchainMgr.AppchainRegisting, statusOf())
+
+	res = register()
+	assert.False(t, res.Ok)
+
+	res = register()
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, appchainMgr.AppchainRegisting, statusOf())
+
+	// a rejected or logged out appchain can be registered again
+	setStatus(appchainMgr.AppchainUnavailable)
+	res = register()
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, appchainMgr.AppchainRegisting, statusOf())
+
+	setStatus(appchainMgr.AppchainAvailable)
+	res = register()
+	assert.False(t, res.Ok)
+}
+
+func TestInterchainManager_HandleIBTPFrozen(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	from := types.NewAddress([]byte{0}).String()
+	to := types.NewAddress([]byte{1}).String()
+	interchain := pb.Interchain{ID: from}
+	data, err := interchain.Marshal()
+	assert.Nil(t, err)
+
+	frozen, err := json.Marshal(&appchainMgr.Appchain{ID: to, Status: appchainMgr.AppchainFrozen})
+	assert.Nil(t, err)
+	available, err := json.Marshal(&appchainMgr.Appchain{ID: from, Status: appchainMgr.AppchainAvailable})
+	assert.Nil(t, err)
+
+	mockStub.EXPECT().Caller().Return(from).AnyTimes()
+	mockStub.EXPECT().Get(AppchainKey(from)).Return(true, data).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(from)).Return(boltvm.Success(available)).Times(1)
+	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(to)).Return(boltvm.Success(frozen)).Times(1)
+	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(from)).Return(boltvm.Success(frozen)).Times(1)
+
+	im := &InterchainManager{mockStub}
+
+	ibtp := &pb.IBTP{From: from, To: to, Index: 1, Type: pb.IBTP_INTERCHAIN}
+	res := im.HandleIBTP(ibtp)
+	assert.False(t, res.Ok)
+	assert.Equal(t, fmt.Sprintf("destination appchain %s is frozen", to), string(res.Result))
+
+	res = im.HandleIBTP(ibtp)
+	assert.False(t, res.Ok)
+	assert.Equal(t, fmt.Sprintf("source appchain %s is frozen", from), string(res.Result))
+}
+
+func TestInterchainManager_HandleIBTPService(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	from := types.NewAddress([]byte{0}).String()
+	to := types.NewAddress([]byte{1}).String()
+	interchain := pb.Interchain{ID: from}
+	data, err := interchain.Marshal()
+	assert.Nil(t, err)
+	denied := fmt.Sprintf("appchain %s is not allowed to call service transfer of appchain %s", from, to)
+
+	mockStub.EXPECT().Caller().Return(from).AnyTimes()
+	mockStub.EXPECT().Get(AppchainKey(from)).Return(true, data).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", gomock.Any()).Return(boltvm.Error("")).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.ServiceMgrContractAddr.String(), "CheckInvocation",
+		pb.String(from), pb.String(to), pb.String("transfer")).Return(boltvm.Error(denied))
+
+	im := &InterchainManager{mockStub}
+
+	ibtp := &pb.IBTP{From: from, To: to, Index: 1, Type: pb.IBTP_INTERCHAIN}
+	res := im.HandleIBTP(ibtp)
+	assert.False(t, res.Ok)
+	assert.Contains(t, string(res.Result), "unmarshal ibtp payload")
+
+	// encrypted payloads are only checked against the services of the destination chain
+	deniedAll := fmt.Sprintf("appchain %s is not allowed to call any service of appchain %s", from, to)
+	mockStub.EXPECT().CrossInvoke(constant.ServiceMgrContractAddr.String(), "CheckEncryptedInvocation",
+		pb.String(from), pb.String(to)).Return(boltvm.Error(deniedAll))
+	mockStub.EXPECT().CrossInvoke(constant.ServiceMgrContractAddr.String(), "CheckEncryptedInvocation",
+		pb.String(from), pb.String(to)).Return(boltvm.Success(nil))
+	encrypted, err := json.Marshal(pb.Payload{Encrypted: true})
+	assert.Nil(t, err)
+	ibtp.Payload = encrypted
+	err = im.checkService(ibtp)
+	assert.NotNil(t, err)
+	assert.Equal(t, deniedAll, err.Error())
+	assert.Nil(t, im.checkService(ibtp))
+
+	ibtp.Payload = mockIBTPPayload(t, "transfer")
+	res = im.HandleIBTP(ibtp)
+	assert.False(t, res.Ok)
+	assert.Equal(t, denied, string(res.Result))
+}
+
+func mockIBTPPayload(t *testing.T, dstContractID string) []byte {
+	content := pb.Content{
+		DstContractId: dstContractID,
+		Func:          "set",
+	}
+	data, err := content.Marshal()
+	assert.Nil(t, err)
+
+	payload, err := json.Marshal(pb.Payload{Content: data})
+	assert.Nil(t, err)
+
+	return payload
+}
+
+func TestInterchainManager_HandleIBTPRollback(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	from := types.NewAddress([]byte{0}).String()
+	to := types.NewAddress([]byte{1}).String()
+	interchain := pb.Interchain{
+		ID:                   from,
+		InterchainCounter:    map[string]uint64{to: 2},
+		ReceiptCounter:       map[string]uint64{to: 1},
+		SourceReceiptCounter: map[string]uint64{},
+	}
+	data, err := interchain.Marshal()
+	assert.Nil(t, err)
+	txID := fmt.Sprintf("%s-%s-2", from, to)
+
+	state := map[string][]byte{AppchainKey(from): data, AppchainKey(to): data}
+	sender := constant.TransactionMgrContractAddr.Address().String()
+	mockStub.EXPECT().Caller().DoAndReturn(func() string { return sender }).AnyTimes()
+	mockStub.EXPECT().Get(gomock.Any()).DoAndReturn(func(key string) (bool, []byte) {
+		v, ok := state[key]
+		return ok, v
+	}).AnyTimes()
+	mockStub.EXPECT().Set(gomock.Any(), gomock.Any()).Do(func(key string, value []byte) {
+		state[key] = value
+	}).AnyTimes()
+	mockStub.EXPECT().SetObject(gomock.Any(), gomock.Any()).AnyTimes()
+	mockStub.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(false).AnyTimes()
+	mockStub.EXPECT().GetTxIndex().Return(uint64(1)).AnyTimes()
+	mockStub.EXPECT().GetTxHash().Return(&types.Hash{}).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", gomock.Any()).Return(boltvm.Error("")).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.TransactionMgrContractAddr.String(), "Rollback", pb.String(txID)).Return(boltvm.Success(nil))
+	mockStub.EXPECT().CrossInvoke(constant.TransactionMgrContractAddr.String(), "IsRolledBack", pb.String(txID)).
+		Return(boltvm.Success([]byte("true")))
+	mockStub.EXPECT().PostInterchainEvent(map[string]uint64{from: 1})
+
+	im := &InterchainManager{mockStub}
+
+	// the failure receipt is sent by the relay chain itself
+	ibtp := &pb.IBTP{From: from, To: to, Index: 2, Type: pb.IBTP_RECEIPT_FAILURE}
+	res := im.HandleIBTP(ibtp)
+	assert.True(t, res.Ok, string(res.Result))
+
+	// the late receipt of the destination chain
+	ibtp = &pb.IBTP{From: from, To: to, Index: 2, Type: pb.IBTP_RECEIPT_SUCCESS}
+	sender = to
+	res = im.HandleIBTP(ibtp)
+	assert.False(t, res.Ok)
+	assert.Equal(t, fmt.Sprintf("transaction %s has been rolled back", txID), string(res.Result))
+}
+
+func TestInterchainManager_HandleIBTPPending(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	from := types.NewAddress([]byte{0}).String()
+	to := types.NewAddress([]byte{1}).String()
+	interchain := pb.Interchain{
+		ID:                   from,
+		InterchainCounter:    map[string]uint64{},
+		ReceiptCounter:       map[string]uint64{},
+		SourceReceiptCounter: map[string]uint64{},
+	}
+	data, err := interchain.Marshal()
+	assert.Nil(t, err)
+
+	state := mockStubState(t, mockStub)
+	state[AppchainKey(from)] = data
+	state[AppchainKey(to)] = data
+	sender := from
+	txIndex := uint64(0)
+	txHash := types.NewHash([]byte{0})
+	var (
+		events  []map[string]uint64
+		drained []*DrainedIBTPEvent
+	)
+	mockStub.EXPECT().Caller().DoAndReturn(func() string { return sender }).AnyTimes()
+	mockStub.EXPECT().Get(gomock.Any()).DoAndReturn(func(key string) (bool, []byte) {
+		v, ok := state[key]
+		return ok, v
+	}).AnyTimes()
+	mockStub.EXPECT().Set(gomock.Any(), gomock.Any()).Do(func(key string, value []byte) {
+		state[key] = value
+	}).AnyTimes()
+	mockStub.EXPECT().AddObject(gomock.Any(), gomock.Any()).Do(func(key string, value interface{}) {
+		v, err := json.Marshal(value)
+		assert.Nil(t, err)
+		state[key] = v
+	}).AnyTimes()
+	mockStub.EXPECT().Delete(gomock.Any()).Do(func(key string) {
+		delete(state, key)
+	}).AnyTimes()
+	mockStub.EXPECT().Query(gomock.Any()).DoAndReturn(func(prefix string) (bool, [][]byte) {
+		var ret [][]byte
+		for key, value := range state {
+			if strings.HasPrefix(key, prefix) {
+				ret = append(ret, value)
+			}
+		}
+		return len(ret) != 0, ret
+	}).AnyTimes()
+	mockStub.EXPECT().GetTxIndex().DoAndReturn(func() uint64 { return txIndex }).AnyTimes()
+	mockStub.EXPECT().GetTxHash().DoAndReturn(func() *types.Hash { return txHash }).AnyTimes()
+	mockStub.EXPECT().PostInterchainEvent(gomock.Any()).Do(func(event interface{}) {
+		events = append(events, event.(map[string]uint64))
+	}).AnyTimes()
+	mockStub.EXPECT().PostEvent(gomock.Any()).Do(func(event interface{}) {
+		drained = append(drained, event.(*DrainedIBTPEvent))
+	}).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", gomock.Any()).Return(boltvm.Error("")).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.ServiceMgrContractAddr.String(), "CheckInvocation", gomock.Any()).Return(boltvm.Success(nil)).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.TransactionMgrContractAddr.String(), "Begin", gomock.Any()).Return(boltvm.Success(nil)).Times(3)
+	mockStub.EXPECT().CrossInvoke(constant.TransactionMgrContractAddr.String(), "Report",
+		pb.String(fmt.Sprintf("%s-%s-1", from, to)), gomock.Any()).Return(boltvm.Success(nil))
+	mockStub.EXPECT().CrossInvoke(constant.TransactionMgrContractAddr.String(), "Report",
+		pb.String(fmt.Sprintf("%s-%s-2", from, to)), gomock.Any()).Return(boltvm.Error("report error"))
+
+	stub := &heightMockStub{MockStub: mockStub, height: 10}
+	im := &InterchainManager{stub}
+	ibtp := func(index uint64, typ pb.IBTP_Type) *pb.IBTP {
+		return &pb.IBTP{From: from, To: to, Index: index, Type: typ, Payload: mockIBTPPayload(t, "transfer")}
+	}
+	handleResult := func(res *boltvm.Response) *HandleIBTPResult {
+		assert.True(t, res.Ok, string(res.Result))
+		result := &HandleIBTPResult{}
+		assert.Nil(t, json.Unmarshal(res.Result, result))
+		return result
+	}
+
+	// index 3 and 2 arrive before index 1 in two blocks
+	hash3 := types.NewHash([]byte{3})
+	txHash = hash3
+	assert.True(t, handleResult(im.HandleIBTP(ibtp(3, pb.IBTP_INTERCHAIN))).Pending)
+	res := im.HandleIBTP(ibtp(3, pb.IBTP_INTERCHAIN))
+	assert.False(t, res.Ok)
+	assert.Equal(t, fmt.Sprintf("ibtp %s-%s-3 is already pending", from, to), string(res.Result))
+	res = im.HandleIBTP(ibtp(1+MaxPendingIBTPs, pb.IBTP_INTERCHAIN))
+	assert.False(t, res.Ok)
+	assert.Equal(t, fmt.Sprintf("wrong index, required 1, but %d, exceeds %d pending ibtps", 1+MaxPendingIBTPs, MaxPendingIBTPs), string(res.Result))
+
+	stub.height = 11
+	txIndex = 1
+	assert.True(t, handleResult(im.HandleIBTP(ibtp(2, pb.IBTP_INTERCHAIN))).Pending)
+	assert.Nil(t, events)
+
+	res = im.GetIBTPGaps(from, to)
+	assert.True(t, res.Ok, string(res.Result))
+	var gaps []*IBTPGap
+	assert.Nil(t, json.Unmarshal(res.Result, &gaps))
+	assert.Equal(t, []*IBTPGap{{From: from, To: to, Required: 1, Pending: []uint64{2, 3}, Missing: []uint64{1}}}, gaps)
+
+	// index 1 drains both, index 2 sent in this block is delivered with its tx
+	// and index 3 sent in the earlier block with the tx appended by the relay
+	txIndex = 2
+	result := handleResult(im.HandleIBTP(ibtp(1, pb.IBTP_INTERCHAIN)))
+	assert.Equal(t, []string{fmt.Sprintf("%s-%s-2", from, to), fmt.Sprintf("%s-%s-3", from, to)}, result.Drained)
+	assert.Equal(t, []map[string]uint64{{to: 2}, {to: 1}}, events)
+	assert.Equal(t, 1, len(drained))
+	assert.Equal(t, to, drained[0].Dst)
+	ibtp3 := &pb.IBTP{}
+	assert.Nil(t, ibtp3.Unmarshal(drained[0].IBTP))
+	assert.Equal(t, fmt.Sprintf("%s-%s-3", from, to), ibtp3.ID())
+
+	evData, err := json.Marshal(drained[0])
+	assert.Nil(t, err)
+	ev := &pb.Event{Data: evData}
+	parsed, ok := ParseDrainedIBTPEvent(ev)
+	assert.True(t, ok)
+	assert.Equal(t, drained[0], parsed)
+	_, ok = ParseNodeEvent(ev)
+	assert.False(t, ok)
+
+	ic, ok := im.getInterchain(from)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), ic.InterchainCounter[to])
+	var hash types.Hash
+	assert.True(t, im.GetObject(im.indexMapKey(fmt.Sprintf("%s-%s-3", from, to)), &hash))
+	assert.Equal(t, hash3.String(), hash.String())
+
+	res = im.GetIBTPGaps(from, "")
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "[]", string(res.Result))
+
+	// the buffered receipt failing to be handled is dropped
+	sender = to
+	assert.True(t, handleResult(im.HandleIBTP(ibtp(3, pb.IBTP_RECEIPT_SUCCESS))).Pending)
+	assert.True(t, handleResult(im.HandleIBTP(ibtp(2, pb.IBTP_RECEIPT_SUCCESS))).Pending)
+	result = handleResult(im.HandleIBTP(ibtp(1, pb.IBTP_RECEIPT_SUCCESS)))
+	assert.Nil(t, result.Drained)
+	assert.Equal(t, map[string]string{fmt.Sprintf("%s-%s-2", from, to): "report error"}, result.Dropped)
+
+	res = im.GetIBTPGaps(from, to)
+	assert.True(t, res.Ok, string(res.Result))
+	gaps = nil
+	assert.Nil(t, json.Unmarshal(res.Result, &gaps))
+	assert.Equal(t, []*IBTPGap{{From: from, To: to, Receipt: true, Required: 2, Pending: []uint64{3}, Missing: []uint64{2}}}, gaps)
+
+	// the drained timeout receipts are marked when they are buffered rather
+	// than by the sender of the transaction draining them
+	txMgr := constant.TransactionMgrContractAddr.Address().String()
+	for _, id := range []uint64{2, 4} {
+		mockStub.EXPECT().CrossInvoke(constant.TransactionMgrContractAddr.String(), "Rollback",
+			pb.String(fmt.Sprintf("%s-%s-%d", from, to, id))).Return(boltvm.Success(nil))
+	}
+	for _, id := range []uint64{3, 5} {
+		mockStub.EXPECT().CrossInvoke(constant.TransactionMgrContractAddr.String(), "Report",
+			pb.String(fmt.Sprintf("%s-%s-%d", from, to, id)), gomock.Any()).Return(boltvm.Success(nil))
+	}
+	sender = txMgr
+	assert.True(t, handleResult(im.HandleIBTP(ibtp(4, pb.IBTP_RECEIPT_FAILURE))).Pending)
+	sender = to
+	assert.True(t, handleResult(im.HandleIBTP(ibtp(5, pb.IBTP_RECEIPT_FAILURE))).Pending)
+	sender = txMgr
+	result = handleResult(im.HandleIBTP(ibtp(2, pb.IBTP_RECEIPT_FAILURE)))
+	assert.Nil(t, result.Dropped)
+	assert.Equal(t, []string{fmt.Sprintf("%s-%s-3", from, to), fmt.Sprintf("%s-%s-4", from, to), fmt.Sprintf("%s-%s-5", from, to)}, result.Drained)
+}
+
 func TestUpdateChain(t *testing.T) {
-	am, mockStub, chains, _ := prepare(t)
+	am, mockStub, chains, chainsData := prepare(t)
 	logger := log.NewWithModule("contracts")
 	// test for DeleteAppchain
 	mockStub.EXPECT().Caller().Return(caller).AnyTimes()
+	mockStub.EXPECT().Get(AppchainKey(caller)).Return(true, chainsData[0]).AnyTimes()
 	mockStub.EXPECT().Has(AppchainKey(caller)).Return(true).AnyTimes()
 	mockStub.EXPECT().SetObject(gomock.Any(), gomock.Any()).Return().AnyTimes()
 	mockStub.EXPECT().Logger().Return(logger).AnyTimes()
@@ -507,6 +973,7 @@ func TestInterchainManager_HandleIBTP(t *testing.T) {
 	mockStub.EXPECT().GetTxIndex().Return(uint64(1)).AnyTimes()
 	mockStub.EXPECT().PostInterchainEvent(gomock.Any()).AnyTimes()
 	mockStub.EXPECT().GetTxHash().Return(&types.Hash{}).AnyTimes()
+	mockStub.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(false).AnyTimes()
 	gomock.InOrder(f1, f2)
 
 	im := &InterchainManager{mockStub}
@@ -536,7 +1003,7 @@ func TestInterchainManager_HandleIBTP(t *testing.T) {
 		Type:      pb.IBTP_INTERCHAIN,
 		Timestamp: 0,
 		Proof:     nil,
-		Payload:   nil,
+		Payload:   mockIBTPPayload(t, "transfer"),
 		Version:   "",
 		Extra:     nil,
 	}
@@ -636,6 +1103,7 @@ func TestInterchainManager_HandleIBTPs(t *testing.T) {
 
 	mockStub.EXPECT().Caller().Return(caller).AnyTimes()
 	mockStub.EXPECT().Has(gomock.Any()).Return(true).AnyTimes()
+	mockStub.EXPECT().GetObject(pendingIBTPKey(caller, to, false), gomock.Any()).Return(false).AnyTimes()
 	mockStub.EXPECT().GetObject(gomock.Any(), gomock.Any()).Do(
 		func(key string, ret interface{}) bool {
 			assert.Equal(t, key, AppchainKey(caller))
@@ -670,7 +1138,7 @@ func TestInterchainManager_HandleIBTPs(t *testing.T) {
 		Type:      pb.IBTP_INTERCHAIN,
 		Timestamp: time.Now().UnixNano(),
 		Proof:     nil,
-		Payload:   nil,
+		Payload:   mockIBTPPayload(t, "transfer"),
 		Version:   "",
 	}
 
@@ -758,7 +1226,7 @@ func TestInterchainManager_HandleUnionIBTP(t *testing.T) {
 		Type:      pb.IBTP_INTERCHAIN,
 		Timestamp: 0,
 		Proof:     nil,
-		Payload:   nil,
+		Payload:   mockIBTPPayload(t, "transfer"),
 		Version:   "",
 		Extra:     nil,
 	}
@@ -860,6 +1328,199 @@ func TestInterchainManager_HandleUnionIBTP(t *testing.T) {
 	assert.True(t, res.Ok)
 }
 
+func TestVerifyMultiSign(t *testing.T) {
+	keys := make([]crypto.PrivateKey, 0, 4)
+	addrs := make([]string, 0, 4)
+	for i := 0; i < 4; i++ {
+		keyPair, err := asym.GenerateKeyPair(crypto.Secp256k1)
+		require.Nil(t, err)
+		keys = append(keys, keyPair)
+		address, err := keyPair.PublicKey().Address()
+		require.Nil(t, err)
+		addrs = append(addrs, address.String())
+	}
+
+	ibtp := &pb.IBTP{
+		From:    "relay-" + caller,
+		To:      caller,
+		Index:   1,
+		Type:    pb.IBTP_INTERCHAIN,
+		Payload: mockIBTPPayload(t, "transfer"),
+	}
+	signBy := func(signers ...int) []byte {
+		ibtpHash := ibtp.Hash()
+		hash := sha256.Sum256([]byte(ibtpHash.String()))
+		sign := &pb.SignResponse{Sign: make(map[string][]byte)}
+		for _, i := range signers {
+			signData, err := keys[i].Sign(hash[:])
+			require.Nil(t, err)
+			sign.Sign[addrs[i]] = signData
+		}
+		data, err := sign.Marshal()
+		require.Nil(t, err)
+		return data
+	}
+	relayChain := func(validators interface{}) *appchainMgr.Appchain {
+		data, err := json.Marshal(validators)
+		require.Nil(t, err)
+		return &appchainMgr.Appchain{ID: "relay", ChainType: appchainMgr.RelaychainType, Validators: string(data)}
+	}
+	weighted := func(policy ThresholdPolicy, threshold uint64, weights ...uint64) *BxhValidators {
+		bv := &BxhValidators{Policy: policy, Threshold: threshold}
+		for i, weight := range weights {
+			bv.Validators = append(bv.Validators, &RelayValidator{Address: addrs[i], Weight: weight})
+		}
+		return bv
+	}
+
+	// the legacy addresses weigh 1 each with the policy f+1
+	legacy := relayChain(&BxhValidators{Addresses: addrs})
+	ok, err := VerifyMultiSign(legacy, ibtp, signBy(0))
+	assert.False(t, ok)
+	assert.Equal(t, "multi signs verify fail, weight: 1, required: 2", err.Error())
+	ok, err = VerifyMultiSign(legacy, ibtp, signBy(0, 1))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	bft := relayChain(weighted(BftTwoFPlusOne, 0, 1, 1, 1, 1))
+	ok, err = VerifyMultiSign(bft, ibtp, signBy(0, 1))
+	assert.False(t, ok)
+	assert.NotNil(t, err)
+	ok, err = VerifyMultiSign(bft, ibtp, signBy(0, 1, 2))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// the weight of the first validator alone exceeds 2/3 of the total weight
+	heavy := relayChain(weighted(BftTwoFPlusOne, 0, 7, 1, 1, 1))
+	ok, err = VerifyMultiSign(heavy, ibtp, signBy(1, 2, 3))
+	assert.False(t, ok)
+	assert.Equal(t, "multi signs verify fail, weight: 3, required: 7", err.Error())
+	ok, err = VerifyMultiSign(heavy, ibtp, signBy(0))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	custom := relayChain(weighted(CustomThreshold, 4, 1, 2, 3, 4))
+	ok, err = VerifyMultiSign(custom, ibtp, signBy(0, 1))
+	assert.False(t, ok)
+	assert.NotNil(t, err)
+	ok, err = VerifyMultiSign(custom, ibtp, signBy(0, 2))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// signs of the validators out of the set are rejected
+	partial := relayChain(weighted(BftFPlusOne, 0, 1, 1, 1))
+	_, err = VerifyMultiSign(partial, ibtp, signBy(3))
+	assert.Equal(t, "wrong validator: "+addrs[3], err.Error())
+
+	_, err = VerifyMultiSign(relayChain(weighted(CustomThreshold, 11, 1, 2, 3, 4)), ibtp, signBy(0, 1, 2, 3))
+	assert.NotNil(t, err)
+	_, err = VerifyMultiSign(relayChain(weighted("bft_3f+1", 0, 1, 1, 1, 1)), ibtp, signBy(0, 1, 2, 3))
+	assert.NotNil(t, err)
+	_, err = VerifyMultiSign(relayChain(weighted(BftFPlusOne, 0, 1, 0)), ibtp, signBy(0))
+	assert.NotNil(t, err)
+	_, err = VerifyMultiSign(&appchainMgr.Appchain{ID: "relay"}, ibtp, signBy(0))
+	assert.Equal(t, "empty validators in relay chain:relay", err.Error())
+
+	// malformed addresses and overflowing weights are rejected before verifying
+	malformed := weighted(BftFPlusOne, 0, 1, 1)
+	malformed.Validators[1].Address = "0x1"
+	_, err = VerifyMultiSign(relayChain(malformed), ibtp, signBy(0))
+	assert.Equal(t, "invalid validators in relay chain relay: invalid validator address 0x1", err.Error())
+	_, err = ParseBxhValidators(`{"addresses":["relay"]}`)
+	assert.Equal(t, "invalid validator address relay", err.Error())
+	_, err = VerifyMultiSign(relayChain(weighted(BftTwoFPlusOne, 0, math.MaxUint64, 2)), ibtp, signBy(1))
+	assert.Equal(t, "invalid validators in relay chain relay: total weight of validators overflows", err.Error())
+}
+
+func TestAppchainManager_UpdateRelayValidators(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	addr1 := types.NewAddress([]byte{1}).String()
+	addr2 := types.NewAddress([]byte{2}).String()
+	validators := fmt.Sprintf(`{"validators":[{"address":"%s","weight":1},{"address":"%s","weight":1}]}`, addr1, addr2)
+	chain := &appchainMgr.Appchain{
+		ID:         caller,
+		Name:       "relay",
+		Status:     appchainMgr.AppchainAvailable,
+		ChainType:  appchainMgr.RelaychainType,
+		Validators: validators,
+	}
+	data, err := json.Marshal(chain)
+	assert.Nil(t, err)
+
+	state := map[string][]byte{AppchainKey(caller): data}
+	chainOf := func() *appchainMgr.Appchain {
+		c := &appchainMgr.Appchain{}
+		assert.Nil(t, json.Unmarshal(state[AppchainKey(caller)], c))
+		return c
+	}
+
+	var proposal []byte
+	mockStub.EXPECT().Caller().Return(caller).AnyTimes()
+	mockStub.EXPECT().Get(gomock.Any()).DoAndReturn(func(key string) (bool, []byte) {
+		v, ok := state[key]
+		return ok, v
+	}).AnyTimes()
+	mockStub.EXPECT().Has(gomock.Any()).DoAndReturn(func(key string) bool {
+		_, ok := state[key]
+		return ok
+	}).AnyTimes()
+	mockStub.EXPECT().GetObject(gomock.Any(), gomock.Any()).DoAndReturn(func(key string, ret interface{}) bool {
+		v, ok := state[key]
+		if ok {
+			assert.Nil(t, json.Unmarshal(v, ret))
+		}
+		return ok
+	}).AnyTimes()
+	mockStub.EXPECT().SetObject(gomock.Any(), gomock.Any()).Do(func(key string, value interface{}) {
+		v, err := json.Marshal(value)
+		assert.Nil(t, err)
+		state[key] = v
+	}).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(caller), pb.String(appchainMgr.EventUpdate), pb.String(string(AppchainMgr)), gomock.Any()).DoAndReturn(
+		func(addr, method string, args ...*pb.Arg) *boltvm.Response {
+			proposal = args[3].Value
+			return boltvm.Success([]byte("proposal"))
+		}).AnyTimes()
+
+	am := &AppchainManager{Stub: &callerMockStub{MockStub: mockStub, caller: constant.GovernanceContractAddr.Address().String()}}
+
+	updated := fmt.Sprintf(`{"validators":[{"address":"%s","weight":3},{"address":"%s","weight":1}],"policy":"custom","threshold":3}`, addr1, addr2)
+
+	// the validators of relay chain can not be updated directly
+	res := am.UpdateAppchain(updated, chain.ConsensusType, chain.ChainType, chain.Name, chain.Desc, chain.Version, chain.PublicKey)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "validators of relay chain can only be updated through governance", string(res.Result))
+
+	res = am.UpdateRelayValidators(fmt.Sprintf(`{"validators":[{"address":"%s","weight":1}],"policy":"custom","threshold":2}`, addr1))
+	assert.False(t, res.Ok)
+	res = am.UpdateRelayValidators(`{"validators":[{"address":"0x1","weight":1}]}`)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "invalid relay chain validators: invalid validator address 0x1", string(res.Result))
+	assert.Equal(t, validators, chainOf().Validators)
+
+	res = am.UpdateRelayValidators(updated)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "proposal", string(res.Result))
+	assert.Equal(t, appchainMgr.AppchainUpdating, chainOf().Status)
+	assert.Equal(t, validators, chainOf().Validators)
+
+	res = am.UpdateRelayValidators(updated)
+	assert.False(t, res.Ok)
+
+	res = am.Manager(appchainMgr.EventUpdate, string(APPOVED), proposal)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, appchainMgr.AppchainAvailable, chainOf().Status)
+	assert.Equal(t, updated, chainOf().Validators)
+
+	bv, err := ParseBxhValidators(chainOf().Validators)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), bv.TotalWeight())
+	assert.Equal(t, uint64(3), bv.RequiredWeight())
+}
+
 func TestRole_GetRole(t *testing.T) {
 	mockCtl := gomock.NewController(t)
 	mockStub := mock_stub.NewMockStub(mockCtl)
@@ -871,7 +1532,7 @@ func TestRole_GetRole(t *testing.T) {
 		},
 	}
 
-	mockStub.EXPECT().GetObject(adminRolesKey, gomock.Any()).SetArg(1, admins).AnyTimes()
+	mockStub.EXPECT().GetObject(AdminRolesKey, gomock.Any()).SetArg(1, admins).AnyTimes()
 	mockStub.EXPECT().Caller().Return(admins[0].Address)
 
 	im := &Role{mockStub}
@@ -905,7 +1566,7 @@ func TestRole_IsAdmin(t *testing.T) {
 		},
 	}
 
-	mockStub.EXPECT().GetObject(adminRolesKey, gomock.Any()).SetArg(1, admins).AnyTimes()
+	mockStub.EXPECT().GetObject(AdminRolesKey, gomock.Any()).SetArg(1, admins).AnyTimes()
 
 	im := &Role{mockStub}
 
@@ -933,7 +1594,7 @@ func TestRole_GetAdminRoles(t *testing.T) {
 		},
 	}
 
-	mockStub.EXPECT().GetObject(adminRolesKey, gomock.Any()).SetArg(1, admins).AnyTimes()
+	mockStub.EXPECT().GetObject(AdminRolesKey, gomock.Any()).SetArg(1, admins).AnyTimes()
 
 	im := &Role{mockStub}
 
@@ -949,24 +1610,84 @@ func TestRole_GetAdminRoles(t *testing.T) {
 	}
 }
 
-func TestRole_SetAdminRoles(t *testing.T) {
+// callerMockStub is a mock stub knowing the immediate caller of the contract
+type callerMockStub struct {
+	*mock_stub.MockStub
+	caller string
+}
+
+func (s *callerMockStub) CurrentCaller() string {
+	return s.caller
+}
+
+func TestRole_Manager(t *testing.T) {
 	mockCtl := gomock.NewController(t)
 	mockStub := mock_stub.NewMockStub(mockCtl)
+	stub := &callerMockStub{MockStub: mockStub, caller: constant.GovernanceContractAddr.Address().String()}
 
-	addrs := []string{types.NewAddress([]byte{0}).String(), types.NewAddress([]byte{1}).String()}
-	mockStub.EXPECT().SetObject(gomock.Any(), gomock.Any()).AnyTimes()
+	addr0 := types.NewAddress([]byte{0}).String()
+	addr1 := types.NewAddress([]byte{1}).String()
+	admins := []*repo.Admin{{Address: addr0, Weight: 1}}
 
-	im := &Role{mockStub}
+	mockStub.EXPECT().GetObject(AdminRolesKey, gomock.Any()).Do(func(key string, ret interface{}) bool {
+		data, err := json.Marshal(admins)
+		require.Nil(t, err)
+		require.Nil(t, json.Unmarshal(data, ret))
+		return true
+	}).Return(true).AnyTimes()
+	mockStub.EXPECT().SetObject(AdminRolesKey, gomock.Any()).Do(func(key string, value interface{}) {
+		admins = value.([]*repo.Admin)
+	}).AnyTimes()
+
+	im := &Role{stub}
 
-	data, err := json.Marshal(addrs)
+	add, err := json.Marshal(&repo.Admin{Address: addr1, Weight: 2})
+	assert.Nil(t, err)
+	update, err := json.Marshal(&repo.Admin{Address: addr1, Weight: 3})
+	assert.Nil(t, err)
+	remove, err := json.Marshal(&repo.Admin{Address: addr0})
 	assert.Nil(t, err)
 
-	res := im.SetAdminRoles(string(data))
-	assert.True(t, res.Ok)
-}
+	res := im.Manager(AdminAdd, string(APPOVED), []byte("admin"))
+	assert.False(t, res.Ok)
+	res = im.Manager(AdminAdd, string(REJECTED), add)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, 1, len(admins))
 
-func TestRole_GetRoleWeight(t *testing.T) {
-	mockCtl := gomock.NewController(t)
+	res = im.Manager(AdminAdd, string(APPOVED), add)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, []*repo.Admin{{Address: addr0, Weight: 1}, {Address: addr1, Weight: 2}}, admins)
+	res = im.Manager(AdminAdd, string(APPOVED), add)
+	assert.False(t, res.Ok)
+
+	res = im.Manager(AdminUpdateWeight, string(APPOVED), update)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, uint64(3), admins[1].Weight)
+
+	res = im.Manager(AdminRemove, string(APPOVED), remove)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, []*repo.Admin{{Address: addr1, Weight: 3}}, admins)
+	res = im.Manager(AdminRemove, string(APPOVED), remove)
+	assert.False(t, res.Ok)
+	res = im.Manager(AdminRemove, string(APPOVED), update)
+	assert.False(t, res.Ok, "the last admin can not be removed")
+
+	res = im.Manager("unknown", string(APPOVED), update)
+	assert.False(t, res.Ok)
+
+	// only the governance contract can change the admin set
+	stub.caller = addr1
+	res = im.AddAdmin(addr0, 1)
+	assert.False(t, res.Ok)
+	res = im.UpdateWeight(addr1, 1)
+	assert.False(t, res.Ok)
+	res = im.RemoveAdmin(addr1)
+	assert.False(t, res.Ok)
+	assert.Equal(t, []*repo.Admin{{Address: addr1, Weight: 3}}, admins)
+}
+
+func TestRole_GetRoleWeight(t *testing.T) {
+	mockCtl := gomock.NewController(t)
 	mockStub := mock_stub.NewMockStub(mockCtl)
 
 	admins := []*repo.Admin{
@@ -976,7 +1697,7 @@ func TestRole_GetRoleWeight(t *testing.T) {
 		},
 	}
 
-	mockStub.EXPECT().GetObject(adminRolesKey, gomock.Any()).SetArg(1, admins).AnyTimes()
+	mockStub.EXPECT().GetObject(AdminRolesKey, gomock.Any()).SetArg(1, admins).AnyTimes()
 
 	im := &Role{mockStub}
 
@@ -990,6 +1711,39 @@ func TestRole_GetRoleWeight(t *testing.T) {
 	assert.False(t, res.Ok)
 }
 
+// mockStubState backs the object accessors of the mock stub by a map
+func mockStubState(t *testing.T, mockStub *mock_stub.MockStub) map[string][]byte {
+	state := make(map[string][]byte)
+	mockStub.EXPECT().Get(gomock.Any()).DoAndReturn(func(key string) (bool, []byte) {
+		v, ok := state[key]
+		return ok, v
+	}).AnyTimes()
+	mockStub.EXPECT().GetObject(gomock.Any(), gomock.Any()).DoAndReturn(func(key string, ret interface{}) bool {
+		v, ok := state[key]
+		if !ok {
+			return false
+		}
+		assert.Nil(t, json.Unmarshal(v, ret))
+		return true
+	}).AnyTimes()
+	mockStub.EXPECT().SetObject(gomock.Any(), gomock.Any()).Do(func(key string, value interface{}) {
+		v, err := json.Marshal(value)
+		assert.Nil(t, err)
+		state[key] = v
+	}).AnyTimes()
+
+	return state
+}
+
+func mockStubRawState(mockStub *mock_stub.MockStub, state map[string][]byte) {
+	mockStub.EXPECT().Set(gomock.Any(), gomock.Any()).Do(func(key string, value []byte) {
+		state[key] = value
+	}).AnyTimes()
+	mockStub.EXPECT().Delete(gomock.Any()).Do(func(key string) {
+		delete(state, key)
+	}).AnyTimes()
+}
+
 func TestRuleManager_RegisterRule(t *testing.T) {
 	mockCtl := gomock.NewController(t)
 	mockStub := mock_stub.NewMockStub(mockCtl)
@@ -997,74 +1751,162 @@ func TestRuleManager_RegisterRule(t *testing.T) {
 	id0 := types.NewAddress([]byte{0}).String()
 	id1 := types.NewAddress([]byte{1}).String()
 
-	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(id0)).Return(boltvm.Success(nil))
+	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(id0)).Return(boltvm.Success(nil)).AnyTimes()
 	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(id1)).Return(boltvm.Error(""))
-	mockStub.EXPECT().SetObject(gomock.Any(), gomock.Any()).AnyTimes()
+	mockStubState(t, mockStub)
+	caller0 := mockStub.EXPECT().Caller().Return(id0).Times(2)
+	caller1 := mockStub.EXPECT().Caller().Return(id1).AnyTimes()
+	gomock.InOrder(caller0, caller1)
 
 	im := &RuleManager{mockStub}
 
 	addr := types.NewAddress([]byte{2}).String()
 	res := im.RegisterRule(id0, addr)
 	assert.True(t, res.Ok)
+	res = im.RegisterRule(id0, addr)
+	assert.False(t, res.Ok)
 
 	res = im.RegisterRule(id1, addr)
 	assert.False(t, res.Ok)
 	assert.Equal(t, "this appchain does not exist", string(res.Result))
+
+	// the rules of an appchain can only be registered by the appchain itself
+	res = im.RegisterRule(id0, types.NewAddress([]byte{3}).String())
+	assert.False(t, res.Ok)
+	assert.Equal(t, "caller is not the appchain", string(res.Result))
+
+	res = im.Rules(id0)
+	assert.True(t, res.Ok)
+	var rules []*Rule
+	assert.Nil(t, json.Unmarshal(res.Result, &rules))
+	assert.Equal(t, []*Rule{{Address: addr, Status: RuleRegistered}}, rules)
+
+	// a registered rule is not used before it is bound
+	res = im.GetRuleAddress(id0, "fabric")
+	assert.False(t, res.Ok)
 }
 
-func TestRuleManager_GetRuleAddress(t *testing.T) {
+func TestRuleManager_LegacyRule(t *testing.T) {
 	mockCtl := gomock.NewController(t)
 	mockStub := mock_stub.NewMockStub(mockCtl)
+	state := mockStubState(t, mockStub)
 
 	id0 := types.NewAddress([]byte{0}).String()
 	id1 := types.NewAddress([]byte{1}).String()
-	rule := Rule{
-		Address: "123",
-		Status:  1,
-	}
-
-	mockStub.EXPECT().GetObject(RuleKey(id0), gomock.Any()).SetArg(1, rule).Return(true)
-	mockStub.EXPECT().GetObject(RuleKey(id1), gomock.Any()).Return(false).MaxTimes(5)
+	addr := types.NewAddress([]byte{2}).String()
+	legacy, err := json.Marshal(&legacyRule{Address: addr})
+	assert.Nil(t, err)
+	state[RuleKey(id0)] = legacy
 
 	im := &RuleManager{mockStub}
 
-	res := im.GetRuleAddress(id0, "")
+	// the rule stored before rules are versioned is bound
+	res := im.GetRuleAddress(id0, "ethereum")
+	assert.True(t, res.Ok)
+	assert.Equal(t, addr, string(res.Result))
+	res = im.Rules(id0)
 	assert.True(t, res.Ok)
-	assert.Equal(t, rule.Address, string(res.Result))
+	var rules []*Rule
+	assert.Nil(t, json.Unmarshal(res.Result, &rules))
+	assert.Equal(t, []*Rule{{Address: addr, Status: RuleBound}}, rules)
 
+	// fabric appchains registering no rule use the default fabric rule
 	res = im.GetRuleAddress(id1, "fabric")
 	assert.True(t, res.Ok)
 	assert.Equal(t, validator.FabricRuleAddr, string(res.Result))
-
-	res = im.GetRuleAddress(id1, "hyperchain")
+	res = im.GetRuleAddress(id1, "ethereum")
 	assert.False(t, res.Ok)
-	assert.Equal(t, "", string(res.Result))
 }
 
-func TestRuleManager_Audit(t *testing.T) {
+func TestRuleManager_Manager(t *testing.T) {
 	mockCtl := gomock.NewController(t)
 	mockStub := mock_stub.NewMockStub(mockCtl)
+	stub := &governanceMockStub{heightMockStub: &heightMockStub{MockStub: mockStub, height: 10}}
 
 	id0 := types.NewAddress([]byte{0}).String()
-	id1 := types.NewAddress([]byte{1}).String()
-	rule := Rule{
-		Address: "123",
-		Status:  1,
+	addr0 := types.NewAddress([]byte{2}).String()
+	addr1 := types.NewAddress([]byte{3}).String()
+	addr2 := types.NewAddress([]byte{4}).String()
+
+	mockStub.EXPECT().Caller().Return(id0).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", gomock.Any()).Return(boltvm.Success(nil)).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(id0), pb.String(RuleBind), pb.String(string(RuleMgr)), gomock.Any()).Return(boltvm.Success([]byte("proposal"))).AnyTimes()
+	mockStubState(t, mockStub)
+
+	im := &RuleManager{stub}
+	extra := func(addr string) []byte {
+		data, err := json.Marshal(&ruleProposal{ChainID: id0, Address: addr})
+		assert.Nil(t, err)
+		return data
+	}
+	statusOf := func(addr string) RuleStatus {
+		var rules []*Rule
+		assert.True(t, stub.GetObject(RuleKey(id0), &rules))
+		return findRule(rules, addr).Status
 	}
 
-	mockStub.EXPECT().GetObject(RuleKey(id0), gomock.Any()).SetArg(1, rule).Return(true)
-	mockStub.EXPECT().GetObject(RuleKey(id1), gomock.Any()).Return(false)
-	mockStub.EXPECT().SetObject(gomock.Any(), gomock.Any()).AnyTimes()
-	mockStub.EXPECT().GetObject("audit-record-"+id0, gomock.Any()).SetArg(1, []*ruleRecord{}).Return(true).AnyTimes()
-
-	im := &RuleManager{mockStub}
+	for _, addr := range []string{addr0, addr1, addr2} {
+		assert.True(t, im.RegisterRule(id0, addr).Ok)
+	}
 
-	res := im.Audit(id1, 0, "")
+	res := im.BindRule(types.NewAddress([]byte{5}).String(), addr0)
+	assert.False(t, res.Ok)
+	res = im.BindRule(id0, addr0)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "proposal", string(res.Result))
+	assert.Equal(t, RuleBinding, statusOf(addr0))
+	res = im.BindRule(id0, addr1)
+	assert.False(t, res.Ok)
+	res = (&RuleManager{stub.heightMockStub}).Manager(RuleBind, string(APPOVED), extra(addr0))
+	assert.False(t, res.Ok)
+	res = im.Manager("unbind", string(APPOVED), extra(addr0))
+	assert.False(t, res.Ok)
+	res = im.Manager(RuleBind, string(APPOVED), extra(addr1))
 	assert.False(t, res.Ok)
-	assert.Equal(t, "this rule does not exist", string(res.Result))
 
-	res = im.Audit(id0, 1, "approve")
+	// the rule is bound at height 10 and verifies IBTPs from height 11
+	res = im.Manager(RuleBind, string(APPOVED), extra(addr0))
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, RuleBound, statusOf(addr0))
+	res = im.GetRuleAddress(id0, "")
 	assert.True(t, res.Ok)
+	assert.Equal(t, addr0, string(res.Result))
+
+	stub.height = 20
+	assert.True(t, im.BindRule(id0, addr1).Ok)
+	res = im.Manager(RuleBind, string(REJECTED), extra(addr1))
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, RuleRegistered, statusOf(addr1))
+
+	assert.True(t, im.BindRule(id0, addr1).Ok)
+	res = im.Manager(RuleBind, string(APPOVED), extra(addr1))
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, RuleUnbound, statusOf(addr0))
+	assert.Equal(t, RuleBound, statusOf(addr1))
+	res = im.GetRuleAddress(id0, "")
+	assert.Equal(t, addr1, string(res.Result))
+
+	// bound rules can not be deprecated
+	assert.False(t, im.DeprecateRule(id0, addr1).Ok)
+	assert.True(t, im.DeprecateRule(id0, addr2).Ok)
+	assert.Equal(t, RuleDeprecated, statusOf(addr2))
+	assert.False(t, im.BindRule(id0, addr2).Ok)
+
+	history := func(begin, end uint64) []*RuleBindingRecord {
+		res := im.GetRuleHistory(id0, begin, end)
+		assert.True(t, res.Ok, string(res.Result))
+		var records []*RuleBindingRecord
+		assert.Nil(t, json.Unmarshal(res.Result, &records))
+		return records
+	}
+	record0 := &RuleBindingRecord{Address: addr0, BeginHeight: 11, EndHeight: 20}
+	record1 := &RuleBindingRecord{Address: addr1, BeginHeight: 21}
+	assert.Equal(t, []*RuleBindingRecord{}, history(1, 10))
+	assert.Equal(t, []*RuleBindingRecord{record0}, history(1, 11))
+	assert.Equal(t, []*RuleBindingRecord{record0, record1}, history(20, 21))
+	assert.Equal(t, []*RuleBindingRecord{record1}, history(21, 0))
+	assert.False(t, im.GetRuleHistory(id0, 2, 1).Ok)
 }
 
 func TestStore_Get(t *testing.T) {
@@ -1107,10 +1949,18 @@ func TestTransactionManager_Begin(t *testing.T) {
 
 	id := types.NewHash([]byte{0}).String()
 	mockStub.EXPECT().AddObject(fmt.Sprintf("%s-%s", PREFIX, id), pb.TransactionStatus_BEGIN)
+	mockStub.EXPECT().AddObject(fmt.Sprintf("timeout-%s-%s", PREFIX, id), uint64(100))
+	mockStub.EXPECT().SetObject(txRecordKey(id), gomock.Any())
+	mockStub.EXPECT().GetObject(TxTimeoutKey(100), gomock.Any()).Return(false)
+	mockStub.EXPECT().SetObject(TxTimeoutKey(100), []string{id})
+	mockStub.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(false).Times(8)
+	mockStub.EXPECT().Set(gomock.Any(), []byte(id)).Times(8)
+	mockStub.EXPECT().SetObject(gomock.Any(), uint64(1)).Times(8)
+	mockStub.EXPECT().SetObject(txStatusSeqKey(id), []uint64{0, 0, 0, 0})
 
 	im := &TransactionManager{mockStub}
 
-	res := im.Begin(id)
+	res := im.Begin(id, 100)
 	assert.True(t, res.Ok)
 }
 
@@ -1123,6 +1973,9 @@ func TestTransactionManager_Report(t *testing.T) {
 	txInfoKey := fmt.Sprintf("%s-%s", PREFIX, id0)
 
 	im := &TransactionManager{mockStub}
+	mockStub.EXPECT().Has(gomock.Any()).Return(false).AnyTimes()
+	mockStub.EXPECT().GetObject(fmt.Sprintf("timeout-%s-%s", PREFIX, id0), gomock.Any()).Return(false).AnyTimes()
+	mockStub.EXPECT().GetObject(txRecordKey(id0), gomock.Any()).Return(false).AnyTimes()
 
 	mockStub.EXPECT().GetObject(txInfoKey, gomock.Any()).SetArg(1, pb.TransactionStatus_SUCCESS).Return(true)
 	res := im.Report(id0, 0)
@@ -1270,24 +2123,237 @@ func TestTransactionManager_BeginMultiTXs(t *testing.T) {
 	im := &TransactionManager{mockStub}
 
 	mockStub.EXPECT().Has(txInfoKey).Return(true).MaxTimes(1)
-	res := im.BeginMultiTXs(globalId, id0, id1)
+	res := im.BeginMultiTXs(globalId, 100, id0, id1)
 	assert.False(t, res.Ok)
 	assert.Equal(t, "Transaction id already exists", string(res.Result))
 
 	mockStub.EXPECT().Has(txInfoKey).Return(false).AnyTimes()
 	mockStub.EXPECT().Set(id0, []byte(globalId))
 	mockStub.EXPECT().Set(id1, []byte(globalId))
+	mockStub.EXPECT().SetObject(txRecordKey(id0), gomock.Any())
+	mockStub.EXPECT().SetObject(txRecordKey(id1), gomock.Any())
+	mockStub.EXPECT().GetObject(TxTimeoutKey(100), gomock.Any()).Return(false).Times(2)
+	mockStub.EXPECT().SetObject(TxTimeoutKey(100), gomock.Any()).Times(2)
+	mockStub.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(false).Times(16)
+	mockStub.EXPECT().Set(gomock.Any(), []byte(id0)).Times(8)
+	mockStub.EXPECT().Set(gomock.Any(), []byte(id1)).Times(8)
+	mockStub.EXPECT().SetObject(gomock.Any(), uint64(1)).Times(16)
+	mockStub.EXPECT().SetObject(txStatusSeqKey(id0), []uint64{0, 0, 0, 0})
+	mockStub.EXPECT().SetObject(txStatusSeqKey(id1), []uint64{0, 0, 0, 0})
 	txInfo := TransactionInfo{
-		GlobalState: pb.TransactionStatus_BEGIN,
-		ChildTxInfo: make(map[string]pb.TransactionStatus),
+		GlobalState:   pb.TransactionStatus_BEGIN,
+		ChildTxInfo:   make(map[string]pb.TransactionStatus),
+		TimeoutHeight: 100,
 	}
 	txInfo.ChildTxInfo[id0] = pb.TransactionStatus_BEGIN
 	txInfo.ChildTxInfo[id1] = pb.TransactionStatus_BEGIN
 	mockStub.EXPECT().SetObject(globalInfoKey, txInfo)
-	res = im.BeginMultiTXs(globalId, id0, id1)
+	res = im.BeginMultiTXs(globalId, 100, id0, id1)
 	assert.True(t, res.Ok)
 }
 
+func TestTransactionManager_Rollback(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+	state := mockStubState(t, mockStub)
+	mockStub.EXPECT().AddObject(gomock.Any(), gomock.Any()).Do(func(key string, value interface{}) {
+		v, err := json.Marshal(value)
+		assert.Nil(t, err)
+		state[key] = v
+	}).AnyTimes()
+	mockStub.EXPECT().Set(gomock.Any(), gomock.Any()).Do(func(key string, value []byte) {
+		state[key] = value
+	}).AnyTimes()
+	mockStub.EXPECT().Get(gomock.Any()).DoAndReturn(func(key string) (bool, []byte) {
+		v, ok := state[key]
+		return ok, v
+	}).AnyTimes()
+	mockStub.EXPECT().Delete(gomock.Any()).Do(func(key string) {
+		delete(state, key)
+	}).AnyTimes()
+	mockStub.EXPECT().Has(gomock.Any()).DoAndReturn(func(key string) bool {
+		_, ok := state[key]
+		return ok
+	}).AnyTimes()
+	timeouts := func() []string {
+		var ids []string
+		if data, ok := state[TxTimeoutKey(20)]; ok {
+			assert.Nil(t, json.Unmarshal(data, &ids))
+		}
+		return ids
+	}
+
+	stub := &heightMockStub{MockStub: mockStub, height: 10}
+	tm := &TransactionManager{stub}
+
+	res := tm.Begin("id0", 20)
+	assert.True(t, res.Ok)
+	res = tm.Begin("id1", 20)
+	assert.True(t, res.Ok)
+	res = tm.BeginMultiTXs("global", 20, "id2", "id3")
+	assert.True(t, res.Ok)
+	assert.Equal(t, []string{"id0", "id1", "id2", "id3"}, timeouts())
+
+	res = tm.Rollback("id0")
+	assert.False(t, res.Ok)
+	assert.Equal(t, "transaction with Id id0 does not time out until height 20", string(res.Result))
+	res = tm.Report("id1", 0)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, []string{"id0", "id2", "id3"}, timeouts())
+
+	stub.height = 21
+	res = tm.Report("id0", 0)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "transaction with Id id0 timed out at height 20", string(res.Result))
+	res = tm.Report("id2", 0)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "transaction with Id id2 timed out at height 20", string(res.Result))
+
+	res = tm.Rollback("id1")
+	assert.False(t, res.Ok)
+	assert.Equal(t, "transaction with Id id1 is not waiting for receipt", string(res.Result))
+	res = tm.Rollback("id0")
+	assert.True(t, res.Ok, string(res.Result))
+	res = tm.GetStatus("id0")
+	assert.True(t, res.Ok)
+	assert.Equal(t, strconv.Itoa(int(pb.TransactionStatus_FAILURE)), string(res.Result))
+	res = tm.IsRolledBack("id0")
+	assert.True(t, res.Ok)
+	assert.Equal(t, "true", string(res.Result))
+	res = tm.IsRolledBack("id1")
+	assert.True(t, res.Ok)
+	assert.Equal(t, "false", string(res.Result))
+	res = tm.Report("id0", 0)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "transaction with Id id0 has been rolled back", string(res.Result))
+	res = tm.Rollback("id0")
+	assert.False(t, res.Ok)
+
+	res = tm.Rollback("id2")
+	assert.True(t, res.Ok, string(res.Result))
+	res = tm.GetStatus("global")
+	assert.True(t, res.Ok)
+	assert.Equal(t, strconv.Itoa(int(pb.TransactionStatus_FAILURE)), string(res.Result))
+	res = tm.Report("id3", 0)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "transaction with global Id global has been rolled back", string(res.Result))
+	res = tm.Rollback("id3")
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Nil(t, timeouts())
+}
+
+func TestTransactionManager_ListTransactions(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+	state := mockStubState(t, mockStub)
+	mockStub.EXPECT().AddObject(gomock.Any(), gomock.Any()).Do(func(key string, value interface{}) {
+		v, err := json.Marshal(value)
+		assert.Nil(t, err)
+		state[key] = v
+	}).AnyTimes()
+	mockStub.EXPECT().Set(gomock.Any(), gomock.Any()).Do(func(key string, value []byte) {
+		state[key] = value
+	}).AnyTimes()
+	mockStub.EXPECT().Get(gomock.Any()).DoAndReturn(func(key string) (bool, []byte) {
+		v, ok := state[key]
+		return ok, v
+	}).AnyTimes()
+	mockStub.EXPECT().Delete(gomock.Any()).Do(func(key string) {
+		delete(state, key)
+	}).AnyTimes()
+	mockStub.EXPECT().Has(gomock.Any()).Return(false).AnyTimes()
+
+	chain0 := types.NewAddress([]byte{0}).String()
+	chain1 := types.NewAddress([]byte{1}).String()
+	chain2 := types.NewAddress([]byte{2}).String()
+	txID := func(from, to string, index uint64) string {
+		return fmt.Sprintf("%s-%s-%d", from, to, index)
+	}
+
+	stub := &heightMockStub{MockStub: mockStub, height: 10}
+	tm := &TransactionManager{stub}
+
+	list := func(from, to, status string, offset, limit uint64) *InterchainTxPage {
+		res := tm.ListTransactions(from, to, status, offset, limit)
+		assert.True(t, res.Ok, string(res.Result))
+		page := &InterchainTxPage{}
+		assert.Nil(t, json.Unmarshal(res.Result, page))
+		return page
+	}
+	ids := func(page *InterchainTxPage) []string {
+		ret := make([]string, 0, len(page.Txs))
+		for _, tx := range page.Txs {
+			ret = append(ret, tx.Id)
+		}
+		return ret
+	}
+
+	assert.Equal(t, uint64(0), list("", "", "", 0, 0).Total)
+
+	assert.True(t, tm.Begin(txID(chain0, chain1, 1), 20).Ok)
+	stub.height = 11
+	assert.True(t, tm.Begin(txID(chain0, chain1, 2), 20).Ok)
+	assert.True(t, tm.Begin(txID(chain1, chain0, 1), 20).Ok)
+	stub.height = 12
+	assert.True(t, tm.BeginMultiTXs("global", 20, txID(chain0, chain1, 3), txID(chain0, chain2, 1)).Ok)
+
+	page := list(chain0, "", "", 0, 0)
+	assert.Equal(t, uint64(4), page.Total)
+	assert.Equal(t, []string{txID(chain0, chain1, 1), txID(chain0, chain1, 2), txID(chain0, chain1, 3), txID(chain0, chain2, 1)}, ids(page))
+	assert.Equal(t, chain0, page.Txs[0].From)
+	assert.Equal(t, chain1, page.Txs[0].To)
+	assert.Equal(t, uint64(10), page.Txs[0].BeginHeight)
+	assert.Equal(t, uint64(20), page.Txs[0].TimeoutHeight)
+	assert.Equal(t, "global", page.Txs[3].GlobalId)
+
+	page = list(chain0, "", "", 1, 2)
+	assert.Equal(t, uint64(4), page.Total)
+	assert.Equal(t, []string{txID(chain0, chain1, 2), txID(chain0, chain1, 3)}, ids(page))
+	page = list(chain0, "", "", 4, 2)
+	assert.Equal(t, uint64(4), page.Total)
+	assert.Equal(t, 0, len(page.Txs))
+
+	assert.Equal(t, []string{txID(chain0, chain1, 1), txID(chain0, chain1, 2), txID(chain0, chain1, 3)}, ids(list(chain0, chain1, "", 0, 0)))
+	assert.Equal(t, []string{txID(chain1, chain0, 1)}, ids(list("", chain0, "", 0, 0)))
+	assert.Equal(t, uint64(5), list("", "", "begin", 0, 0).Total)
+
+	assert.True(t, tm.Report(txID(chain0, chain1, 1), 0).Ok)
+	assert.True(t, tm.Report(txID(chain0, chain1, 3), 1).Ok)
+	stub.height = 21
+	assert.True(t, tm.Rollback(txID(chain0, chain1, 2)).Ok)
+
+	page = list(chain0, chain1, "", 0, 0)
+	assert.Equal(t, pb.TransactionStatus_SUCCESS, page.Txs[0].Status)
+	assert.Equal(t, pb.TransactionStatus_FAILURE, page.Txs[1].Status)
+	assert.True(t, page.Txs[1].RolledBack)
+	assert.Equal(t, pb.TransactionStatus_FAILURE, page.Txs[2].Status)
+	assert.False(t, page.Txs[2].RolledBack)
+
+	// the finished transactions are replaced by the last ones of the begin index
+	page = list("", "", "BEGIN", 0, 0)
+	assert.Equal(t, uint64(2), page.Total)
+	assert.Equal(t, []string{txID(chain0, chain2, 1), txID(chain1, chain0, 1)}, ids(page))
+	assert.Equal(t, []string{txID(chain1, chain0, 1)}, ids(list("", "", "begin", 1, 1)))
+	assert.Equal(t, []string{txID(chain0, chain1, 1)}, ids(list("", "", "success", 0, 0)))
+	assert.Equal(t, []string{txID(chain0, chain1, 3), txID(chain0, chain1, 2)}, ids(list("", "", "failure", 0, 0)))
+
+	assert.Equal(t, []string{txID(chain0, chain2, 1)}, ids(list(chain0, "", "begin", 0, 0)))
+	assert.Equal(t, []string{txID(chain1, chain0, 1)}, ids(list("", chain0, "begin", 0, 0)))
+	assert.Equal(t, uint64(0), list(chain0, chain1, "begin", 0, 0).Total)
+	assert.Equal(t, uint64(0), list(chain1, "", "failure", 0, 0).Total)
+	page = list(chain0, chain1, "failure", 0, 1)
+	assert.Equal(t, uint64(2), page.Total)
+	assert.Equal(t, []string{txID(chain0, chain1, 3)}, ids(page))
+	assert.Equal(t, []string{txID(chain0, chain1, 2)}, ids(list(chain0, chain1, "failure", 1, 1)))
+
+	res := tm.ListTransactions("", "", "unknown", 0, 0)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "illegal transaction status unknown", string(res.Result))
+	res = tm.ListTransactions("", "", "", 0, MaxTxListLimit+1)
+	assert.False(t, res.Ok)
+	assert.Equal(t, fmt.Sprintf("limit %d exceeds the max limit %d", MaxTxListLimit+1, MaxTxListLimit), string(res.Result))
+}
+
 func TestAssetExchange_Init(t *testing.T) {
 	mockCtl := gomock.NewController(t)
 	mockStub := mock_stub.NewMockStub(mockCtl)
@@ -1295,7 +2361,7 @@ func TestAssetExchange_Init(t *testing.T) {
 	from := types.NewAddress([]byte{0}).String()
 	to := types.NewAddress([]byte{1}).String()
 
-	ae := &AssetExchange{mockStub}
+	ae := &AssetExchange{&heightMockStub{MockStub: mockStub, height: 10}}
 
 	res := ae.Init(from, to, []byte{1})
 	assert.False(t, res.Ok)
@@ -1317,7 +2383,7 @@ func TestAssetExchange_Init(t *testing.T) {
 	assert.False(t, res.Ok)
 	assert.Equal(t, "asset exhcange id already exists", string(res.Result))
 
-	mockStub.EXPECT().Has(AssetExchangeKey(aei.Id)).Return(false).AnyTimes()
+	mockStub.EXPECT().Has(gomock.Any()).Return(false).AnyTimes()
 	res = ae.Init(from, to, info)
 	assert.False(t, res.Ok)
 	assert.Equal(t, "illegal asset exchange info", string(res.Result))
@@ -1326,121 +2392,259 @@ func TestAssetExchange_Init(t *testing.T) {
 	info, err = aei.Marshal()
 	assert.Nil(t, err)
 
-	aer := AssetExchangeRecord{
-		Chain0: from,
-		Chain1: to,
-		Status: AssetExchangeInit,
-		Info:   aei,
-	}
-	mockStub.EXPECT().SetObject(AssetExchangeKey(aei.Id), aer)
+	state := mockStubState(t, mockStub)
+	mockStubRawState(mockStub, state)
 	res = ae.Init(from, to, info)
 	assert.True(t, res.Ok)
+
+	aer := AssetExchangeRecord{}
+	assert.Nil(t, json.Unmarshal(state[AssetExchangeKey(aei.Id)], &aer))
+	assert.Equal(t, AssetExchangeRecord{
+		Chain0:       from,
+		Chain1:       to,
+		Status:       AssetExchangeInit,
+		Info:         aei,
+		ExpiryHeight: 10 + DefaultAssetExchangeTimeout,
+	}, aer)
+
+	lock, err := json.Marshal(&AssetExchangeLock{Info: info, HashLock: "abc", Timeout: 5})
+	assert.Nil(t, err)
+	res = ae.Init(from, to, lock)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "invalid hash lock abc", string(res.Result))
+
+	hash := sha256.Sum256([]byte("secret"))
+	aei.Id = "456"
+	info, err = aei.Marshal()
+	assert.Nil(t, err)
+	lock, err = json.Marshal(&AssetExchangeLock{Info: info, HashLock: hex.EncodeToString(hash[:]), Timeout: 5})
+	assert.Nil(t, err)
+	res = ae.Init(from, to, lock)
+	assert.True(t, res.Ok, string(res.Result))
+
+	assert.Nil(t, json.Unmarshal(state[AssetExchangeKey(aei.Id)], &aer))
+	assert.Equal(t, hex.EncodeToString(hash[:]), aer.HashLock)
+	assert.Equal(t, uint64(15), aer.ExpiryHeight)
+
+	aei.Id = "789"
+	info, err = aei.Marshal()
+	assert.Nil(t, err)
+	lock, err = json.Marshal(&AssetExchangeLock{Info: info, Timeout: MaxAssetExchangeTimeout + 1})
+	assert.Nil(t, err)
+	res = ae.Init(from, to, lock)
+	assert.False(t, res.Ok)
+	assert.Equal(t, fmt.Sprintf("timeout %d exceeds the max timeout %d", MaxAssetExchangeTimeout+1, MaxAssetExchangeTimeout), string(res.Result))
+
+	res = ae.OpenExchanges(to, 0, 0)
+	assert.True(t, res.Ok, string(res.Result))
+	var records []*AssetExchangeRecord
+	assert.Nil(t, json.Unmarshal(res.Result, &records))
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, "123", records[0].Info.Id)
+	assert.Equal(t, "456", records[1].Info.Id)
+
+	res = ae.OpenExchanges(to, 1, 1)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Nil(t, json.Unmarshal(res.Result, &records))
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "456", records[0].Info.Id)
+
+	res = ae.OpenExchanges(to, 0, MaxOpenExchangesPerQuery+1)
+	assert.False(t, res.Ok)
+	assert.Equal(t, fmt.Sprintf("query %d records exceeds the max limit %d", MaxOpenExchangesPerQuery+1, MaxOpenExchangesPerQuery), string(res.Result))
+
+	// the last open exchange takes the place of the closed one
+	ae.removeOpenExchange(to, "123")
+	res = ae.OpenExchanges(to, 0, 0)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Nil(t, json.Unmarshal(res.Result, &records))
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "456", records[0].Info.Id)
+	assert.Nil(t, state[assetOpenEntryKey(to, 1)])
+
+	res = ae.OpenExchanges(from, 0, 0)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Nil(t, json.Unmarshal(res.Result, &records))
+	assert.Equal(t, 2, len(records))
 }
 
-func TestAssetExchange_Redeem(t *testing.T) {
+func prepareAssetExchange(t *testing.T, height uint64, hashLock string) (*AssetExchange, *heightMockStub, map[string][]byte) {
 	mockCtl := gomock.NewController(t)
 	mockStub := mock_stub.NewMockStub(mockCtl)
+	state := mockStubState(t, mockStub)
+	mockStubRawState(mockStub, state)
+	stub := &heightMockStub{MockStub: mockStub, height: height}
 
 	from := types.NewAddress([]byte{0}).String()
 	to := types.NewAddress([]byte{1}).String()
-
-	ae := &AssetExchange{mockStub}
-
-	aei := pb.AssetExchangeInfo{
-		Id:            "123",
-		SenderOnSrc:   "aliceSrc",
-		ReceiverOnSrc: "bobSrc",
-		AssetOnSrc:    10,
-		SenderOnDst:   "bobDst",
-		ReceiverOnDst: "aliceDst",
-		AssetOnDst:    100,
-	}
-
 	aer := AssetExchangeRecord{
 		Chain0: from,
 		Chain1: to,
-		Status: AssetExchangeRedeem,
-		Info:   aei,
+		Status: AssetExchangeInit,
+		Info: pb.AssetExchangeInfo{
+			Id:            "123",
+			SenderOnSrc:   "aliceSrc",
+			ReceiverOnSrc: "bobSrc",
+			AssetOnSrc:    10,
+			SenderOnDst:   "bobDst",
+			ReceiverOnDst: "aliceDst",
+			AssetOnDst:    100,
+		},
+		HashLock:     hashLock,
+		ExpiryHeight: 20,
 	}
 
-	mockStub.EXPECT().GetObject(AssetExchangeKey(aei.Id), gomock.Any()).Return(false).MaxTimes(1)
-	res := ae.Redeem(from, to, []byte(aei.Id))
+	ae := &AssetExchange{stub}
+	ae.SetObject(AssetExchangeKey(aer.Info.Id), aer)
+	ae.addOpenExchange(from, aer.Info.Id)
+	ae.addOpenExchange(to, aer.Info.Id)
+
+	return ae, stub, state
+}
+
+func TestAssetExchange_Redeem(t *testing.T) {
+	from := types.NewAddress([]byte{0}).String()
+	to := types.NewAddress([]byte{1}).String()
+	secret := []byte("secret")
+	hash := sha256.Sum256(secret)
+
+	ae, stub, state := prepareAssetExchange(t, 10, hex.EncodeToString(hash[:]))
+
+	res := ae.Redeem(to, from, []byte("456"))
 	assert.False(t, res.Ok)
 	assert.Equal(t, "asset exchange record does not exist", string(res.Result))
 
-	mockStub.EXPECT().GetObject(AssetExchangeKey(aei.Id), gomock.Any()).SetArg(1, aer).Return(true).MaxTimes(1)
-	res = ae.Redeem(from, to, []byte(aei.Id))
+	res = ae.Redeem(to, to, []byte("123"))
+	assert.False(t, res.Ok)
+	assert.Equal(t, "invalid participator of asset exchange id 123", string(res.Result))
+
+	res = ae.Redeem(from, to, []byte("123"))
+	assert.False(t, res.Ok)
+	assert.Equal(t, fmt.Sprintf("asset exchange 123 can only be redeemed by the counter chain %s", to), string(res.Result))
+
+	res = ae.Redeem(to, from, []byte("123"))
+	assert.False(t, res.Ok)
+	assert.Equal(t, "preimage of the hash lock is required", string(res.Result))
+
+	proof, err := json.Marshal(&AssetExchangeProof{Id: "123", Preimage: hex.EncodeToString([]byte("wrong"))})
+	assert.Nil(t, err)
+	res = ae.Redeem(to, from, proof)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "preimage does not match the hash lock", string(res.Result))
+
+	proof, err = json.Marshal(&AssetExchangeProof{Id: "123", Preimage: hex.EncodeToString(secret)})
+	assert.Nil(t, err)
+	stub.height = 21
+	res = ae.Redeem(to, from, proof)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "asset exchange 123 expired at height 20", string(res.Result))
+
+	stub.height = 20
+	res = ae.Redeem(to, from, proof)
+	assert.True(t, res.Ok, string(res.Result))
+
+	aer := AssetExchangeRecord{}
+	assert.Nil(t, json.Unmarshal(state[AssetExchangeKey("123")], &aer))
+	assert.Equal(t, AssetExchangeRedeem, aer.Status)
+	res = ae.OpenExchanges(from, 0, 0)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "[]", string(res.Result))
+	assert.Nil(t, state[assetOpenPosKey("123")])
+
+	res = ae.Redeem(to, from, proof)
 	assert.False(t, res.Ok)
 	assert.Equal(t, "asset exchange status for this id is not 'Init'", string(res.Result))
 
-	aer.Status = AssetExchangeInit
-	mockStub.EXPECT().GetObject(AssetExchangeKey(aei.Id), gomock.Any()).SetArg(1, aer).Return(true).AnyTimes()
-	res = ae.Redeem(to, to, []byte(aei.Id))
+	// the exchange without hash lock is redeemed with the proof of the lock
+	ae, stub, state = prepareAssetExchange(t, 10, "")
+	mockEngine := mock_validator.NewMockEngine(gomock.NewController(t))
+	chainData, err := json.Marshal(&appchainMgr.Appchain{ID: to, ChainType: "fabric", Validators: "validators"})
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(state[AssetExchangeKey("123")], &aer))
+	info, err := aer.Info.Marshal()
+	assert.Nil(t, err)
+	stub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(to)).Return(boltvm.Success(chainData)).AnyTimes()
+	stub.EXPECT().CrossInvoke(constant.RuleManagerContractAddr.String(), "GetRuleAddress", pb.String(to), pb.String("fabric")).Return(boltvm.Success([]byte("rule"))).AnyTimes()
+	stub.EXPECT().ValidationEngine().Return(mockEngine).AnyTimes()
+	wrongV := mockEngine.EXPECT().Validate("rule", to, []byte("wrong"), info, "validators").Return(false, nil)
+	lockV := mockEngine.EXPECT().Validate("rule", to, []byte("lock"), info, "validators").Return(true, nil)
+	gomock.InOrder(wrongV, lockV)
+
+	res = ae.Redeem(to, from, []byte("123"))
 	assert.False(t, res.Ok)
-	assert.Equal(t, fmt.Sprintf("invalid participator of asset exchange id %s", aei.Id), string(res.Result))
+	assert.Equal(t, "proof of the counter chain lock is required", string(res.Result))
 
-	expAer := AssetExchangeRecord{
-		Chain0: from,
-		Chain1: to,
-		Status: AssetExchangeRedeem,
-		Info:   aei,
-	}
-	mockStub.EXPECT().SetObject(AssetExchangeKey(aei.Id), expAer)
-	res = ae.Redeem(from, to, []byte(aei.Id))
-	assert.True(t, res.Ok)
-}
+	proof, err = json.Marshal(&AssetExchangeProof{Id: "123", Proof: []byte("wrong")})
+	assert.Nil(t, err)
+	res = ae.Redeem(to, from, proof)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "invalid proof of the counter chain lock", string(res.Result))
 
-func TestAssetExchange_Refund(t *testing.T) {
-	mockCtl := gomock.NewController(t)
-	mockStub := mock_stub.NewMockStub(mockCtl)
+	proof, err = json.Marshal(&AssetExchangeProof{Id: "123", Proof: []byte("lock")})
+	assert.Nil(t, err)
+	res = ae.Redeem(to, from, proof)
+	assert.True(t, res.Ok, string(res.Result))
+}
 
+func TestAssetExchange_LegacyExpiry(t *testing.T) {
 	from := types.NewAddress([]byte{0}).String()
 	to := types.NewAddress([]byte{1}).String()
 
-	ae := &AssetExchange{mockStub}
+	ae, stub, state := prepareAssetExchange(t, 10, "")
+	aer := AssetExchangeRecord{}
+	assert.Nil(t, json.Unmarshal(state[AssetExchangeKey("123")], &aer))
+	aer.ExpiryHeight = 0
+	ae.SetObject(AssetExchangeKey("123"), aer)
 
-	aei := pb.AssetExchangeInfo{
-		Id:            "123",
-		SenderOnSrc:   "aliceSrc",
-		ReceiverOnSrc: "bobSrc",
-		AssetOnSrc:    10,
-		SenderOnDst:   "bobDst",
-		ReceiverOnDst: "aliceDst",
-		AssetOnDst:    100,
-	}
+	// the exchange stored before exchanges expire expires from now on
+	res := ae.Refund(from, to, []byte("123"))
+	assert.False(t, res.Ok)
+	assert.Equal(t, fmt.Sprintf("asset exchange 123 can not be refunded by the initiator before height %d", 10+DefaultAssetExchangeTimeout), string(res.Result))
 
-	aer := AssetExchangeRecord{
-		Chain0: from,
-		Chain1: to,
-		Status: AssetExchangeRedeem,
-		Info:   aei,
-	}
+	stub.height = 11 + DefaultAssetExchangeTimeout
+	res = ae.Refund(from, to, []byte("123"))
+	assert.True(t, res.Ok, string(res.Result))
+}
 
-	mockStub.EXPECT().GetObject(AssetExchangeKey(aei.Id), gomock.Any()).Return(false).MaxTimes(1)
-	res := ae.Refund(from, to, []byte(aei.Id))
+func TestAssetExchange_Refund(t *testing.T) {
+	from := types.NewAddress([]byte{0}).String()
+	to := types.NewAddress([]byte{1}).String()
+
+	ae, stub, state := prepareAssetExchange(t, 10, "")
+
+	res := ae.Refund(from, to, []byte("456"))
 	assert.False(t, res.Ok)
 	assert.Equal(t, "asset exchange record does not exist", string(res.Result))
 
-	mockStub.EXPECT().GetObject(AssetExchangeKey(aei.Id), gomock.Any()).SetArg(1, aer).Return(true).MaxTimes(1)
-	res = ae.Refund(from, to, []byte(aei.Id))
+	res = ae.Refund(to, to, []byte("123"))
 	assert.False(t, res.Ok)
-	assert.Equal(t, "asset exchange status for this id is not 'Init'", string(res.Result))
+	assert.Equal(t, "invalid participator of asset exchange id 123", string(res.Result))
 
-	aer.Status = AssetExchangeInit
-	mockStub.EXPECT().GetObject(AssetExchangeKey(aei.Id), gomock.Any()).SetArg(1, aer).Return(true).AnyTimes()
-	res = ae.Refund(to, to, []byte(aei.Id))
+	res = ae.Refund(from, to, []byte("123"))
 	assert.False(t, res.Ok)
-	assert.Equal(t, fmt.Sprintf("invalid participator of asset exchange id %s", aei.Id), string(res.Result))
+	assert.Equal(t, "asset exchange 123 can not be refunded by the initiator before height 20", string(res.Result))
 
-	expAer := AssetExchangeRecord{
-		Chain0: from,
-		Chain1: to,
-		Status: AssetExchangeRefund,
-		Info:   aei,
-	}
-	mockStub.EXPECT().SetObject(AssetExchangeKey(aei.Id), expAer)
-	res = ae.Refund(from, to, []byte(aei.Id))
-	assert.True(t, res.Ok)
+	stub.height = 21
+	res = ae.Redeem(to, from, []byte("123"))
+	assert.False(t, res.Ok)
+	res = ae.Refund(from, to, []byte("123"))
+	assert.True(t, res.Ok, string(res.Result))
+
+	aer := AssetExchangeRecord{}
+	assert.Nil(t, json.Unmarshal(state[AssetExchangeKey("123")], &aer))
+	assert.Equal(t, AssetExchangeRefund, aer.Status)
+
+	res = ae.Refund(from, to, []byte("123"))
+	assert.False(t, res.Ok)
+	assert.Equal(t, "asset exchange status for this id is not 'Init'", string(res.Result))
+
+	// the counter chain refuses the exchange before it expires
+	ae, _, _ = prepareAssetExchange(t, 10, "")
+	res = ae.Refund(to, from, []byte("123"))
+	assert.True(t, res.Ok, string(res.Result))
+	res = ae.OpenExchanges(to, 0, 0)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "[]", string(res.Result))
 }
 
 func TestAssetExchange_GetStatus(t *testing.T) {
@@ -1485,6 +2689,8 @@ func TestInterRelayBroker_InvokeInterRelayContract(t *testing.T) {
 
 	mockStub.EXPECT().SetObject(gomock.Any(), gomock.Any()).AnyTimes()
 	mockStub.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(true).AnyTimes()
+	mockStub.EXPECT().Has(gomock.Any()).Return(false).AnyTimes()
+	mockStub.EXPECT().Query(gomock.Any()).Return(false, nil).AnyTimes()
 	mockStub.EXPECT().CrossInvoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&boltvm.Response{
 		Ok:     true,
 		Result: nil,
@@ -1527,6 +2733,463 @@ func TestInterRelayBroker_InvokeInterRelayContract(t *testing.T) {
 	require.True(t, res.Ok)
 }
 
+func TestInterRelayBroker_OutMessages(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	state := mockStubState(t, mockStub)
+	mockStub.EXPECT().Has(gomock.Any()).DoAndReturn(func(key string) bool {
+		_, ok := state[key]
+		return ok
+	}).AnyTimes()
+	mockStub.EXPECT().Delete(gomock.Any()).Do(func(key string) {
+		delete(state, key)
+	}).AnyTimes()
+	mockStub.EXPECT().Query(gomock.Any()).DoAndReturn(func(prefix string) (bool, [][]byte) {
+		var ret [][]byte
+		for key, value := range state {
+			if strings.HasPrefix(key, prefix) {
+				ret = append(ret, value)
+			}
+		}
+		return len(ret) != 0, ret
+	}).AnyTimes()
+
+	// the out messages recorded before upgrading are kept in the legacy maps
+	legacy := uint64(OutMessagesMigrationBatch + 1)
+	legacyCounters := map[string]uint64{"chainA": legacy}
+	legacyMessages := make(map[string]*pb.IBTP)
+	for i := uint64(1); i <= legacy; i++ {
+		legacyMessages[combineKey("chainA", i)] = &pb.IBTP{From: "relay", To: "chainA", Index: i, Type: pb.IBTP_INTERCHAIN}
+	}
+	data, err := json.Marshal(legacyCounters)
+	require.Nil(t, err)
+	state[OutCounterKey] = data
+	data, err = json.Marshal(legacyMessages)
+	require.Nil(t, err)
+	state[OutMessageKey] = data
+
+	ibroker := InterRelayBroker{mockStub}
+	outMessages := func(dest string, begin, end uint64) []*pb.IBTP {
+		res := ibroker.GetOutMessages(dest, begin, end)
+		require.True(t, res.Ok, string(res.Result))
+		var ibtps []*pb.IBTP
+		require.Nil(t, json.Unmarshal(res.Result, &ibtps))
+		return ibtps
+	}
+
+	// the legacy maps are read until they are migrated
+	ibtps := outMessages("chainA", 0, 10)
+	require.Equal(t, 10, len(ibtps))
+	res := ibroker.GetOutMessage("chainA", 2)
+	require.True(t, res.Ok)
+	ibtp := &pb.IBTP{}
+	require.Nil(t, json.Unmarshal(res.Result, ibtp))
+	require.Equal(t, uint64(2), ibtp.Index)
+
+	record := &pb.IBTPs{Ibtps: []*pb.IBTP{
+		{From: "relay", To: "chainA", Type: pb.IBTP_INTERCHAIN},
+		{From: "relay", To: "chainB", Type: pb.IBTP_INTERCHAIN},
+		{From: "relay", To: "chainA", Type: pb.IBTP_INTERCHAIN},
+	}}
+	data, err = record.Marshal()
+	require.Nil(t, err)
+	res = ibroker.RecordIBTPs(data)
+	require.True(t, res.Ok, string(res.Result))
+	recorded := &pb.IBTPs{}
+	require.Nil(t, recorded.Unmarshal(res.Result))
+	require.Equal(t, legacy+1, recorded.Ibtps[0].Index)
+	require.Equal(t, uint64(1), recorded.Ibtps[1].Index)
+	require.Equal(t, legacy+2, recorded.Ibtps[2].Index)
+
+	// RecordIBTPs does not migrate, the legacy messages are read from the
+	// legacy map while the recorded ones from their own keys
+	require.Contains(t, state, OutCounterKey)
+	require.Contains(t, state, OutMessageKey)
+	require.NotContains(t, state, outMessageKey("chainA", 1))
+	ibtps = outMessages("chainA", 98, 0)
+	require.Equal(t, 6, len(ibtps))
+	for i, ibtp := range ibtps {
+		require.Equal(t, 98+uint64(i), ibtp.Index)
+	}
+
+	// the first call splits the legacy maps into chunks and moves the counters
+	res = ibroker.MigrateOutMessages()
+	require.True(t, res.Ok)
+	require.Equal(t, strconv.Itoa(int(legacy)), string(res.Result))
+	require.NotContains(t, state, OutCounterKey)
+	require.NotContains(t, state, OutMessageKey)
+	require.Contains(t, state, outMigrationChunkKey(0))
+	require.Contains(t, state, outMigrationChunkKey(1))
+	require.Equal(t, legacy+2, ibroker.getOutCounter("chainA"))
+	ibtps = outMessages("chainA", 95, 0)
+	require.Equal(t, 9, len(ibtps))
+	for i, ibtp := range ibtps {
+		require.Equal(t, 95+uint64(i), ibtp.Index)
+	}
+
+	// every call after moves a chunk
+	res = ibroker.MigrateOutMessages()
+	require.True(t, res.Ok)
+	require.Equal(t, "1", string(res.Result))
+	require.NotContains(t, state, outMigrationChunkKey(0))
+	require.Contains(t, state, outMessageKey("chainA", 1))
+	require.NotContains(t, state, outMessageKey("chainA", legacy))
+	require.Equal(t, legacy, outMessages("chainA", legacy, legacy)[0].Index)
+
+	res = ibroker.MigrateOutMessages()
+	require.True(t, res.Ok)
+	require.Equal(t, "0", string(res.Result))
+	require.NotContains(t, state, outMigrationKey)
+	require.NotContains(t, state, outMigrationChunkKey(1))
+	require.Contains(t, state, outMessageKey("chainA", legacy))
+	res = ibroker.MigrateOutMessages()
+	require.True(t, res.Ok)
+	require.Equal(t, "0", string(res.Result))
+
+	ibtps = outMessages("chainA", 2, 3)
+	require.Equal(t, 2, len(ibtps))
+	require.Equal(t, uint64(2), ibtps[0].Index)
+	require.Equal(t, uint64(3), ibtps[1].Index)
+	require.Equal(t, 3, len(outMessages("chainA", legacy, 0)))
+	require.Equal(t, 1, len(outMessages("chainB", 1, 0)))
+	require.Equal(t, 0, len(outMessages("chainB", 2, 0)))
+	require.Equal(t, 0, len(outMessages("chainC", 0, 0)))
+
+	res = ibroker.GetOutCouterMap()
+	require.True(t, res.Ok)
+	counters := make(map[string]uint64)
+	require.Nil(t, json.Unmarshal(res.Result, &counters))
+	require.Equal(t, map[string]uint64{"chainA": legacy + 2, "chainB": 1}, counters)
+
+	res = ibroker.GetOutMessageMap()
+	require.True(t, res.Ok)
+	messages := make(map[string]*pb.IBTP)
+	require.Nil(t, json.Unmarshal(res.Result, &messages))
+	require.Equal(t, int(legacy+3), len(messages))
+	require.Equal(t, "chainB", messages[combineKey("chainB", 1)].To)
+
+	res = ibroker.GetOutMessage("chainA", legacy+3)
+	require.True(t, res.Ok)
+	require.Equal(t, "null", string(res.Result))
+
+	// the queried range is bounded
+	for i := 0; i < int(MaxOutMessagesPerQuery); i++ {
+		state[outMessageKey("chainB", uint64(i+2))] = state[outMessageKey("chainB", 1)]
+	}
+	data, err = json.Marshal(&outCounter{To: "chainB", Counter: MaxOutMessagesPerQuery + 1})
+	require.Nil(t, err)
+	state[outCounterKey("chainB")] = data
+	require.Equal(t, int(MaxOutMessagesPerQuery), len(outMessages("chainB", 2, 0)))
+	res = ibroker.GetOutMessages("chainB", 0, 0)
+	require.False(t, res.Ok)
+	require.Equal(t, fmt.Sprintf("query %d messages exceeds the max limit %d", MaxOutMessagesPerQuery+1, MaxOutMessagesPerQuery), string(res.Result))
+}
+
+func TestNodeManager_Manager(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	node0 := &Node{Id: 5, Pid: "pid0", Account: "account0", Hosts: []string{"/ip4/127.0.0.1/tcp/4001"}}
+	node1 := &Node{Id: 6, Pid: "pid1", Account: "account1"}
+	data0, err := json.Marshal(node0)
+	assert.Nil(t, err)
+	data1, err := json.Marshal(node1)
+	assert.Nil(t, err)
+
+	mockStub.EXPECT().Has(NodeKey(node0.Pid)).Return(false).Times(1)
+	mockStub.EXPECT().Has(NodeKey(node0.Pid)).Return(true).AnyTimes()
+	mockStub.EXPECT().Has(NodeKey(node1.Pid)).Return(true).AnyTimes()
+	mockStub.EXPECT().SetObject(NodeKey(node0.Pid), node0).Times(1)
+	mockStub.EXPECT().Delete(NodeKey(node0.Pid)).Times(1)
+	mockStub.EXPECT().PostEvent(&NodeEvent{Operation: NodeAdd, Node: node0}).Times(1)
+	mockStub.EXPECT().PostEvent(&NodeEvent{Operation: NodeRemove, Node: node0}).Times(1)
+	mockStub.EXPECT().Get(NodeKey(node0.Pid)).Return(true, data0)
+	mockStub.EXPECT().Query(nodePrefix).Return(true, [][]byte{data0, data1})
+	mockStub.EXPECT().Query(nodePrefix).Return(true, [][]byte{data0, data1, data1, data1})
+	mockStub.EXPECT().Query(nodePrefix).Return(true, [][]byte{data0, data1, data1, data1, data1})
+
+	res := (&NodeManager{&callerMockStub{MockStub: mockStub, caller: caller}}).Manager(NodeAdd, string(APPOVED), data0)
+	assert.False(t, res.Ok)
+
+	nm := &NodeManager{&callerMockStub{MockStub: mockStub, caller: constant.GovernanceContractAddr.Address().String()}}
+
+	res = nm.Manager(NodeAdd, string(APPOVED), []byte("node"))
+	assert.False(t, res.Ok)
+	res = nm.Manager(NodeAdd, string(APPOVED), []byte(`{"pid":"pid0"}`))
+	assert.False(t, res.Ok)
+	res = nm.Manager(NodeAdd, string(REJECTED), data0)
+	assert.True(t, res.Ok, string(res.Result))
+	res = nm.Manager(NodeAdd, string(APPOVED), data0)
+	assert.True(t, res.Ok, string(res.Result))
+	res = nm.Manager(NodeAdd, string(APPOVED), data1)
+	assert.False(t, res.Ok)
+	res = nm.Manager("update", string(APPOVED), data0)
+	assert.False(t, res.Ok)
+
+	res = nm.GetNode(node0.Pid)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, data0, res.Result)
+	res = nm.Nodes()
+	assert.True(t, res.Ok, string(res.Result))
+	nodes := make([]*Node, 0)
+	assert.Nil(t, json.Unmarshal(res.Result, &nodes))
+	assert.Equal(t, []*Node{node0, node1}, nodes)
+
+	// the removal approved after other removals can't shrink the cluster below the minimum
+	res = nm.Manager(NodeRemove, string(APPOVED), data0)
+	assert.False(t, res.Ok)
+	res = nm.Manager(NodeRemove, string(APPOVED), data0)
+	assert.True(t, res.Ok, string(res.Result))
+}
+
+func TestNodeManager_Propose(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	node0 := &Node{Id: 5, Pid: "pid0", Account: "account0", Hosts: []string{"/ip4/127.0.0.1/tcp/4001", "/ip4/127.0.0.1/tcp/4002"}}
+	node1 := &Node{Id: 6, Pid: "pid1", Account: "account1", Hosts: []string{"/ip4/127.0.0.1/tcp/4003"}}
+	data0, err := json.Marshal(node0)
+	assert.Nil(t, err)
+	genesisData, err := json.Marshal(&Node{Id: 1, Pid: "genesis"})
+	assert.Nil(t, err)
+
+	mockStub.EXPECT().Caller().Return(caller).AnyTimes()
+	mockStub.EXPECT().Has(NodeKey(node0.Pid)).Return(false).AnyTimes()
+	mockStub.EXPECT().Has(NodeKey(node1.Pid)).Return(true).AnyTimes()
+	mockStub.EXPECT().Has(NodeKey("genesis")).Return(false).AnyTimes()
+	mockStub.EXPECT().GetObject(NodeKey(node1.Pid), gomock.Any()).SetArg(1, *node1).Return(true).AnyTimes()
+	mockStub.EXPECT().Query(nodePrefix).Return(true, [][]byte{data0, data0, data0, data0})
+	mockStub.EXPECT().Query(nodePrefix).Return(true, [][]byte{data0, data0, data0, data0, data0}).AnyTimes()
+	mockStub.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(false).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(caller), pb.String(NodeAdd), pb.String(string(NodeMgr)), pb.Bytes(data0)).
+		Return(boltvm.Success([]byte("proposal0")))
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(caller), pb.String(NodeRemove), pb.String(string(NodeMgr)), gomock.Any()).
+		Return(boltvm.Success([]byte("proposal1"))).Times(2)
+
+	nm := &NodeManager{mockStub}
+
+	res := nm.AddNode(0, node0.Pid, node0.Account, "")
+	assert.False(t, res.Ok)
+	res = nm.AddNode(node0.Id, node0.Pid, node0.Account, " ,")
+	assert.False(t, res.Ok)
+	res = nm.AddNode(node1.Id, node1.Pid, node1.Account, node1.Hosts[0])
+	assert.False(t, res.Ok)
+	res = nm.AddNode(node0.Id, node0.Pid, node0.Account, strings.Join(node0.Hosts, ", "))
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "proposal0", string(res.Result))
+
+	res = nm.RemoveNode(0, "genesis")
+	assert.False(t, res.Ok)
+	res = nm.RemoveNode(0, node1.Pid)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "can't remove node pid1 as only 3 consensus nodes would be left", string(res.Result))
+	res = nm.RemoveNode(0, node1.Pid)
+	assert.True(t, res.Ok, string(res.Result))
+	res = nm.RemoveNode(1, "genesis")
+	assert.True(t, res.Ok, string(res.Result))
+
+	ev, ok := ParseNodeEvent(&pb.Event{Data: []byte(`{"node_operation":"add","node":` + string(genesisData) + `}`)})
+	assert.True(t, ok)
+	assert.Equal(t, NodeAdd, ev.Operation)
+	assert.Equal(t, uint64(1), ev.Node.Id)
+	_, ok = ParseNodeEvent(&pb.Event{Data: []byte(`{"id":"1356:chain0:1"}`)})
+	assert.False(t, ok)
+	_, ok = ParseNodeEvent(&pb.Event{Data: []byte(`{"node_operation":"update","node":{}}`)})
+	assert.False(t, ok)
+}
+
+func TestServiceManager_Manager(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	service := &Service{ChainID: "chain0", ServiceID: "transfer", Desc: "asset transfer", Whitelist: []string{"chain1"}}
+	data, err := json.Marshal(service)
+	assert.Nil(t, err)
+	updated := &Service{ChainID: "chain0", ServiceID: "transfer", Desc: "asset transfer", Whitelist: []string{"chain1", "chain2"}}
+	updatedData, err := json.Marshal(updated)
+	assert.Nil(t, err)
+	key := ServiceKey(service.ChainID, service.ServiceID)
+
+	state := mockStubState(t, mockStub)
+	mockStub.EXPECT().Has(gomock.Any()).DoAndReturn(func(key string) bool {
+		_, ok := state[key]
+		return ok
+	}).AnyTimes()
+	mockStub.EXPECT().Query(gomock.Any()).DoAndReturn(func(prefix string) (bool, [][]byte) {
+		var ret [][]byte
+		for key, v := range state {
+			if strings.HasPrefix(key, prefix) {
+				ret = append(ret, v)
+			}
+		}
+		return len(ret) != 0, ret
+	}).AnyTimes()
+	mockStub.EXPECT().Delete(key).Do(func(key string) {
+		delete(state, key)
+	}).Times(1)
+
+	res := (&ServiceManager{&callerMockStub{MockStub: mockStub, caller: caller}}).Manager(ServiceRegister, string(APPOVED), data)
+	assert.False(t, res.Ok)
+
+	sm := &ServiceManager{&callerMockStub{MockStub: mockStub, caller: constant.GovernanceContractAddr.Address().String()}}
+
+	res = sm.Manager(ServiceRegister, string(APPOVED), []byte(`{"chain_id":"chain0"}`))
+	assert.False(t, res.Ok)
+	res = sm.Manager(ServiceRegister, string(REJECTED), data)
+	assert.True(t, res.Ok, string(res.Result))
+	res = sm.GetService(service.ChainID, service.ServiceID)
+	assert.False(t, res.Ok)
+	res = sm.Manager(ServiceUpdate, string(APPOVED), updatedData)
+	assert.False(t, res.Ok)
+	res = sm.Manager(ServiceRegister, string(APPOVED), data)
+	assert.True(t, res.Ok, string(res.Result))
+	res = sm.Manager(ServiceRegister, string(APPOVED), data)
+	assert.False(t, res.Ok)
+
+	res = sm.GetService(service.ChainID, service.ServiceID)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, data, res.Result)
+	res = sm.GetService(service.ChainID, "unknown")
+	assert.False(t, res.Ok)
+
+	res = sm.CheckInvocation("chain1", service.ChainID, service.ServiceID)
+	assert.True(t, res.Ok, string(res.Result))
+	res = sm.CheckInvocation("chain2", service.ChainID, service.ServiceID)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "appchain chain2 is not allowed to call service transfer of appchain chain0", string(res.Result))
+	res = sm.CheckInvocation("chain1", service.ChainID, "unknown")
+	assert.False(t, res.Ok)
+	assert.Equal(t, "service unknown of appchain chain0 does not exist", string(res.Result))
+	res = sm.CheckEncryptedInvocation("chain1", service.ChainID)
+	assert.True(t, res.Ok, string(res.Result))
+	res = sm.CheckEncryptedInvocation("chain2", service.ChainID)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "appchain chain2 is not allowed to call any service of appchain chain0", string(res.Result))
+
+	res = sm.Manager(ServiceUpdate, string(APPOVED), updatedData)
+	assert.True(t, res.Ok, string(res.Result))
+	res = sm.CheckInvocation("chain2", service.ChainID, service.ServiceID)
+	assert.True(t, res.Ok, string(res.Result))
+
+	res = sm.Manager(ServiceRemove, string(APPOVED), data)
+	assert.True(t, res.Ok, string(res.Result))
+	res = sm.Manager(ServiceRemove, string(APPOVED), data)
+	assert.False(t, res.Ok)
+
+	// the services of the appchain registering no service are open to all
+	res = sm.CheckInvocation("chain2", service.ChainID, "unknown")
+	assert.True(t, res.Ok, string(res.Result))
+	res = sm.CheckEncryptedInvocation("chain2", service.ChainID)
+	assert.True(t, res.Ok, string(res.Result))
+}
+
+func TestServiceManager_Propose(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	service := &Service{ChainID: caller, ServiceID: "transfer", Desc: "asset transfer", Whitelist: []string{"chain1", "chain2"}}
+	data, err := json.Marshal(service)
+	assert.Nil(t, err)
+	key := ServiceKey(service.ChainID, service.ServiceID)
+
+	mockStub.EXPECT().Caller().Return(caller).AnyTimes()
+	mockStub.EXPECT().Has(key).Return(false).Times(2)
+	mockStub.EXPECT().Has(key).Return(true).AnyTimes()
+	mockStub.EXPECT().Has(gomock.Any()).Return(false).AnyTimes()
+	mockStub.EXPECT().GetObject(key, gomock.Any()).SetArg(1, *service).Return(true).AnyTimes()
+	mockStub.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(false).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(caller)).Return(boltvm.Success(nil))
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(caller), pb.String(ServiceRegister), pb.String(string(ServiceMgr)), pb.Bytes(data)).
+		Return(boltvm.Success([]byte("proposal0")))
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(caller), pb.String(ServiceUpdate), pb.String(string(ServiceMgr)), gomock.Any()).
+		Return(boltvm.Success([]byte("proposal1")))
+	mockStub.EXPECT().CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(caller), pb.String(ServiceRemove), pb.String(string(ServiceMgr)), pb.Bytes(data)).
+		Return(boltvm.Success([]byte("proposal2")))
+
+	sm := &ServiceManager{mockStub}
+
+	res := sm.RegisterService("chain1", service.ServiceID, service.Desc, "chain2")
+	assert.False(t, res.Ok)
+	assert.Equal(t, "caller is not the appchain", string(res.Result))
+	res = sm.RegisterService(caller, "", service.Desc, "chain2")
+	assert.False(t, res.Ok)
+	res = sm.UpdateService(caller, service.ServiceID, service.Desc, "chain1")
+	assert.False(t, res.Ok)
+	res = sm.RegisterService(caller, service.ServiceID, service.Desc, " chain1, chain2,")
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "proposal0", string(res.Result))
+	res = sm.RegisterService(caller, service.ServiceID, service.Desc, "chain1")
+	assert.False(t, res.Ok)
+
+	res = sm.UpdateService(caller, service.ServiceID, service.Desc, "chain1")
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "proposal1", string(res.Result))
+
+	res = sm.RemoveService(caller, "unknown")
+	assert.False(t, res.Ok)
+	res = sm.RemoveService(caller, service.ServiceID)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "proposal2", string(res.Result))
+}
+
+func TestPermissionManager_Manager(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	perm := &repo.Permission{
+		Contract: constant.StoreContractAddr.String(),
+		Method:   "Set",
+		Roles:    []string{RoleAdmin},
+	}
+	data, err := json.Marshal(perm)
+	assert.Nil(t, err)
+	key := PermissionKey(perm.Contract, perm.Method)
+	assert.Equal(t, key, PermissionKey(constant.StoreContractAddr.Address().String(), "Set"))
+
+	mockStub.EXPECT().SetObject(key, perm).Times(1)
+	mockStub.EXPECT().Has(key).Return(false).Times(1)
+	mockStub.EXPECT().Has(key).Return(true).Times(1)
+	mockStub.EXPECT().Delete(key).Times(1)
+	mockStub.EXPECT().Get(key).Return(true, data)
+	mockStub.EXPECT().Query(permissionPrefix).Return(true, [][]byte{data})
+
+	res := (&PermissionManager{&callerMockStub{MockStub: mockStub, caller: caller}}).Manager(PermissionSet, string(APPOVED), data)
+	assert.False(t, res.Ok)
+
+	pm := &PermissionManager{&callerMockStub{MockStub: mockStub, caller: constant.GovernanceContractAddr.Address().String()}}
+
+	res = pm.Manager(PermissionSet, string(APPOVED), []byte(`{"contract":"0x0b","method":"Set","roles":["admin"]}`))
+	assert.False(t, res.Ok)
+	res = pm.Manager(PermissionSet, string(APPOVED), []byte(`{"contract":"0x000000000000000000000000000000000000000b","method":"Set"}`))
+	assert.False(t, res.Ok)
+	res = pm.Manager(PermissionSet, string(REJECTED), data)
+	assert.True(t, res.Ok, string(res.Result))
+	res = pm.Manager(PermissionSet, string(APPOVED), data)
+	assert.True(t, res.Ok, string(res.Result))
+	res = pm.Manager("update", string(APPOVED), data)
+	assert.False(t, res.Ok)
+
+	res = pm.GetPermission(perm.Contract, perm.Method)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, data, res.Result)
+	res = pm.Permissions()
+	assert.True(t, res.Ok, string(res.Result))
+	perms := make([]*repo.Permission, 0)
+	assert.Nil(t, json.Unmarshal(res.Result, &perms))
+	assert.Equal(t, []*repo.Permission{perm}, perms)
+
+	res = pm.Manager(PermissionRemove, string(APPOVED), data)
+	assert.False(t, res.Ok)
+	res = pm.Manager(PermissionRemove, string(APPOVED), data)
+	assert.True(t, res.Ok, string(res.Result))
+}
+
 func TestGovernance_SubmitProposal(t *testing.T) {
 	mockCtl := gomock.NewController(t)
 	mockStub := mock_stub.NewMockStub(mockCtl)
@@ -1777,6 +3440,9 @@ func TestGovernance_Proposal(t *testing.T) {
 	mockStub.EXPECT().CrossInvoke(constant.RoleContractAddr.String(), "GetAdminRoles").Return(boltvm.Success(adminsData)).AnyTimes()
 	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "Manager", gomock.Any(), gomock.Any(), gomock.Any()).Return(boltvm.Error("")).Times(1)
 	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "Manager", gomock.Any(), gomock.Any(), gomock.Any()).Return(boltvm.Success(nil)).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(NodeManagerContractAddr.String(), "Manager", gomock.Any(), gomock.Any(), gomock.Any()).Return(boltvm.Error("")).Times(1)
+	mockStub.EXPECT().CrossInvoke(NodeManagerContractAddr.String(), "Manager", gomock.Any(), gomock.Any(), gomock.Any()).Return(boltvm.Success(nil)).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.ServiceMgrContractAddr.String(), "Manager", gomock.Any(), gomock.Any(), gomock.Any()).Return(boltvm.Success(nil)).AnyTimes()
 
 	res := g.ModifyProposal(idExistent, "des", string(AppchainMgr), []byte{})
 	assert.False(t, res.Ok, string(res.Result))
@@ -1921,15 +3587,15 @@ func TestGovernance_Proposal(t *testing.T) {
 	// not reach threshold (approve:1)
 	res = g.Vote(idNotReachThreshold, BallotApprove, "")
 	assert.True(t, res.Ok, string(res.Result))
-	// SuperMajorityApprove (reject:1)
+	// SuperMajorityApprove and NodeMgr Manager error (reject:1)
 	res = g.Vote(idSuperMajorityApprove, BallotReject, "")
 	assert.False(t, res.Ok, string(res.Result))
 	// SuperMajorityAgainst (approve:2)
 	res = g.Vote(idSuperMajorityAgainst, BallotApprove, "")
-	assert.False(t, res.Ok, string(res.Result))
-	// UnupportedType (reject:2)
+	assert.True(t, res.Ok, string(res.Result))
+	// ServiceMgr (reject:2)
 	res = g.Vote(idUnupportedType, BallotReject, "")
-	assert.False(t, res.Ok, string(res.Result))
+	assert.True(t, res.Ok, string(res.Result))
 	// Manager error (approve:3)
 	res = g.Vote(idExistent, BallotApprove, "")
 	assert.False(t, res.Ok, string(res.Result))
@@ -1941,6 +3607,255 @@ func TestGovernance_Proposal(t *testing.T) {
 	assert.True(t, res.Ok, string(res.Result))
 }
 
+// heightMockStub is a mock stub knowing the height of the executing block
+type heightMockStub struct {
+	*mock_stub.MockStub
+	height uint64
+}
+
+func (s *heightMockStub) GetCurrentHeight() uint64 {
+	return s.height
+}
+
+// governanceMockStub is a mock stub of a contract cross invoked by the
+// governance contract in the executing block
+type governanceMockStub struct {
+	*heightMockStub
+}
+
+func (s *governanceMockStub) CurrentCaller() string {
+	return constant.GovernanceContractAddr.Address().String()
+}
+
+func TestGovernance_Expiry(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+	stub := &heightMockStub{MockStub: mockStub, height: 10}
+
+	g := Governance{stub}
+
+	admins := []*repo.Admin{{Address: "addr1", Weight: 1}, {Address: "addr2", Weight: 1}}
+	adminsData, err := json.Marshal(admins)
+	assert.Nil(t, err)
+
+	var submitted Proposal
+	mockStub.EXPECT().Query(PROPOSAL_PREFIX).Return(false, nil).Times(1)
+	mockStub.EXPECT().CrossInvoke(constant.RoleContractAddr.String(), "GetAdminRoles").Return(boltvm.Success(adminsData))
+	mockStub.EXPECT().GetObject(string(AppchainMgr), gomock.Any()).SetArg(1, ProposalStrategy{Typ: SimpleMajority, ParticipateThreshold: 1, Lifetime: 5}).Return(true)
+	mockStub.EXPECT().AddObject(gomock.Any(), gomock.Any()).Do(func(key string, value interface{}) {
+		submitted = value.(Proposal)
+	})
+
+	res := g.SubmitProposal("from", "des", string(AppchainMgr), []byte("extra"))
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, uint64(15), submitted.ExpireHeight)
+	assert.Equal(t, uint64(2), submitted.ThresholdNum)
+
+	mockStub.EXPECT().GetObject(ProposalKey(submitted.Id), gomock.Any()).SetArg(1, submitted).Return(true).AnyTimes()
+
+	// the proposal is open until its expiry height
+	stub.height = 15
+	res = g.GetStatus(submitted.Id)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, string(PROPOSED), string(res.Result))
+
+	stub.height = 16
+	res = g.GetStatus(submitted.Id)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, string(EXPIRED), string(res.Result))
+
+	pData, err := json.Marshal(submitted)
+	assert.Nil(t, err)
+	mockStub.EXPECT().Query(PROPOSAL_PREFIX).Return(true, [][]byte{pData}).Times(2)
+	res = g.GetProposalsByStatus(string(EXPIRED))
+	assert.True(t, res.Ok, string(res.Result))
+	proposals := make([]Proposal, 0)
+	assert.Nil(t, json.Unmarshal(res.Result, &proposals))
+	assert.Equal(t, 1, len(proposals))
+	res = g.GetProposalsByStatus(string(PROPOSED))
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "[]", string(res.Result))
+
+	// voting on the expired proposal closes it as rejected
+	var closed Proposal
+	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "Manager",
+		pb.String("des"), pb.String(string(REJECTED)), pb.Bytes([]byte("extra"))).Return(boltvm.Success(nil)).Times(2)
+	mockStub.EXPECT().SetObject(ProposalKey(submitted.Id), gomock.Any()).Do(func(key string, value interface{}) {
+		closed = value.(Proposal)
+	}).Times(2)
+	mockStub.EXPECT().Caller().Return("addr1").Times(1)
+	res = g.Vote(submitted.Id, BallotApprove, "")
+	assert.False(t, res.Ok)
+	assert.Equal(t, "the proposal has expired", string(res.Result))
+	assert.Equal(t, EXPIRED, closed.Status)
+	assert.True(t, closed.Executed)
+	assert.True(t, closed.ExecuteSuccess)
+
+	// withdraw the proposal before it expires
+	stub.height = 12
+	mockStub.EXPECT().Caller().Return("addr1").Times(1)
+	res = g.WithdrawProposal(submitted.Id)
+	assert.False(t, res.Ok)
+	assert.Equal(t, "only the submitter can withdraw the proposal", string(res.Result))
+
+	mockStub.EXPECT().Caller().Return("from").Times(1)
+	res = g.WithdrawProposal(submitted.Id)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, WITHDRAWN, closed.Status)
+	assert.True(t, closed.Executed)
+
+	mockStub.EXPECT().GetObject(ProposalKey("from-1"), gomock.Any()).SetArg(1, closed).Return(true)
+	res = g.WithdrawProposal("from-1")
+	assert.False(t, res.Ok)
+
+	// only the expired proposals still open in the state are closed
+	stub.height = 16
+	closedData, err := json.Marshal(closed)
+	assert.Nil(t, err)
+	mockStub.EXPECT().Query(PROPOSAL_PREFIX).Return(true, [][]byte{pData, closedData}).Times(2)
+	mockStub.EXPECT().CrossInvoke(constant.AppchainMgrContractAddr.String(), "Manager",
+		pb.String("des"), pb.String(string(REJECTED)), pb.Bytes([]byte("extra"))).Return(boltvm.Success(nil)).Times(1)
+	mockStub.EXPECT().SetObject(ProposalKey(submitted.Id), gomock.Any()).Do(func(key string, value interface{}) {
+		closed = value.(Proposal)
+	}).Times(1)
+	res = g.CloseExpiredProposals("from", string(RuleMgr))
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "0", string(res.Result))
+	res = g.CloseExpiredProposals("from", string(AppchainMgr))
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, "1", string(res.Result))
+	assert.Equal(t, EXPIRED, closed.Status)
+	assert.True(t, closed.Executed)
+}
+
+func TestGovernance_Electorate(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	g := Governance{mockStub}
+
+	admins := []*repo.Admin{{Address: "addr1", Weight: 1}, {Address: "addr2", Weight: 2}}
+	adminsData, err := json.Marshal(admins)
+	assert.Nil(t, err)
+
+	var submitted Proposal
+	mockStub.EXPECT().Caller().Return("addr3").Times(1)
+	mockStub.EXPECT().CrossInvoke(constant.RoleContractAddr.String(), "IsAdmin", pb.String("addr3")).Return(boltvm.Success([]byte("false")))
+	mockStub.EXPECT().Caller().Return("addr1").Times(1)
+	mockStub.EXPECT().CrossInvoke(constant.RoleContractAddr.String(), "IsAdmin", pb.String("addr1")).Return(boltvm.Success([]byte("true")))
+	mockStub.EXPECT().Query(PROPOSAL_PREFIX).Return(false, nil).AnyTimes()
+	mockStub.EXPECT().CrossInvoke(constant.RoleContractAddr.String(), "GetAdminRoles").Return(boltvm.Success(adminsData))
+	mockStub.EXPECT().GetObject(string(RoleMgr), gomock.Any()).SetArg(1, ProposalStrategy{Typ: SimpleMajority, ParticipateThreshold: 1}).Return(true).AnyTimes()
+	mockStub.EXPECT().AddObject(gomock.Any(), gomock.Any()).Do(func(key string, value interface{}) {
+		submitted = value.(Proposal)
+	})
+
+	extra, err := json.Marshal(&repo.Admin{Address: "addr3", Weight: 1})
+	assert.Nil(t, err)
+	res := g.SubmitProposal("addr3", AdminAdd, string(RoleMgr), extra)
+	assert.False(t, res.Ok)
+	res = g.SubmitProposal("addr1", AdminAdd, string(RoleMgr), extra)
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, uint64(3), submitted.ElectorateNum)
+	assert.Equal(t, map[string]uint64{"addr1": 1, "addr2": 2}, submitted.Electorate)
+
+	// the weights of the snapshot are used even if the admin set changes
+	mockStub.EXPECT().GetObject(ProposalKey(submitted.Id), gomock.Any()).SetArg(1, submitted).Return(true).AnyTimes()
+	mockStub.EXPECT().SetObject(ProposalKey(submitted.Id), gomock.Any()).Do(func(key string, value interface{}) {
+		submitted = value.(Proposal)
+	}).AnyTimes()
+
+	unvote, err := g.getUnvote(submitted.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, admins, unvote)
+
+	mockStub.EXPECT().Caller().Return("addr3").Times(1)
+	res = g.Vote(submitted.Id, BallotApprove, "")
+	assert.False(t, res.Ok)
+
+	mockStub.EXPECT().Caller().Return("addr2").Times(1)
+	res = g.Vote(submitted.Id, BallotApprove, "")
+	assert.True(t, res.Ok, string(res.Result))
+	assert.Equal(t, uint64(2), submitted.ApproveNum)
+	assert.Equal(t, PROPOSED, submitted.Status)
+}
+
+func TestGovernance_SuperMajority(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockStub := mock_stub.NewMockStub(mockCtl)
+
+	g := Governance{mockStub}
+
+	ratioExtra, err := json.Marshal(&SuperMajorityExtra{Ratio: 0.8})
+	assert.Nil(t, err)
+	strategies := map[ProposalType]ProposalStrategy{
+		AppchainMgr: {Typ: SuperMajorityApprove},
+		RuleMgr:     {Typ: SuperMajorityAgainst},
+		NodeMgr:     {Typ: SuperMajorityApprove, Extra: ratioExtra},
+		ServiceMgr:  {Typ: SuperMajorityApprove, Extra: []byte(`{"ratio":0.5}`)},
+	}
+	for typ, ps := range strategies {
+		mockStub.EXPECT().GetObject(string(typ), gomock.Any()).SetArg(1, ps).Return(true).AnyTimes()
+	}
+	mockStub.EXPECT().SetObject(gomock.Any(), gomock.Any()).AnyTimes()
+
+	tests := []struct {
+		typ        ProposalType
+		approveNum uint64
+		againstNum uint64
+		closed     bool
+		status     ProposalStatus
+	}{
+		// 2/3 of 6 is 4
+		{AppchainMgr, 3, 1, false, PROPOSED},
+		{AppchainMgr, 4, 0, true, APPOVED},
+		{AppchainMgr, 3, 2, false, PROPOSED},
+		{AppchainMgr, 3, 3, true, REJECTED},
+		{AppchainMgr, 0, 3, true, REJECTED},
+		{RuleMgr, 2, 1, false, PROPOSED},
+		{RuleMgr, 0, 4, true, REJECTED},
+		{RuleMgr, 3, 3, true, APPOVED},
+		{RuleMgr, 5, 0, true, APPOVED},
+		// 0.8 of 6 is 5
+		{NodeMgr, 4, 1, false, PROPOSED},
+		{NodeMgr, 5, 0, true, APPOVED},
+		{NodeMgr, 3, 2, true, REJECTED},
+	}
+
+	for i, test := range tests {
+		p := &Proposal{
+			Id:            fmt.Sprintf("addr-%d", i),
+			Typ:           test.typ,
+			Status:        PROPOSED,
+			ApproveNum:    test.approveNum,
+			AgainstNum:    test.againstNum,
+			ElectorateNum: 6,
+			ThresholdNum:  3,
+		}
+		closed, err := g.countVote(p)
+		assert.Nil(t, err)
+		assert.Equal(t, test.closed, closed, "case %d", i)
+		assert.Equal(t, test.status, p.Status, "case %d", i)
+	}
+
+	// the participation threshold is not reached
+	p := &Proposal{Id: "addr-0", Typ: AppchainMgr, Status: PROPOSED, ApproveNum: 2, ElectorateNum: 3, ThresholdNum: 3}
+	closed, err := g.countVote(p)
+	assert.Nil(t, err)
+	assert.False(t, closed)
+
+	p = &Proposal{Id: "addr-0", Typ: ServiceMgr, Status: PROPOSED, ApproveNum: 4, ElectorateNum: 6, ThresholdNum: 3}
+	_, err = g.countVote(p)
+	assert.NotNil(t, err)
+
+	res := g.NewProposalStrategy(string(SuperMajorityApprove), 0.5, ratioExtra)
+	assert.True(t, res.Ok, string(res.Result))
+	res = g.NewProposalStrategy(string(SuperMajorityAgainst), 0.5, []byte(`{"ratio":1.5}`))
+	assert.False(t, res.Ok, string(res.Result))
+	res = g.NewProposalStrategy(string(SuperMajorityAgainst), 0.5, []byte("ratio"))
+	assert.False(t, res.Ok, string(res.Result))
+}
+
 func TestGovernance_ProposalStrategy(t *testing.T) {
 	mockCtl := gomock.NewController(t)
 	mockStub := mock_stub.NewMockStub(mockCtl)
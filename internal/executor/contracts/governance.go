@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -23,19 +24,33 @@ type ProposalStatus string
 const (
 	PROPOSAL_PREFIX = "proposal-"
 
-	AppchainMgr ProposalType = "AppchainMgr"
-	RuleMgr     ProposalType = "RuleMgr"
-	NodeMgr     ProposalType = "NodeMgr"
-	ServiceMgr  ProposalType = "ServiceMgr"
+	AppchainMgr   ProposalType = "AppchainMgr"
+	RuleMgr       ProposalType = "RuleMgr"
+	NodeMgr       ProposalType = "NodeMgr"
+	ServiceMgr    ProposalType = "ServiceMgr"
+	RoleMgr       ProposalType = "RoleMgr"
+	PermissionMgr ProposalType = "PermissionMgr"
 
-	PROPOSED ProposalStatus = "proposed"
-	APPOVED  ProposalStatus = "approve"
-	REJECTED ProposalStatus = "reject"
+	PROPOSED  ProposalStatus = "proposed"
+	APPOVED   ProposalStatus = "approve"
+	REJECTED  ProposalStatus = "reject"
+	EXPIRED   ProposalStatus = "expired"
+	WITHDRAWN ProposalStatus = "withdrawn"
 
 	BallotApprove = "approve"
 	BallotReject  = "reject"
 )
 
+// proposalHandlers maps each proposal type to the contract executing its closed proposals
+var proposalHandlers = map[ProposalType]constant.BoltContractAddress{
+	AppchainMgr:   constant.AppchainMgrContractAddr,
+	RuleMgr:       constant.RuleManagerContractAddr,
+	NodeMgr:       NodeManagerContractAddr,
+	ServiceMgr:    constant.ServiceMgrContractAddr,
+	RoleMgr:       constant.RoleContractAddr,
+	PermissionMgr: PermissionContractAddr,
+}
+
 type Ballot struct {
 	VoterAddr string `json:"voter_addr"`
 	Approve   string `json:"approve"`
@@ -72,21 +87,39 @@ type Proposal struct {
 	AgainstNum    uint64            `json:"against_num"`
 	ElectorateNum uint64            `json:"electorate_num"`
 	ThresholdNum  uint64            `json:"threshold_num"`
-	Extra         []byte            `json:"extra"`
+	// weights of the admins at the time the proposal was submitted: address -> weight
+	Electorate map[string]uint64 `json:"electorate"`
+	Extra      []byte            `json:"extra"`
+	// the proposal expires after the block of the height, 0 means never
+	ExpireHeight uint64 `json:"expire_height"`
+	// execution result of the closed proposal
+	Executed       bool   `json:"executed"`
+	ExecuteSuccess bool   `json:"execute_success"`
+	ExecuteResult  string `json:"execute_result"`
 }
 
 func (g *Governance) SubmitProposal(from, des string, typ string, extra []byte) *boltvm.Response {
+	// changes of the admin set, the permissions and the consensus nodes can
+	// only be proposed by admins
+	if ProposalType(typ) == RoleMgr || ProposalType(typ) == PermissionMgr || ProposalType(typ) == NodeMgr {
+		res := g.CrossInvoke(constant.RoleContractAddr.String(), "IsAdmin", pb.String(g.Caller()))
+		if !res.Ok || string(res.Result) != strconv.FormatBool(true) {
+			return boltvm.Error("caller is not an admin account")
+		}
+	}
+
 	ret, err := g.getProposalsByFrom(from)
 	if err != nil {
 		return boltvm.Error(err.Error())
 	}
 
-	en, err := g.getElectorateNum()
+	electorate, err := g.getElectorate()
 	if err != nil {
 		return boltvm.Error(err.Error())
 	}
+	en := getElectorateNum(electorate)
 
-	tn, err := g.getThresholdNum(en, ProposalType(typ))
+	ps, err := g.getProposalStrategy(ProposalType(typ))
 	if err != nil {
 		return boltvm.Error(err.Error())
 	}
@@ -100,8 +133,10 @@ func (g *Governance) SubmitProposal(from, des string, typ string, extra []byte)
 		ApproveNum:    0,
 		AgainstNum:    0,
 		ElectorateNum: en,
-		ThresholdNum:  tn,
+		ThresholdNum:  getThresholdNum(en, ps),
+		Electorate:    electorate,
 		Extra:         extra,
+		ExpireHeight:  g.getExpireHeight(ps),
 	}
 	if err := checkProposalInfo(p); err != nil {
 		return boltvm.Error(err.Error())
@@ -112,47 +147,85 @@ func (g *Governance) SubmitProposal(from, des string, typ string, extra []byte)
 	return boltvm.Success([]byte(p.Id))
 }
 
-func (g *Governance) getElectorateNum() (uint64, error) {
+// getElectorate returns the weights of the current admins
+func (g *Governance) getElectorate() (map[string]uint64, error) {
 	res := g.CrossInvoke(constant.RoleContractAddr.String(), "GetAdminRoles")
 	if !res.Ok {
-		return 0, fmt.Errorf(string(res.Result))
+		return nil, fmt.Errorf(string(res.Result))
 	}
 
 	var admins []*repo.Admin
 	if err := json.Unmarshal(res.Result, &admins); err != nil {
-		return 0, fmt.Errorf(err.Error())
+		return nil, fmt.Errorf(err.Error())
 	}
 
-	electorateNum := uint64(0)
+	electorate := make(map[string]uint64, len(admins))
 	for _, admin := range admins {
-		electorateNum = electorateNum + admin.Weight
+		electorate[admin.Address] = admin.Weight
 	}
-	return electorateNum, nil
+	return electorate, nil
 }
 
-func (g *Governance) getThresholdNum(electorateNum uint64, proposalTyp ProposalType) (uint64, error) {
+func getElectorateNum(electorate map[string]uint64) uint64 {
+	electorateNum := uint64(0)
+	for _, weight := range electorate {
+		electorateNum = electorateNum + weight
+	}
+	return electorateNum
+}
+
+func (g *Governance) getProposalStrategy(proposalTyp ProposalType) (*ProposalStrategy, error) {
 	if err := checkProposalType(proposalTyp); err != nil {
-		return 0, fmt.Errorf(err.Error())
+		return nil, fmt.Errorf(err.Error())
 	}
 	ps := ProposalStrategy{}
 	if !g.GetObject(string(proposalTyp), &ps) {
 		// SimpleMajority is used by default
 		ps.Typ = SimpleMajority
-		ps.ParticipateThreshold = 0.75
+		ps.ParticipateThreshold = DefaultParticipateThreshold
 		g.AddObject(string(proposalTyp), ps)
 	}
 
-	return uint64(math.Ceil(float64(electorateNum) * ps.ParticipateThreshold)), nil
+	return &ps, nil
+}
+
+func getThresholdNum(electorateNum uint64, ps *ProposalStrategy) uint64 {
+	return uint64(math.Ceil(float64(electorateNum) * ps.ParticipateThreshold))
+}
+
+// getExpireHeight returns the expiry height of a proposal submitted in the current block
+func (g *Governance) getExpireHeight(ps *ProposalStrategy) uint64 {
+	height := currentHeight(g.Stub)
+	if height == 0 {
+		return 0
+	}
+
+	lifetime := ps.Lifetime
+	if lifetime == 0 {
+		lifetime = DefaultProposalLifetime
+	}
+	return height + lifetime
+}
+
+// checkExpired marks the proposal expired if it is still open after its expiry height
+func (g *Governance) checkExpired(p *Proposal) bool {
+	if p.Status != PROPOSED || p.ExpireHeight == 0 || currentHeight(g.Stub) <= p.ExpireHeight {
+		return false
+	}
+
+	p.Status = EXPIRED
+	return true
 }
 
 // ModifyProposal modify a proposal
 func (g *Governance) ModifyProposal(id, des string, typ string, extra []byte) *boltvm.Response {
-	en, err := g.getElectorateNum()
+	electorate, err := g.getElectorate()
 	if err != nil {
 		return boltvm.Error(err.Error())
 	}
+	en := getElectorateNum(electorate)
 
-	tn, err := g.getThresholdNum(en, ProposalType(typ))
+	ps, err := g.getProposalStrategy(ProposalType(typ))
 	if err != nil {
 		return boltvm.Error(err.Error())
 	}
@@ -166,8 +239,10 @@ func (g *Governance) ModifyProposal(id, des string, typ string, extra []byte) *b
 		ApproveNum:    0,
 		AgainstNum:    0,
 		ElectorateNum: en,
-		ThresholdNum:  tn,
+		ThresholdNum:  getThresholdNum(en, ps),
+		Electorate:    electorate,
 		Extra:         extra,
+		ExpireHeight:  g.getExpireHeight(ps),
 	}
 
 	if err := checkProposalInfo(p); err != nil {
@@ -188,6 +263,7 @@ func (g *Governance) GetProposal(id string) *boltvm.Response {
 	if !g.GetObject(ProposalKey(id), p) {
 		return boltvm.Error("proposal does not exist")
 	}
+	g.checkExpired(p)
 
 	pData, err := json.Marshal(p)
 	if err != nil {
@@ -222,6 +298,7 @@ func (g *Governance) getProposalsByFrom(from string) ([]Proposal, error) {
 		if err := json.Unmarshal(d, &p); err != nil {
 			return nil, err
 		}
+		g.checkExpired(&p)
 
 		if from == p.Id[0:strings.Index(p.Id, "-")] {
 			ret = append(ret, p)
@@ -246,6 +323,7 @@ func (g *Governance) GetProposalsByTyp(typ string) *boltvm.Response {
 			if err := json.Unmarshal(d, &p); err != nil {
 				return boltvm.Error(err.Error())
 			}
+			g.checkExpired(&p)
 
 			if ProposalType(typ) == p.Typ {
 				ret = append(ret, p)
@@ -275,6 +353,7 @@ func (g *Governance) GetProposalsByStatus(status string) *boltvm.Response {
 			if err := json.Unmarshal(d, &p); err != nil {
 				return boltvm.Error(err.Error())
 			}
+			g.checkExpired(&p)
 
 			if ProposalStatus(status) == p.Status {
 				ret = append(ret, p)
@@ -315,6 +394,7 @@ func (g *Governance) GetStatus(id string) *boltvm.Response {
 	if !g.GetObject(ProposalKey(id), p) {
 		return boltvm.Error("proposal does not exist")
 	}
+	g.checkExpired(p)
 
 	return boltvm.Success([]byte(p.Status))
 }
@@ -447,6 +527,22 @@ func (g *Governance) getUnvote(id string) ([]*repo.Admin, error) {
 		return nil, fmt.Errorf("proposal does not exist")
 	}
 
+	ret := make([]*repo.Admin, 0)
+	if p.Electorate != nil {
+		addrs := make([]string, 0, len(p.Electorate))
+		for addr := range p.Electorate {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+
+		for _, addr := range addrs {
+			if _, ok := p.BallotMap[addr]; !ok {
+				ret = append(ret, &repo.Admin{Address: addr, Weight: p.Electorate[addr]})
+			}
+		}
+		return ret, nil
+	}
+
 	res := g.CrossInvoke(constant.RoleContractAddr.String(), "GetAdminRoles")
 	if !res.Ok {
 		return nil, fmt.Errorf("get admin roles error: " + string(res.Result))
@@ -456,7 +552,6 @@ func (g *Governance) getUnvote(id string) ([]*repo.Admin, error) {
 		return nil, fmt.Errorf("get admin roles error: " + err.Error())
 	}
 
-	ret := make([]*repo.Admin, 0)
 	for _, admin := range admins {
 		if _, ok := p.BallotMap[admin.Address]; !ok {
 			ret = append(ret, admin)
@@ -484,6 +579,12 @@ func (g *Governance) Vote(id, approve string, reason string) *boltvm.Response {
 	if !g.GetObject(ProposalKey(id), p) {
 		return boltvm.Error("proposal does not exist")
 	}
+	if g.checkExpired(p) {
+		if res := g.closeProposal(p); !res.Ok {
+			return boltvm.Error("cross invoke Manager error:" + string(res.Result))
+		}
+		return boltvm.Error("the proposal has expired")
+	}
 
 	// 2. Set vote
 	if err := g.setVote(p, addr, approve, reason); err != nil {
@@ -503,16 +604,90 @@ func (g *Governance) Vote(id, approve string, reason string) *boltvm.Response {
 	}
 
 	// 4. Handle result
-	switch p.Typ {
-	case RuleMgr, NodeMgr, ServiceMgr:
-		return boltvm.Error("waiting for subsequent implementation")
-	default: // APPCHAIN_MGR
-		res := g.CrossInvoke(constant.AppchainMgrContractAddr.String(), "Manager", pb.String(p.Des), pb.String(string(p.Status)), pb.Bytes(p.Extra))
-		if !res.Ok {
+	if res := g.closeProposal(p); !res.Ok {
+		return boltvm.Error("cross invoke Manager error:" + string(res.Result))
+	}
+	return boltvm.Success(nil)
+}
+
+// WithdrawProposal closes an open proposal, only the submitter can withdraw it
+func (g *Governance) WithdrawProposal(id string) *boltvm.Response {
+	p := &Proposal{}
+	if !g.GetObject(ProposalKey(id), p) {
+		return boltvm.Error("proposal does not exist")
+	}
+
+	if g.checkExpired(p) {
+		if res := g.closeProposal(p); !res.Ok {
 			return boltvm.Error("cross invoke Manager error:" + string(res.Result))
 		}
-		return boltvm.Success(nil)
+		return boltvm.Error("the proposal has expired")
 	}
+
+	if p.Status != PROPOSED {
+		return boltvm.Error("the vote on the proposal has been closed")
+	}
+
+	if g.Caller() != p.Id[0:strings.Index(p.Id, "-")] {
+		return boltvm.Error("only the submitter can withdraw the proposal")
+	}
+
+	p.Status = WITHDRAWN
+	if res := g.closeProposal(p); !res.Ok {
+		return boltvm.Error("cross invoke Manager error:" + string(res.Result))
+	}
+	return boltvm.Success(nil)
+}
+
+// CloseExpiredProposals closes the expired proposals of the type submitted by
+// the address which are still open in the state, returning the number closed
+func (g *Governance) CloseExpiredProposals(from, typ string) *boltvm.Response {
+	ret, err := g.getProposalsByFrom(from)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	closed := 0
+	for i := range ret {
+		p := &ret[i]
+		if p.Typ != ProposalType(typ) || p.Status != EXPIRED || p.Executed {
+			continue
+		}
+		if res := g.closeProposal(p); !res.Ok {
+			return boltvm.Error("cross invoke Manager error:" + string(res.Result))
+		}
+		closed++
+	}
+
+	return boltvm.Success([]byte(strconv.Itoa(closed)))
+}
+
+// closeProposal lets the contract managing the proposal type execute the
+// closed proposal, and records the result of the execution on the proposal.
+func (g *Governance) closeProposal(p *Proposal) *boltvm.Response {
+	res := g.executeProposal(p)
+	p.Executed = true
+	p.ExecuteSuccess = res.Ok
+	p.ExecuteResult = string(res.Result)
+	g.SetObject(ProposalKey(p.Id), *p)
+
+	return res
+}
+
+// executeProposal calls the Manager method of the contract handling the proposal type,
+// expired and withdrawn proposals are handled as rejected ones
+func (g *Governance) executeProposal(p *Proposal) *boltvm.Response {
+	addr, ok := proposalHandlers[p.Typ]
+	if !ok {
+		return boltvm.Error("no handler for the proposal type " + string(p.Typ))
+	}
+
+	result := p.Status
+	if result == EXPIRED || result == WITHDRAWN {
+		result = REJECTED
+	}
+
+	return g.CrossInvoke(addr.String(), "Manager", pb.String(p.Des), pb.String(string(result)), pb.Bytes(p.Extra))
 }
 
 // Set vote of an administrator
@@ -527,34 +702,53 @@ func (g *Governance) setVote(p *Proposal, addr string, approve string, reason st
 		return fmt.Errorf("administrator of the address has voted")
 	}
 
-	res := g.CrossInvoke(constant.RoleContractAddr.String(), "GetRoleWeight", pb.String(addr))
-	if !res.Ok {
-		return fmt.Errorf(string(res.Result))
-	}
-	num, err := strconv.Atoi(string(res.Result))
+	num, err := g.getVoteWeight(p, addr)
 	if err != nil {
-		return fmt.Errorf(err.Error())
+		return err
 	}
 
 	// Record Voting Information
 	ballot := Ballot{
 		VoterAddr: addr,
 		Approve:   approve,
-		Num:       uint64(num),
+		Num:       num,
 		Reason:    reason,
 	}
 	p.BallotMap[addr] = ballot
 	switch approve {
 	case BallotApprove:
-		p.ApproveNum = p.ApproveNum + uint64(num)
+		p.ApproveNum = p.ApproveNum + num
 	case BallotReject:
-		p.AgainstNum = p.AgainstNum + uint64(num)
+		p.AgainstNum = p.AgainstNum + num
 	}
 
 	g.SetObject(ProposalKey(p.Id), *p)
 	return nil
 }
 
+// getVoteWeight returns the weight of the administrator in the electorate of
+// the proposal, later changes of the admin set do not affect the proposal.
+func (g *Governance) getVoteWeight(p *Proposal, addr string) (uint64, error) {
+	if p.Electorate != nil {
+		weight, ok := p.Electorate[addr]
+		if !ok {
+			return 0, fmt.Errorf("account at the address is not in the electorate of the proposal:" + addr)
+		}
+		return weight, nil
+	}
+
+	// proposals submitted without the snapshot of the electorate
+	res := g.CrossInvoke(constant.RoleContractAddr.String(), "GetRoleWeight", pb.String(addr))
+	if !res.Ok {
+		return 0, fmt.Errorf(string(res.Result))
+	}
+	num, err := strconv.Atoi(string(res.Result))
+	if err != nil {
+		return 0, fmt.Errorf(err.Error())
+	}
+	return uint64(num), nil
+}
+
 // Count votes to see if this round is over.
 // If the vote is over change the status of the proposal.
 func (g *Governance) countVote(p *Proposal) (bool, error) {
@@ -563,7 +757,7 @@ func (g *Governance) countVote(p *Proposal) (bool, error) {
 	if !g.GetObject(string(p.Typ), &ps) {
 		// SimpleMajority is used by default
 		ps.Typ = SimpleMajority
-		ps.ParticipateThreshold = 0.75
+		ps.ParticipateThreshold = DefaultParticipateThreshold
 		g.SetObject(string(p.Typ), ps)
 	}
 
@@ -574,21 +768,46 @@ func (g *Governance) countVote(p *Proposal) (bool, error) {
 
 	// Votes are counted according to strategy
 	switch ps.Typ {
-	case SuperMajorityApprove:
-		// TODO: SUPER_MAJORITY_APPROVE
-		return false, fmt.Errorf("this policy is not supported currently")
-	case SuperMajorityAgainst:
-		// TODO: SUPER_MAJORITY_AGAINST
-		return false, fmt.Errorf("this policy is not supported currently")
+	case SuperMajorityApprove, SuperMajorityAgainst:
+		ratio, err := superMajorityRatio(&ps)
+		if err != nil {
+			return false, err
+		}
+
+		// The supermajority side decides the proposal once it reaches the
+		// supermajority, the other side wins once the supermajority can not
+		// be reached by the remaining votes.
+		superNum := uint64(math.Ceil(float64(p.ElectorateNum) * ratio))
+		superVotes, otherVotes := p.ApproveNum, p.AgainstNum
+		if ps.Typ == SuperMajorityAgainst {
+			superVotes, otherVotes = p.AgainstNum, p.ApproveNum
+		}
+
+		var superWins bool
+		switch {
+		case superVotes >= superNum:
+			superWins = true
+		case otherVotes > p.ElectorateNum-superNum:
+			superWins = false
+		default:
+			return false, nil
+		}
+
+		if superWins == (ps.Typ == SuperMajorityApprove) {
+			p.Status = APPOVED
+		} else {
+			p.Status = REJECTED
+		}
 	default: // SIMPLE_MAJORITY
 		if p.ApproveNum > p.AgainstNum {
 			p.Status = APPOVED
 		} else {
 			p.Status = REJECTED
 		}
-		g.SetObject(ProposalKey(p.Id), *p)
-		return true, nil
 	}
+
+	g.SetObject(ProposalKey(p.Id), *p)
+	return true, nil
 }
 
 // Proposal strategy ===============================================================
@@ -601,6 +820,18 @@ const (
 	SimpleMajority       ProposalStrategyType = "SimpleMajority"
 )
 
+const (
+	// DefaultParticipateThreshold is the participation threshold of the default strategy
+	DefaultParticipateThreshold = 0.75
+
+	// DefaultSuperMajorityRatio is used by supermajority strategies without a ratio
+	DefaultSuperMajorityRatio = 2.0 / 3
+
+	// DefaultProposalLifetime is the number of blocks a proposal stays open
+	// if its strategy has no lifetime
+	DefaultProposalLifetime = 100000
+)
+
 type ProposalStrategy struct {
 	Typ ProposalStrategyType `json:"typ"`
 	// The minimum participation threshold.
@@ -609,6 +840,34 @@ type ProposalStrategy struct {
 	// according to the voting situation.
 	ParticipateThreshold float64 `json:"participate_threshold"`
 	Extra                []byte  `json:"extra"`
+	// The number of blocks a proposal stays open before it expires,
+	// DefaultProposalLifetime is used if it is 0.
+	Lifetime uint64 `json:"lifetime"`
+}
+
+// SuperMajorityExtra is the Extra of SuperMajorityApprove and
+// SuperMajorityAgainst strategies.
+// Ratio is the proportion of the electorate the approving (or against)
+// ballots must reach, it must be greater than 0.5 and no more than 1.
+type SuperMajorityExtra struct {
+	Ratio float64 `json:"ratio"`
+}
+
+func superMajorityRatio(ps *ProposalStrategy) (float64, error) {
+	if len(ps.Extra) == 0 {
+		return DefaultSuperMajorityRatio, nil
+	}
+
+	extra := &SuperMajorityExtra{}
+	if err := json.Unmarshal(ps.Extra, extra); err != nil {
+		return 0, fmt.Errorf("unmarshal supermajority extra: %w", err)
+	}
+
+	if extra.Ratio <= 0.5 || extra.Ratio > 1 {
+		return 0, fmt.Errorf("illegal supermajority ratio %v", extra.Ratio)
+	}
+
+	return extra.Ratio, nil
 }
 
 func (g *Governance) NewProposalStrategy(typ string, participateThreshold float64, extra []byte) *boltvm.Response {
@@ -695,7 +954,9 @@ func checkProposalType(pt ProposalType) error {
 	if pt != AppchainMgr &&
 		pt != RuleMgr &&
 		pt != NodeMgr &&
-		pt != ServiceMgr {
+		pt != ServiceMgr &&
+		pt != RoleMgr &&
+		pt != PermissionMgr {
 		return fmt.Errorf("illegal proposal type")
 	}
 	return nil
@@ -704,7 +965,9 @@ func checkProposalType(pt ProposalType) error {
 func checkProposalStauts(ps ProposalStatus) error {
 	if ps != PROPOSED &&
 		ps != APPOVED &&
-		ps != REJECTED {
+		ps != REJECTED &&
+		ps != EXPIRED &&
+		ps != WITHDRAWN {
 		return fmt.Errorf("illegal proposal status")
 	}
 	return nil
@@ -716,6 +979,12 @@ func checkStrategyInfo(ps *ProposalStrategy) error {
 		ps.ParticipateThreshold > 1 {
 		return fmt.Errorf("illegal proposal strategy info")
 	}
+
+	if ps.Typ == SuperMajorityApprove || ps.Typ == SuperMajorityAgainst {
+		if _, err := superMajorityRatio(ps); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
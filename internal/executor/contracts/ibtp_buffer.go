@@ -0,0 +1,456 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/meshplus/bitxhub-core/boltvm"
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/constant"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
+)
+
+const (
+	pendingIBTPPrefix  = "pending-ibtp-"
+	pendingDrainPrefix = "pending-drain-"
+
+	// MaxPendingIBTPs bounds the IBTPs buffered for a chain pair, an IBTP is
+	// buffered only if its index is less than the required index plus it
+	MaxPendingIBTPs uint64 = 64
+
+	// DrainIBTPGas is the gas reserved for draining a buffered IBTP besides
+	// the gas of its bytes. The IBTPs the transaction has no gas left for are
+	// drained by the transaction the relay chain appends to the next block
+	DrainIBTPGas uint64 = 400000
+)
+
+// wrongIndexError is returned by checkIBTP if the IBTP arrives before the
+// IBTPs with the indexes in front of it
+type wrongIndexError struct {
+	required uint64
+	index    uint64
+	receipt  bool
+}
+
+func (e *wrongIndexError) Error() string {
+	if e.receipt {
+		return fmt.Sprintf("wrong receipt index, required %d, but %d", e.required, e.index)
+	}
+
+	return fmt.Sprintf("wrong index, required %d, but %d", e.required, e.index)
+}
+
+// PendingIBTP is an IBTP buffered until the missing IBTPs in front of it
+// arrive, with the transaction it was sent in
+type PendingIBTP struct {
+	IBTP    []byte      `json:"ibtp"`
+	TxHash  *types.Hash `json:"tx_hash"`
+	TxIndex uint64      `json:"tx_index"`
+	Height  uint64      `json:"height"`
+	Timeout bool        `json:"timeout,omitempty"`
+}
+
+// DrainedIBTPEvent is posted for the drained IBTP buffered in an earlier block,
+// whose transaction is not in the block the IBTP is delivered with
+type DrainedIBTPEvent struct {
+	Dst  string `json:"drained_ibtp_dst"`
+	IBTP []byte `json:"drained_ibtp"`
+}
+
+// PendingIBTPs are the IBTPs of the chain pair buffered in index order,
+// requests and receipts are buffered separately
+type PendingIBTPs struct {
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Receipt bool           `json:"receipt"`
+	Indexes []uint64       `json:"indexes"`
+	IBTPs   []*PendingIBTP `json:"ibtps"`
+}
+
+// IBTPGap describes the indexes of the chain pair missing in front of the
+// buffered IBTPs
+type IBTPGap struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Receipt  bool     `json:"receipt"`
+	Required uint64   `json:"required"`
+	Pending  []uint64 `json:"pending"`
+	Missing  []uint64 `json:"missing"`
+}
+
+// HandleIBTPResult is the result of HandleIBTP if the IBTP is buffered or the
+// buffered IBTPs following it are drained, Dropped holds the buffered IBTPs
+// failing to be handled with the reasons
+type HandleIBTPResult struct {
+	Pending bool              `json:"pending,omitempty"`
+	Drained []string          `json:"drained,omitempty"`
+	Dropped map[string]string `json:"dropped,omitempty"`
+}
+
+// GetIBTPGaps returns the gaps of the IBTPs sent from the source chain to the
+// destination chain, an empty destination means all destination chains
+func (x *InterchainManager) GetIBTPGaps(from, to string) *boltvm.Response {
+	prefix := pendingIBTPPrefix + from + "-"
+	if to != "" {
+		prefix += to + "-"
+	}
+
+	interchain, ok := x.getInterchain(from)
+	if !ok {
+		return boltvm.Error("this appchain does not exist")
+	}
+
+	gaps := make([]*IBTPGap, 0)
+	_, values := x.Query(prefix)
+	for _, value := range values {
+		pending := &PendingIBTPs{}
+		if err := json.Unmarshal(value, pending); err != nil {
+			return boltvm.Error(err.Error())
+		}
+		if pending.From != from || (to != "" && pending.To != to) || len(pending.Indexes) == 0 {
+			continue
+		}
+
+		gap := &IBTPGap{
+			From:     pending.From,
+			To:       pending.To,
+			Receipt:  pending.Receipt,
+			Required: requiredIndex(interchain, pending.To, pending.Receipt),
+			Pending:  pending.Indexes,
+			Missing:  make([]uint64, 0),
+		}
+		for i, idx := gap.Required, 0; idx < len(pending.Indexes); i++ {
+			if pending.Indexes[idx] == i {
+				idx++
+				continue
+			}
+			gap.Missing = append(gap.Missing, i)
+		}
+		gaps = append(gaps, gap)
+	}
+
+	sort.Slice(gaps, func(i, j int) bool {
+		if gaps[i].To != gaps[j].To {
+			return gaps[i].To < gaps[j].To
+		}
+		return !gaps[i].Receipt && gaps[j].Receipt
+	})
+
+	data, err := json.Marshal(gaps)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return boltvm.Success(data)
+}
+
+// bufferIBTP buffers the checked IBTP arriving before the required one, it is
+// handled once all IBTPs in front of it are handled
+func (x *InterchainManager) bufferIBTP(ibtp *pb.IBTP, required uint64) *boltvm.Response {
+	receipt := isReceiptIBTP(ibtp)
+	if ibtp.Index-required >= MaxPendingIBTPs {
+		return boltvm.Error((&wrongIndexError{required: required, index: ibtp.Index, receipt: receipt}).Error() +
+			fmt.Sprintf(", exceeds %d pending ibtps", MaxPendingIBTPs))
+	}
+
+	pending := x.getPendingIBTPs(ibtp.From, ibtp.To, receipt)
+	i := sort.Search(len(pending.Indexes), func(i int) bool {
+		return pending.Indexes[i] >= ibtp.Index
+	})
+	if i < len(pending.Indexes) && pending.Indexes[i] == ibtp.Index {
+		return boltvm.Error(fmt.Sprintf("ibtp %s is already pending", ibtp.ID()))
+	}
+
+	data, err := ibtp.Marshal()
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	entry := &PendingIBTP{
+		IBTP:    data,
+		TxHash:  x.GetTxHash(),
+		TxIndex: x.GetTxIndex(),
+		Height:  currentHeight(x.Stub),
+		Timeout: x.isTimeoutReceipt(ibtp),
+	}
+	pending.Indexes = append(pending.Indexes, 0)
+	copy(pending.Indexes[i+1:], pending.Indexes[i:])
+	pending.Indexes[i] = ibtp.Index
+	pending.IBTPs = append(pending.IBTPs, nil)
+	copy(pending.IBTPs[i+1:], pending.IBTPs[i:])
+	pending.IBTPs[i] = entry
+	x.SetObject(pendingIBTPKey(ibtp.From, ibtp.To, receipt), pending)
+
+	ret, err := json.Marshal(&HandleIBTPResult{Pending: true})
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return boltvm.Success(ret)
+}
+
+// DrainPendingIBTPs continues draining the buffered IBTPs under the key, which
+// the last block left for lack of gas. It is only called by the transactions
+// the relay chain appends to the block, see DrainPendingIBTPsTx
+func (x *InterchainManager) DrainPendingIBTPs(key string) *boltvm.Response {
+	if x.Caller() != constant.InterchainContractAddr.Address().String() {
+		return boltvm.Error("caller is not the relay chain")
+	}
+	x.removePendingDrain(currentHeight(x.Stub)-1, key)
+
+	pending := &PendingIBTPs{}
+	if !x.GetObject(key, pending) {
+		return boltvm.Success(nil)
+	}
+
+	interchain, ok := x.getInterchain(pending.From)
+	if !ok {
+		return boltvm.Error("this appchain does not exist")
+	}
+
+	result := x.drainPendingIBTPs(pending.From, pending.To, pending.Receipt, interchain)
+	if result == nil {
+		return boltvm.Success(nil)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return boltvm.Success(data)
+}
+
+// drainPendingIBTPs handles the buffered IBTPs of the chain pair following the
+// handled IBTP in index order, the drained IBTPs buffered in this block are
+// delivered with their own transactions and the others with the transactions
+// the relay chain appends to the block for them. Draining stops if the gas
+// left can't cover the next IBTP, the rest are drained in the next block
+func (x *InterchainManager) drainPendingIBTPs(from, to string, receipt bool, interchain *pb.Interchain) *HandleIBTPResult {
+	pending := x.getPendingIBTPs(from, to, receipt)
+	if len(pending.Indexes) == 0 {
+		return nil
+	}
+
+	var size uint64
+	for _, entry := range pending.IBTPs {
+		size += uint64(len(entry.IBTP))
+	}
+
+	result := &HandleIBTPResult{}
+	height := currentHeight(x.Stub)
+	key := pendingIBTPKey(from, to, receipt)
+	for len(pending.Indexes) != 0 {
+		index, entry := pending.Indexes[0], pending.IBTPs[0]
+		required := requiredIndex(interchain, to, receipt)
+		if index > required {
+			break
+		}
+		size -= uint64(len(entry.IBTP))
+		if index == required && remainingGas(x.Stub) < drainGas(entry, size) {
+			x.addPendingDrain(height, key)
+			break
+		}
+		pending.Indexes = pending.Indexes[1:]
+		pending.IBTPs = pending.IBTPs[1:]
+
+		id := fmt.Sprintf("%s-%s-%d", from, to, index)
+		// the index may be taken by the IBTPs handled together in HandleIBTPs
+		if index < required {
+			result.drop(id, fmt.Errorf("index already exists, required %d, but %d", required, index))
+			continue
+		}
+
+		next := &pb.IBTP{}
+		if err := next.Unmarshal(entry.IBTP); err != nil {
+			result.drop(id, err)
+			break
+		}
+		if err := x.checkPendingIBTP(next, interchain, entry.Timeout); err != nil {
+			result.drop(next.ID(), err)
+			break
+		}
+		if res := x.handleIBTPType(next, entry.Timeout); !res.Ok {
+			result.drop(next.ID(), fmt.Errorf("%s", res.Result))
+			break
+		}
+
+		dst := x.processIBTP(next, interchain, entry.TxHash)
+		if entry.Height == height {
+			x.PostInterchainEvent(map[string]uint64{dst: entry.TxIndex})
+		} else {
+			x.PostEvent(&DrainedIBTPEvent{Dst: dst, IBTP: entry.IBTP})
+		}
+		result.Drained = append(result.Drained, next.ID())
+	}
+
+	if len(result.Drained) == 0 && len(result.Dropped) == 0 {
+		return nil
+	}
+
+	if len(pending.Indexes) == 0 {
+		x.Delete(key)
+	} else {
+		x.SetObject(key, pending)
+	}
+
+	return result
+}
+
+// drainGas returns the gas reserved for draining the buffered IBTP and writing
+// back the IBTPs of the given size left behind it
+func drainGas(entry *PendingIBTP, left uint64) uint64 {
+	return DrainIBTPGas + gas.SetGas + gas.ByteGas*(4*uint64(len(entry.IBTP))+2*left)
+}
+
+// addPendingDrain records the buffered IBTPs left for lack of gas in the block
+// of the height, they are drained by the transactions the relay chain appends
+// to the next block
+func (x *InterchainManager) addPendingDrain(height uint64, key string) {
+	var keys []string
+	x.GetObject(PendingDrainKey(height), &keys)
+	for _, k := range keys {
+		if k == key {
+			return
+		}
+	}
+	x.SetObject(PendingDrainKey(height), append(keys, key))
+}
+
+func (x *InterchainManager) removePendingDrain(height uint64, key string) {
+	var keys []string
+	if !x.GetObject(PendingDrainKey(height), &keys) {
+		return
+	}
+	for i, k := range keys {
+		if k == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+
+	if len(keys) == 0 {
+		x.Delete(PendingDrainKey(height))
+	} else {
+		x.SetObject(PendingDrainKey(height), keys)
+	}
+}
+
+// DrainPendingIBTPsTx returns the transaction the relay chain appends to the
+// block to continue draining the buffered IBTPs under the key
+func DrainPendingIBTPsTx(key string, timestamp int64) (*pb.Transaction, error) {
+	payload, err := (&pb.InvokePayload{
+		Method: "DrainPendingIBTPs",
+		Args:   []*pb.Arg{pb.String(key)},
+	}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := (&pb.TransactionData{
+		Type:    pb.TransactionData_INVOKE,
+		VmType:  pb.TransactionData_BVM,
+		Payload: payload,
+	}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &pb.Transaction{
+		From:      constant.InterchainContractAddr.Address(),
+		To:        constant.InterchainContractAddr.Address(),
+		Timestamp: timestamp,
+		Payload:   data,
+	}
+	tx.TransactionHash = tx.Hash()
+
+	return tx, nil
+}
+
+// ParseDrainedIBTPEvent returns the event posted for the drained IBTP, false
+// if the event is not a drained IBTP event
+func ParseDrainedIBTPEvent(ev *pb.Event) (*DrainedIBTPEvent, bool) {
+	if ev.Interchain {
+		return nil, false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(ev.Data, &fields); err != nil || len(fields) != 2 ||
+		fields["drained_ibtp_dst"] == nil || fields["drained_ibtp"] == nil {
+		return nil, false
+	}
+
+	e := &DrainedIBTPEvent{}
+	if err := json.Unmarshal(ev.Data, e); err != nil || e.Dst == "" || len(e.IBTP) == 0 {
+		return nil, false
+	}
+
+	return e, true
+}
+
+// DrainedIBTPTx returns the transaction the relay chain appends to the block to
+// deliver the drained IBTP buffered in an earlier block
+func DrainedIBTPTx(ibtp *pb.IBTP, timestamp int64) *pb.Transaction {
+	tx := &pb.Transaction{
+		From:      constant.InterchainContractAddr.Address(),
+		To:        constant.InterchainContractAddr.Address(),
+		Timestamp: timestamp,
+		IBTP:      ibtp,
+	}
+	tx.TransactionHash = tx.Hash()
+
+	return tx
+}
+
+func (r *HandleIBTPResult) drop(id string, err error) {
+	if r.Dropped == nil {
+		r.Dropped = make(map[string]string)
+	}
+	r.Dropped[id] = err.Error()
+}
+
+func (x *InterchainManager) getPendingIBTPs(from, to string, receipt bool) *PendingIBTPs {
+	pending := &PendingIBTPs{}
+	if !x.GetObject(pendingIBTPKey(from, to, receipt), pending) {
+		pending = &PendingIBTPs{
+			From:    from,
+			To:      to,
+			Receipt: receipt,
+		}
+	}
+
+	return pending
+}
+
+// requiredIndex returns the index of the next IBTP of the chain pair
+func requiredIndex(interchain *pb.Interchain, to string, receipt bool) uint64 {
+	if receipt {
+		return interchain.ReceiptCounter[to] + 1
+	}
+
+	return interchain.InterchainCounter[to] + 1
+}
+
+func isReceiptIBTP(ibtp *pb.IBTP) bool {
+	return pb.IBTP_INTERCHAIN != ibtp.Type &&
+		pb.IBTP_ASSET_EXCHANGE_INIT != ibtp.Type &&
+		pb.IBTP_ASSET_EXCHANGE_REDEEM != ibtp.Type &&
+		pb.IBTP_ASSET_EXCHANGE_REFUND != ibtp.Type
+}
+
+// PendingDrainKey is the key of the buffered IBTPs left for lack of gas in the
+// block of the height
+func PendingDrainKey(height uint64) string {
+	return pendingDrainPrefix + strconv.FormatUint(height, 10)
+}
+
+func pendingIBTPKey(from, to string, receipt bool) string {
+	if receipt {
+		return pendingIBTPPrefix + from + "-" + to + "-receipt"
+	}
+
+	return pendingIBTPPrefix + from + "-" + to + "-interchain"
+}
@@ -1,15 +1,13 @@
 package contracts
 
 import (
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
 	appchainMgr "github.com/meshplus/bitxhub-core/appchain-mgr"
 	"github.com/meshplus/bitxhub-core/boltvm"
-	"github.com/meshplus/bitxhub-kit/crypto"
-	"github.com/meshplus/bitxhub-kit/crypto/asym"
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/constant"
 	"github.com/meshplus/bitxhub-model/pb"
@@ -19,10 +17,6 @@ type InterchainManager struct {
 	boltvm.Stub
 }
 
-type BxhValidators struct {
-	Addresses []string `json:"addresses"`
-}
-
 func (x *InterchainManager) Register(chainId string) *boltvm.Response {
 	interchain, ok := x.getInterchain(chainId)
 	if !ok {
@@ -114,28 +108,47 @@ func (x *InterchainManager) HandleIBTP(ibtp *pb.IBTP) *boltvm.Response {
 	}
 
 	if err := x.checkIBTP(ibtp, interchain); err != nil {
+		var indexErr *wrongIndexError
+		if errors.As(err, &indexErr) {
+			return x.bufferIBTP(ibtp, indexErr.required)
+		}
 		return boltvm.Error(err.Error())
 	}
 
-	res := boltvm.Success(nil)
+	res := x.handleIBTPType(ibtp, x.isTimeoutReceipt(ibtp))
+	if !res.Ok {
+		return res
+	}
 
+	x.ProcessIBTP(ibtp, interchain)
+
+	if result := x.drainPendingIBTPs(ibtp.From, ibtp.To, isReceiptIBTP(ibtp), interchain); result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return boltvm.Error(err.Error())
+		}
+		return boltvm.Success(data)
+	}
+
+	return res
+}
+
+// handleIBTPType invokes the contracts handling the IBTP of its type, the
+// timeout receipts roll back their transactions
+func (x *InterchainManager) handleIBTPType(ibtp *pb.IBTP, timeout bool) *boltvm.Response {
 	if pb.IBTP_INTERCHAIN == ibtp.Type {
-		res = x.beginTransaction(ibtp)
+		return x.beginTransaction(ibtp)
+	} else if timeout {
+		return x.rollbackTransaction(ibtp)
 	} else if pb.IBTP_RECEIPT_SUCCESS == ibtp.Type || pb.IBTP_RECEIPT_FAILURE == ibtp.Type {
-		res = x.reportTransaction(ibtp)
+		return x.reportTransaction(ibtp)
 	} else if pb.IBTP_ASSET_EXCHANGE_INIT == ibtp.Type ||
 		pb.IBTP_ASSET_EXCHANGE_REDEEM == ibtp.Type ||
 		pb.IBTP_ASSET_EXCHANGE_REFUND == ibtp.Type {
-		res = x.handleAssetExchange(ibtp)
-	}
-
-	if !res.Ok {
-		return res
+		return x.handleAssetExchange(ibtp)
 	}
 
-	x.ProcessIBTP(ibtp, interchain)
-
-	return res
+	return boltvm.Success(nil)
 }
 
 func (x *InterchainManager) HandleIBTPs(data []byte) *boltvm.Response {
@@ -162,20 +175,60 @@ func (x *InterchainManager) HandleIBTPs(data []byte) *boltvm.Response {
 		return res
 	}
 
+	result := &HandleIBTPResult{}
 	for _, ibtp := range ibtps.Ibtps {
 		x.ProcessIBTP(ibtp, interchain)
+
+		if drained := x.drainPendingIBTPs(ibtp.From, ibtp.To, isReceiptIBTP(ibtp), interchain); drained != nil {
+			result.Drained = append(result.Drained, drained.Drained...)
+			for id, reason := range drained.Dropped {
+				result.drop(id, fmt.Errorf("%s", reason))
+			}
+		}
+	}
+
+	if len(result.Drained) != 0 || len(result.Dropped) != 0 {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return boltvm.Error(err.Error())
+		}
+		return boltvm.Success(data)
 	}
 
 	return boltvm.Success(nil)
 }
 
 func (x *InterchainManager) checkIBTP(ibtp *pb.IBTP, interchain *pb.Interchain) error {
-	isRelayIBTP := x.isRelayIBTP(ibtp.From)
+	return x.checkIBTPOf(ibtp, interchain, true, x.isTimeoutReceipt(ibtp))
+}
+
+// checkPendingIBTP checks the drained IBTP again except its sender, which is
+// checked when it is buffered along with whether it is a timeout receipt
+func (x *InterchainManager) checkPendingIBTP(ibtp *pb.IBTP, interchain *pb.Interchain, timeout bool) error {
+	return x.checkIBTPOf(ibtp, interchain, false, timeout)
+}
+
+func (x *InterchainManager) checkIBTPOf(ibtp *pb.IBTP, interchain *pb.Interchain, checkCaller, timeout bool) error {
+	srcChain, _ := x.getAppchain(ibtp.From)
+	isRelayIBTP := srcChain != nil && srcChain.ChainType == appchainMgr.RelaychainType
 
 	if ibtp.To == "" {
 		return fmt.Errorf("empty destination chain id")
 	}
 
+	// the transactions of frozen appchains are rolled back as well
+	if !timeout && srcChain != nil && IsInterchainDisabled(srcChain.Status) {
+		return fmt.Errorf("source appchain %s is %s", ibtp.From, srcChain.Status)
+	}
+	if !timeout {
+		if err := x.checkAppchainEnabled(ibtp.To); err != nil {
+			return err
+		}
+	}
+	if err := x.checkService(ibtp); err != nil {
+		return err
+	}
+
 	if _, ok := x.getInterchain(ibtp.To); !ok {
 		x.Logger().WithField("chain_id", ibtp.To).Debug("target appchain does not exist")
 	}
@@ -184,7 +237,7 @@ func (x *InterchainManager) checkIBTP(ibtp *pb.IBTP, interchain *pb.Interchain)
 		pb.IBTP_ASSET_EXCHANGE_INIT == ibtp.Type ||
 		pb.IBTP_ASSET_EXCHANGE_REDEEM == ibtp.Type ||
 		pb.IBTP_ASSET_EXCHANGE_REFUND == ibtp.Type {
-		if !isRelayIBTP {
+		if !isRelayIBTP && checkCaller {
 			if ibtp.From != x.Caller() {
 				return fmt.Errorf("ibtp from != caller")
 			}
@@ -195,10 +248,10 @@ func (x *InterchainManager) checkIBTP(ibtp *pb.IBTP, interchain *pb.Interchain)
 			return fmt.Errorf(fmt.Sprintf("index already exists, required %d, but %d", idx+1, ibtp.Index))
 		}
 		if ibtp.Index > idx+1 {
-			return fmt.Errorf(fmt.Sprintf("wrong index, required %d, but %d", idx+1, ibtp.Index))
+			return &wrongIndexError{required: idx + 1, index: ibtp.Index}
 		}
 	} else {
-		if !isRelayIBTP {
+		if !isRelayIBTP && !timeout && checkCaller {
 			if ibtp.To != x.Caller() {
 				return fmt.Errorf("ibtp to != caller")
 			}
@@ -206,29 +259,91 @@ func (x *InterchainManager) checkIBTP(ibtp *pb.IBTP, interchain *pb.Interchain)
 
 		idx := interchain.ReceiptCounter[ibtp.To]
 		if ibtp.Index <= idx {
+			if x.isRolledBack(ibtp) {
+				return fmt.Errorf("transaction %s has been rolled back", txID(ibtp))
+			}
 			return fmt.Errorf(fmt.Sprintf("receipt index already exists, required %d, but %d", idx+1, ibtp.Index))
 		}
 
 		if ibtp.Index > idx+1 {
-			return fmt.Errorf(fmt.Sprintf("wrong receipt index, required %d, but %d", idx+1, ibtp.Index))
+			return &wrongIndexError{required: idx + 1, index: ibtp.Index, receipt: true}
 		}
 	}
 
 	return nil
 }
 
-// isRelayIBTP returns whether ibtp.from is relaychain type
-func (x *InterchainManager) isRelayIBTP(from string) bool {
-	srcChain := &appchainMgr.Appchain{}
-	res := x.CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(from))
-	if err := json.Unmarshal(res.Result, srcChain); err != nil {
-		return false
+// getAppchain returns the appchain registered in the appchain manager, false
+// if the appchain is unknown to this relay chain
+func (x *InterchainManager) getAppchain(id string) (*appchainMgr.Appchain, bool) {
+	res := x.CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(id))
+	if !res.Ok {
+		return nil, false
+	}
+
+	chain := &appchainMgr.Appchain{}
+	if err := json.Unmarshal(res.Result, chain); err != nil {
+		return nil, false
+	}
+
+	return chain, true
+}
+
+// checkAppchainEnabled returns error if the appchain is known to this relay
+// chain and its interchain txs are disabled
+func (x *InterchainManager) checkAppchainEnabled(id string) error {
+	chain, ok := x.getAppchain(id)
+	if ok && IsInterchainDisabled(chain.Status) {
+		return fmt.Errorf("destination appchain %s is %s", id, chain.Status)
+	}
+
+	return nil
+}
+
+// checkService returns error if the interchain request calls a service which
+// is not registered by the destination chain or not open to the source chain.
+// The destination service of encrypted payload is unknown, so at least one
+// service of the destination chain must be open to the source chain.
+func (x *InterchainManager) checkService(ibtp *pb.IBTP) error {
+	if pb.IBTP_INTERCHAIN != ibtp.Type {
+		return nil
+	}
+
+	payload := &pb.Payload{}
+	if err := json.Unmarshal(ibtp.Payload, payload); err != nil {
+		return fmt.Errorf("unmarshal ibtp payload: %w", err)
 	}
-	return srcChain.ChainType == appchainMgr.RelaychainType
+	if payload.Encrypted {
+		res := x.CrossInvoke(constant.ServiceMgrContractAddr.String(), "CheckEncryptedInvocation",
+			pb.String(ibtp.From), pb.String(ibtp.To))
+		if !res.Ok {
+			return fmt.Errorf("%s", res.Result)
+		}
+		return nil
+	}
+
+	content := &pb.Content{}
+	if err := content.Unmarshal(payload.Content); err != nil {
+		return fmt.Errorf("unmarshal ibtp content: %w", err)
+	}
+
+	res := x.CrossInvoke(constant.ServiceMgrContractAddr.String(), "CheckInvocation",
+		pb.String(ibtp.From), pb.String(ibtp.To), pb.String(content.DstContractId))
+	if !res.Ok {
+		return fmt.Errorf("%s", res.Result)
+	}
+
+	return nil
 }
 
 func (x *InterchainManager) ProcessIBTP(ibtp *pb.IBTP, interchain *pb.Interchain) {
-	m := make(map[string]uint64)
+	dst := x.processIBTP(ibtp, interchain, x.GetTxHash())
+	x.PostInterchainEvent(map[string]uint64{dst: x.GetTxIndex()})
+}
+
+// processIBTP updates the counters of the IBTP sent in the transaction and
+// returns the chain the IBTP is delivered to
+func (x *InterchainManager) processIBTP(ibtp *pb.IBTP, interchain *pb.Interchain, txHash *types.Hash) string {
 	if pb.IBTP_INTERCHAIN == ibtp.Type ||
 		pb.IBTP_ASSET_EXCHANGE_INIT == ibtp.Type ||
 		pb.IBTP_ASSET_EXCHANGE_REDEEM == ibtp.Type ||
@@ -239,52 +354,76 @@ func (x *InterchainManager) ProcessIBTP(ibtp *pb.IBTP, interchain *pb.Interchain
 		}
 		interchain.InterchainCounter[ibtp.To]++
 		x.setInterchain(ibtp.From, interchain)
-		x.AddObject(x.indexMapKey(ibtp.ID()), x.GetTxHash())
-		m[ibtp.To] = x.GetTxIndex()
+		x.AddObject(x.indexMapKey(ibtp.ID()), txHash)
+		return ibtp.To
 	} else {
 		interchain.ReceiptCounter[ibtp.To] = ibtp.Index
 		x.setInterchain(ibtp.From, interchain)
-		m[ibtp.From] = x.GetTxIndex()
 
 		ic, _ := x.getInterchain(ibtp.To)
 		ic.SourceReceiptCounter[ibtp.From] = ibtp.Index
 		x.setInterchain(ibtp.To, ic)
-		x.SetObject(x.indexReceiptMapKey(ibtp.ID()), x.GetTxHash())
-
+		x.SetObject(x.indexReceiptMapKey(ibtp.ID()), txHash)
+		return ibtp.From
 	}
-
-	x.PostInterchainEvent(m)
 }
 
 func (x *InterchainManager) beginMultiTargetsTransaction(ibtps *pb.IBTPs) *boltvm.Response {
 	args := make([]*pb.Arg, 0)
 	globalId := fmt.Sprintf("%s-%s", x.Caller(), x.GetTxHash())
-	args = append(args, pb.String(globalId))
+	args = append(args, pb.String(globalId), pb.Uint64(x.txTimeoutHeight()))
 
 	for _, ibtp := range ibtps.Ibtps {
 		if ibtp.Type != pb.IBTP_INTERCHAIN {
 			return boltvm.Error("ibtp type != IBTP_INTERCHAIN")
 		}
 
-		childTxId := fmt.Sprintf("%s-%s-%d", ibtp.From, ibtp.To, ibtp.Index)
-		args = append(args, pb.String(childTxId))
+		args = append(args, pb.String(txID(ibtp)))
 	}
 
 	return x.CrossInvoke(constant.TransactionMgrContractAddr.String(), "BeginMultiTXs", args...)
 }
 
 func (x *InterchainManager) beginTransaction(ibtp *pb.IBTP) *boltvm.Response {
-	txId := fmt.Sprintf("%s-%s-%d", ibtp.From, ibtp.To, ibtp.Index)
-	return x.CrossInvoke(constant.TransactionMgrContractAddr.String(), "Begin", pb.String(txId))
+	return x.CrossInvoke(constant.TransactionMgrContractAddr.String(), "Begin", pb.String(txID(ibtp)), pb.Uint64(x.txTimeoutHeight()))
 }
 
 func (x *InterchainManager) reportTransaction(ibtp *pb.IBTP) *boltvm.Response {
-	txId := fmt.Sprintf("%s-%s-%d", ibtp.From, ibtp.To, ibtp.Index)
 	result := int32(0)
 	if ibtp.Type == pb.IBTP_RECEIPT_FAILURE {
 		result = 1
 	}
-	return x.CrossInvoke(constant.TransactionMgrContractAddr.String(), "Report", pb.String(txId), pb.Int32(result))
+	return x.CrossInvoke(constant.TransactionMgrContractAddr.String(), "Report", pb.String(txID(ibtp)), pb.Int32(result))
+}
+
+// rollbackTransaction rolls back the timed out transaction, the failure
+// receipt is then routed to the source chain like other receipts
+func (x *InterchainManager) rollbackTransaction(ibtp *pb.IBTP) *boltvm.Response {
+	return x.CrossInvoke(constant.TransactionMgrContractAddr.String(), "Rollback", pb.String(txID(ibtp)))
+}
+
+func (x *InterchainManager) isRolledBack(ibtp *pb.IBTP) bool {
+	res := x.CrossInvoke(constant.TransactionMgrContractAddr.String(), "IsRolledBack", pb.String(txID(ibtp)))
+
+	return res.Ok && string(res.Result) == "true"
+}
+
+// isTimeoutReceipt returns whether the IBTP sent in the transaction is the
+// failure receipt sent by the relay chain itself for the transaction timing
+// out, see TimeoutReceipt. The drained IBTPs are marked when they are buffered
+func (x *InterchainManager) isTimeoutReceipt(ibtp *pb.IBTP) bool {
+	return pb.IBTP_RECEIPT_FAILURE == ibtp.Type &&
+		x.Caller() == constant.TransactionMgrContractAddr.Address().String()
+}
+
+// txTimeoutHeight returns the timeout height of the transaction begun in the
+// current block
+func (x *InterchainManager) txTimeoutHeight() uint64 {
+	return currentHeight(x.Stub) + DefaultTransactionTimeout
+}
+
+func txID(ibtp *pb.IBTP) string {
+	return fmt.Sprintf("%s-%s-%d", ibtp.From, ibtp.To, ibtp.Index)
 }
 
 func (x *InterchainManager) handleAssetExchange(ibtp *pb.IBTP) *boltvm.Response {
@@ -345,6 +484,15 @@ func (x *InterchainManager) handleUnionIBTP(ibtp *pb.IBTP) *boltvm.Response {
 	if err := json.Unmarshal(res.Result, app); err != nil {
 		return boltvm.Error(err.Error())
 	}
+	if IsInterchainDisabled(app.Status) {
+		return boltvm.Error(fmt.Sprintf("source relay chain %s is %s", srcRelayChainID, app.Status))
+	}
+	if err := x.checkAppchainEnabled(ibtp.To); err != nil {
+		return boltvm.Error(err.Error())
+	}
+	if err := x.checkService(ibtp); err != nil {
+		return boltvm.Error(err.Error())
+	}
 
 	interchain, ok := x.getInterchain(ibtp.From)
 	if !ok {
@@ -381,52 +529,10 @@ func (x *InterchainManager) checkUnionIBTP(app *appchainMgr.Appchain, ibtp *pb.I
 		}
 	}
 
-	_, err := verifyMultiSign(app, ibtp, ibtp.Proof)
+	_, err := VerifyMultiSign(app, ibtp, ibtp.Proof)
 	return err
 }
 
-// verifyMultiSign .
-func verifyMultiSign(app *appchainMgr.Appchain, ibtp *pb.IBTP, proof []byte) (bool, error) {
-	if "" == app.Validators {
-		return false, fmt.Errorf("empty validators in relay chain:%s", app.ID)
-	}
-	var validators BxhValidators
-	if err := json.Unmarshal([]byte(app.Validators), &validators); err != nil {
-		return false, err
-	}
-
-	m := make(map[string]struct{}, 0)
-	for _, validator := range validators.Addresses {
-		m[validator] = struct{}{}
-	}
-
-	var signs pb.SignResponse
-	if err := signs.Unmarshal(ibtp.Proof); err != nil {
-		return false, err
-	}
-
-	threshold := (len(validators.Addresses) - 1) / 3 // TODO be dynamic
-	counter := 0
-
-	ibtpHash := ibtp.Hash()
-	hash := sha256.Sum256([]byte(ibtpHash.String()))
-	for v, sign := range signs.Sign {
-		if _, ok := m[v]; !ok {
-			return false, fmt.Errorf("wrong validator: %s", v)
-		}
-		delete(m, v)
-		addr := types.NewAddressByStr(v)
-		ok, _ := asym.Verify(crypto.Secp256k1, sign, hash[:], *addr)
-		if ok {
-			counter++
-		}
-		if counter > threshold {
-			return true, nil
-		}
-	}
-	return false, fmt.Errorf("multi signs verify fail, counter: %d", counter)
-}
-
 func AppchainKey(id string) string {
 	return appchainMgr.PREFIX + id
 }
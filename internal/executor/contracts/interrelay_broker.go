@@ -3,6 +3,8 @@ package contracts
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 
 	"github.com/meshplus/bitxhub-core/boltvm"
 	"github.com/meshplus/bitxhub-model/constant"
@@ -25,8 +27,46 @@ const (
 	InMessageKey  = "InMessage"
 	OutMessageKey = "OutMessage"
 	Locked        = true
+
+	outCounterPrefix        = "ibroker-out-counter-"
+	outMessagePrefix        = "ibroker-out-msg-"
+	outMigrationKey         = "ibroker-out-migration"
+	outMigrationChunkPrefix = "ibroker-out-migration-chunk-"
+
+	// MaxOutMessagesPerQuery bounds the out messages returned by GetOutMessages
+	MaxOutMessagesPerQuery uint64 = 100
+
+	// OutMessagesMigrationBatch bounds the legacy out messages moved to their
+	// own keys by a single call, so the migration fits in the gas limit
+	OutMessagesMigrationBatch = 100
 )
 
+// outCounter is the greatest index of the out messages to the destination
+// chain, the out messages are kept with their own keys since the counters and
+// messages kept in the single maps of OutCounterKey and OutMessageKey grow
+// with all inter-relaychain traffic
+type outCounter struct {
+	To      string `json:"to"`
+	Counter uint64 `json:"counter"`
+}
+
+// outMigration tracks the legacy out messages split into chunks of at most
+// OutMessagesMigrationBatch messages, the chunks from Next on are not moved to
+// the keys of their messages yet
+type outMigration struct {
+	Chunks []outMigrationChunk `json:"chunks"`
+	Next   int                 `json:"next"`
+	Left   int                 `json:"left"`
+}
+
+// outMigrationChunk is the index range of the out messages to the destination
+// chain kept in a chunk
+type outMigrationChunk struct {
+	To    string `json:"to"`
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+}
+
 // IncInCounter increases InCounter[from] by once
 func (ibroker *InterRelayBroker) IncInCounter(from string) *boltvm.Response {
 	ibroker.incInCounter(from)
@@ -57,6 +97,15 @@ func (ibroker *InterRelayBroker) GetInCouterMap() *boltvm.Response {
 func (ibroker *InterRelayBroker) GetOutCouterMap() *boltvm.Response {
 	OutCounterMap := make(map[string]uint64)
 	ibroker.GetObject(OutCounterKey, &OutCounterMap)
+	_, values := ibroker.Query(outCounterPrefix)
+	for _, value := range values {
+		counter := &outCounter{}
+		if err := json.Unmarshal(value, counter); err != nil {
+			return boltvm.Error(err.Error())
+		}
+		OutCounterMap[counter.To] = counter.Counter
+	}
+
 	data, err := json.Marshal(OutCounterMap)
 	if err != nil {
 		return boltvm.Error(err.Error())
@@ -64,10 +113,30 @@ func (ibroker *InterRelayBroker) GetOutCouterMap() *boltvm.Response {
 	return boltvm.Success(data)
 }
 
-// GetOutMessageMap returns interchain-message(ibtp) map
+// GetOutMessageMap returns interchain-message(ibtp) map, it loads all out
+// messages and is kept for compatibility, use GetOutMessages instead
 func (ibroker *InterRelayBroker) GetOutMessageMap() *boltvm.Response {
 	OutMessage := make(map[string]*pb.IBTP)
 	ibroker.GetObject(OutMessageKey, &OutMessage)
+	_, values := ibroker.Query(outMessagePrefix)
+	for _, value := range values {
+		ibtp := &pb.IBTP{}
+		if err := json.Unmarshal(value, ibtp); err != nil {
+			return boltvm.Error(err.Error())
+		}
+		OutMessage[combineKey(ibtp.To, ibtp.Index)] = ibtp
+	}
+	_, values = ibroker.Query(outMigrationChunkPrefix)
+	for _, value := range values {
+		var ibtps []*pb.IBTP
+		if err := json.Unmarshal(value, &ibtps); err != nil {
+			return boltvm.Error(err.Error())
+		}
+		for _, ibtp := range ibtps {
+			OutMessage[combineKey(ibtp.To, ibtp.Index)] = ibtp
+		}
+	}
+
 	data, err := json.Marshal(OutMessage)
 	if err != nil {
 		return boltvm.Error(err.Error())
@@ -77,9 +146,40 @@ func (ibroker *InterRelayBroker) GetOutMessageMap() *boltvm.Response {
 
 // GetOutMessage returns interchain ibtp by index and target chain_id
 func (ibroker *InterRelayBroker) GetOutMessage(destChain string, index uint64) *boltvm.Response {
-	OutMessage := make(map[string]*pb.IBTP)
-	ibroker.GetObject(OutMessageKey, &OutMessage)
-	data, err := json.Marshal(OutMessage[combineKey(destChain, index)])
+	data, err := json.Marshal(newOutMessageReader(ibroker).get(destChain, index))
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+	return boltvm.Success(data)
+}
+
+// GetOutMessages returns the interchain ibtps to the target chain with the
+// indexes from begin to end, end 0 means the greatest index
+func (ibroker *InterRelayBroker) GetOutMessages(destChain string, begin, end uint64) *boltvm.Response {
+	if begin == 0 {
+		begin = 1
+	}
+	counter := ibroker.getOutCounter(destChain)
+	if end == 0 || end > counter {
+		end = counter
+	}
+
+	ibtps := make([]*pb.IBTP, 0)
+	if begin <= end {
+		if end-begin+1 > MaxOutMessagesPerQuery {
+			return boltvm.Error(fmt.Sprintf("query %d messages exceeds the max limit %d", end-begin+1, MaxOutMessagesPerQuery))
+		}
+		reader := newOutMessageReader(ibroker)
+		for index := begin; index <= end; index++ {
+			ibtp := reader.get(destChain, index)
+			if ibtp == nil {
+				return boltvm.Error(fmt.Sprintf("out message %s does not exist", combineKey(destChain, index)))
+			}
+			ibtps = append(ibtps, ibtp)
+		}
+	}
+
+	data, err := json.Marshal(ibtps)
 	if err != nil {
 		return boltvm.Error(err.Error())
 	}
@@ -89,25 +189,31 @@ func (ibroker *InterRelayBroker) GetOutMessage(destChain string, index uint64) *
 // RecordIBTPs receives ibtps, adds index for them, and stores in counter and message maps,
 // called by inter-relaychain ibtp producer contracts
 func (ibroker *InterRelayBroker) RecordIBTPs(ibtpsBytes []byte) *boltvm.Response {
-	OutCounterMap := make(map[string]uint64)
-	OutMessageMap := make(map[string]*pb.IBTP)
-	ibroker.GetObject(OutCounterKey, &OutCounterMap)
-	ibroker.GetObject(OutMessageKey, &OutMessageMap)
-
 	ibtps := &pb.IBTPs{}
 	err := ibtps.Unmarshal(ibtpsBytes)
 	if err != nil {
 		return boltvm.Error(err.Error())
 	}
 
+	OutCounterMap := make(map[string]uint64)
 	for _, ibtp := range ibtps.Ibtps {
-		OutCounterMap[ibtp.To] = OutCounterMap[ibtp.To] + 1
-		ibtp.Index = OutCounterMap[ibtp.To]
-		OutMessageMap[combineKey(ibtp.To, ibtp.Index)] = ibtp
+		counter, ok := OutCounterMap[ibtp.To]
+		if !ok {
+			counter = ibroker.getOutCounter(ibtp.To)
+		}
+		OutCounterMap[ibtp.To] = counter + 1
+		ibtp.Index = counter + 1
+		ibroker.SetObject(outMessageKey(ibtp.To, ibtp.Index), ibtp)
 	}
 
-	ibroker.SetObject(OutCounterKey, OutCounterMap)
-	ibroker.SetObject(OutMessageKey, OutMessageMap)
+	dests := make([]string, 0, len(OutCounterMap))
+	for to := range OutCounterMap {
+		dests = append(dests, to)
+	}
+	sort.Strings(dests)
+	for _, to := range dests {
+		ibroker.SetObject(outCounterKey(to), &outCounter{To: to, Counter: OutCounterMap[to]})
+	}
 
 	newIbtps, err := ibtps.Marshal()
 	if err != nil {
@@ -117,6 +223,179 @@ func (ibroker *InterRelayBroker) RecordIBTPs(ibtpsBytes []byte) *boltvm.Response
 	return boltvm.Success(newIbtps)
 }
 
+// MigrateOutMessages moves the out counters and messages kept in the legacy
+// maps to their own keys and returns the number of messages left to move. The
+// first call splits the legacy message map into chunks of
+// OutMessagesMigrationBatch messages, which costs about as much as recording
+// an ibtp before upgrading, and every call after moves a chunk. Until the
+// migration is done the messages missing from their own keys are read from
+// the legacy map or the chunks
+func (ibroker *InterRelayBroker) MigrateOutMessages() *boltvm.Response {
+	left := ibroker.migrateOutMessages()
+
+	return boltvm.Success([]byte(strconv.Itoa(left)))
+}
+
+func (ibroker *InterRelayBroker) migrateOutMessages() int {
+	if ibroker.Has(OutCounterKey) || ibroker.Has(OutMessageKey) {
+		return ibroker.splitLegacyOutMessages()
+	}
+
+	migration := &outMigration{}
+	if !ibroker.GetObject(outMigrationKey, migration) {
+		return 0
+	}
+
+	var ibtps []*pb.IBTP
+	ibroker.GetObject(outMigrationChunkKey(migration.Next), &ibtps)
+	for _, ibtp := range ibtps {
+		ibroker.SetObject(outMessageKey(ibtp.To, ibtp.Index), ibtp)
+	}
+	ibroker.Delete(outMigrationChunkKey(migration.Next))
+
+	migration.Next++
+	migration.Left -= len(ibtps)
+	if migration.Next == len(migration.Chunks) {
+		ibroker.Delete(outMigrationKey)
+		return 0
+	}
+	ibroker.SetObject(outMigrationKey, migration)
+
+	return migration.Left
+}
+
+// splitLegacyOutMessages loads the legacy message map once and splits it into
+// chunks ordered by destination chain and index, the counters are moved and
+// the legacy maps deleted right away
+func (ibroker *InterRelayBroker) splitLegacyOutMessages() int {
+	OutMessageMap := make(map[string]*pb.IBTP)
+	ibroker.GetObject(OutMessageKey, &OutMessageMap)
+	ibtps := make([]*pb.IBTP, 0, len(OutMessageMap))
+	for _, ibtp := range OutMessageMap {
+		ibtps = append(ibtps, ibtp)
+	}
+	sort.Slice(ibtps, func(i, j int) bool {
+		if ibtps[i].To != ibtps[j].To {
+			return ibtps[i].To < ibtps[j].To
+		}
+		return ibtps[i].Index < ibtps[j].Index
+	})
+
+	migration := &outMigration{Left: len(ibtps)}
+	for begin := 0; begin < len(ibtps); {
+		end := begin + 1
+		for end < len(ibtps) && end-begin < OutMessagesMigrationBatch && ibtps[end].To == ibtps[begin].To {
+			end++
+		}
+		ibroker.SetObject(outMigrationChunkKey(len(migration.Chunks)), ibtps[begin:end])
+		migration.Chunks = append(migration.Chunks, outMigrationChunk{
+			To:    ibtps[begin].To,
+			First: ibtps[begin].Index,
+			Last:  ibtps[end-1].Index,
+		})
+		begin = end
+	}
+	if len(migration.Chunks) != 0 {
+		ibroker.SetObject(outMigrationKey, migration)
+	}
+
+	// the counters recorded after upgrading are kept
+	OutCounterMap := make(map[string]uint64)
+	ibroker.GetObject(OutCounterKey, &OutCounterMap)
+	dests := make([]string, 0, len(OutCounterMap))
+	for to := range OutCounterMap {
+		dests = append(dests, to)
+	}
+	sort.Strings(dests)
+	for _, to := range dests {
+		if !ibroker.Has(outCounterKey(to)) {
+			ibroker.SetObject(outCounterKey(to), &outCounter{To: to, Counter: OutCounterMap[to]})
+		}
+	}
+
+	ibroker.Delete(OutCounterKey)
+	ibroker.Delete(OutMessageKey)
+
+	return migration.Left
+}
+
+// getOutCounter falls back to the legacy counter map, which has an entry per
+// destination chain, until the migration splits it
+func (ibroker *InterRelayBroker) getOutCounter(destChain string) uint64 {
+	counter := &outCounter{}
+	if ibroker.GetObject(outCounterKey(destChain), counter) {
+		return counter.Counter
+	}
+
+	OutCounterMap := make(map[string]uint64)
+	ibroker.GetObject(OutCounterKey, &OutCounterMap)
+	return OutCounterMap[destChain]
+}
+
+// outMessageReader reads the out messages, the ones missing from their own
+// keys are read from the legacy map or the migration chunks, which are loaded
+// at most once per reader
+type outMessageReader struct {
+	ibroker   *InterRelayBroker
+	migration *outMigration
+	chunks    map[int][]*pb.IBTP
+	legacy    map[string]*pb.IBTP
+}
+
+func newOutMessageReader(ibroker *InterRelayBroker) *outMessageReader {
+	return &outMessageReader{
+		ibroker: ibroker,
+		chunks:  make(map[int][]*pb.IBTP),
+	}
+}
+
+func (r *outMessageReader) get(destChain string, index uint64) *pb.IBTP {
+	ibtp := &pb.IBTP{}
+	if r.ibroker.GetObject(outMessageKey(destChain, index), ibtp) {
+		return ibtp
+	}
+
+	if r.migration == nil {
+		r.migration = &outMigration{}
+		r.ibroker.GetObject(outMigrationKey, r.migration)
+	}
+	for seq := r.migration.Next; seq < len(r.migration.Chunks); seq++ {
+		chunk := r.migration.Chunks[seq]
+		if chunk.To != destChain || index < chunk.First || index > chunk.Last {
+			continue
+		}
+		ibtps, ok := r.chunks[seq]
+		if !ok {
+			r.ibroker.GetObject(outMigrationChunkKey(seq), &ibtps)
+			r.chunks[seq] = ibtps
+		}
+		for _, ibtp := range ibtps {
+			if ibtp.Index == index {
+				return ibtp
+			}
+		}
+		return nil
+	}
+
+	if r.legacy == nil {
+		r.legacy = make(map[string]*pb.IBTP)
+		r.ibroker.GetObject(OutMessageKey, &r.legacy)
+	}
+	return r.legacy[combineKey(destChain, index)]
+}
+
+func outCounterKey(destChain string) string {
+	return outCounterPrefix + destChain
+}
+
+func outMessageKey(destChain string, index uint64) string {
+	return fmt.Sprintf("%s%s-%d", outMessagePrefix, destChain, index)
+}
+
+func outMigrationChunkKey(seq int) string {
+	return fmt.Sprintf("%s%d", outMigrationChunkPrefix, seq)
+}
+
 // InvokeInterRelayContract receives inter-relaychain execution call and invokes
 func (ibroker *InterRelayBroker) InvokeInterRelayContract(addr string, fun string, args []byte) *boltvm.Response {
 	// ibroker.Logger().Info("In InvokeInterRelayContract....")
@@ -0,0 +1,225 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/meshplus/bitxhub-core/boltvm"
+	"github.com/meshplus/bitxhub-model/constant"
+	"github.com/meshplus/bitxhub-model/pb"
+)
+
+const (
+	// NodeManagerContractAddr is the address of the node manager contract
+	NodeManagerContractAddr constant.BoltContractAddress = "0x0000000000000000000000000000000000000016"
+
+	nodePrefix = "node-"
+
+	NodeAdd    = "add"
+	NodeRemove = "remove"
+
+	// MinConsensusNodes is the least number of consensus nodes, removing a
+	// node is rejected if fewer nodes would be left
+	MinConsensusNodes = 4
+)
+
+// NodeManager is the contract managing the consensus nodes
+type NodeManager struct {
+	boltvm.Stub
+}
+
+type Node struct {
+	Id      uint64   `json:"id"`
+	Pid     string   `json:"pid"`
+	Account string   `json:"account"`
+	Hosts   []string `json:"hosts"`
+}
+
+// NodeEvent is posted once a node change is approved, the node applies it to
+// its routing table and the consensus membership after the block is persisted
+type NodeEvent struct {
+	Operation string `json:"node_operation"`
+	Node      *Node  `json:"node"`
+}
+
+// AddNode proposes to add the consensus node, hosts are the comma separated
+// multiaddrs of the node
+func (nm *NodeManager) AddNode(id uint64, pid, account, hosts string) *boltvm.Response {
+	if id == 0 || pid == "" {
+		return boltvm.Error("node id and pid are required")
+	}
+	if nm.Has(NodeKey(pid)) {
+		return boltvm.Error(fmt.Sprintf("node %s has been added", pid))
+	}
+
+	node := &Node{
+		Id:      id,
+		Pid:     pid,
+		Account: account,
+	}
+	for _, host := range strings.Split(hosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			node.Hosts = append(node.Hosts, host)
+		}
+	}
+	if len(node.Hosts) == 0 {
+		return boltvm.Error("node hosts are required")
+	}
+
+	return nm.submitProposal(NodeAdd, node)
+}
+
+// RemoveNode proposes to remove the consensus node. The id is only used for
+// the nodes which are not recorded by the contract, such as the genesis nodes
+// of a chain whose genesis does not list them
+func (nm *NodeManager) RemoveNode(id uint64, pid string) *boltvm.Response {
+	node := &Node{}
+	if !nm.GetObject(NodeKey(pid), node) {
+		if id == 0 || pid == "" {
+			return boltvm.Error("node id and pid are required")
+		}
+		node = &Node{Id: id, Pid: pid}
+	}
+	if err := nm.checkRemovable(node.Pid); err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return nm.submitProposal(NodeRemove, node)
+}
+
+// checkRemovable makes sure at least MinConsensusNodes recorded nodes are left
+// after the node is removed
+func (nm *NodeManager) checkRemovable(pid string) error {
+	remaining := 0
+	if ok, value := nm.Query(nodePrefix); ok {
+		remaining = len(value)
+	}
+	if nm.Has(NodeKey(pid)) {
+		remaining--
+	}
+	if remaining < MinConsensusNodes {
+		return fmt.Errorf("can't remove node %s as only %d consensus nodes would be left", pid, remaining)
+	}
+
+	return nil
+}
+
+func (nm *NodeManager) submitProposal(des string, node *Node) *boltvm.Response {
+	data, err := json.Marshal(node)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return nm.CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(nm.Caller()),
+		pb.String(des),
+		pb.String(string(NodeMgr)),
+		pb.Bytes(data),
+	)
+}
+
+// Manager adds or removes the node in the extra of a closed NodeMgr proposal,
+// it is only callable from the governance contract
+func (nm *NodeManager) Manager(des string, proposalResult string, extra []byte) *boltvm.Response {
+	if res := checkGovernance(nm.Stub); !res.Ok {
+		return res
+	}
+
+	node := &Node{}
+	if err := json.Unmarshal(extra, node); err != nil {
+		return boltvm.Error("unmarshal json error:" + err.Error())
+	}
+	if node.Id == 0 || node.Pid == "" {
+		return boltvm.Error("node id or pid is empty")
+	}
+
+	if proposalResult != string(APPOVED) {
+		return boltvm.Success(nil)
+	}
+
+	switch des {
+	case NodeAdd:
+		if nm.Has(NodeKey(node.Pid)) {
+			return boltvm.Error(fmt.Sprintf("node %s has been added", node.Pid))
+		}
+		nm.SetObject(NodeKey(node.Pid), node)
+	case NodeRemove:
+		// other removals may have been approved since the proposal was submitted
+		if err := nm.checkRemovable(node.Pid); err != nil {
+			return boltvm.Error(err.Error())
+		}
+		nm.Delete(NodeKey(node.Pid))
+	default:
+		return boltvm.Error("unsupported node event: " + des)
+	}
+
+	nm.PostEvent(&NodeEvent{
+		Operation: des,
+		Node:      node,
+	})
+
+	return boltvm.Success(nil)
+}
+
+// GetNode returns the node info by pid
+func (nm *NodeManager) GetNode(pid string) *boltvm.Response {
+	ok, data := nm.Get(NodeKey(pid))
+	if !ok {
+		return boltvm.Error(fmt.Sprintf("node %s does not exist", pid))
+	}
+
+	return boltvm.Success(data)
+}
+
+// Nodes returns all managed nodes
+func (nm *NodeManager) Nodes() *boltvm.Response {
+	ok, value := nm.Query(nodePrefix)
+	if !ok {
+		return boltvm.Success(nil)
+	}
+
+	nodes := make([]*Node, 0, len(value))
+	for _, data := range value {
+		node := &Node{}
+		if err := json.Unmarshal(data, node); err != nil {
+			return boltvm.Error(err.Error())
+		}
+		nodes = append(nodes, node)
+	}
+
+	data, err := json.Marshal(nodes)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return boltvm.Success(data)
+}
+
+func NodeKey(pid string) string {
+	return nodePrefix + pid
+}
+
+// ParseNodeEvent returns the node event posted by the node manager, false if
+// the event is not a node event
+func ParseNodeEvent(ev *pb.Event) (*NodeEvent, bool) {
+	if ev.Interchain {
+		return nil, false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(ev.Data, &fields); err != nil || len(fields) != 2 ||
+		fields["node_operation"] == nil || fields["node"] == nil {
+		return nil, false
+	}
+
+	e := &NodeEvent{}
+	if err := json.Unmarshal(ev.Data, e); err != nil || e.Node == nil {
+		return nil, false
+	}
+	if e.Operation != NodeAdd && e.Operation != NodeRemove {
+		return nil, false
+	}
+
+	return e, true
+}
@@ -0,0 +1,143 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/meshplus/bitxhub-core/boltvm"
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/constant"
+	"github.com/meshplus/bitxhub/internal/repo"
+)
+
+const (
+	// PermissionContractAddr is the address of the permission manager contract
+	PermissionContractAddr constant.BoltContractAddress = "0x0000000000000000000000000000000000000017"
+
+	permissionPrefix = "permission-"
+
+	PermissionSet    = "set"
+	PermissionRemove = "remove"
+
+	// RoleAnyone allows every account to call the method
+	RoleAnyone = "anyone"
+	// RoleAdmin allows the governance admins to call the method
+	RoleAdmin = "admin"
+	// RoleAppchainAdmin allows the registered appchains to call the method
+	RoleAppchainAdmin = "appchain_admin"
+	// RoleContract allows the bolt contracts to cross invoke the method
+	RoleContract = "contract"
+)
+
+// defaultRoles are the roles allowed to call the sensitive methods of the
+// built-in contracts, besides the Manager methods executing the proposals
+var defaultRoles = map[string][]string{
+	PermissionKey(constant.InterchainContractAddr.String(), "DeleteInterchain"):  {RoleAdmin, RoleContract},
+	PermissionKey(constant.InterchainContractAddr.String(), "DrainPendingIBTPs"): {RoleContract},
+	PermissionKey(constant.StoreContractAddr.String(), "Set"):                    {RoleAdmin},
+}
+
+// PermissionManager is the contract managing the roles allowed to call the
+// methods of bolt contracts. The permissions override the default roles of the
+// sensitive built-in methods, other methods without permission are open to
+// anyone. Unknown roles are treated as account addresses.
+type PermissionManager struct {
+	boltvm.Stub
+}
+
+// DefaultRoles returns the roles allowed to call the method of the built-in
+// contract if it has no permission, nil means the method is open to anyone.
+// The Manager methods are restricted to the bolt contracts, the handlers check
+// themselves that the caller is the governance contract.
+func DefaultRoles(contract, method string) []string {
+	if method == "Manager" {
+		return []string{RoleContract}
+	}
+
+	return defaultRoles[PermissionKey(contract, method)]
+}
+
+// Manager sets or removes the permission in the extra of a closed PermissionMgr
+// proposal, it is only callable from the governance contract
+func (pm *PermissionManager) Manager(des string, proposalResult string, extra []byte) *boltvm.Response {
+	if res := checkGovernance(pm.Stub); !res.Ok {
+		return res
+	}
+
+	perm := &repo.Permission{}
+	if err := json.Unmarshal(extra, perm); err != nil {
+		return boltvm.Error("unmarshal json error:" + err.Error())
+	}
+	if err := checkPermission(perm); err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	if proposalResult != string(APPOVED) {
+		return boltvm.Success(nil)
+	}
+
+	key := PermissionKey(perm.Contract, perm.Method)
+	switch des {
+	case PermissionSet:
+		pm.SetObject(key, perm)
+	case PermissionRemove:
+		if !pm.Has(key) {
+			return boltvm.Error(fmt.Sprintf("permission of method %s of contract %s does not exist", perm.Method, perm.Contract))
+		}
+		pm.Delete(key)
+	default:
+		return boltvm.Error("unsupported permission event: " + des)
+	}
+
+	return boltvm.Success(nil)
+}
+
+// GetPermission returns the permission of the method of the contract
+func (pm *PermissionManager) GetPermission(contract, method string) *boltvm.Response {
+	ok, data := pm.Get(PermissionKey(contract, method))
+	if !ok {
+		return boltvm.Error(fmt.Sprintf("permission of method %s of contract %s does not exist", method, contract))
+	}
+
+	return boltvm.Success(data)
+}
+
+// Permissions returns all permissions
+func (pm *PermissionManager) Permissions() *boltvm.Response {
+	ok, value := pm.Query(permissionPrefix)
+	if !ok {
+		return boltvm.Success(nil)
+	}
+
+	perms := make([]*repo.Permission, 0, len(value))
+	for _, data := range value {
+		perm := &repo.Permission{}
+		if err := json.Unmarshal(data, perm); err != nil {
+			return boltvm.Error(err.Error())
+		}
+		perms = append(perms, perm)
+	}
+
+	data, err := json.Marshal(perms)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return boltvm.Success(data)
+}
+
+// PermissionKey returns the key of the permission of the method of the contract
+func PermissionKey(contract, method string) string {
+	if addr := types.NewAddressByStr(contract); addr != nil {
+		contract = addr.String()
+	}
+	return permissionPrefix + contract + "-" + method
+}
+
+func checkPermission(perm *repo.Permission) error {
+	if types.NewAddressByStr(perm.Contract) == nil || perm.Method == "" || len(perm.Roles) == 0 {
+		return fmt.Errorf("illegal permission info")
+	}
+
+	return nil
+}
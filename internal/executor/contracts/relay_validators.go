@@ -0,0 +1,166 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	appchainMgr "github.com/meshplus/bitxhub-core/appchain-mgr"
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/crypto/asym"
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/pb"
+)
+
+type ThresholdPolicy string
+
+const (
+	// BftFPlusOne requires the signs of more than 1/3 of the total weight,
+	// at least one of which is honest
+	BftFPlusOne ThresholdPolicy = "bft_f+1"
+	// BftTwoFPlusOne requires the signs of more than 2/3 of the total weight
+	BftTwoFPlusOne ThresholdPolicy = "bft_2f+1"
+	// CustomThreshold requires the signs of the weight set in Threshold
+	CustomThreshold ThresholdPolicy = "custom"
+)
+
+// RelayValidator is a validator of a relay chain signing the union IBTPs
+type RelayValidator struct {
+	Address string `json:"address"`
+	Weight  uint64 `json:"weight"`
+}
+
+// BxhValidators is the validator set registered as the validators of a relay
+// chain. Addresses is the legacy format whose validators weigh 1 each, and the
+// policy is BFT f+1 if it is not set.
+type BxhValidators struct {
+	Addresses  []string          `json:"addresses,omitempty"`
+	Validators []*RelayValidator `json:"validators,omitempty"`
+	Policy     ThresholdPolicy   `json:"policy,omitempty"`
+	Threshold  uint64            `json:"threshold,omitempty"`
+}
+
+// ParseBxhValidators parses and checks the validators of a relay chain, the
+// addresses must be valid and the total weight must not overflow
+func ParseBxhValidators(data string) (*BxhValidators, error) {
+	if data == "" {
+		return nil, fmt.Errorf("empty validators")
+	}
+
+	validators := &BxhValidators{}
+	if err := json.Unmarshal([]byte(data), validators); err != nil {
+		return nil, fmt.Errorf("unmarshal validators: %w", err)
+	}
+	if len(validators.Validators) == 0 {
+		for _, addr := range validators.Addresses {
+			validators.Validators = append(validators.Validators, &RelayValidator{Address: addr, Weight: 1})
+		}
+	}
+	validators.Addresses = nil
+	if validators.Policy == "" {
+		validators.Policy = BftFPlusOne
+	}
+
+	if len(validators.Validators) == 0 {
+		return nil, fmt.Errorf("empty validators")
+	}
+	addrs := make(map[string]struct{}, len(validators.Validators))
+	var total uint64
+	for _, v := range validators.Validators {
+		if types.NewAddressByStr(v.Address) == nil {
+			return nil, fmt.Errorf("invalid validator address %s", v.Address)
+		}
+		if v.Weight == 0 {
+			return nil, fmt.Errorf("weight of validator %s is 0", v.Address)
+		}
+		if v.Weight > math.MaxUint64-total {
+			return nil, fmt.Errorf("total weight of validators overflows")
+		}
+		total += v.Weight
+		if _, ok := addrs[v.Address]; ok {
+			return nil, fmt.Errorf("duplicated validator %s", v.Address)
+		}
+		addrs[v.Address] = struct{}{}
+	}
+
+	switch validators.Policy {
+	case BftFPlusOne, BftTwoFPlusOne:
+	case CustomThreshold:
+		if validators.Threshold == 0 || validators.Threshold > validators.TotalWeight() {
+			return nil, fmt.Errorf("custom threshold %d is out of range (0, %d]", validators.Threshold, validators.TotalWeight())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported threshold policy %s", validators.Policy)
+	}
+
+	return validators, nil
+}
+
+// TotalWeight returns the weight of all validators
+func (v *BxhValidators) TotalWeight() uint64 {
+	var total uint64
+	for _, validator := range v.Validators {
+		total += validator.Weight
+	}
+
+	return total
+}
+
+// RequiredWeight returns the weight of the validators whose signs are required
+// by the threshold policy, f is the max faulty weight of the total weight
+func (v *BxhValidators) RequiredWeight() uint64 {
+	f := (v.TotalWeight() - 1) / 3
+	switch v.Policy {
+	case BftTwoFPlusOne:
+		return 2*f + 1
+	case CustomThreshold:
+		return v.Threshold
+	default:
+		return f + 1
+	}
+}
+
+// VerifyMultiSign verifies the signs of the union IBTP from the relay chain, it
+// succeeds once the signing validators reach the weight required by the policy
+// of the relay chain
+func VerifyMultiSign(app *appchainMgr.Appchain, ibtp *pb.IBTP, signData []byte) (bool, error) {
+	if "" == app.Validators {
+		return false, fmt.Errorf("empty validators in relay chain:%s", app.ID)
+	}
+	validators, err := ParseBxhValidators(app.Validators)
+	if err != nil {
+		return false, fmt.Errorf("invalid validators in relay chain %s: %w", app.ID, err)
+	}
+
+	weights := make(map[string]uint64, len(validators.Validators))
+	for _, validator := range validators.Validators {
+		weights[validator.Address] = validator.Weight
+	}
+
+	var signs pb.SignResponse
+	if err := signs.Unmarshal(signData); err != nil {
+		return false, err
+	}
+
+	required := validators.RequiredWeight()
+	var counter uint64
+
+	ibtpHash := ibtp.Hash()
+	hash := sha256.Sum256([]byte(ibtpHash.String()))
+	for v, sign := range signs.Sign {
+		weight, ok := weights[v]
+		if !ok {
+			return false, fmt.Errorf("wrong validator: %s", v)
+		}
+		addr := types.NewAddressByStr(v)
+		ok, _ = asym.Verify(crypto.Secp256k1, sign, hash[:], *addr)
+		if ok {
+			counter += weight
+		}
+		if counter >= required {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("multi signs verify fail, weight: %d, required: %d", counter, required)
+}
@@ -10,7 +10,12 @@ import (
 )
 
 const (
-	adminRolesKey = "admin-roles"
+	// AdminRolesKey is the key of the admins in the role contract
+	AdminRolesKey = "admin-roles"
+
+	AdminAdd          = "add"
+	AdminRemove       = "remove"
+	AdminUpdateWeight = "update_weight"
 )
 
 type Role struct {
@@ -19,7 +24,7 @@ type Role struct {
 
 func (r *Role) GetRole() *boltvm.Response {
 	var admins []*repo.Admin
-	r.GetObject(adminRolesKey, &admins)
+	r.GetObject(AdminRolesKey, &admins)
 
 	for _, admin := range admins {
 		if admin.Address == r.Caller() {
@@ -37,7 +42,7 @@ func (r *Role) GetRole() *boltvm.Response {
 
 func (r *Role) IsAdmin(address string) *boltvm.Response {
 	var admins []*repo.Admin
-	r.GetObject(adminRolesKey, &admins)
+	r.GetObject(AdminRolesKey, &admins)
 
 	for _, admin := range admins {
 		if admin.Address == address {
@@ -50,7 +55,7 @@ func (r *Role) IsAdmin(address string) *boltvm.Response {
 
 func (r *Role) GetAdminRoles() *boltvm.Response {
 	var admins []*repo.Admin
-	r.GetObject(adminRolesKey, &admins)
+	r.GetObject(AdminRolesKey, &admins)
 
 	ret, err := json.Marshal(admins)
 	if err != nil {
@@ -60,31 +65,105 @@ func (r *Role) GetAdminRoles() *boltvm.Response {
 	return boltvm.Success(ret)
 }
 
-func (r *Role) SetAdminRoles(addrs string) *boltvm.Response {
-	as := make([]string, 0)
-	if err := json.Unmarshal([]byte(addrs), &as); err != nil {
-		return boltvm.Error(err.Error())
+func (r *Role) GetRoleWeight(address string) *boltvm.Response {
+	var admins []*repo.Admin
+	r.GetObject(AdminRolesKey, &admins)
+
+	for _, admin := range admins {
+		if admin.Address == address {
+			return boltvm.Success([]byte(strconv.Itoa(int(admin.Weight))))
+		}
+	}
+
+	return boltvm.Error("account at the address does not exist:" + address)
+}
+
+// Manager changes the admin set with the admin in the extra of a closed RoleMgr proposal
+func (r *Role) Manager(des string, proposalResult string, extra []byte) *boltvm.Response {
+	admin := &repo.Admin{}
+	if err := json.Unmarshal(extra, admin); err != nil {
+		return boltvm.Error("unmarshal json error:" + err.Error())
+	}
+
+	if proposalResult != string(APPOVED) {
+		return boltvm.Success(nil)
+	}
+
+	switch des {
+	case AdminAdd:
+		return r.AddAdmin(admin.Address, admin.Weight)
+	case AdminRemove:
+		return r.RemoveAdmin(admin.Address)
+	case AdminUpdateWeight:
+		return r.UpdateWeight(admin.Address, admin.Weight)
+	default:
+		return boltvm.Error("unsupported admin event: " + des)
+	}
+}
+
+// AddAdmin adds an administrator with the weight, it is only callable from the governance contract
+func (r *Role) AddAdmin(address string, weight uint64) *boltvm.Response {
+	if res := checkGovernance(r.Stub); !res.Ok {
+		return res
+	}
+	if address == "" || weight == 0 {
+		return boltvm.Error("illegal admin address or weight")
 	}
 
-	admins := make([]*repo.Admin, 0)
-	for _, addr := range as {
-		admins = append(admins, &repo.Admin{
-			Address: addr,
-			Weight:  1,
-		})
+	var admins []*repo.Admin
+	r.GetObject(AdminRolesKey, &admins)
+	for _, admin := range admins {
+		if admin.Address == address {
+			return boltvm.Error("admin already exists: " + address)
+		}
 	}
 
-	r.SetObject(adminRolesKey, admins)
+	admins = append(admins, &repo.Admin{
+		Address: address,
+		Weight:  weight,
+	})
+	r.SetObject(AdminRolesKey, admins)
 	return boltvm.Success(nil)
 }
 
-func (r *Role) GetRoleWeight(address string) *boltvm.Response {
+// RemoveAdmin removes an administrator, it is only callable from the governance contract
+func (r *Role) RemoveAdmin(address string) *boltvm.Response {
+	if res := checkGovernance(r.Stub); !res.Ok {
+		return res
+	}
+
 	var admins []*repo.Admin
-	r.GetObject(adminRolesKey, &admins)
+	r.GetObject(AdminRolesKey, &admins)
+	for i, admin := range admins {
+		if admin.Address == address {
+			if len(admins) == 1 {
+				return boltvm.Error("can not remove the last admin")
+			}
+			admins = append(admins[:i], admins[i+1:]...)
+			r.SetObject(AdminRolesKey, admins)
+			return boltvm.Success(nil)
+		}
+	}
+
+	return boltvm.Error("account at the address does not exist:" + address)
+}
 
+// UpdateWeight changes the weight of an administrator, it is only callable from the governance contract
+func (r *Role) UpdateWeight(address string, weight uint64) *boltvm.Response {
+	if res := checkGovernance(r.Stub); !res.Ok {
+		return res
+	}
+	if weight == 0 {
+		return boltvm.Error("illegal admin weight")
+	}
+
+	var admins []*repo.Admin
+	r.GetObject(AdminRolesKey, &admins)
 	for _, admin := range admins {
 		if admin.Address == address {
-			return boltvm.Success([]byte(strconv.Itoa(int(admin.Weight))))
+			admin.Weight = weight
+			r.SetObject(AdminRolesKey, admins)
+			return boltvm.Success(nil)
 		}
 	}
 
@@ -1,6 +1,7 @@
 package contracts
 
 import (
+	"encoding/json"
 	"fmt"
 
 	appchainMgr "github.com/meshplus/bitxhub-core/appchain-mgr"
@@ -10,8 +11,20 @@ import (
 	"github.com/meshplus/bitxhub-model/pb"
 )
 
+type RuleStatus string
+
 const (
-	rulePrefix = "rule-"
+	rulePrefix        = "rule-"
+	ruleHistoryPrefix = "rule-history-"
+
+	RuleRegistered RuleStatus = "registered"
+	RuleBinding    RuleStatus = "binding"
+	RuleBound      RuleStatus = "bound"
+	RuleUnbound    RuleStatus = "unbound"
+	RuleDeprecated RuleStatus = "deprecated"
+
+	// RuleBind is the description of the RuleMgr proposal binding a rule
+	RuleBind = "bind"
 )
 
 // RuleManager is the contract manage validation rules
@@ -19,9 +32,31 @@ type RuleManager struct {
 	boltvm.Stub
 }
 
+// Rule is a version of the validation rule of an appchain, at most one rule of
+// an appchain is bound and used to verify its IBTPs
 type Rule struct {
+	Address string     `json:"address"`
+	Status  RuleStatus `json:"status"`
+}
+
+// legacyRule is the only rule of an appchain stored before rules are
+// versioned, it verifies the IBTPs of the appchain whatever its status is
+type legacyRule struct {
+	Address string `json:"address"`
+	Status  int32  `json:"status"`
+}
+
+// RuleBindingRecord records the heights of the blocks whose IBTPs are
+// verified by the rule, EndHeight is 0 if the rule is still bound
+type RuleBindingRecord struct {
+	Address     string `json:"address"`
+	BeginHeight uint64 `json:"begin_height"`
+	EndHeight   uint64 `json:"end_height"`
+}
+
+type ruleProposal struct {
+	ChainID string `json:"chain_id"`
 	Address string `json:"address"`
-	Status  int32  `json:"status"` // 0 => registered, 1 => approved, -1 => rejected
 }
 
 type ruleRecord struct {
@@ -30,64 +65,279 @@ type ruleRecord struct {
 	Desc       string `json:"desc"`
 }
 
-// SetRule can map the validation rule address with the chain id
+// RegisterRule adds a new version of the validation rule of the appchain of the caller
 func (r *RuleManager) RegisterRule(id string, address string) *boltvm.Response {
+	if id != r.Caller() {
+		return boltvm.Error("caller is not the appchain")
+	}
 
 	if res := r.CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(id)); !res.Ok {
 		return boltvm.Error("this appchain does not exist")
 	}
 
-	rl := &Rule{
+	rules := r.getRules(id)
+	if rl := findRule(rules, address); rl != nil {
+		return boltvm.Error(fmt.Sprintf("rule %s has been registered", address))
+	}
+
+	rules = append(rules, &Rule{
 		Address: address,
-		Status:  0,
+		Status:  RuleRegistered,
+	})
+	r.SetObject(RuleKey(id), rules)
+
+	return boltvm.Success(nil)
+}
+
+// BindRule proposes to bind the registered rule to the appchain of the caller,
+// the bound rule is replaced once the proposal is approved
+func (r *RuleManager) BindRule(id string, address string) *boltvm.Response {
+	if id != r.Caller() {
+		return boltvm.Error("caller is not the appchain")
+	}
+
+	rules := r.getRules(id)
+	rl := findRule(rules, address)
+	if rl == nil {
+		return boltvm.Error(fmt.Sprintf("rule %s does not exist", address))
+	}
+	if rl.Status != RuleRegistered && rl.Status != RuleUnbound {
+		return boltvm.Error(fmt.Sprintf("rule %s is %s, can not be bound", address, rl.Status))
+	}
+	for _, other := range rules {
+		if other.Status == RuleBinding {
+			return boltvm.Error(fmt.Sprintf("rule %s is binding", other.Address))
+		}
 	}
-	r.SetObject(RuleKey(id), rl)
+
+	extra, err := json.Marshal(&ruleProposal{ChainID: id, Address: address})
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	res := r.CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(r.Caller()),
+		pb.String(RuleBind),
+		pb.String(string(RuleMgr)),
+		pb.Bytes(extra),
+	)
+	if !res.Ok {
+		return res
+	}
+
+	rl.Status = RuleBinding
+	r.SetObject(RuleKey(id), rules)
+
+	return res
+}
+
+// DeprecateRule deprecates the rule of the appchain of the caller which is not
+// bound, a deprecated rule can not be bound any more
+func (r *RuleManager) DeprecateRule(id string, address string) *boltvm.Response {
+	if id != r.Caller() {
+		return boltvm.Error("caller is not the appchain")
+	}
+
+	rules := r.getRules(id)
+	rl := findRule(rules, address)
+	if rl == nil {
+		return boltvm.Error(fmt.Sprintf("rule %s does not exist", address))
+	}
+	if rl.Status != RuleRegistered && rl.Status != RuleUnbound {
+		return boltvm.Error(fmt.Sprintf("rule %s is %s, can not be deprecated", address, rl.Status))
+	}
+
+	rl.Status = RuleDeprecated
+	r.SetObject(RuleKey(id), rules)
+
 	return boltvm.Success(nil)
 }
 
+// GetRuleAddress returns the address of the rule bound to the appchain, the
+// default fabric rule is used by fabric appchains never registering a rule
 func (r *RuleManager) GetRuleAddress(id, chainType string) *boltvm.Response {
-	rl := &Rule{}
-
-	ok := r.GetObject(RuleKey(id), rl)
-	if ok {
+	rules := r.getRules(id)
+	if rl := BoundRule(rules); rl != nil {
 		return boltvm.Success([]byte(rl.Address))
 	}
-
-	if chainType == "fabric" {
+	if len(rules) == 0 && chainType == appchainMgr.FabricType {
 		return boltvm.Success([]byte(validator.FabricRuleAddr))
 	}
 
-	return boltvm.Error("")
+	return boltvm.Error(fmt.Sprintf("appchain %s has no bound rule", id))
 }
 
-func (r *RuleManager) Audit(id string, isApproved int32, desc string) *boltvm.Response {
-	rl := &Rule{}
-	ok := r.GetObject(RuleKey(id), rl)
-	if !ok {
+// Rules returns all versions of the rule of the appchain
+func (r *RuleManager) Rules(id string) *boltvm.Response {
+	data, err := json.Marshal(r.getRules(id))
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return boltvm.Success(data)
+}
+
+// GetRuleHistory returns the bindings of the rules which verified the IBTPs of
+// the appchain in blocks from begin to end, end 0 means the latest block
+func (r *RuleManager) GetRuleHistory(id string, begin, end uint64) *boltvm.Response {
+	if end != 0 && begin > end {
+		return boltvm.Error(fmt.Sprintf("invalid height range [%d, %d]", begin, end))
+	}
+
+	var history []*RuleBindingRecord
+	r.GetObject(ruleHistoryKey(id), &history)
+
+	ret := make([]*RuleBindingRecord, 0)
+	for _, binding := range history {
+		if end != 0 && binding.BeginHeight > end {
+			continue
+		}
+		if binding.EndHeight != 0 && binding.EndHeight < begin {
+			continue
+		}
+		ret = append(ret, binding)
+	}
+
+	data, err := json.Marshal(ret)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return boltvm.Success(data)
+}
+
+// Manager binds the rule in the extra of a closed RuleMgr proposal, it is only
+// callable from the governance contract
+func (r *RuleManager) Manager(des string, proposalResult string, extra []byte) *boltvm.Response {
+	if res := checkGovernance(r.Stub); !res.Ok {
+		return res
+	}
+
+	if des != RuleBind {
+		return boltvm.Error("unsupported rule event: " + des)
+	}
+
+	proposal := &ruleProposal{}
+	if err := json.Unmarshal(extra, proposal); err != nil {
+		return boltvm.Error("unmarshal json error:" + err.Error())
+	}
+
+	rules := r.getRules(proposal.ChainID)
+	rl := findRule(rules, proposal.Address)
+	if rl == nil {
 		return boltvm.Error(fmt.Errorf("this rule does not exist").Error())
 	}
-	rl.Status = isApproved
+	if rl.Status != RuleBinding {
+		return boltvm.Error(fmt.Sprintf("rule %s is %s, not binding", rl.Address, rl.Status))
+	}
 
-	record := &ruleRecord{
-		Rule:       rl,
-		IsApproved: isApproved == appchainMgr.APPROVED,
-		Desc:       desc,
+	var history []*RuleBindingRecord
+	r.GetObject(ruleHistoryKey(proposal.ChainID), &history)
+
+	approved := proposalResult == string(APPOVED)
+	if approved {
+		// IBTPs are verified before the block is executed, so the rule bound
+		// in this block verifies the IBTPs from the next block
+		height := currentHeight(r.Stub)
+		for _, other := range rules {
+			if other.Status == RuleBound {
+				other.Status = RuleUnbound
+			}
+		}
+		for _, binding := range history {
+			if binding.EndHeight == 0 {
+				binding.EndHeight = height
+			}
+		}
+		rl.Status = RuleBound
+		history = append(history, &RuleBindingRecord{
+			Address:     rl.Address,
+			BeginHeight: height + 1,
+		})
+		r.SetObject(ruleHistoryKey(proposal.ChainID), history)
+	} else {
+		rl.Status = RuleRegistered
+		for _, binding := range history {
+			if binding.Address == rl.Address {
+				rl.Status = RuleUnbound
+				break
+			}
+		}
 	}
 
 	var records []*ruleRecord
-	r.GetObject(r.ruleRecordKey(id), &records)
-	records = append(records, record)
+	r.GetObject(r.ruleRecordKey(proposal.ChainID), &records)
+	records = append(records, &ruleRecord{
+		Rule:       rl,
+		IsApproved: approved,
+		Desc:       des,
+	})
 
-	r.SetObject(r.ruleRecordKey(id), records)
-	r.SetObject(RuleKey(id), rl)
+	r.SetObject(r.ruleRecordKey(proposal.ChainID), records)
+	r.SetObject(RuleKey(proposal.ChainID), rules)
 
 	return boltvm.Success(nil)
 }
 
+func (r *RuleManager) getRules(id string) []*Rule {
+	ok, data := r.Get(RuleKey(id))
+	if !ok {
+		return nil
+	}
+
+	rules, err := UnmarshalRules(data)
+	if err != nil {
+		return nil
+	}
+
+	return rules
+}
+
+// UnmarshalRules unmarshals the rule versions of an appchain, the rule stored
+// in the legacy single rule format is read as the bound rule
+func UnmarshalRules(data []byte) ([]*Rule, error) {
+	var rules []*Rule
+	if err := json.Unmarshal(data, &rules); err == nil {
+		return rules, nil
+	}
+
+	rl := &legacyRule{}
+	if err := json.Unmarshal(data, rl); err != nil {
+		return nil, err
+	}
+
+	return []*Rule{{Address: rl.Address, Status: RuleBound}}, nil
+}
+
+// BoundRule returns the bound rule of the rule versions, nil if none is bound
+func BoundRule(rules []*Rule) *Rule {
+	for _, rl := range rules {
+		if rl.Status == RuleBound {
+			return rl
+		}
+	}
+
+	return nil
+}
+
+func findRule(rules []*Rule, address string) *Rule {
+	for _, rl := range rules {
+		if rl.Address == address {
+			return rl
+		}
+	}
+
+	return nil
+}
+
 func RuleKey(id string) string {
 	return rulePrefix + id
 }
 
+func ruleHistoryKey(id string) string {
+	return ruleHistoryPrefix + id
+}
+
 func (r *RuleManager) ruleRecordKey(id string) string {
 	return "audit-record-" + id
 }
@@ -0,0 +1,239 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/meshplus/bitxhub-core/boltvm"
+	"github.com/meshplus/bitxhub-model/constant"
+	"github.com/meshplus/bitxhub-model/pb"
+)
+
+const (
+	servicePrefix = "service-"
+
+	ServiceRegister = "register"
+	ServiceUpdate   = "update"
+	ServiceRemove   = "remove"
+)
+
+// ServiceManager is the contract registering the services exposed by appchains
+type ServiceManager struct {
+	boltvm.Stub
+}
+
+// Service is a contract or service exposed by an appchain, only the chains in
+// its whitelist are allowed to invoke it through interchain txs
+type Service struct {
+	ChainID   string   `json:"chain_id"`
+	ServiceID string   `json:"service_id"`
+	Desc      string   `json:"desc"`
+	Whitelist []string `json:"whitelist"`
+}
+
+// RegisterService proposes to register the service of the appchain of the
+// caller, whitelist is the comma separated ids of the chains allowed to call it
+func (sm *ServiceManager) RegisterService(chainID, serviceID, desc, whitelist string) *boltvm.Response {
+	service, err := sm.newService(chainID, serviceID, desc, whitelist)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+	if sm.Has(ServiceKey(chainID, serviceID)) {
+		return boltvm.Error(fmt.Sprintf("service %s of appchain %s has been registered", serviceID, chainID))
+	}
+	if res := sm.CrossInvoke(constant.AppchainMgrContractAddr.String(), "GetAppchain", pb.String(chainID)); !res.Ok {
+		return boltvm.Error("this appchain does not exist")
+	}
+
+	return sm.submitProposal(ServiceRegister, service)
+}
+
+// UpdateService proposes to replace the description and the whitelist of the
+// registered service of the appchain of the caller
+func (sm *ServiceManager) UpdateService(chainID, serviceID, desc, whitelist string) *boltvm.Response {
+	service, err := sm.newService(chainID, serviceID, desc, whitelist)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+	if !sm.Has(ServiceKey(chainID, serviceID)) {
+		return boltvm.Error(fmt.Sprintf("service %s of appchain %s does not exist", serviceID, chainID))
+	}
+
+	return sm.submitProposal(ServiceUpdate, service)
+}
+
+// RemoveService proposes to remove the registered service of the appchain of
+// the caller
+func (sm *ServiceManager) RemoveService(chainID, serviceID string) *boltvm.Response {
+	if chainID != sm.Caller() {
+		return boltvm.Error("caller is not the appchain")
+	}
+
+	service := &Service{}
+	if !sm.GetObject(ServiceKey(chainID, serviceID), service) {
+		return boltvm.Error(fmt.Sprintf("service %s of appchain %s does not exist", serviceID, chainID))
+	}
+
+	return sm.submitProposal(ServiceRemove, service)
+}
+
+func (sm *ServiceManager) newService(chainID, serviceID, desc, whitelist string) (*Service, error) {
+	if chainID != sm.Caller() {
+		return nil, fmt.Errorf("caller is not the appchain")
+	}
+	if serviceID == "" {
+		return nil, fmt.Errorf("service id is required")
+	}
+
+	service := &Service{
+		ChainID:   chainID,
+		ServiceID: serviceID,
+		Desc:      desc,
+	}
+	for _, id := range strings.Split(whitelist, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			service.Whitelist = append(service.Whitelist, id)
+		}
+	}
+
+	return service, nil
+}
+
+func (sm *ServiceManager) submitProposal(des string, service *Service) *boltvm.Response {
+	data, err := json.Marshal(service)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return sm.CrossInvoke(constant.GovernanceContractAddr.String(), "SubmitProposal",
+		pb.String(sm.Caller()),
+		pb.String(des),
+		pb.String(string(ServiceMgr)),
+		pb.Bytes(data),
+	)
+}
+
+// Manager registers, updates or removes the service in the extra of a closed
+// ServiceMgr proposal, it is only callable from the governance contract
+func (sm *ServiceManager) Manager(des string, proposalResult string, extra []byte) *boltvm.Response {
+	if res := checkGovernance(sm.Stub); !res.Ok {
+		return res
+	}
+
+	service := &Service{}
+	if err := json.Unmarshal(extra, service); err != nil {
+		return boltvm.Error("unmarshal json error:" + err.Error())
+	}
+	if service.ChainID == "" || service.ServiceID == "" {
+		return boltvm.Error("chain id or service id is empty")
+	}
+
+	if proposalResult != string(APPOVED) {
+		return boltvm.Success(nil)
+	}
+
+	key := ServiceKey(service.ChainID, service.ServiceID)
+	switch des {
+	case ServiceRegister:
+		if sm.Has(key) {
+			return boltvm.Error(fmt.Sprintf("service %s of appchain %s has been registered", service.ServiceID, service.ChainID))
+		}
+		sm.SetObject(key, service)
+	case ServiceUpdate:
+		if !sm.Has(key) {
+			return boltvm.Error(fmt.Sprintf("service %s of appchain %s does not exist", service.ServiceID, service.ChainID))
+		}
+		sm.SetObject(key, service)
+	case ServiceRemove:
+		if !sm.Has(key) {
+			return boltvm.Error(fmt.Sprintf("service %s of appchain %s does not exist", service.ServiceID, service.ChainID))
+		}
+		sm.Delete(key)
+	default:
+		return boltvm.Error("unsupported service event: " + des)
+	}
+
+	return boltvm.Success(nil)
+}
+
+// GetService returns the service info of the appchain
+func (sm *ServiceManager) GetService(chainID, serviceID string) *boltvm.Response {
+	ok, data := sm.Get(ServiceKey(chainID, serviceID))
+	if !ok {
+		return boltvm.Error(fmt.Sprintf("service %s of appchain %s does not exist", serviceID, chainID))
+	}
+
+	return boltvm.Success(data)
+}
+
+// Services returns all registered services of the appchain
+func (sm *ServiceManager) Services(chainID string) *boltvm.Response {
+	services := make([]*Service, 0)
+	ok, value := sm.Query(ServiceKey(chainID, ""))
+	if ok {
+		for _, data := range value {
+			service := &Service{}
+			if err := json.Unmarshal(data, service); err != nil {
+				return boltvm.Error(err.Error())
+			}
+			services = append(services, service)
+		}
+	}
+
+	data, err := json.Marshal(services)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return boltvm.Success(data)
+}
+
+// CheckInvocation returns error if the service of the destination chain does
+// not exist or the source chain is not in its whitelist, the services of the
+// destination chain registering no service are open to all chains
+func (sm *ServiceManager) CheckInvocation(from, to, serviceID string) *boltvm.Response {
+	service := &Service{}
+	if !sm.GetObject(ServiceKey(to, serviceID), service) {
+		if ok, _ := sm.Query(ServiceKey(to, "")); !ok {
+			return boltvm.Success(nil)
+		}
+		return boltvm.Error(fmt.Sprintf("service %s of appchain %s does not exist", serviceID, to))
+	}
+
+	for _, id := range service.Whitelist {
+		if id == from {
+			return boltvm.Success(nil)
+		}
+	}
+
+	return boltvm.Error(fmt.Sprintf("appchain %s is not allowed to call service %s of appchain %s", from, serviceID, to))
+}
+
+// CheckEncryptedInvocation returns error if the destination chain registers
+// services but none of them is open to the source chain, the service called
+// by an encrypted payload is unknown to the relay chain
+func (sm *ServiceManager) CheckEncryptedInvocation(from, to string) *boltvm.Response {
+	ok, value := sm.Query(ServiceKey(to, ""))
+	if !ok {
+		return boltvm.Success(nil)
+	}
+
+	for _, data := range value {
+		service := &Service{}
+		if err := json.Unmarshal(data, service); err != nil {
+			return boltvm.Error(err.Error())
+		}
+		for _, id := range service.Whitelist {
+			if id == from {
+				return boltvm.Success(nil)
+			}
+		}
+	}
+
+	return boltvm.Error(fmt.Sprintf("appchain %s is not allowed to call any service of appchain %s", from, to))
+}
+
+func ServiceKey(chainID, serviceID string) string {
+	return servicePrefix + chainID + "-" + serviceID
+}
@@ -0,0 +1,66 @@
+package contracts
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/meshplus/bitxhub-core/boltvm"
+	"github.com/meshplus/bitxhub-model/constant"
+)
+
+// heightStub is implemented by stubs knowing the height of the block
+// executing the transaction
+type heightStub interface {
+	GetCurrentHeight() uint64
+}
+
+// currentHeight returns the height of the block executing the transaction,
+// 0 means the height is unknown to the stub
+func currentHeight(stub boltvm.Stub) uint64 {
+	if hs, ok := stub.(heightStub); ok {
+		return hs.GetCurrentHeight()
+	}
+
+	return 0
+}
+
+// callerStub is implemented by stubs knowing the immediate caller of the
+// contract, which is the invoking contract in case of cross invocations
+type callerStub interface {
+	CurrentCaller() string
+}
+
+// currentCaller returns the immediate caller of the contract, it falls back
+// to the caller of the transaction if the stub does not know it
+func currentCaller(stub boltvm.Stub) string {
+	if cs, ok := stub.(callerStub); ok {
+		return cs.CurrentCaller()
+	}
+
+	return stub.Caller()
+}
+
+// gasStub is implemented by stubs metering the gas of the transaction
+type gasStub interface {
+	RemainingGas() uint64
+}
+
+// remainingGas returns the gas left to the transaction, the stubs not metering
+// gas have no limit
+func remainingGas(stub boltvm.Stub) uint64 {
+	if gs, ok := stub.(gasStub); ok {
+		return gs.RemainingGas()
+	}
+
+	return math.MaxUint64
+}
+
+// checkGovernance makes sure the contract is invoked by the governance
+// contract executing a closed proposal
+func checkGovernance(stub boltvm.Stub) *boltvm.Response {
+	if caller := currentCaller(stub); caller != constant.GovernanceContractAddr.Address().String() {
+		return boltvm.Error(fmt.Sprintf("caller %s is not the governance contract", caller))
+	}
+
+	return boltvm.Success(nil)
+}
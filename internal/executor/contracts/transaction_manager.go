@@ -1,37 +1,85 @@
 package contracts
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/meshplus/bitxhub-core/boltvm"
+	"github.com/meshplus/bitxhub-model/constant"
 	"github.com/meshplus/bitxhub-model/pb"
 )
 
-const PREFIX = "tx-"
+const (
+	PREFIX = "tx-"
+
+	// DefaultTransactionTimeout is the number of blocks the destination chain
+	// has to answer an interchain transaction before it is rolled back
+	DefaultTransactionTimeout uint64 = 1000
+
+	// DefaultTxListLimit and MaxTxListLimit bound the page size of
+	// ListTransactions
+	DefaultTxListLimit uint64 = 20
+	MaxTxListLimit     uint64 = 100
+
+	txRecordPrefix      = "tx-record-"
+	txIndexLenPrefix    = "tx-len-"
+	txAllIndexPrefix    = "tx-all-"
+	txSrcIndexPrefix    = "tx-src-"
+	txDstIndexPrefix    = "tx-dst-"
+	txPairIndexPrefix   = "tx-pair-"
+	txStatusIndexPrefix = "tx-status-"
+	txStatusSeqPrefix   = "tx-status-seq-"
+	txTimeoutPrefix     = "tx-timeout-"
+)
 
 type TransactionManager struct {
 	boltvm.Stub
 }
 
 type TransactionInfo struct {
-	GlobalState pb.TransactionStatus
-	ChildTxInfo map[string]pb.TransactionStatus
+	GlobalState   pb.TransactionStatus
+	ChildTxInfo   map[string]pb.TransactionStatus
+	TimeoutHeight uint64
+}
+
+// InterchainTx is the indexed record of an interchain transaction, the status
+// of a child transaction is its own status rather than the global one
+type InterchainTx struct {
+	Id            string               `json:"id"`
+	GlobalId      string               `json:"global_id,omitempty"`
+	From          string               `json:"from"`
+	To            string               `json:"to"`
+	Status        pb.TransactionStatus `json:"status"`
+	RolledBack    bool                 `json:"rolled_back,omitempty"`
+	BeginHeight   uint64               `json:"begin_height"`
+	TimeoutHeight uint64               `json:"timeout_height"`
+}
+
+// InterchainTxPage is a page of the interchain transactions matching the
+// query, Total is the number of transactions in the index the page is read from
+type InterchainTxPage struct {
+	Total uint64          `json:"total"`
+	Txs   []*InterchainTx `json:"txs"`
 }
 
-func (t *TransactionManager) BeginMultiTXs(globalId string, childTxIds ...string) *boltvm.Response {
+func (t *TransactionManager) BeginMultiTXs(globalId string, timeoutHeight uint64, childTxIds ...string) *boltvm.Response {
 	if t.Has(t.txInfoKey(globalId)) {
 		return boltvm.Error("Transaction id already exists")
 	}
 
 	txInfo := TransactionInfo{
-		GlobalState: pb.TransactionStatus_BEGIN,
-		ChildTxInfo: make(map[string]pb.TransactionStatus),
+		GlobalState:   pb.TransactionStatus_BEGIN,
+		ChildTxInfo:   make(map[string]pb.TransactionStatus),
+		TimeoutHeight: timeoutHeight,
 	}
 
 	for _, childTxId := range childTxIds {
 		txInfo.ChildTxInfo[childTxId] = pb.TransactionStatus_BEGIN
 		t.Set(childTxId, []byte(globalId))
+		t.indexTx(childTxId, globalId, timeoutHeight)
+		t.addTimeout(childTxId, timeoutHeight)
 	}
 
 	t.SetObject(t.globalTxInfoKey(globalId), txInfo)
@@ -39,8 +87,11 @@ func (t *TransactionManager) BeginMultiTXs(globalId string, childTxIds ...string
 	return boltvm.Success(nil)
 }
 
-func (t *TransactionManager) Begin(txId string) *boltvm.Response {
+func (t *TransactionManager) Begin(txId string, timeoutHeight uint64) *boltvm.Response {
 	t.AddObject(t.txInfoKey(txId), pb.TransactionStatus_BEGIN)
+	t.AddObject(t.txTimeoutKey(txId), timeoutHeight)
+	t.indexTx(txId, "", timeoutHeight)
+	t.addTimeout(txId, timeoutHeight)
 
 	return boltvm.Success(nil)
 }
@@ -49,15 +100,18 @@ func (t *TransactionManager) Report(txId string, result int32) *boltvm.Response
 	var status pb.TransactionStatus
 	ok := t.GetObject(t.txInfoKey(txId), &status)
 	if ok {
-		if status != pb.TransactionStatus_BEGIN {
-			return boltvm.Error(fmt.Sprintf("transaction with Id %s is finished", txId))
+		timeoutHeight := t.getTimeoutHeight(txId)
+		if err := t.checkReportable(txId, status, timeoutHeight); err != nil {
+			return boltvm.Error(err.Error())
 		}
 
-		if result == 0 {
-			t.SetObject(t.txInfoKey(txId), pb.TransactionStatus_SUCCESS)
-		} else {
-			t.SetObject(t.txInfoKey(txId), pb.TransactionStatus_FAILURE)
+		status = pb.TransactionStatus_SUCCESS
+		if result != 0 {
+			status = pb.TransactionStatus_FAILURE
 		}
+		t.SetObject(t.txInfoKey(txId), status)
+		t.setIndexedStatus(txId, status, false)
+		t.removeTimeout(txId, timeoutHeight)
 	} else {
 		ok, val := t.Get(txId)
 		if !ok {
@@ -70,9 +124,15 @@ func (t *TransactionManager) Report(txId string, result int32) *boltvm.Response
 			return boltvm.Error(fmt.Sprintf("transaction global id %s does not exist", globalId))
 		}
 
+		if t.Has(t.txRollbackKey(globalId)) {
+			return boltvm.Error(fmt.Sprintf("transaction with global Id %s has been rolled back", globalId))
+		}
 		if txInfo.GlobalState != pb.TransactionStatus_BEGIN {
 			return boltvm.Error(fmt.Sprintf("transaction with global Id %s is finished", globalId))
 		}
+		if err := t.checkTimeout(txId, txInfo.TimeoutHeight); err != nil {
+			return boltvm.Error(err.Error())
+		}
 
 		status, ok := txInfo.ChildTxInfo[txId]
 		if !ok {
@@ -102,11 +162,140 @@ func (t *TransactionManager) Report(txId string, result int32) *boltvm.Response
 		}
 
 		t.SetObject(t.globalTxInfoKey(globalId), txInfo)
+		t.setIndexedStatus(txId, txInfo.ChildTxInfo[txId], false)
+		t.removeTimeout(txId, txInfo.TimeoutHeight)
+	}
+
+	return boltvm.Success(nil)
+}
+
+// Rollback fails the transaction which is not answered by the destination
+// chain before its timeout height, the child transaction of a multi-target
+// transaction fails the whole transaction. There is no rollback status in
+// pb.TransactionStatus, so the rolled back transaction is marked separately
+func (t *TransactionManager) Rollback(txId string) *boltvm.Response {
+	var status pb.TransactionStatus
+	if t.GetObject(t.txInfoKey(txId), &status) {
+		timeoutHeight := t.getTimeoutHeight(txId)
+		if err := t.checkRollbackable(txId, status, timeoutHeight); err != nil {
+			return boltvm.Error(err.Error())
+		}
+
+		t.SetObject(t.txInfoKey(txId), pb.TransactionStatus_FAILURE)
+		t.Set(t.txRollbackKey(txId), []byte("true"))
+		t.setIndexedStatus(txId, pb.TransactionStatus_FAILURE, true)
+		t.removeTimeout(txId, timeoutHeight)
+		return boltvm.Success(nil)
+	}
+
+	ok, val := t.Get(txId)
+	if !ok {
+		return boltvm.Error(fmt.Sprintf("cannot get global id of child tx id %s", txId))
+	}
+
+	globalId := string(val)
+	txInfo := TransactionInfo{}
+	if !t.GetObject(t.globalTxInfoKey(globalId), &txInfo) {
+		return boltvm.Error(fmt.Sprintf("transaction global id %s does not exist", globalId))
+	}
+
+	status, ok = txInfo.ChildTxInfo[txId]
+	if !ok {
+		return boltvm.Error(fmt.Sprintf("%s is not in transaction %s", txId, globalId))
+	}
+	if err := t.checkRollbackable(txId, status, txInfo.TimeoutHeight); err != nil {
+		return boltvm.Error(err.Error())
 	}
 
+	txInfo.ChildTxInfo[txId] = pb.TransactionStatus_FAILURE
+	t.Set(t.txRollbackKey(txId), []byte("true"))
+	if txInfo.GlobalState == pb.TransactionStatus_BEGIN {
+		txInfo.GlobalState = pb.TransactionStatus_FAILURE
+		t.Set(t.txRollbackKey(globalId), []byte("true"))
+	}
+	t.SetObject(t.globalTxInfoKey(globalId), txInfo)
+	t.setIndexedStatus(txId, pb.TransactionStatus_FAILURE, true)
+	t.removeTimeout(txId, txInfo.TimeoutHeight)
+
 	return boltvm.Success(nil)
 }
 
+// IsRolledBack returns whether the transaction is rolled back after its
+// timeout height
+func (t *TransactionManager) IsRolledBack(txId string) *boltvm.Response {
+	return boltvm.Success([]byte(strconv.FormatBool(t.Has(t.txRollbackKey(txId)))))
+}
+
+func (t *TransactionManager) checkReportable(txId string, status pb.TransactionStatus, timeoutHeight uint64) error {
+	if t.Has(t.txRollbackKey(txId)) {
+		return fmt.Errorf("transaction with Id %s has been rolled back", txId)
+	}
+	if status != pb.TransactionStatus_BEGIN {
+		return fmt.Errorf("transaction with Id %s is finished", txId)
+	}
+
+	return t.checkTimeout(txId, timeoutHeight)
+}
+
+// checkTimeout returns error if the receipt of the transaction comes after
+// its timeout height, 0 means the transaction never times out
+func (t *TransactionManager) checkTimeout(txId string, timeoutHeight uint64) error {
+	if timeoutHeight != 0 && currentHeight(t.Stub) > timeoutHeight {
+		return fmt.Errorf("transaction with Id %s timed out at height %d", txId, timeoutHeight)
+	}
+
+	return nil
+}
+
+func (t *TransactionManager) checkRollbackable(txId string, status pb.TransactionStatus, timeoutHeight uint64) error {
+	if status != pb.TransactionStatus_BEGIN {
+		return fmt.Errorf("transaction with Id %s is not waiting for receipt", txId)
+	}
+	if timeoutHeight == 0 || currentHeight(t.Stub) <= timeoutHeight {
+		return fmt.Errorf("transaction with Id %s does not time out until height %d", txId, timeoutHeight)
+	}
+
+	return nil
+}
+
+// addTimeout adds the transaction to the ones timing out at the height, which
+// are rolled back by the relay chain when it executes the next block
+func (t *TransactionManager) addTimeout(txId string, timeoutHeight uint64) {
+	if timeoutHeight == 0 {
+		return
+	}
+
+	var ids []string
+	t.GetObject(TxTimeoutKey(timeoutHeight), &ids)
+	t.SetObject(TxTimeoutKey(timeoutHeight), append(ids, txId))
+}
+
+func (t *TransactionManager) removeTimeout(txId string, timeoutHeight uint64) {
+	var ids []string
+	if timeoutHeight == 0 || !t.GetObject(TxTimeoutKey(timeoutHeight), &ids) {
+		return
+	}
+
+	for i, id := range ids {
+		if id == txId {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		t.Delete(TxTimeoutKey(timeoutHeight))
+		return
+	}
+	t.SetObject(TxTimeoutKey(timeoutHeight), ids)
+}
+
+func (t *TransactionManager) getTimeoutHeight(txId string) uint64 {
+	var timeoutHeight uint64
+	t.GetObject(t.txTimeoutKey(txId), &timeoutHeight)
+
+	return timeoutHeight
+}
+
 func (t *TransactionManager) GetStatus(txId string) *boltvm.Response {
 	var status pb.TransactionStatus
 	ok := t.GetObject(t.txInfoKey(txId), &status)
@@ -134,10 +323,303 @@ func (t *TransactionManager) GetStatus(txId string) *boltvm.Response {
 	return boltvm.Success([]byte(strconv.Itoa(int(txInfo.GlobalState))))
 }
 
+// ListTransactions returns a page of the interchain transactions sent from the
+// source chain to the destination chain with the status, empty conditions
+// match any transaction. Only the entries in the window [offset, offset+limit)
+// of the index of the conditions are read. The transactions are in the order
+// they began, except with a status, as a transaction leaving the status is
+// replaced by the last one in its index
+func (t *TransactionManager) ListTransactions(from, to, status string, offset, limit uint64) *boltvm.Response {
+	var (
+		txStatus     pb.TransactionStatus
+		filterStatus = status != ""
+		err          error
+	)
+	if filterStatus {
+		if txStatus, err = ParseTransactionStatus(status); err != nil {
+			return boltvm.Error(err.Error())
+		}
+	}
+	if limit == 0 {
+		limit = DefaultTxListLimit
+	}
+	if limit > MaxTxListLimit {
+		return boltvm.Error(fmt.Sprintf("limit %d exceeds the max limit %d", limit, MaxTxListLimit))
+	}
+
+	prefix := txAllIndexPrefix
+	switch {
+	case from != "" && to != "":
+		prefix = txPairIndexKey(from, to)
+	case from != "":
+		prefix = txSrcIndexKey(from)
+	case to != "":
+		prefix = txDstIndexKey(to)
+	}
+	if filterStatus {
+		prefix = txStatusIndexKey(prefix, txStatus)
+	}
+
+	page := &InterchainTxPage{
+		Total: t.indexLen(prefix),
+		Txs:   make([]*InterchainTx, 0),
+	}
+	for i := offset; i < page.Total && i-offset < limit; i++ {
+		ok, id := t.Get(txIndexEntryKey(prefix, i))
+		if !ok {
+			return boltvm.Error(fmt.Sprintf("entry %d of index %s does not exist", i, prefix))
+		}
+		tx := &InterchainTx{}
+		if !t.GetObject(txRecordKey(string(id)), tx) {
+			return boltvm.Error(fmt.Sprintf("record of transaction %s does not exist", id))
+		}
+		page.Txs = append(page.Txs, tx)
+	}
+
+	data, err := json.Marshal(page)
+	if err != nil {
+		return boltvm.Error(err.Error())
+	}
+
+	return boltvm.Success(data)
+}
+
+// indexTx records the begun transaction and appends it to the indexes of all
+// transactions, its source chain, destination chain and both chains, and to
+// the status indexes of them
+func (t *TransactionManager) indexTx(txId, globalId string, timeoutHeight uint64) {
+	from, to := splitTxID(txId)
+	tx := &InterchainTx{
+		Id:            txId,
+		GlobalId:      globalId,
+		From:          from,
+		To:            to,
+		Status:        pb.TransactionStatus_BEGIN,
+		BeginHeight:   currentHeight(t.Stub),
+		TimeoutHeight: timeoutHeight,
+	}
+
+	t.SetObject(txRecordKey(txId), tx)
+	for _, prefix := range []string{
+		txAllIndexPrefix,
+		txSrcIndexKey(from),
+		txDstIndexKey(to),
+		txPairIndexKey(from, to),
+	} {
+		t.appendIndex(prefix, txId)
+	}
+	t.addStatusIndexes(tx)
+}
+
+// setIndexedStatus moves the transaction from the status indexes of the old
+// status to the ones of the new status. The transactions begun before indexing
+// was introduced have no record to update
+func (t *TransactionManager) setIndexedStatus(txId string, status pb.TransactionStatus, rolledBack bool) {
+	tx := &InterchainTx{}
+	if !t.GetObject(txRecordKey(txId), tx) {
+		return
+	}
+
+	if tx.Status != status {
+		t.removeStatusIndexes(tx)
+		tx.Status = status
+		t.addStatusIndexes(tx)
+	}
+	tx.RolledBack = rolledBack
+	t.SetObject(txRecordKey(txId), tx)
+}
+
+// addStatusIndexes appends the transaction to the indexes of the transactions
+// in its status, the sequences of the entries are kept to remove them
+func (t *TransactionManager) addStatusIndexes(tx *InterchainTx) {
+	prefixes := txStatusIndexKeys(tx)
+	seqs := make([]uint64, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		seqs = append(seqs, t.appendIndex(prefix, tx.Id))
+	}
+	t.SetObject(txStatusSeqKey(tx.Id), seqs)
+}
+
+// removeStatusIndexes removes the transaction from the indexes of the
+// transactions in its status by moving the last entry of each index into its
+// place, so the indexes only hold the transactions still in the status
+func (t *TransactionManager) removeStatusIndexes(tx *InterchainTx) {
+	prefixes := txStatusIndexKeys(tx)
+	var seqs []uint64
+	if !t.GetObject(txStatusSeqKey(tx.Id), &seqs) || len(seqs) != len(prefixes) {
+		return
+	}
+
+	for i, prefix := range prefixes {
+		last := t.indexLen(prefix) - 1
+		if seqs[i] != last {
+			_, lastId := t.Get(txIndexEntryKey(prefix, last))
+			t.Set(txIndexEntryKey(prefix, seqs[i]), lastId)
+
+			var lastSeqs []uint64
+			if t.GetObject(txStatusSeqKey(string(lastId)), &lastSeqs) && len(lastSeqs) == len(prefixes) {
+				lastSeqs[i] = seqs[i]
+				t.SetObject(txStatusSeqKey(string(lastId)), lastSeqs)
+			}
+		}
+		t.Delete(txIndexEntryKey(prefix, last))
+		t.SetObject(txIndexLenKey(prefix), last)
+	}
+}
+
+// appendIndex appends the transaction to the end of the index and returns its
+// sequence, the entries are keyed by their sequence in the index so a window
+// of it is read key by key
+func (t *TransactionManager) appendIndex(prefix, txId string) uint64 {
+	length := t.indexLen(prefix)
+	t.Set(txIndexEntryKey(prefix, length), []byte(txId))
+	t.SetObject(txIndexLenKey(prefix), length+1)
+	return length
+}
+
+func (t *TransactionManager) indexLen(prefix string) uint64 {
+	var length uint64
+	t.GetObject(txIndexLenKey(prefix), &length)
+	return length
+}
+
+// ParseTransactionStatus parses the case insensitive name of the transaction
+// status, one of begin, success and failure
+func ParseTransactionStatus(status string) (pb.TransactionStatus, error) {
+	switch strings.ToLower(status) {
+	case "begin":
+		return pb.TransactionStatus_BEGIN, nil
+	case "success":
+		return pb.TransactionStatus_SUCCESS, nil
+	case "failure":
+		return pb.TransactionStatus_FAILURE, nil
+	default:
+		return 0, fmt.Errorf("illegal transaction status %s", status)
+	}
+}
+
+// TransactionStatusName returns the lower case name of the transaction status
+func TransactionStatusName(status pb.TransactionStatus) string {
+	return strings.ToLower(status.String())
+}
+
+// splitTxID splits the id from-to-index of the transaction, the source chain
+// id may contain the separator in union mode so it is split from the end
+func splitTxID(txId string) (string, string) {
+	fields := strings.Split(txId, "-")
+	if len(fields) < 3 {
+		return "", ""
+	}
+
+	return strings.Join(fields[:len(fields)-2], "-"), fields[len(fields)-2]
+}
+
+// ParseTxID parses the source chain, destination chain and index of the
+// transaction from its id
+func ParseTxID(txId string) (string, string, uint64, error) {
+	from, to := splitTxID(txId)
+	if from == "" || to == "" {
+		return "", "", 0, fmt.Errorf("illegal transaction id %s", txId)
+	}
+
+	index, err := strconv.ParseUint(txId[strings.LastIndex(txId, "-")+1:], 10, 64)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("illegal index of transaction %s: %w", txId, err)
+	}
+
+	return from, to, index, nil
+}
+
+// TimeoutReceipt returns the transaction of the failure receipt the relay chain
+// sends itself to roll back the transaction timing out. bitxhub-model has no
+// IBTP type for rollbacks, so the source chain is notified with the failure
+// receipt which it rolls back the transaction on
+func TimeoutReceipt(txId string, timestamp int64) (*pb.Transaction, error) {
+	from, to, index, err := ParseTxID(txId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &pb.Transaction{
+		From:      constant.TransactionMgrContractAddr.Address(),
+		To:        constant.InterchainContractAddr.Address(),
+		Timestamp: timestamp,
+		IBTP: &pb.IBTP{
+			From:      from,
+			To:        to,
+			Index:     index,
+			Type:      pb.IBTP_RECEIPT_FAILURE,
+			Timestamp: timestamp,
+		},
+	}
+	tx.TransactionHash = tx.Hash()
+
+	return tx, nil
+}
+
+// TxTimeoutKey is the key of the ids of the transactions timing out at the
+// height
+func TxTimeoutKey(height uint64) string {
+	return txTimeoutPrefix + strconv.FormatUint(height, 10)
+}
+
+func txRecordKey(id string) string {
+	return txRecordPrefix + id
+}
+
+func txIndexLenKey(prefix string) string {
+	return txIndexLenPrefix + prefix
+}
+
+func txIndexEntryKey(prefix string, seq uint64) string {
+	return prefix + strconv.FormatUint(seq, 10)
+}
+
+func txSrcIndexKey(chainID string) string {
+	return txSrcIndexPrefix + chainID + "-"
+}
+
+func txDstIndexKey(chainID string) string {
+	return txDstIndexPrefix + chainID + "-"
+}
+
+func txPairIndexKey(from, to string) string {
+	return txPairIndexPrefix + from + "-" + to + "-"
+}
+
+// txStatusIndexKey returns the index of the transactions of the index in the
+// status
+func txStatusIndexKey(prefix string, status pb.TransactionStatus) string {
+	return txStatusIndexPrefix + prefix + strconv.Itoa(int(status)) + "-"
+}
+
+// txStatusIndexKeys returns the status indexes holding the transaction, in the
+// order of its sequences kept under txStatusSeqKey
+func txStatusIndexKeys(tx *InterchainTx) []string {
+	return []string{
+		txStatusIndexKey(txAllIndexPrefix, tx.Status),
+		txStatusIndexKey(txSrcIndexKey(tx.From), tx.Status),
+		txStatusIndexKey(txDstIndexKey(tx.To), tx.Status),
+		txStatusIndexKey(txPairIndexKey(tx.From, tx.To), tx.Status),
+	}
+}
+
+func txStatusSeqKey(txId string) string {
+	return txStatusSeqPrefix + txId
+}
+
 func (t *TransactionManager) txInfoKey(id string) string {
 	return fmt.Sprintf("%s-%s", PREFIX, id)
 }
 
+func (t *TransactionManager) txTimeoutKey(id string) string {
+	return fmt.Sprintf("timeout-%s-%s", PREFIX, id)
+}
+
+func (t *TransactionManager) txRollbackKey(id string) string {
+	return fmt.Sprintf("rollback-%s-%s", PREFIX, id)
+}
+
 func (t *TransactionManager) globalTxInfoKey(id string) string {
 	return fmt.Sprintf("global-%s-%s", PREFIX, id)
 }
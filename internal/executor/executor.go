@@ -2,6 +2,7 @@ package executor
 
 import (
 	"context"
+	"fmt"
 	"sort"
 	"sync"
 	"time"
@@ -17,6 +18,7 @@ import (
 	"github.com/meshplus/bitxhub/internal/model/events"
 	"github.com/meshplus/bitxhub/pkg/proof"
 	"github.com/meshplus/bitxhub/pkg/vm/boltvm"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 	"github.com/sirupsen/logrus"
 	"github.com/wasmerio/go-ext-wasm/wasmer"
 )
@@ -42,6 +44,7 @@ type BlockExecutor struct {
 	wasmInstances    map[string]wasmer.Instance
 	txsExecutor      agency.TxsExecutor
 	blockFeed        event.Feed
+	nodeFeed         event.Feed
 	ctx              context.Context
 	cancel           context.CancelFunc
 }
@@ -50,13 +53,13 @@ type BlockExecutor struct {
 func New(chainLedger ledger.Ledger, logger logrus.FieldLogger, typ string) (*BlockExecutor, error) {
 	ibtpVerify := proof.New(chainLedger, logger)
 
-	ctx, cancel := context.WithCancel(context.Background())
-
 	txsExecutor, err := agency.GetExecutorConstructor(typ)
 	if err != nil {
 		return nil, err
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	blockExecutor := &BlockExecutor{
 		ledger:           chainLedger,
 		logger:           logger,
@@ -72,6 +75,9 @@ func New(chainLedger ledger.Ledger, logger logrus.FieldLogger, typ string) (*Blo
 		wasmInstances:    make(map[string]wasmer.Instance),
 	}
 	blockExecutor.txsExecutor = txsExecutor(blockExecutor.applyTx, registerBoltContracts, logger)
+	if binder, ok := blockExecutor.txsExecutor.(ledgerBinder); ok {
+		binder.bindLedger(chainLedger, blockExecutor.applyTxWithLedger)
+	}
 
 	return blockExecutor, nil
 }
@@ -111,7 +117,46 @@ func (exec *BlockExecutor) SubscribeBlockEvent(ch chan<- events.ExecutedEvent) e
 	return exec.blockFeed.Subscribe(ch)
 }
 
+// SubscribeNodeEvent registers a subscription of NodeEvent.
+func (exec *BlockExecutor) SubscribeNodeEvent(ch chan<- events.NodeEvent) event.Subscription {
+	return exec.nodeFeed.Subscribe(ch)
+}
+
+// Replay executes a block which is already committed by the chain and persists
+// the result synchronously, the executor must not be started
+func (exec *BlockExecutor) Replay(block *pb.Block) *ledger.BlockData {
+	blockData := exec.processExecuteEvent(block)
+	exec.ledger.PersistBlockData(blockData)
+
+	return blockData
+}
+
 func (exec *BlockExecutor) ApplyReadonlyTransactions(txs []*pb.Transaction) []*pb.Receipt {
+	return exec.applyReadonlyTransactions(txs, exec.ledger, exec.ledger.GetChainMeta().Height+1)
+}
+
+// ApplyReadonlyTransactionsAt executes readonly txs against the state after the
+// block of the given height, height 0 means the latest committed block
+func (exec *BlockExecutor) ApplyReadonlyTransactionsAt(txs []*pb.Transaction, height uint64) ([]*pb.Receipt, error) {
+	ldg, err := exec.ledger.StateAt(height)
+	if err != nil {
+		return nil, fmt.Errorf("get state of block %d: %w", height, err)
+	}
+	if height == 0 {
+		height = exec.ledger.GetChainMeta().Height
+	}
+
+	receipts := exec.applyReadonlyTransactions(txs, ldg, height+1)
+	if err := ldg.StateErr(); err != nil {
+		return nil, err
+	}
+
+	return receipts, nil
+}
+
+// applyReadonlyTransactions executes readonly txs as if they were in the
+// block of the given height
+func (exec *BlockExecutor) applyReadonlyTransactions(txs []*pb.Transaction, ldg ledger.Ledger, height uint64) []*pb.Receipt {
 	current := time.Now()
 	receipts := make([]*pb.Receipt, 0, len(txs))
 
@@ -121,7 +166,11 @@ func (exec *BlockExecutor) ApplyReadonlyTransactions(txs []*pb.Transaction) []*p
 			TxHash:  tx.TransactionHash,
 		}
 
-		ret, err := exec.applyTransaction(i, tx, nil)
+		limit, err := gas.TxGasLimit(tx)
+		var ret []byte
+		if err == nil {
+			ret, err = exec.applyTransaction(i, tx, nil, ldg, gas.NewMeter(limit), height)
+		}
 		if err != nil {
 			receipt.Status = pb.Receipt_FAILED
 			receipt.Ret = []byte(err.Error())
@@ -132,7 +181,7 @@ func (exec *BlockExecutor) ApplyReadonlyTransactions(txs []*pb.Transaction) []*p
 
 		receipts = append(receipts, receipt)
 		// clear potential write to ledger
-		exec.ledger.Clear()
+		ldg.Clear()
 	}
 
 	exec.logger.WithFields(logrus.Fields{
@@ -209,6 +258,7 @@ func (exec *BlockExecutor) persistData() {
 		now := time.Now()
 		exec.ledger.PersistBlockData(data)
 		exec.postBlockEvent(data.Block, data.InterchainMeta, data.TxHashList)
+		exec.postNodeEvents(data.Receipts)
 		exec.logger.WithFields(logrus.Fields{
 			"height": data.Block.BlockHeader.Number,
 			"hash":   data.Block.BlockHash.String(),
@@ -274,6 +324,24 @@ func registerBoltContracts() map[string]agency.Contract {
 			Address:  constant.GovernanceContractAddr.Address().String(),
 			Contract: &contracts.Governance{},
 		},
+		{
+			Enabled:  true,
+			Name:     "node manager service",
+			Address:  contracts.NodeManagerContractAddr.Address().String(),
+			Contract: &contracts.NodeManager{},
+		},
+		{
+			Enabled:  true,
+			Name:     "service manager service",
+			Address:  constant.ServiceMgrContractAddr.Address().String(),
+			Contract: &contracts.ServiceManager{},
+		},
+		{
+			Enabled:  true,
+			Name:     "permission manager service",
+			Address:  contracts.PermissionContractAddr.Address().String(),
+			Contract: &contracts.PermissionManager{},
+		},
 	}
 
 	ContractsInfo := agency.GetRegisteredContractInfo()
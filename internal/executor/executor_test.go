@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -20,10 +22,13 @@ import (
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/constant"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/executor/contracts"
 	"github.com/meshplus/bitxhub/internal/ledger"
 	"github.com/meshplus/bitxhub/internal/ledger/mock_ledger"
 	"github.com/meshplus/bitxhub/internal/model/events"
 	"github.com/meshplus/bitxhub/internal/repo"
+	"github.com/meshplus/bitxhub/pkg/proof"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 	libp2pcert "github.com/meshplus/go-libp2p-cert"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -88,6 +93,7 @@ func TestBlockExecutor_ExecuteBlock(t *testing.T) {
 	evs = append(evs, ev)
 	mockLedger.EXPECT().GetChainMeta().Return(chainMeta).AnyTimes()
 	mockLedger.EXPECT().Events(gomock.Any()).Return(evs).AnyTimes()
+	mockLedger.EXPECT().Snapshot().Return(0).AnyTimes()
 	mockLedger.EXPECT().Commit(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 	mockLedger.EXPECT().Clear().AnyTimes()
 	mockLedger.EXPECT().GetState(gomock.Any(), gomock.Any()).Return(true, []byte("10")).AnyTimes()
@@ -194,9 +200,12 @@ func TestBlockExecutor_ApplyReadonlyTransactions(t *testing.T) {
 
 	mockLedger.EXPECT().GetChainMeta().Return(chainMeta).AnyTimes()
 	mockLedger.EXPECT().Events(gomock.Any()).Return(nil).AnyTimes()
+	mockLedger.EXPECT().Snapshot().Return(0).AnyTimes()
 	mockLedger.EXPECT().Commit(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 	mockLedger.EXPECT().Clear().AnyTimes()
 	mockLedger.EXPECT().GetState(contractAddr, []byte(fmt.Sprintf("index-tx-%s", id))).Return(true, val).AnyTimes()
+	// no permissions of the methods
+	mockLedger.EXPECT().GetState(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
 	mockLedger.EXPECT().PersistExecutionResult(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 	mockLedger.EXPECT().FlushDirtyDataAndComputeJournal().Return(make(map[string]*ledger.Account), &ledger.BlockJournal{}).AnyTimes()
 	mockLedger.EXPECT().PersistBlockData(gomock.Any()).AnyTimes()
@@ -218,6 +227,437 @@ func TestBlockExecutor_ApplyReadonlyTransactions(t *testing.T) {
 	assert.Equal(t, pb.Receipt_SUCCESS, receipts[0].Status)
 }
 
+func TestBlockExecutor_ApplyReadonlyTransactionsAt(t *testing.T) {
+	privKey, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	require.Nil(t, err)
+	addr, err := privKey.PublicKey().Address()
+	require.Nil(t, err)
+
+	ldg := newTestLedger(t, []*types.Address{addr})
+	ldg.SetBalance(addr, 10)
+	accounts, journal := ldg.FlushDirtyDataAndComputeJournal()
+	require.Nil(t, ldg.Commit(2, accounts, journal))
+
+	exec, err := New(ldg, log.NewWithModule("executor"), executorType)
+	require.Nil(t, err)
+
+	tx := genTransferTx(t, privKey, types.NewAddressByStr(to), 50)
+
+	receipts, err := exec.ApplyReadonlyTransactionsAt([]*pb.Transaction{tx}, 1)
+	require.Nil(t, err)
+	require.Equal(t, pb.Receipt_SUCCESS, receipts[0].Status)
+
+	receipts, err = exec.ApplyReadonlyTransactionsAt([]*pb.Transaction{tx}, 0)
+	require.Nil(t, err)
+	require.Equal(t, pb.Receipt_FAILED, receipts[0].Status)
+	require.Equal(t, uint64(10), ldg.GetBalance(addr))
+
+	_, err = exec.ApplyReadonlyTransactionsAt([]*pb.Transaction{tx}, 3)
+	require.NotNil(t, err)
+}
+
+func TestBlockExecutor_TxProof(t *testing.T) {
+	ldg := newTestLedger(t, nil)
+	exec, err := New(ldg, log.NewWithModule("executor"), executorType)
+	require.Nil(t, err)
+
+	var txs []*pb.Transaction
+	for i := 0; i < 7; i++ {
+		txs = append(txs, &pb.Transaction{
+			TransactionHash: types.NewHash([]byte(fmt.Sprintf("tx-%d", i))),
+		})
+	}
+
+	exec.txsExecutor.ApplyTransactions(nil)
+	exec.txsExecutor.AddInterchainCounter(to, 1)
+	exec.txsExecutor.AddInterchainCounter(to, 4)
+	exec.txsExecutor.AddInterchainCounter(from, 2)
+	for _, i := range []int{0, 3, 5, 6} {
+		exec.txsExecutor.AddNormalTx(txs[i].TransactionHash)
+	}
+
+	txRoot, l2Roots, err := exec.buildTxMerkleTree(txs)
+	require.Nil(t, err)
+
+	block := mockBlock(2, txs)
+	block.BlockHeader.TxRoot = txRoot
+	meta := &pb.InterchainMeta{
+		Counter: map[string]*pb.Uint64Slice{
+			to:   {Slice: []uint64{1, 4}},
+			from: {Slice: []uint64{2}},
+		},
+		L2Roots: l2Roots,
+	}
+
+	root, err := proof.TxRoot(block, meta)
+	require.Nil(t, err)
+	require.Equal(t, txRoot.String(), root.String())
+
+	for i := range txs {
+		txProof, err := proof.NewTxProof(block, meta, uint64(i))
+		require.Nil(t, err)
+		require.Equal(t, txs[i].TransactionHash, txProof.TxHash)
+		require.Nil(t, proof.VerifyTxProof(txProof, txRoot))
+	}
+
+	txProof, err := proof.NewTxProof(block, meta, 1)
+	require.Nil(t, err)
+	txProof.TxHash = txs[0].TransactionHash
+	require.NotNil(t, proof.VerifyTxProof(txProof, txRoot))
+
+	txProof, err = proof.NewTxProof(block, meta, 1)
+	require.Nil(t, err)
+	require.NotNil(t, proof.VerifyTxProof(txProof, types.NewHash([]byte("root"))))
+
+	_, err = proof.NewTxProof(block, meta, 7)
+	require.NotNil(t, err)
+}
+
+func TestBlockExecutor_ReceiptProof(t *testing.T) {
+	privKey, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	require.Nil(t, err)
+	addr, err := privKey.PublicKey().Address()
+	require.Nil(t, err)
+
+	ldg := newTestLedger(t, []*types.Address{addr})
+	exec, err := New(ldg, log.NewWithModule("executor"), executorType)
+	require.Nil(t, err)
+
+	var txs []*pb.Transaction
+	for i := 0; i < 5; i++ {
+		txs = append(txs, genTransferTx(t, privKey, randAddress(t), uint64(30)))
+	}
+
+	blockData := exec.processExecuteEvent(mockBlock(2, txs))
+	ldg.PersistBlockData(blockData)
+
+	receiptRoot, err := proof.ReceiptRoot(blockData.Receipts)
+	require.Nil(t, err)
+	require.Equal(t, blockData.Block.BlockHeader.ReceiptRoot.String(), receiptRoot.String())
+	txRoot, err := proof.TxRoot(blockData.Block, blockData.InterchainMeta)
+	require.Nil(t, err)
+	require.Equal(t, blockData.Block.BlockHeader.TxRoot.String(), txRoot.String())
+
+	for i, tx := range txs {
+		receiptProof, err := ldg.GetReceiptProof(tx.TransactionHash)
+		require.Nil(t, err)
+		require.Equal(t, blockData.Receipts[i].Hash(), receiptProof.Receipt.Hash())
+		require.Equal(t, blockData.Block.BlockHeader.ReceiptRoot.String(), receiptProof.BlockHeader.ReceiptRoot.String())
+		require.Nil(t, proof.VerifyReceiptProof(receiptProof))
+	}
+
+	// the last two transfers fail for insufficient funds
+	receiptProof, err := ldg.GetReceiptProof(txs[4].TransactionHash)
+	require.Nil(t, err)
+	require.Equal(t, pb.Receipt_FAILED, receiptProof.Receipt.Status)
+
+	receiptProof.Receipt.Status = pb.Receipt_SUCCESS
+	require.NotNil(t, proof.VerifyReceiptProof(receiptProof))
+}
+
+func TestBlockExecutor_OutOfGas(t *testing.T) {
+	privKey, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	require.Nil(t, err)
+	addr, err := privKey.PublicKey().Address()
+	require.Nil(t, err)
+
+	ldg := newTestLedger(t, []*types.Address{addr})
+	exec, err := New(ldg, log.NewWithModule("executor"), executorType)
+	require.Nil(t, err)
+
+	// Store.Set is only callable from the admins
+	admins, err := json.Marshal([]*repo.Admin{{Address: addr.String(), Weight: 1}})
+	require.Nil(t, err)
+	ldg.SetState(constant.RoleContractAddr.Address(), []byte(contracts.AdminRolesKey), admins)
+
+	storeAddr := constant.StoreContractAddr.Address()
+	setTx, err := genBVMContractTransaction(privKey, 2, storeAddr, "Set", pb.String("a"), pb.String("1"))
+	require.Nil(t, err)
+	largeSetTx, err := genBVMContractTransaction(privKey, 3, storeAddr, "Set", pb.String("b"), pb.String(strings.Repeat("1", 1000)))
+	require.Nil(t, err)
+	illegalTx, err := genBVMContractTransaction(privKey, 4, storeAddr, "Set", pb.String("c"), pb.String("1"))
+	require.Nil(t, err)
+	limit := gas.TxGas + gas.GetGas + 2*gas.SetGas
+	setGasLimit(t, privKey, setTx, limit)
+	setGasLimit(t, privKey, largeSetTx, limit)
+	setGasLimit(t, privKey, illegalTx, gas.MaxTxGasLimit+1)
+
+	txs := []*pb.Transaction{genTransferTx(t, privKey, randAddress(t), 10), setTx, largeSetTx, illegalTx}
+	blockData := exec.processExecuteEvent(mockBlock(2, txs))
+
+	require.Equal(t, pb.Receipt_SUCCESS, blockData.Receipts[0].Status)
+	require.Equal(t, pb.Receipt_SUCCESS, blockData.Receipts[1].Status)
+	used, ok := gas.GasUsed(blockData.Receipts[1])
+	require.True(t, ok)
+	require.True(t, used > gas.TxGas && used <= limit)
+	require.Equal(t, pb.Receipt_FAILED, blockData.Receipts[2].Status)
+	require.Equal(t, gas.ErrOutOfGas.Error(), string(blockData.Receipts[2].Ret))
+	require.Equal(t, []*pb.Event{gas.NewUsedEvent(largeSetTx.TransactionHash, limit)}, blockData.Receipts[2].Events)
+	require.Equal(t, pb.Receipt_FAILED, blockData.Receipts[3].Status)
+	require.Contains(t, string(blockData.Receipts[3].Ret), "out of range")
+	used, ok = gas.GasUsed(blockData.Receipts[3])
+	require.True(t, ok)
+	require.Equal(t, uint64(0), used)
+	require.Equal(t, uint64(90), ldg.GetBalance(addr))
+
+	ok, _ = ldg.GetState(storeAddr, []byte("a"))
+	require.True(t, ok)
+	ok, _ = ldg.GetState(storeAddr, []byte("b"))
+	require.False(t, ok)
+}
+
+func TestBlockExecutor_TimeoutReceipts(t *testing.T) {
+	privKey, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	require.Nil(t, err)
+	addr, err := privKey.PublicKey().Address()
+	require.Nil(t, err)
+
+	ldg := newTestLedger(t, []*types.Address{addr})
+	exec, err := New(ldg, log.NewWithModule("executor"), executorType)
+	require.Nil(t, err)
+
+	src := types.NewAddress([]byte{1}).String()
+	dst := types.NewAddress([]byte{2}).String()
+	id := fmt.Sprintf("%s-%s-1", src, dst)
+	for _, interchain := range []*pb.Interchain{
+		{ID: src, InterchainCounter: map[string]uint64{dst: 1}, ReceiptCounter: map[string]uint64{}},
+		{ID: dst, SourceReceiptCounter: map[string]uint64{}},
+	} {
+		data, err := interchain.Marshal()
+		require.Nil(t, err)
+		ldg.SetState(constant.InterchainContractAddr.Address(), []byte(contracts.AppchainKey(interchain.ID)), data)
+	}
+
+	// the transaction times out at the height of the last executed block
+	height := exec.currentHeight
+	txMgr := constant.TransactionMgrContractAddr.Address()
+	ldg.SetState(txMgr, []byte(fmt.Sprintf("%s-%s", contracts.PREFIX, id)), []byte("0"))
+	ldg.SetState(txMgr, []byte(fmt.Sprintf("timeout-%s-%s", contracts.PREFIX, id)), []byte(strconv.FormatUint(height, 10)))
+	ids, err := json.Marshal([]string{id})
+	require.Nil(t, err)
+	ldg.SetState(txMgr, []byte(contracts.TxTimeoutKey(height)), ids)
+
+	// the timeout receipts in the block are generated by the relay chain only
+	forged, err := contracts.TimeoutReceipt(fmt.Sprintf("%s-%s-2", src, dst), 0)
+	require.Nil(t, err)
+	transferTx := genTransferTx(t, privKey, randAddress(t), 10)
+	blockData := exec.processExecuteEvent(mockBlock(height+1, []*pb.Transaction{transferTx, forged}))
+
+	txs := blockData.Block.Transactions
+	require.Equal(t, 2, len(txs))
+	require.Equal(t, []*types.Hash{transferTx.TransactionHash}, blockData.TxHashList)
+	require.Equal(t, pb.IBTP_RECEIPT_FAILURE, txs[1].IBTP.Type)
+	require.Equal(t, id, fmt.Sprintf("%s-%s-%d", txs[1].IBTP.From, txs[1].IBTP.To, txs[1].IBTP.Index))
+	require.Equal(t, pb.Receipt_SUCCESS, blockData.Receipts[1].Status, string(blockData.Receipts[1].Ret))
+	require.Equal(t, []uint64{1}, blockData.InterchainMeta.Counter[src].Slice)
+
+	ok, _ := ldg.GetState(txMgr, []byte(contracts.TxTimeoutKey(height)))
+	require.False(t, ok)
+	ok, status := ldg.GetState(txMgr, []byte(fmt.Sprintf("%s-%s", contracts.PREFIX, id)))
+	require.True(t, ok)
+	require.Equal(t, strconv.Itoa(int(pb.TransactionStatus_FAILURE)), string(status))
+}
+
+func TestBlockExecutor_AppendDrainedIBTPs(t *testing.T) {
+	privKey, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	require.Nil(t, err)
+	addr, err := privKey.PublicKey().Address()
+	require.Nil(t, err)
+
+	ldg := newTestLedger(t, []*types.Address{addr})
+	exec, err := New(ldg, log.NewWithModule("executor"), executorType)
+	require.Nil(t, err)
+
+	src := types.NewAddress([]byte{1}).String()
+	dst := types.NewAddress([]byte{2}).String()
+	ibtp := &pb.IBTP{From: src, To: dst, Index: 3, Type: pb.IBTP_INTERCHAIN}
+	data, err := ibtp.Marshal()
+	require.Nil(t, err)
+	evData, err := json.Marshal(&contracts.DrainedIBTPEvent{Dst: dst, IBTP: data})
+	require.Nil(t, err)
+
+	transferTx := genTransferTx(t, privKey, randAddress(t), 10)
+	block := mockBlock(2, []*pb.Transaction{transferTx})
+	receipts := exec.txsExecutor.ApplyTransactions(nil)
+	receipts = append(receipts,
+		&pb.Receipt{Status: pb.Receipt_SUCCESS, Events: []*pb.Event{{Data: evData}}},
+		&pb.Receipt{Status: pb.Receipt_FAILED, Events: []*pb.Event{{Data: evData}}},
+	)
+
+	receipts = exec.appendDrainedIBTPs(block, receipts)
+	require.Equal(t, 3, len(receipts))
+	require.Equal(t, 2, len(block.Transactions))
+	tx := block.Transactions[1]
+	require.Equal(t, ibtp.ID(), tx.IBTP.ID())
+	require.Equal(t, constant.InterchainContractAddr.Address().String(), tx.From.String())
+	require.Equal(t, tx.TransactionHash, receipts[2].TxHash)
+	require.Equal(t, map[string][]uint64{dst: {1}}, exec.txsExecutor.GetInterchainCounter())
+
+	// the drained ibtps are appended again when the block is replayed
+	require.Equal(t, []*pb.Transaction{transferTx}, removeRelayTxs(block.Transactions))
+}
+
+func TestBlockExecutor_DrainPendingIBTPs(t *testing.T) {
+	privKey, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	require.Nil(t, err)
+	addr, err := privKey.PublicKey().Address()
+	require.Nil(t, err)
+
+	ldg := newTestLedger(t, []*types.Address{addr})
+	exec, err := New(ldg, log.NewWithModule("executor"), executorType)
+	require.Nil(t, err)
+
+	interchainAddr := constant.InterchainContractAddr.Address()
+	src := addr.String()
+	dst := types.NewAddress([]byte{2}).String()
+	interchain := &pb.Interchain{
+		ID:                   src,
+		InterchainCounter:    map[string]uint64{},
+		ReceiptCounter:       map[string]uint64{},
+		SourceReceiptCounter: map[string]uint64{},
+	}
+	data, err := interchain.Marshal()
+	require.Nil(t, err)
+	ldg.SetState(interchainAddr, []byte(contracts.AppchainKey(src)), data)
+	counter := func() uint64 {
+		ok, data := ldg.GetState(interchainAddr, []byte(contracts.AppchainKey(src)))
+		require.True(t, ok)
+		ic := &pb.Interchain{}
+		require.Nil(t, ic.Unmarshal(data))
+		return ic.InterchainCounter[dst]
+	}
+	ibtpTx := func(index uint64) *pb.Transaction {
+		ibtp := mockIBTP(t, index, pb.IBTP_INTERCHAIN)
+		ibtp.From, ibtp.To = src, dst
+		tx := &pb.Transaction{
+			From:      addr,
+			To:        interchainAddr,
+			IBTP:      ibtp,
+			Timestamp: time.Now().UnixNano(),
+			Nonce:     index,
+		}
+		require.Nil(t, tx.Sign(privKey))
+		tx.TransactionHash = tx.Hash()
+		return tx
+	}
+
+	// the buffer of the chain pair is full
+	var txs []*pb.Transaction
+	for i := uint64(2); i <= contracts.MaxPendingIBTPs; i++ {
+		txs = append(txs, ibtpTx(i))
+	}
+	for _, receipt := range exec.txsExecutor.ApplyTransactions(txs) {
+		require.Equal(t, pb.Receipt_SUCCESS, receipt.Status, string(receipt.Ret))
+	}
+
+	// the missing ibtp drains the buffered ones its gas covers under the real
+	// meter, the rest are left to the next block
+	receipt := exec.txsExecutor.ApplyTransactions([]*pb.Transaction{ibtpTx(1)})[0]
+	require.Equal(t, pb.Receipt_SUCCESS, receipt.Status, string(receipt.Ret))
+	result := &contracts.HandleIBTPResult{}
+	require.Nil(t, json.Unmarshal(receipt.Ret, result))
+	require.Empty(t, result.Dropped)
+	require.NotEmpty(t, result.Drained)
+	require.True(t, uint64(len(result.Drained)) < contracts.MaxPendingIBTPs-1)
+	require.Equal(t, uint64(1+len(result.Drained)), counter())
+	used, ok := gas.GasUsed(receipt)
+	require.True(t, ok)
+	require.True(t, used <= gas.MaxTxGasLimit)
+	ok, _ = ldg.GetState(interchainAddr, []byte(contracts.PendingDrainKey(exec.currentHeight+1)))
+	require.True(t, ok)
+
+	// the transactions the relay chain appends to the next blocks drain the rest
+	blockData := exec.processExecuteEvent(mockBlock(exec.currentHeight+1, nil))
+	require.Empty(t, blockData.Block.Transactions)
+	for i := 0; counter() < contracts.MaxPendingIBTPs; i++ {
+		require.True(t, i < int(contracts.MaxPendingIBTPs), "pending ibtps are not drained")
+		drained := counter()
+		blockData = exec.processExecuteEvent(mockBlock(exec.currentHeight+1, nil))
+		txs = blockData.Block.Transactions
+		require.True(t, len(txs) > 1)
+		require.Equal(t, interchainAddr.String(), txs[0].From.String())
+		require.False(t, txs[0].IsIBTP())
+		require.Equal(t, pb.Receipt_SUCCESS, blockData.Receipts[0].Status, string(blockData.Receipts[0].Ret))
+		require.Equal(t, int(counter()-drained), len(txs)-1)
+		for _, tx := range txs[1:] {
+			require.Equal(t, dst, tx.IBTP.To)
+		}
+	}
+	ok, _ = ldg.GetState(interchainAddr, []byte(contracts.PendingDrainKey(exec.currentHeight-1)))
+	require.False(t, ok)
+	ok, _ = ldg.GetState(interchainAddr, []byte(contracts.PendingDrainKey(exec.currentHeight)))
+	require.False(t, ok)
+
+	// the pending drains are generated by the relay chain only
+	forged, err := contracts.DrainPendingIBTPsTx("key", 0)
+	require.Nil(t, err)
+	require.Empty(t, removeRelayTxs([]*pb.Transaction{forged}))
+}
+
+func TestBlockExecutor_PostNodeEvents(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockLedger := mock_ledger.NewMockLedger(mockCtl)
+	mockLedger.EXPECT().GetChainMeta().Return(&pb.ChainMeta{Height: 1, BlockHash: types.NewHashByStr(from)}).AnyTimes()
+
+	exec, err := New(mockLedger, log.NewWithModule("executor"), executorType)
+	require.Nil(t, err)
+
+	node := &contracts.Node{Id: 5, Pid: "pid", Account: "account", Hosts: []string{"/ip4/127.0.0.1/tcp/4005"}}
+	data, err := json.Marshal(&contracts.NodeEvent{Operation: contracts.NodeAdd, Node: node})
+	require.Nil(t, err)
+	nodeEvent := &pb.Event{Data: data}
+	receipts := []*pb.Receipt{
+		{Status: pb.Receipt_FAILED, Events: []*pb.Event{nodeEvent}},
+		{Status: pb.Receipt_SUCCESS, Events: []*pb.Event{{Data: []byte(`{"id":"1356:chain0:1"}`)}, nodeEvent}},
+	}
+
+	ch := make(chan events.NodeEvent, 2)
+	sub := exec.SubscribeNodeEvent(ch)
+	defer sub.Unsubscribe()
+
+	exec.postNodeEvents(receipts)
+	require.Equal(t, 1, len(ch))
+	ev := <-ch
+	require.Equal(t, contracts.NodeAdd, ev.Operation)
+	require.Equal(t, &pb.VpInfo{Id: node.Id, Pid: node.Pid, Account: node.Account, Hosts: node.Hosts}, ev.VpInfo)
+}
+
+func TestBlockExecutor_Replay(t *testing.T) {
+	privKey, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	require.Nil(t, err)
+	addr, err := privKey.PublicKey().Address()
+	require.Nil(t, err)
+
+	ldg := newTestLedger(t, []*types.Address{addr})
+	exec, err := New(ldg, log.NewWithModule("executor"), executorType)
+	require.Nil(t, err)
+	replayLdg := newTestLedger(t, []*types.Address{addr})
+	replayExec, err := New(replayLdg, log.NewWithModule("executor"), executorType)
+	require.Nil(t, err)
+
+	var txs []*pb.Transaction
+	for i := 0; i < 3; i++ {
+		txs = append(txs, genTransferTx(t, privKey, randAddress(t), uint64(40)))
+	}
+	block := mockBlock(2, txs)
+	data, err := block.Marshal()
+	require.Nil(t, err)
+
+	blockData := exec.Replay(block)
+	require.Equal(t, uint64(2), ldg.GetChainMeta().Height)
+
+	replayed := &pb.Block{}
+	require.Nil(t, replayed.Unmarshal(data))
+	replayData := replayExec.Replay(replayed)
+	require.Equal(t, uint64(2), replayLdg.GetChainMeta().Height)
+	require.Equal(t, blockData.Block.BlockHeader.StateRoot.String(), replayData.Block.BlockHeader.StateRoot.String())
+	require.Equal(t, blockData.Block.BlockHeader.ReceiptRoot.String(), replayData.Block.BlockHeader.ReceiptRoot.String())
+
+	diffs, err := ledger.DiffStates(ldg, replayLdg, blockData.Journal, replayData.Journal)
+	require.Nil(t, err)
+	require.Empty(t, diffs)
+}
+
 func listenBlock(wg *sync.WaitGroup, done chan bool, blockCh chan events.ExecutedEvent) {
 	for {
 		select {
@@ -375,6 +815,19 @@ func randAddress(t *testing.T) *types.Address {
 	return address
 }
 
+// setGasLimit declares the gas limit in the data of the transaction and signs
+// it again
+func setGasLimit(t *testing.T, privateKey crypto.PrivateKey, tx *pb.Transaction, limit uint64) {
+	td := &pb.TransactionData{}
+	require.Nil(t, td.Unmarshal(tx.Payload))
+	td.Extra = gas.EncodeTxGasLimit(limit)
+	payload, err := td.Marshal()
+	require.Nil(t, err)
+	tx.Payload = payload
+	require.Nil(t, tx.Sign(privateKey))
+	tx.TransactionHash = tx.Hash()
+}
+
 func genBVMContractTransaction(privateKey crypto.PrivateKey, nonce uint64, address *types.Address, method string, args ...*pb.Arg) (*pb.Transaction, error) {
 	return genContractTransaction(pb.TransactionData_BVM, privateKey, nonce, address, method, args...)
 }
@@ -14,11 +14,14 @@ import (
 	"github.com/meshplus/bitxhub-kit/crypto"
 	"github.com/meshplus/bitxhub-kit/crypto/asym"
 	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/constant"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/executor/contracts"
 	"github.com/meshplus/bitxhub/internal/ledger"
 	"github.com/meshplus/bitxhub/internal/model/events"
 	"github.com/meshplus/bitxhub/pkg/vm"
 	"github.com/meshplus/bitxhub/pkg/vm/boltvm"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 	"github.com/meshplus/bitxhub/pkg/vm/wasm"
 	"github.com/sirupsen/logrus"
 )
@@ -27,12 +30,16 @@ func (exec *BlockExecutor) processExecuteEvent(block *pb.Block) *ledger.BlockDat
 	current := time.Now()
 	var txHashList []*types.Hash
 
+	block.Transactions = removeRelayTxs(block.Transactions)
 	for _, tx := range block.Transactions {
 		txHashList = append(txHashList, tx.TransactionHash)
 	}
 
 	block = exec.verifyProofs(block)
+	block.Transactions = append(block.Transactions, exec.timeoutReceipts(block)...)
+	block.Transactions = append(block.Transactions, exec.pendingDrainTxs(block)...)
 	receipts := exec.txsExecutor.ApplyTransactions(block.Transactions)
+	receipts = exec.appendDrainedIBTPs(block, receipts)
 
 	applyTxsDuration.Observe(float64(time.Since(current)) / float64(time.Second))
 	exec.logger.WithFields(logrus.Fields{
@@ -93,6 +100,115 @@ func (exec *BlockExecutor) processExecuteEvent(block *pb.Block) *ledger.BlockDat
 	}
 }
 
+// timeoutReceipts returns the failure receipts of the interchain transactions
+// timing out at the height of the last executed block, which the relay chain
+// appends to the block to roll them back
+func (exec *BlockExecutor) timeoutReceipts(block *pb.Block) []*pb.Transaction {
+	height := exec.currentHeight
+	ok, data := exec.ledger.GetState(constant.TransactionMgrContractAddr.Address(), []byte(contracts.TxTimeoutKey(height)))
+	if !ok || len(data) == 0 {
+		return nil
+	}
+
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		exec.logger.WithField("height", height).Errorf("Unmarshal timeout transactions error: %v", err)
+		return nil
+	}
+
+	txs := make([]*pb.Transaction, 0, len(ids))
+	for _, id := range ids {
+		tx, err := contracts.TimeoutReceipt(id, block.BlockHeader.Timestamp)
+		if err != nil {
+			exec.logger.WithField("id", id).Errorf("Generate timeout receipt error: %v", err)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+
+	return txs
+}
+
+// pendingDrainTxs returns the transactions continuing to drain the buffered
+// IBTPs which the last executed block left for lack of gas, which the relay
+// chain appends to the block
+func (exec *BlockExecutor) pendingDrainTxs(block *pb.Block) []*pb.Transaction {
+	height := exec.currentHeight
+	ok, data := exec.ledger.GetState(constant.InterchainContractAddr.Address(), []byte(contracts.PendingDrainKey(height)))
+	if !ok || len(data) == 0 {
+		return nil
+	}
+
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		exec.logger.WithField("height", height).Errorf("Unmarshal pending drains error: %v", err)
+		return nil
+	}
+
+	txs := make([]*pb.Transaction, 0, len(keys))
+	for _, key := range keys {
+		tx, err := contracts.DrainPendingIBTPsTx(key, block.BlockHeader.Timestamp)
+		if err != nil {
+			exec.logger.WithField("key", key).Errorf("Generate pending drain error: %v", err)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+
+	return txs
+}
+
+// appendDrainedIBTPs appends the transactions delivering the IBTPs drained in
+// the block which were buffered in earlier blocks, along with their receipts
+func (exec *BlockExecutor) appendDrainedIBTPs(block *pb.Block, receipts []*pb.Receipt) []*pb.Receipt {
+	for _, receipt := range receipts[:len(receipts):len(receipts)] {
+		if receipt.Status != pb.Receipt_SUCCESS {
+			continue
+		}
+
+		for _, ev := range receipt.Events {
+			drained, ok := contracts.ParseDrainedIBTPEvent(ev)
+			if !ok {
+				continue
+			}
+
+			ibtp := &pb.IBTP{}
+			if err := ibtp.Unmarshal(drained.IBTP); err != nil {
+				exec.logger.WithField("tx", receipt.TxHash.String()).Errorf("Unmarshal drained ibtp error: %v", err)
+				continue
+			}
+
+			tx := contracts.DrainedIBTPTx(ibtp, block.BlockHeader.Timestamp)
+			exec.txsExecutor.AddInterchainCounter(drained.Dst, uint64(len(block.Transactions)))
+			block.Transactions = append(block.Transactions, tx)
+			receipts = append(receipts, &pb.Receipt{
+				Version: tx.Version,
+				TxHash:  tx.TransactionHash,
+				Status:  pb.Receipt_SUCCESS,
+			})
+		}
+	}
+
+	return receipts
+}
+
+// removeRelayTxs removes the timeout receipts, the pending drains and the
+// drained IBTPs from the block, which are generated by the relay chain itself
+// when the block is executed or replayed
+func removeRelayTxs(txs []*pb.Transaction) []*pb.Transaction {
+	txMgr := constant.TransactionMgrContractAddr.Address().String()
+	interchain := constant.InterchainContractAddr.Address().String()
+	ret := txs[:0]
+	for _, tx := range txs {
+		if tx.From != nil && (tx.From.String() == txMgr || tx.From.String() == interchain) {
+			continue
+		}
+		ret = append(ret, tx)
+	}
+
+	return ret
+}
+
 func (exec *BlockExecutor) listenPreExecuteEvent() {
 	for {
 		select {
@@ -221,13 +337,32 @@ func (exec *BlockExecutor) verifySign(commitEvent *pb.CommitEvent) *pb.Block {
 }
 
 func (exec *BlockExecutor) applyTx(index int, tx *pb.Transaction, opt *agency.TxOpt) *pb.Receipt {
+	return exec.applyTxWithLedger(index, tx, opt, exec.ledger)
+}
+
+// applyTxWithLedger applies the transaction against the given ledger, which
+// is either the executor's own ledger or an isolated view of it.
+func (exec *BlockExecutor) applyTxWithLedger(index int, tx *pb.Transaction, opt *agency.TxOpt, ldg ledger.Ledger) *pb.Receipt {
 	receipt := &pb.Receipt{
 		Version: tx.Version,
 		TxHash:  tx.TransactionHash,
 	}
 	normalTx := true
 
-	ret, err := exec.applyTransaction(index, tx, opt)
+	// the gas limit is validated at admission, but the blocks of other nodes
+	// may carry any
+	var ret []byte
+	limit, err := gas.TxGasLimit(tx)
+	meter := gas.NewMeter(limit)
+	if err == nil {
+		snapshot := ldg.Snapshot()
+		ret, err = exec.applyTransaction(index, tx, opt, ldg, meter, exec.currentHeight+1)
+		if meter.Exhausted() {
+			// nothing written by a transaction running out of gas is kept
+			ldg.RevertToSnapshot(snapshot)
+			ret, err = nil, gas.ErrOutOfGas
+		}
+	}
 	if err != nil {
 		receipt.Status = pb.Receipt_FAILED
 		receipt.Ret = []byte(err.Error())
@@ -236,9 +371,9 @@ func (exec *BlockExecutor) applyTx(index int, tx *pb.Transaction, opt *agency.Tx
 		receipt.Ret = ret
 	}
 
-	events := exec.ledger.Events(tx.TransactionHash.String())
+	events := ldg.Events(tx.TransactionHash.String())
 	if len(events) != 0 {
-		receipt.Events = events
+		receipt.Events = append(receipt.Events, events...)
 		for _, ev := range events {
 			if ev.Interchain {
 				m := make(map[string]uint64)
@@ -255,6 +390,13 @@ func (exec *BlockExecutor) applyTx(index int, tx *pb.Transaction, opt *agency.Tx
 		}
 	}
 
+	receipt.Events = append(receipt.Events, gas.NewUsedEvent(tx.TransactionHash, meter.Used()))
+
+	exec.logger.WithFields(logrus.Fields{
+		"hash":     tx.TransactionHash.String(),
+		"gas_used": meter.Used(),
+	}).Debug("Applied transaction")
+
 	if normalTx {
 		exec.txsExecutor.AddNormalTx(tx.TransactionHash)
 	}
@@ -270,9 +412,52 @@ func (exec *BlockExecutor) postBlockEvent(block *pb.Block, interchainMeta *pb.In
 	})
 }
 
-func (exec *BlockExecutor) applyTransaction(i int, tx *pb.Transaction, opt *agency.TxOpt) ([]byte, error) {
+// postNodeEvents posts the node changes approved in the persisted block
+func (exec *BlockExecutor) postNodeEvents(receipts []*pb.Receipt) {
+	for _, receipt := range receipts {
+		if receipt.Status != pb.Receipt_SUCCESS {
+			continue
+		}
+
+		for _, ev := range receipt.Events {
+			nodeEvent, ok := contracts.ParseNodeEvent(ev)
+			if !ok {
+				continue
+			}
+
+			exec.logger.WithFields(logrus.Fields{
+				"operation": nodeEvent.Operation,
+				"id":        nodeEvent.Node.Id,
+				"pid":       nodeEvent.Node.Pid,
+			}).Info("Node change approved")
+
+			exec.nodeFeed.Send(events.NodeEvent{
+				Operation: nodeEvent.Operation,
+				VpInfo: &pb.VpInfo{
+					Id:      nodeEvent.Node.Id,
+					Pid:     nodeEvent.Node.Pid,
+					Account: nodeEvent.Node.Account,
+					Hosts:   nodeEvent.Node.Hosts,
+				},
+			})
+		}
+	}
+}
+
+// applyTransaction executes the transaction as a part of the block of the given height
+func (exec *BlockExecutor) applyTransaction(i int, tx *pb.Transaction, opt *agency.TxOpt, ldg ledger.Ledger, meter *gas.Meter, height uint64) ([]byte, error) {
+	if err := meter.Consume(gas.TxGas); err != nil {
+		return nil, err
+	}
+
+	newContext := func(data *pb.TransactionData) *vm.Context {
+		ctx := vm.NewContext(tx, uint64(i), data, ldg, exec.logger, meter)
+		ctx.CurrentHeight = height
+		return ctx
+	}
+
 	if tx.IsIBTP() {
-		ctx := vm.NewContext(tx, uint64(i), nil, exec.ledger, exec.logger)
+		ctx := newContext(nil)
 		instance := boltvm.New(ctx, exec.validationEngine, exec.getContracts(opt))
 		return instance.HandleIBTP(tx.IBTP)
 	}
@@ -288,16 +473,16 @@ func (exec *BlockExecutor) applyTransaction(i int, tx *pb.Transaction, opt *agen
 
 	switch data.Type {
 	case pb.TransactionData_NORMAL:
-		err := exec.transfer(tx.From, tx.To, data.Amount)
+		err := exec.transfer(ldg, tx.From, tx.To, data.Amount)
 		return nil, err
 	default:
 		var instance vm.VM
 		switch data.VmType {
 		case pb.TransactionData_BVM:
-			ctx := vm.NewContext(tx, uint64(i), data, exec.ledger, exec.logger)
+			ctx := newContext(data)
 			instance = boltvm.New(ctx, exec.validationEngine, exec.getContracts(opt))
 		case pb.TransactionData_XVM:
-			ctx := vm.NewContext(tx, uint64(i), data, exec.ledger, exec.logger)
+			ctx := newContext(data)
 			imports, err := wasm.EmptyImports()
 			if err != nil {
 				return nil, err
@@ -318,20 +503,20 @@ func (exec *BlockExecutor) clear() {
 	exec.ledger.Clear()
 }
 
-func (exec *BlockExecutor) transfer(from, to *types.Address, value uint64) error {
+func (exec *BlockExecutor) transfer(ldg ledger.StateAccessor, from, to *types.Address, value uint64) error {
 	if value == 0 {
 		return nil
 	}
 
-	fv := exec.ledger.GetBalance(from)
+	fv := ldg.GetBalance(from)
 	if fv < value {
 		return fmt.Errorf("not sufficient funds for %s", from.String())
 	}
 
-	tv := exec.ledger.GetBalance(to)
+	tv := ldg.GetBalance(to)
 
-	exec.ledger.SetBalance(from, fv-value)
-	exec.ledger.SetBalance(to, tv+value)
+	ldg.SetBalance(from, fv-value)
+	ldg.SetBalance(to, tv+value)
 
 	return nil
 }
@@ -0,0 +1,263 @@
+package executor
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/meshplus/bitxhub-core/agency"
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/ledger"
+	"github.com/sirupsen/logrus"
+)
+
+const globalConflictKey = "global"
+
+// applyTxWithLedgerFunc applies a transaction against the given ledger
+type applyTxWithLedgerFunc func(int, *pb.Transaction, *agency.TxOpt, ledger.Ledger) *pb.Receipt
+
+// ledgerBinder is implemented by TxsExecutors that execute transactions
+// against their own views of the ledger instead of the shared one.
+type ledgerBinder interface {
+	bindLedger(ldg ledger.Ledger, f applyTxWithLedgerFunc)
+}
+
+// ParallelExecutor groups the transactions of a block by the chains and
+// accounts they touch, and executes groups without overlap at the same time,
+// each one against an isolated state view. The views are merged back in
+// block order, so the result is the same as with serial execution. If the
+// groups turn out to touch the same state, the block is executed serially.
+type ParallelExecutor struct {
+	normalTxs         []*types.Hash
+	interchainCounter map[string][]uint64
+	applyTxFunc       agency.ApplyTxFunc
+	applyTxWithLedger applyTxWithLedgerFunc
+	registerContracts agency.RegisterContractFunc
+	boltContracts     map[string]agency.Contract
+	ledger            ledger.Ledger
+	workers           int
+	logger            logrus.FieldLogger
+	lock              sync.Mutex
+}
+
+func NewParallelExecutor(f1 agency.ApplyTxFunc, f2 agency.RegisterContractFunc, logger logrus.FieldLogger) agency.TxsExecutor {
+	return &ParallelExecutor{
+		applyTxFunc:       f1,
+		registerContracts: f2,
+		boltContracts:     f2(),
+		workers:           runtime.NumCPU(),
+		logger:            logger,
+	}
+}
+
+func init() {
+	agency.RegisterExecutorConstructor("parallel", NewParallelExecutor)
+}
+
+func (pe *ParallelExecutor) bindLedger(ldg ledger.Ledger, f applyTxWithLedgerFunc) {
+	pe.ledger = ldg
+	pe.applyTxWithLedger = f
+}
+
+func (pe *ParallelExecutor) ApplyTransactions(txs []*pb.Transaction) []*pb.Receipt {
+	pe.reset()
+
+	groups := groupTransactions(txs)
+	if pe.ledger == nil || len(groups) < 2 {
+		return pe.applySerially(txs)
+	}
+
+	receipts := make([]*pb.Receipt, len(txs))
+	views := make([]*stateView, len(groups))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, pe.workers)
+	wg.Add(len(groups))
+	for i, group := range groups {
+		sem <- struct{}{}
+		go func(i int, group []int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			view := newStateView(pe.ledger)
+			opt := &agency.TxOpt{Contracts: pe.registerContracts()}
+			for _, idx := range group {
+				receipts[idx] = pe.applyTxWithLedger(idx, txs[idx], opt, view)
+			}
+			views[i] = view
+		}(i, group)
+	}
+	wg.Wait()
+
+	if hasConflict(views) {
+		pe.logger.WithFields(logrus.Fields{
+			"count":  len(txs),
+			"groups": len(groups),
+		}).Debug("parallel executor found conflicting groups, fall back to serial execution")
+		pe.reset()
+		return pe.applySerially(txs)
+	}
+
+	for _, view := range views {
+		view.commitTo(pe.ledger)
+	}
+	pe.sortResults(txs)
+
+	pe.logger.Debugf("parallel executor executed %d txs in %d groups", len(txs), len(groups))
+
+	return receipts
+}
+
+func (pe *ParallelExecutor) applySerially(txs []*pb.Transaction) []*pb.Receipt {
+	receipts := make([]*pb.Receipt, 0, len(txs))
+	for i, tx := range txs {
+		receipts = append(receipts, pe.applyTxFunc(i, tx, nil))
+	}
+
+	return receipts
+}
+
+func (pe *ParallelExecutor) reset() {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+
+	pe.interchainCounter = make(map[string][]uint64)
+	pe.normalTxs = make([]*types.Hash, 0)
+}
+
+// sortResults restores the order serial execution would have produced for
+// normal transactions and interchain counters.
+func (pe *ParallelExecutor) sortResults(txs []*pb.Transaction) {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+
+	order := make(map[string]int, len(txs))
+	for i, tx := range txs {
+		order[tx.TransactionHash.String()] = i
+	}
+
+	sort.Slice(pe.normalTxs, func(i, j int) bool {
+		return order[pe.normalTxs[i].String()] < order[pe.normalTxs[j].String()]
+	})
+
+	for _, indexes := range pe.interchainCounter {
+		sort.Slice(indexes, func(i, j int) bool {
+			return indexes[i] < indexes[j]
+		})
+	}
+}
+
+func (pe *ParallelExecutor) GetBoltContracts() map[string]agency.Contract {
+	return pe.boltContracts
+}
+
+func (pe *ParallelExecutor) AddNormalTx(hash *types.Hash) {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+
+	pe.normalTxs = append(pe.normalTxs, hash)
+}
+
+func (pe *ParallelExecutor) GetNormalTxs() []*types.Hash {
+	return pe.normalTxs
+}
+
+func (pe *ParallelExecutor) AddInterchainCounter(to string, index uint64) {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+
+	pe.interchainCounter[to] = append(pe.interchainCounter[to], index)
+}
+
+func (pe *ParallelExecutor) GetInterchainCounter() map[string][]uint64 {
+	return pe.interchainCounter
+}
+
+// groupTransactions splits the transactions into groups which share no
+// conflict key, keeping the block order inside each group.
+func groupTransactions(txs []*pb.Transaction) [][]int {
+	parent := make(map[string]string)
+	var find func(key string) string
+	find = func(key string) string {
+		p, ok := parent[key]
+		if !ok {
+			parent[key] = key
+			return key
+		}
+		if p == key {
+			return key
+		}
+		root := find(p)
+		parent[key] = root
+		return root
+	}
+
+	txKeys := make([][]string, len(txs))
+	for i, tx := range txs {
+		keys := conflictKeys(tx)
+		txKeys[i] = keys
+		root := find(keys[0])
+		for _, key := range keys[1:] {
+			if r := find(key); r != root {
+				parent[r] = root
+			}
+		}
+	}
+
+	var groups [][]int
+	groupIdx := make(map[string]int)
+	for i := range txs {
+		root := find(txKeys[i][0])
+		idx, ok := groupIdx[root]
+		if !ok {
+			idx = len(groups)
+			groupIdx[root] = idx
+			groups = append(groups, nil)
+		}
+		groups[idx] = append(groups[idx], i)
+	}
+
+	return groups
+}
+
+// conflictKeys returns the keys a transaction is expected to touch. IBTPs
+// touch the interchain records of their source and destination chains and
+// transfers touch the two accounts. Contract invocations may touch anything,
+// so they all share the global key.
+func conflictKeys(tx *pb.Transaction) []string {
+	if tx.IsIBTP() {
+		keys := []string{"chain-" + tx.IBTP.From, "chain-" + tx.IBTP.To}
+		if strs := strings.Split(tx.IBTP.From, "-"); len(strs) == 2 {
+			keys = append(keys, "chain-"+strs[0])
+		}
+		return keys
+	}
+
+	if tx.Payload != nil && tx.From != nil && tx.To != nil {
+		data := &pb.TransactionData{}
+		if err := data.Unmarshal(tx.Payload); err == nil && data.Type == pb.TransactionData_NORMAL {
+			return []string{"addr-" + tx.From.String(), "addr-" + tx.To.String()}
+		}
+	}
+
+	return []string{globalConflictKey}
+}
+
+func hasConflict(views []*stateView) bool {
+	for i, view := range views {
+		if view.unsafe {
+			return true
+		}
+		for _, other := range views[i+1:] {
+			if view.conflictWith(other) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,175 @@
+package executor
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/crypto/asym"
+	"github.com/meshplus/bitxhub-kit/log"
+	"github.com/meshplus/bitxhub-kit/storage/blockfile"
+	"github.com/meshplus/bitxhub-kit/storage/leveldb"
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/ledger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelExecutor_ApplyTransactions(t *testing.T) {
+	keys := make([]crypto.PrivateKey, 0)
+	addrs := make([]*types.Address, 0)
+	for i := 0; i < 4; i++ {
+		privKey, err := asym.GenerateKeyPair(crypto.Secp256k1)
+		require.Nil(t, err)
+		addr, err := privKey.PublicKey().Address()
+		require.Nil(t, err)
+		keys = append(keys, privKey)
+		addrs = append(addrs, addr)
+	}
+	receivers := []*types.Address{randAddress(t), randAddress(t), randAddress(t)}
+
+	var txs []*pb.Transaction
+	txs = append(txs, genTransferTx(t, keys[0], receivers[0], 10))
+	txs = append(txs, genTransferTx(t, keys[1], receivers[1], 20))
+	txs = append(txs, genTransferTx(t, keys[2], receivers[2], 30))
+	// shares the receiver with the second transaction
+	txs = append(txs, genTransferTx(t, keys[3], receivers[1], 40))
+	// not sufficient funds, links the first and third transactions
+	txs = append(txs, genTransferTx(t, keys[0], receivers[2], 1000))
+
+	groups := groupTransactions(txs)
+	require.Equal(t, [][]int{{0, 2, 4}, {1, 3}}, groups)
+
+	serialLdg := newTestLedger(t, addrs)
+	parallelLdg := newTestLedger(t, addrs)
+
+	serialExec, err := New(serialLdg, log.NewWithModule("executor"), "serial")
+	require.Nil(t, err)
+	parallelExec, err := New(parallelLdg, log.NewWithModule("executor"), "parallel")
+	require.Nil(t, err)
+
+	serialData := serialExec.processExecuteEvent(mockBlock(2, txs))
+	parallelData := parallelExec.processExecuteEvent(mockBlock(2, txs))
+
+	require.Equal(t, serialData.Block.BlockHeader.StateRoot, parallelData.Block.BlockHeader.StateRoot)
+	require.Equal(t, serialData.Block.BlockHeader.ReceiptRoot, parallelData.Block.BlockHeader.ReceiptRoot)
+	require.Equal(t, serialData.Block.BlockHeader.TxRoot, parallelData.Block.BlockHeader.TxRoot)
+	require.Equal(t, len(serialData.Receipts), len(parallelData.Receipts))
+	for i := range serialData.Receipts {
+		require.Equal(t, serialData.Receipts[i].Status, parallelData.Receipts[i].Status)
+		require.Equal(t, serialData.Receipts[i].Ret, parallelData.Receipts[i].Ret)
+	}
+	require.Equal(t, pb.Receipt_FAILED, parallelData.Receipts[4].Status)
+
+	serialLdg.PersistBlockData(serialData)
+	parallelLdg.PersistBlockData(parallelData)
+	for _, addr := range append(addrs, receivers...) {
+		require.Equal(t, serialLdg.GetBalance(addr), parallelLdg.GetBalance(addr))
+	}
+	require.Equal(t, uint64(60), parallelLdg.GetBalance(receivers[1]))
+}
+
+func TestStateView_Conflict(t *testing.T) {
+	ldg := newTestLedger(t, nil)
+	addr := randAddress(t)
+
+	v1 := newStateView(ldg)
+	v2 := newStateView(ldg)
+	v1.SetState(addr, []byte("a"), []byte("1"))
+	v2.GetState(addr, []byte("b"))
+	require.False(t, hasConflict([]*stateView{v1, v2}))
+
+	v2.GetState(addr, []byte("a"))
+	require.True(t, hasConflict([]*stateView{v1, v2}))
+
+	v3 := newStateView(ldg)
+	v4 := newStateView(ldg)
+	v3.AddState(addr, []byte("prefix-1"), []byte("1"))
+	v4.QueryByPrefix(addr, "prefix-")
+	require.True(t, hasConflict([]*stateView{v3, v4}))
+
+	v5 := newStateView(ldg)
+	v5.AddState(addr, []byte("prefix-1"), []byte("1"))
+	v5.QueryByPrefix(addr, "prefix-")
+	require.True(t, v5.unsafe)
+
+	v6 := newStateView(ldg)
+	v6.SetBalance(addr, 1)
+	v6.commitTo(ldg)
+	require.Equal(t, uint64(1), ldg.GetBalance(addr))
+}
+
+func newTestLedger(t *testing.T, funded []*types.Address) *ledger.ChainLedger {
+	repoRoot, err := ioutil.TempDir("", "parallel_executor")
+	require.Nil(t, err)
+
+	blockchainStorage, err := leveldb.New(filepath.Join(repoRoot, "storage"))
+	require.Nil(t, err)
+	ldb, err := leveldb.New(filepath.Join(repoRoot, "ledger"))
+	require.Nil(t, err)
+	blockFile, err := blockfile.NewBlockFile(repoRoot, log.NewWithModule("blockfile"))
+	require.Nil(t, err)
+	accountCache, err := ledger.NewAccountCache()
+	require.Nil(t, err)
+
+	ldg, err := ledger.New(createMockRepo(t), blockchainStorage, ldb, blockFile, accountCache, log.NewWithModule("ledger"))
+	require.Nil(t, err)
+
+	for _, addr := range funded {
+		ldg.SetBalance(addr, 100)
+	}
+	accounts, journal := ldg.FlushDirtyDataAndComputeJournal()
+	require.Nil(t, ldg.Commit(1, accounts, journal))
+	require.Nil(t, ldg.PersistExecutionResult(mockBlock(1, nil), nil, &pb.InterchainMeta{}))
+
+	return ldg
+}
+
+func TestStateView_RevertToSnapshot(t *testing.T) {
+	ldg := newTestLedger(t, nil)
+	addr := randAddress(t)
+
+	v := newStateView(ldg)
+	v.SetBalance(addr, 1)
+	v.SetState(addr, []byte("a"), []byte("1"))
+
+	snapshot := v.Snapshot()
+	v.SetBalance(addr, 2)
+	v.SetState(addr, []byte("a"), []byte("2"))
+	v.AddState(addr, []byte("b"), []byte("1"))
+	v.AddEvent(&pb.Event{TxHash: types.NewHash([]byte{1})})
+	v.RevertToSnapshot(snapshot)
+
+	require.Equal(t, uint64(1), v.GetBalance(addr))
+	ok, val := v.GetState(addr, []byte("a"))
+	require.True(t, ok)
+	require.Equal(t, []byte("1"), val)
+	ok, _ = v.GetState(addr, []byte("b"))
+	require.False(t, ok)
+	require.Equal(t, 0, len(v.Events(types.NewHash([]byte{1}).String())))
+}
+
+func genTransferTx(t *testing.T, privKey crypto.PrivateKey, to *types.Address, amount uint64) *pb.Transaction {
+	from, err := privKey.PublicKey().Address()
+	require.Nil(t, err)
+
+	data, err := (&pb.TransactionData{
+		Type:   pb.TransactionData_NORMAL,
+		Amount: amount,
+	}).Marshal()
+	require.Nil(t, err)
+
+	tx := &pb.Transaction{
+		From:      from,
+		To:        to,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   data,
+		Amount:    amount,
+	}
+	require.Nil(t, tx.Sign(privKey))
+	tx.TransactionHash = tx.Hash()
+
+	return tx
+}
@@ -0,0 +1,334 @@
+package executor
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/ledger"
+)
+
+var _ ledger.Ledger = (*stateView)(nil)
+
+// stateView is an isolated, write-buffering view over the ledger. Reads fall
+// through to the underlying ledger and are recorded, writes stay in the view
+// until they are merged back with commitTo. It is used by the parallel
+// executor so that groups of transactions can run at the same time.
+type stateView struct {
+	ledger.Ledger
+
+	accounts map[string]*viewAccount
+	events   map[string][]*pb.Event
+	reverts  []func()
+
+	// read sets, used to detect conflicts between views
+	accountReads map[string]struct{}
+	stateReads   map[string]map[string]struct{}
+	prefixReads  map[string][]string
+
+	// unsafe is set when a prefix query could not see the writes buffered
+	// in this view, so the view result is not trustworthy
+	unsafe bool
+}
+
+type viewAccount struct {
+	addr    *types.Address
+	balance *uint64
+	nonce   *uint64
+	code    []byte
+	codeSet bool
+	states  map[string]*viewState
+}
+
+type viewState struct {
+	value []byte
+	// loaded means the original value has been read before writing, so the
+	// write must be replayed with SetState instead of AddState
+	loaded bool
+}
+
+func newStateView(ldg ledger.Ledger) *stateView {
+	return &stateView{
+		Ledger:       ldg,
+		accounts:     make(map[string]*viewAccount),
+		events:       make(map[string][]*pb.Event),
+		accountReads: make(map[string]struct{}),
+		stateReads:   make(map[string]map[string]struct{}),
+		prefixReads:  make(map[string][]string),
+	}
+}
+
+func (v *stateView) account(addr *types.Address) *viewAccount {
+	acc, ok := v.accounts[addr.String()]
+	if !ok {
+		acc = &viewAccount{
+			addr:   addr,
+			states: make(map[string]*viewState),
+		}
+		v.accounts[addr.String()] = acc
+	}
+
+	return acc
+}
+
+// recordAccountChange keeps the buffered account fields to be restored by
+// RevertToSnapshot
+func (v *stateView) recordAccountChange(acc *viewAccount) {
+	balance, nonce, code, codeSet := acc.balance, acc.nonce, acc.code, acc.codeSet
+
+	v.reverts = append(v.reverts, func() {
+		acc.balance, acc.nonce, acc.code, acc.codeSet = balance, nonce, code, codeSet
+	})
+}
+
+// recordStateChange keeps the buffered state of the key to be restored by
+// RevertToSnapshot
+func (v *stateView) recordStateChange(acc *viewAccount, key []byte) {
+	k := string(key)
+	prev, ok := acc.states[k]
+	var state viewState
+	if ok {
+		state = *prev
+	}
+
+	v.reverts = append(v.reverts, func() {
+		if ok {
+			acc.states[k] = &state
+		} else {
+			delete(acc.states, k)
+		}
+	})
+}
+
+// Snapshot returns the id of the buffered writes and events
+func (v *stateView) Snapshot() int {
+	return len(v.reverts)
+}
+
+// RevertToSnapshot discards the writes and events buffered after the snapshot
+func (v *stateView) RevertToSnapshot(id int) {
+	for i := len(v.reverts) - 1; i >= id; i-- {
+		v.reverts[i]()
+	}
+	v.reverts = v.reverts[:id]
+}
+
+func (v *stateView) readAccount(addr *types.Address) {
+	v.accountReads[addr.String()] = struct{}{}
+}
+
+func (v *stateView) readState(addr *types.Address, key []byte) {
+	reads, ok := v.stateReads[addr.String()]
+	if !ok {
+		reads = make(map[string]struct{})
+		v.stateReads[addr.String()] = reads
+	}
+	reads[string(key)] = struct{}{}
+}
+
+// GetBalance get account balance from the view
+func (v *stateView) GetBalance(addr *types.Address) uint64 {
+	if acc, ok := v.accounts[addr.String()]; ok && acc.balance != nil {
+		return *acc.balance
+	}
+
+	v.readAccount(addr)
+	return v.Ledger.GetBalance(addr)
+}
+
+// SetBalance set account balance in the view
+func (v *stateView) SetBalance(addr *types.Address, value uint64) {
+	acc := v.account(addr)
+	v.recordAccountChange(acc)
+	acc.balance = &value
+}
+
+// GetNonce get account nonce from the view
+func (v *stateView) GetNonce(addr *types.Address) uint64 {
+	if acc, ok := v.accounts[addr.String()]; ok && acc.nonce != nil {
+		return *acc.nonce
+	}
+
+	v.readAccount(addr)
+	return v.Ledger.GetNonce(addr)
+}
+
+// SetNonce set account nonce in the view
+func (v *stateView) SetNonce(addr *types.Address, nonce uint64) {
+	acc := v.account(addr)
+	v.recordAccountChange(acc)
+	acc.nonce = &nonce
+}
+
+// GetCode get contract code from the view
+func (v *stateView) GetCode(addr *types.Address) []byte {
+	if acc, ok := v.accounts[addr.String()]; ok && acc.codeSet {
+		return acc.code
+	}
+
+	v.readAccount(addr)
+	return v.Ledger.GetCode(addr)
+}
+
+// SetCode set contract code in the view
+func (v *stateView) SetCode(addr *types.Address, code []byte) {
+	acc := v.account(addr)
+	v.recordAccountChange(acc)
+	acc.code = code
+	acc.codeSet = true
+}
+
+// GetState get account state from the view
+func (v *stateView) GetState(addr *types.Address, key []byte) (bool, []byte) {
+	if acc, ok := v.accounts[addr.String()]; ok {
+		if state, ok := acc.states[string(key)]; ok {
+			return state.value != nil, state.value
+		}
+	}
+
+	v.readState(addr, key)
+	return v.Ledger.GetState(addr, key)
+}
+
+// SetState set account state in the view
+func (v *stateView) SetState(addr *types.Address, key []byte, value []byte) {
+	acc := v.account(addr)
+	v.recordStateChange(acc, key)
+	acc.states[string(key)] = &viewState{
+		value:  value,
+		loaded: true,
+	}
+}
+
+// AddState add account state in the view
+func (v *stateView) AddState(addr *types.Address, key []byte, value []byte) {
+	acc := v.account(addr)
+	v.recordStateChange(acc, key)
+	state, ok := acc.states[string(key)]
+	if !ok {
+		state = &viewState{}
+		acc.states[string(key)] = state
+	}
+	state.value = value
+}
+
+// QueryByPrefix query states by prefix. The underlying ledger only returns
+// values, so buffered writes under the same prefix make the view unsafe.
+func (v *stateView) QueryByPrefix(addr *types.Address, prefix string) (bool, [][]byte) {
+	if acc, ok := v.accounts[addr.String()]; ok {
+		for key := range acc.states {
+			if strings.HasPrefix(key, prefix) {
+				v.unsafe = true
+				break
+			}
+		}
+	}
+
+	v.prefixReads[addr.String()] = append(v.prefixReads[addr.String()], prefix)
+	return v.Ledger.QueryByPrefix(addr, prefix)
+}
+
+// AddEvent add event to the view
+func (v *stateView) AddEvent(event *pb.Event) {
+	hash := event.TxHash.String()
+	prev, ok := v.events[hash]
+	v.reverts = append(v.reverts, func() {
+		if ok {
+			v.events[hash] = prev
+		} else {
+			delete(v.events, hash)
+		}
+	})
+	v.events[hash] = append(v.events[hash], event)
+}
+
+// Events return events of the view
+func (v *stateView) Events(txHash string) []*pb.Event {
+	return v.events[txHash]
+}
+
+// conflictWith reports whether the two views touched the same data with at
+// least one of them writing it.
+func (v *stateView) conflictWith(other *stateView) bool {
+	return v.writesOverlap(other) || other.writesOverlap(v)
+}
+
+// writesOverlap reports whether the writes of v overlap with the reads or
+// writes of other.
+func (v *stateView) writesOverlap(other *stateView) bool {
+	for addr, acc := range v.accounts {
+		otherAcc, written := other.accounts[addr]
+		if acc.balance != nil || acc.nonce != nil || acc.codeSet {
+			if _, ok := other.accountReads[addr]; ok {
+				return true
+			}
+			if written && (otherAcc.balance != nil || otherAcc.nonce != nil || otherAcc.codeSet) {
+				return true
+			}
+		}
+
+		for key := range acc.states {
+			if _, ok := other.stateReads[addr][key]; ok {
+				return true
+			}
+			if written {
+				if _, ok := otherAcc.states[key]; ok {
+					return true
+				}
+			}
+			for _, prefix := range other.prefixReads[addr] {
+				if strings.HasPrefix(key, prefix) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// commitTo replays the buffered writes and events onto the ledger in a
+// deterministic order.
+func (v *stateView) commitTo(ldg ledger.Ledger) {
+	addrs := make([]string, 0, len(v.accounts))
+	for addr := range v.accounts {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	for _, addr := range addrs {
+		acc := v.accounts[addr]
+		if acc.balance != nil {
+			ldg.SetBalance(acc.addr, *acc.balance)
+		}
+		if acc.nonce != nil {
+			ldg.SetNonce(acc.addr, *acc.nonce)
+		}
+		if acc.codeSet {
+			ldg.SetCode(acc.addr, acc.code)
+		}
+
+		keys := make([]string, 0, len(acc.states))
+		for key := range acc.states {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			state := acc.states[key]
+			_, read := v.stateReads[addr][key]
+			if state.loaded || read {
+				ldg.SetState(acc.addr, []byte(key), state.value)
+			} else {
+				ldg.AddState(acc.addr, []byte(key), state.value)
+			}
+		}
+	}
+
+	for _, evs := range v.events {
+		for _, ev := range evs {
+			ldg.AddEvent(ev)
+		}
+	}
+}
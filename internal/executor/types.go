@@ -19,6 +19,12 @@ type Executor interface {
 	// ApplyReadonlyTransactions execute readonly tx
 	ApplyReadonlyTransactions(txs []*pb.Transaction) []*pb.Receipt
 
+	// ApplyReadonlyTransactionsAt execute readonly tx against the state of a past block
+	ApplyReadonlyTransactionsAt(txs []*pb.Transaction, height uint64) ([]*pb.Receipt, error)
+
 	// SubscribeBlockEvent
 	SubscribeBlockEvent(chan<- events.ExecutedEvent) event.Subscription
+
+	// SubscribeNodeEvent subscribes the approved changes of the consensus nodes
+	SubscribeNodeEvent(chan<- events.NodeEvent) event.Subscription
 }
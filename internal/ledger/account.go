@@ -13,17 +13,16 @@ import (
 )
 
 type Account struct {
-	Addr           *types.Address
-	originAccount  *innerAccount
-	dirtyAccount   *innerAccount
-	originState    sync.Map
-	dirtyState     sync.Map
-	originCode     []byte
-	dirtyCode      []byte
-	dirtyStateHash *types.Hash
-	ldb            storage.Storage
-	cache          *AccountCache
-	lock           sync.RWMutex
+	Addr          *types.Address
+	originAccount *innerAccount
+	dirtyAccount  *innerAccount
+	originState   sync.Map
+	dirtyState    sync.Map
+	originCode    []byte
+	dirtyCode     []byte
+	ldb           storage.Storage
+	cache         *AccountCache
+	lock          sync.RWMutex
 }
 
 type innerAccount struct {
@@ -216,7 +215,7 @@ func (o *Account) getJournalIfModified() *journal {
 		entry.PrevCode = o.originCode
 	}
 
-	prevStates := o.getStateJournalAndComputeHash()
+	prevStates := o.getStateJournal()
 	if len(prevStates) != 0 {
 		entry.PrevStates = prevStates
 	}
@@ -228,10 +227,8 @@ func (o *Account) getJournalIfModified() *journal {
 	return nil
 }
 
-func (o *Account) getStateJournalAndComputeHash() map[string][]byte {
+func (o *Account) getStateJournal() map[string][]byte {
 	prevStates := make(map[string][]byte)
-	var dirtyStateKeys []string
-	var dirtyStateData []byte
 
 	o.dirtyState.Range(func(key, value interface{}) bool {
 		origVal, ok := o.originState.Load(key)
@@ -242,38 +239,32 @@ func (o *Account) getStateJournalAndComputeHash() map[string][]byte {
 		valBytes := value.([]byte)
 		if !bytes.Equal(origValBytes, valBytes) {
 			prevStates[key.(string)] = origValBytes
-			dirtyStateKeys = append(dirtyStateKeys, key.(string))
 		}
 		return true
 	})
 
-	sort.Strings(dirtyStateKeys)
-
-	for _, key := range dirtyStateKeys {
-		dirtyStateData = append(dirtyStateData, key...)
-		dirtyVal, _ := o.dirtyState.Load(key)
-		dirtyStateData = append(dirtyStateData, dirtyVal.([]byte)...)
-	}
-	hash := sha256.Sum256(dirtyStateData)
-	o.dirtyStateHash = types.NewHash(hash[:])
-
 	return prevStates
 }
 
-func (o *Account) getDirtyData() []byte {
-	var dirtyData []byte
-
-	dirtyData = append(dirtyData, o.Addr.Bytes()...)
+// getTrieEntries returns the state trie entries changed in the account, keyed
+// by their ledger keys. A nil value means the entry is removed.
+func (o *Account) getTrieEntries() map[string][]byte {
+	entries := make(map[string][]byte)
 
-	if o.dirtyAccount != nil {
+	if innerAccountChanged(o.originAccount, o.dirtyAccount) {
 		data, err := o.dirtyAccount.Marshal()
 		if err != nil {
 			panic(err)
 		}
-		dirtyData = append(dirtyData, data...)
+		entries[string(compositeKey(accountKey, o.Addr))] = data
+	}
+
+	for key := range o.getStateJournal() {
+		val, _ := o.dirtyState.Load(key)
+		entries[string(composeStateKey(o.Addr, []byte(key)))] = val.([]byte)
 	}
 
-	return append(dirtyData, o.dirtyStateHash.Bytes()...)
+	return entries
 }
 
 func innerAccountChanged(account0 *innerAccount, account1 *innerAccount) bool {
@@ -6,10 +6,12 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/cbergoon/merkletree"
 	"github.com/meshplus/bitxhub-kit/storage"
 	"github.com/meshplus/bitxhub-kit/storage/blockfile"
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/pkg/merkle"
 )
 
 // PutBlock put block into store
@@ -21,6 +23,10 @@ func (l *ChainLedger) PutBlock(height uint64, block *pb.Block) error {
 
 // GetBlock get block with height
 func (l *ChainLedger) GetBlock(height uint64) (*pb.Block, error) {
+	if err := l.checkBlockAvailable(height); err != nil {
+		return nil, err
+	}
+
 	data, err := l.bf.Get(blockfile.BlockFileBodiesTable, height)
 	if err != nil {
 		return nil, err
@@ -102,6 +108,10 @@ func (l *ChainLedger) GetTransaction(hash *types.Hash) (*pb.Transaction, error)
 }
 
 func (l *ChainLedger) GetTransactionCount(height uint64) (uint64, error) {
+	if err := l.checkBlockAvailable(height); err != nil {
+		return 0, err
+	}
+
 	txHashesData := l.blockchainStore.Get(compositeKey(blockTxSetKey, height))
 	if txHashesData == nil {
 		return 0, fmt.Errorf("cannot get tx hashes of block")
@@ -151,6 +161,52 @@ func (l *ChainLedger) GetReceipt(hash *types.Hash) (*pb.Receipt, error) {
 	return rs.Receipts[meta.Index], nil
 }
 
+// GetReceiptProof get the transaction receipt with its merkle path to the receipt root of the block
+func (l *ChainLedger) GetReceiptProof(hash *types.Hash) (*ReceiptProof, error) {
+	meta, err := l.GetTransactionMeta(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := l.bf.Get(blockfile.BlockFileBodiesTable, meta.BlockHeight)
+	if err != nil {
+		return nil, err
+	}
+	block := &pb.Block{}
+	if err := block.Unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	rsBytes, err := l.bf.Get(blockfile.BlockFileReceiptTable, meta.BlockHeight)
+	if err != nil {
+		return nil, err
+	}
+	rs := &pb.Receipts{}
+	if err := rs.Unmarshal(rsBytes); err != nil {
+		return nil, err
+	}
+	if meta.Index >= uint64(len(rs.Receipts)) {
+		return nil, fmt.Errorf("receipt index %d out of range", meta.Index)
+	}
+
+	receiptHashes := make([]merkletree.Content, 0, len(rs.Receipts))
+	for _, receipt := range rs.Receipts {
+		receiptHashes = append(receiptHashes, receipt.Hash())
+	}
+
+	receipt := rs.Receipts[meta.Index]
+	path, err := merkle.NewPath(receiptHashes, receipt.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReceiptProof{
+		Receipt:     receipt,
+		BlockHeader: block.BlockHeader,
+		Path:        path,
+	}, nil
+}
+
 // PersistExecutionResult persist the execution result
 func (l *ChainLedger) PersistExecutionResult(block *pb.Block, receipts []*pb.Receipt, interchainMeta *pb.InterchainMeta) error {
 	current := time.Now()
@@ -232,6 +288,10 @@ func (l *ChainLedger) GetChainMeta() *pb.ChainMeta {
 }
 
 func (l *ChainLedger) GetInterchainMeta(height uint64) (*pb.InterchainMeta, error) {
+	if err := l.checkBlockAvailable(height); err != nil {
+		return nil, err
+	}
+
 	data, err := l.bf.Get(blockfile.BlockFileInterchainTable, height)
 	if err != nil {
 		return nil, err
@@ -245,6 +305,16 @@ func (l *ChainLedger) GetInterchainMeta(height uint64) (*pb.InterchainMeta, erro
 	return meta, nil
 }
 
+// checkBlockAvailable fails for the blocks before the snapshot the ledger is
+// imported from, they are only placeholders in the block file
+func (l *ChainLedger) checkBlockAvailable(height uint64) error {
+	if height < l.snapshotHeight {
+		return fmt.Errorf("%w: block %d is before the snapshot at block %d", ErrorBlockBeforeSnapshot, height, l.snapshotHeight)
+	}
+
+	return nil
+}
+
 func (l *ChainLedger) prepareReceipts(batcher storage.Batch, block *pb.Block, receipts []*pb.Receipt) ([]byte, error) {
 	rs := &pb.Receipts{
 		Receipts: receipts,
@@ -337,10 +407,6 @@ func (l *ChainLedger) removeChainDataOnBlock(batch storage.Batch, height uint64)
 		return 0, err
 	}
 
-	if err := l.bf.TruncateBlocks(height - 1); err != nil {
-		return 0, err
-	}
-
 	batch.Delete(compositeKey(blockTxSetKey, height))
 	batch.Delete(compositeKey(blockHashKey, block.BlockHash.String()))
 	batch.Delete(compositeKey(interchainMetaKey, height))
@@ -359,8 +425,10 @@ func (l *ChainLedger) rollbackBlockChain(height uint64) error {
 		return ErrorRollbackToHigherNumber
 	}
 
+	// the blockfile is truncated after the chain meta is persisted, blocks
+	// left over by an interrupted rollback are removed here
 	if meta.Height == height {
-		return nil
+		return l.bf.TruncateBlocks(height)
 	}
 
 	batch := l.blockchainStore.NewBatch()
@@ -396,7 +464,7 @@ func (l *ChainLedger) rollbackBlockChain(height uint64) error {
 
 	l.UpdateChainMeta(meta)
 
-	return nil
+	return l.bf.TruncateBlocks(height)
 }
 
 func getInterchainTxCount(interchainMeta *pb.InterchainMeta) uint64 {
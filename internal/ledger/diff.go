@@ -0,0 +1,107 @@
+package ledger
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/meshplus/bitxhub-kit/types"
+)
+
+// StateDiff is an account or a state key whose value differs between two
+// ledgers. Key is empty for the account itself, whose value is the json
+// encoded nonce, balance and code hash.
+type StateDiff struct {
+	Address  *types.Address
+	Key      string
+	Expected []byte
+	Actual   []byte
+}
+
+// GetBlockJournal returns the state journal of the block of the given height,
+// nil if it is removed
+func (l *ChainLedger) GetBlockJournal(height uint64) *BlockJournal {
+	return getBlockJournal(height, l.ldb)
+}
+
+// DiffStates compares the accounts and state keys changed in the journals on
+// the expected and the actual ledger
+func DiffStates(expected, actual Ledger, journals ...*BlockJournal) ([]*StateDiff, error) {
+	changed := make(map[string]map[string]bool)
+	addrs := make(map[string]*types.Address)
+	for _, blockJournal := range journals {
+		if blockJournal == nil {
+			continue
+		}
+
+		for _, journal := range blockJournal.Journals {
+			addr := journal.Address.String()
+			if changed[addr] == nil {
+				changed[addr] = make(map[string]bool)
+				addrs[addr] = journal.Address
+			}
+			for key := range journal.PrevStates {
+				changed[addr][key] = true
+			}
+		}
+	}
+
+	sortedAddrs := make([]string, 0, len(addrs))
+	for addr := range addrs {
+		sortedAddrs = append(sortedAddrs, addr)
+	}
+	sort.Strings(sortedAddrs)
+
+	var diffs []*StateDiff
+	for _, addr := range sortedAddrs {
+		address := addrs[addr]
+
+		expectedAccount, err := marshalAccount(expected.GetAccount(address))
+		if err != nil {
+			return nil, err
+		}
+		actualAccount, err := marshalAccount(actual.GetAccount(address))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(expectedAccount, actualAccount) {
+			diffs = append(diffs, &StateDiff{
+				Address:  address,
+				Expected: expectedAccount,
+				Actual:   actualAccount,
+			})
+		}
+
+		keys := make([]string, 0, len(changed[addr]))
+		for key := range changed[addr] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			_, expectedVal := expected.GetState(address, []byte(key))
+			_, actualVal := actual.GetState(address, []byte(key))
+			if !bytes.Equal(expectedVal, actualVal) {
+				diffs = append(diffs, &StateDiff{
+					Address:  address,
+					Key:      key,
+					Expected: expectedVal,
+					Actual:   actualVal,
+				})
+			}
+		}
+	}
+
+	return diffs, nil
+}
+
+func marshalAccount(account *Account) ([]byte, error) {
+	inner := account.dirtyAccount
+	if inner == nil {
+		inner = account.originAccount
+	}
+	if inner == nil {
+		return nil, nil
+	}
+
+	return inner.Marshal()
+}
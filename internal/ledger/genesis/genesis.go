@@ -7,6 +7,7 @@ import (
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/constant"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/executor/contracts"
 	"github.com/meshplus/bitxhub/internal/ledger"
 	"github.com/meshplus/bitxhub/internal/repo"
 )
@@ -22,14 +23,42 @@ func Initialize(genesis *repo.Genesis, lg ledger.Ledger) error {
 		return err
 	}
 
-	lg.SetState(roleAddr, []byte("admin-roles"), body)
+	lg.SetState(roleAddr, []byte(contracts.AdminRolesKey), body)
 
 	for _, admin := range genesis.Admins {
 		lg.SetBalance(types.NewAddressByStr(admin.Address), 100000000)
 	}
 
 	for k, v := range genesis.Strategy {
-		lg.SetState(constant.GovernanceContractAddr.Address(), []byte(k), []byte(v))
+		ps, err := json.Marshal(&contracts.ProposalStrategy{
+			Typ:                  contracts.ProposalStrategyType(v),
+			ParticipateThreshold: contracts.DefaultParticipateThreshold,
+		})
+		if err != nil {
+			return err
+		}
+		lg.SetState(constant.GovernanceContractAddr.Address(), []byte(k), ps)
+	}
+
+	for _, perm := range genesis.Permissions {
+		data, err := json.Marshal(perm)
+		if err != nil {
+			return err
+		}
+		lg.SetState(contracts.PermissionContractAddr.Address(), []byte(contracts.PermissionKey(perm.Contract, perm.Method)), data)
+	}
+
+	for _, node := range genesis.Nodes {
+		data, err := json.Marshal(&contracts.Node{
+			Id:      node.ID,
+			Pid:     node.Pid,
+			Account: node.Account,
+			Hosts:   node.Hosts,
+		})
+		if err != nil {
+			return err
+		}
+		lg.SetState(contracts.NodeManagerContractAddr.Address(), []byte(contracts.NodeKey(node.Pid)), data)
 	}
 
 	accounts, journal := lg.FlushDirtyDataAndComputeJournal()
@@ -0,0 +1,300 @@
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+	"github.com/meshplus/bitxhub-kit/types"
+)
+
+// historyStorage is a read only view of the state storage as of the block
+// of the given height. Keys changed by later blocks are answered with the
+// previous values kept in their journals, other keys fall through to the
+// latest committed state.
+type historyStorage struct {
+	ldb       storage.Storage
+	height    uint64
+	maxHeight uint64
+	reverted  map[string][]byte
+	err       error
+	lock      sync.Mutex
+}
+
+var _ storage.Storage = (*historyStorage)(nil)
+
+func newHistoryStorage(ldb storage.Storage, height uint64) (*historyStorage, error) {
+	s := &historyStorage{
+		ldb:       ldb,
+		height:    height,
+		maxHeight: height,
+		reverted:  make(map[string][]byte),
+	}
+
+	if err := s.sync(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// sync reverts the journals committed since the last sync. Journals are
+// walked in increasing height, so the value kept for a key is the one
+// before its first change after the history height.
+func (s *historyStorage) sync() error {
+	_, maxHeight := getJournalRange(s.ldb)
+	if maxHeight < s.height {
+		return fmt.Errorf("state of block %d is not committed", s.height)
+	}
+
+	for i := s.maxHeight + 1; i <= maxHeight; i++ {
+		blockJournal := getBlockJournal(i, s.ldb)
+		if blockJournal == nil {
+			return fmt.Errorf("journal of block %d is removed", i)
+		}
+
+		for _, journal := range blockJournal.Journals {
+			if journal.AccountChanged {
+				var prev []byte
+				if journal.PrevAccount != nil {
+					data, err := journal.PrevAccount.Marshal()
+					if err != nil {
+						return err
+					}
+					prev = data
+				}
+				s.revert(compositeKey(accountKey, journal.Address), prev)
+			}
+
+			for key, val := range journal.PrevStates {
+				s.revert(composeStateKey(journal.Address, []byte(key)), val)
+			}
+
+			if journal.CodeChanged {
+				s.revert(compositeKey(codeKey, journal.Address), journal.PrevCode)
+			}
+		}
+	}
+	s.maxHeight = maxHeight
+
+	return nil
+}
+
+func (s *historyStorage) revert(key []byte, prev []byte) {
+	if _, ok := s.reverted[string(key)]; !ok {
+		s.reverted[string(key)] = prev
+	}
+}
+
+// read runs fn against the latest committed state until no block is
+// committed in between, journals and state of a block are written in
+// one batch. Once the journals can not be synced, fn is not run any more
+// and the error is kept for Err.
+func (s *historyStorage) read(fn func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for {
+		if s.err != nil {
+			return
+		}
+		if err := s.sync(); err != nil {
+			s.err = fmt.Errorf("state of block %d is unavailable: %w", s.height, err)
+			return
+		}
+
+		fn()
+
+		if _, maxHeight := getJournalRange(s.ldb); maxHeight == s.maxHeight {
+			return
+		}
+	}
+}
+
+// Err returns the error which makes the history state unavailable, values
+// read after it are nil
+func (s *historyStorage) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.err
+}
+
+func (s *historyStorage) Get(key []byte) []byte {
+	var val []byte
+	s.read(func() {
+		if prev, ok := s.reverted[string(key)]; ok {
+			val = prev
+			return
+		}
+		val = s.ldb.Get(key)
+	})
+
+	return val
+}
+
+func (s *historyStorage) Has(key []byte) bool {
+	return s.Get(key) != nil
+}
+
+func (s *historyStorage) Iterator(start, end []byte) storage.Iterator {
+	var it *historyIterator
+	s.read(func() {
+		it = s.iterate(s.ldb.Iterator(start, end), func(key []byte) bool {
+			return bytes.Compare(key, start) >= 0 && (end == nil || bytes.Compare(key, end) < 0)
+		})
+	})
+
+	return it
+}
+
+func (s *historyStorage) Prefix(prefix []byte) storage.Iterator {
+	var it *historyIterator
+	s.read(func() {
+		it = s.iterate(s.ldb.Prefix(prefix), func(key []byte) bool {
+			return bytes.HasPrefix(key, prefix)
+		})
+	})
+
+	return it
+}
+
+func (s *historyStorage) iterate(latest storage.Iterator, inRange func(key []byte) bool) *historyIterator {
+	entries := make(map[string][]byte)
+	for latest.Next() {
+		val := make([]byte, len(latest.Value()))
+		copy(val, latest.Value())
+		entries[string(latest.Key())] = val
+	}
+
+	for key, prev := range s.reverted {
+		if !inRange([]byte(key)) {
+			continue
+		}
+		if prev == nil {
+			delete(entries, key)
+		} else {
+			entries[key] = prev
+		}
+	}
+
+	it := &historyIterator{index: -1}
+	for key := range entries {
+		it.keys = append(it.keys, key)
+	}
+	sort.Strings(it.keys)
+	for _, key := range it.keys {
+		it.values = append(it.values, entries[key])
+	}
+
+	return it
+}
+
+func (s *historyStorage) Put(key, value []byte) {
+	panic("history state is read only")
+}
+
+func (s *historyStorage) Delete(key []byte) {
+	panic("history state is read only")
+}
+
+func (s *historyStorage) NewBatch() storage.Batch {
+	panic("history state is read only")
+}
+
+func (s *historyStorage) Close() error {
+	return nil
+}
+
+// historyIterator iterates over key/value pairs collected in key order
+type historyIterator struct {
+	keys   []string
+	values [][]byte
+	index  int
+}
+
+func (it *historyIterator) Next() bool {
+	if it.index < len(it.keys) {
+		it.index++
+	}
+	return it.index < len(it.keys)
+}
+
+func (it *historyIterator) Prev() bool {
+	if it.index >= 0 {
+		it.index--
+	}
+	return it.index >= 0
+}
+
+func (it *historyIterator) Seek(key []byte) bool {
+	it.index = sort.SearchStrings(it.keys, string(key))
+	return it.index < len(it.keys)
+}
+
+func (it *historyIterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.index])
+}
+
+func (it *historyIterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.values) {
+		return nil
+	}
+	return it.values[it.index]
+}
+
+// StateAt returns a read only ledger with the state after the block of the
+// given height, the journals of all the blocks after it must be kept. Height
+// 0 means the latest block. State changes made on it are never committed.
+// Reads on it must be checked with StateErr, as the journals may be pruned or
+// rolled back after it is created.
+func (l *ChainLedger) StateAt(height uint64) (Ledger, error) {
+	if height == 0 {
+		_, height = getJournalRange(l.ldb)
+	}
+
+	ldb, err := newHistoryStorage(l.ldb, height)
+	if err != nil {
+		return nil, err
+	}
+
+	accountCache, err := NewAccountCache()
+	if err != nil {
+		return nil, err
+	}
+
+	prevJnlHash := &types.Hash{}
+	if journal := getBlockJournal(height, l.ldb); journal != nil {
+		prevJnlHash = journal.ChangedHash
+	}
+
+	return &ChainLedger{
+		repo:            l.repo,
+		logger:          l.logger,
+		chainMeta:       l.GetChainMeta(),
+		blockchainStore: l.blockchainStore,
+		ldb:             ldb,
+		bf:              l.bf,
+		minJnlHeight:    height,
+		maxJnlHeight:    height,
+		accounts:        make(map[string]*Account),
+		accountCache:    accountCache,
+		prevJnlHash:     prevJnlHash,
+		trieNodes:       make(map[string][]byte),
+	}, nil
+}
+
+// StateErr returns the error occurred in reading the state of the ledger
+// created by StateAt, it is always nil for the latest state
+func (l *ChainLedger) StateErr() error {
+	if history, ok := l.ldb.(*historyStorage); ok {
+		return history.Err()
+	}
+
+	return nil
+}
@@ -25,6 +25,9 @@ type journal struct {
 type BlockJournal struct {
 	Journals    []*journal
 	ChangedHash *types.Hash
+
+	// trie nodes created by the block, not persisted with the journal
+	trieNodes map[string][]byte
 }
 
 func (journal *journal) revert(batch storage.Batch) {
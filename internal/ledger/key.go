@@ -18,6 +18,8 @@ const (
 	accountKey         = "account-"
 	codeKey            = "code-"
 	journalKey         = "journal-"
+	trieNodeKey        = "trie-"
+	snapshotHeightKey  = "snapshot-height"
 )
 
 func compositeKey(prefix string, value interface{}) []byte {
@@ -27,3 +29,7 @@ func compositeKey(prefix string, value interface{}) []byte {
 func composeStateKey(addr *types.Address, key []byte) []byte {
 	return append(addr.Bytes(), key...)
 }
+
+func composeTrieNodeKey(hash []byte) []byte {
+	return append([]byte(trieNodeKey), hash...)
+}
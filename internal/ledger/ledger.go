@@ -1,6 +1,7 @@
 package ledger
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -18,8 +19,10 @@ var _ Ledger = (*ChainLedger)(nil)
 var (
 	ErrorRollbackToHigherNumber  = fmt.Errorf("rollback to higher blockchain height")
 	ErrorRollbackWithoutJournal  = fmt.Errorf("rollback to blockchain height without journal")
-	ErrorRollbackTooMuch         = fmt.Errorf("rollback too much block")
+	ErrorRollbackPruned          = fmt.Errorf("rollback to blockchain height whose journal is pruned")
 	ErrorRemoveJournalOutOfRange = fmt.Errorf("remove journal out of range")
+	ErrorRemoveTxMetaOutOfRange  = fmt.Errorf("remove transaction meta out of range")
+	ErrorBlockBeforeSnapshot     = fmt.Errorf("block before the imported snapshot is not available")
 )
 
 type ChainLedger struct {
@@ -29,8 +32,10 @@ type ChainLedger struct {
 	bf              *blockfile.BlockFile
 	minJnlHeight    uint64
 	maxJnlHeight    uint64
+	snapshotHeight  uint64
 	events          sync.Map
 	accounts        map[string]*Account
+	reverts         []func()
 	accountCache    *AccountCache
 	prevJnlHash     *types.Hash
 	repo            *repo.Repo
@@ -40,6 +45,10 @@ type ChainLedger struct {
 
 	journalMutex sync.RWMutex
 	lock         sync.RWMutex
+
+	trieMutex     sync.RWMutex
+	trieNodes     map[string][]byte
+	trieCommitted map[string]struct{}
 }
 
 type BlockData struct {
@@ -60,6 +69,11 @@ func New(repo *repo.Repo, blockchainStore storage.Storage, ldb storage.Storage,
 
 	minJnlHeight, maxJnlHeight := getJournalRange(ldb)
 
+	snapshotHeight := uint64(0)
+	if data := blockchainStore.Get([]byte(snapshotHeightKey)); data != nil {
+		snapshotHeight = unmarshalHeight(data)
+	}
+
 	prevJnlHash := &types.Hash{}
 	if maxJnlHeight != 0 {
 		blockJournal := getBlockJournal(maxJnlHeight, ldb)
@@ -85,9 +99,11 @@ func New(repo *repo.Repo, blockchainStore storage.Storage, ldb storage.Storage,
 		bf:              bf,
 		minJnlHeight:    minJnlHeight,
 		maxJnlHeight:    maxJnlHeight,
+		snapshotHeight:  snapshotHeight,
 		accounts:        make(map[string]*Account),
 		accountCache:    accountCache,
 		prevJnlHash:     prevJnlHash,
+		trieNodes:       make(map[string][]byte),
 	}
 
 	height := maxJnlHeight
@@ -95,6 +111,13 @@ func New(repo *repo.Repo, blockchainStore storage.Storage, ldb storage.Storage,
 		height = chainMeta.Height
 	}
 
+	// the state trie of ledgers created by older versions is built once
+	if height == maxJnlHeight {
+		if ledger.prevJnlHash, err = ledger.resolveStateRoot(maxJnlHeight, prevJnlHash); err != nil {
+			return nil, fmt.Errorf("resolve state trie root: %w", err)
+		}
+	}
+
 	if err := ledger.Rollback(height); err != nil {
 		return nil, err
 	}
@@ -164,6 +187,37 @@ func (l *ChainLedger) RemoveJournalsBeforeBlock(height uint64) error {
 	return nil
 }
 
+// RemoveTxMetasBeforeBlock removes the transaction meta of the blocks whose
+// number < height, the transactions of them can not be queried by hash
+// any more but stay in the blocks
+func (l *ChainLedger) RemoveTxMetasBeforeBlock(height uint64) error {
+	if height > l.GetChainMeta().Height+1 {
+		return ErrorRemoveTxMetaOutOfRange
+	}
+
+	from := uint64(1)
+	if data := l.blockchainStore.Get(compositeKey(transactionMetaKey, minHeightStr)); data != nil {
+		from = unmarshalHeight(data)
+	}
+
+	for i := from; i < height; i++ {
+		batch := l.blockchainStore.NewBatch()
+		if data := l.blockchainStore.Get(compositeKey(blockTxSetKey, i)); data != nil {
+			var txHashes []types.Hash
+			if err := json.Unmarshal(data, &txHashes); err != nil {
+				return fmt.Errorf("unmarshal tx hashes of block %d: %w", i, err)
+			}
+			for _, hash := range txHashes {
+				batch.Delete(compositeKey(transactionMetaKey, hash.String()))
+			}
+		}
+		batch.Put(compositeKey(transactionMetaKey, minHeightStr), marshalHeight(i+1))
+		batch.Commit()
+	}
+
+	return nil
+}
+
 // AddEvent add ledger event
 func (l *ChainLedger) AddEvent(event *pb.Event) {
 	var events []*pb.Event
@@ -172,10 +226,31 @@ func (l *ChainLedger) AddEvent(event *pb.Event) {
 	if ok {
 		events = value.([]*pb.Event)
 	}
+	l.reverts = append(l.reverts, func() {
+		if ok {
+			l.events.Store(hash, value)
+		} else {
+			l.events.Delete(hash)
+		}
+	})
 	events = append(events, event)
 	l.events.Store(hash, events)
 }
 
+// Snapshot returns the id of the current state and events, the changes made
+// after it can be discarded by RevertToSnapshot until the ledger is cleared
+func (l *ChainLedger) Snapshot() int {
+	return len(l.reverts)
+}
+
+// RevertToSnapshot discards the state changes and events made after the snapshot
+func (l *ChainLedger) RevertToSnapshot(id int) {
+	for i := len(l.reverts) - 1; i >= id; i-- {
+		l.reverts[i]()
+	}
+	l.reverts = l.reverts[:id]
+}
+
 // Events return ledger events
 func (l *ChainLedger) Events(txHash string) []*pb.Event {
 	events, ok := l.events.Load(txHash)
@@ -1,9 +1,11 @@
 package ledger
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
@@ -153,13 +155,14 @@ func TestChainLedger_Commit(t *testing.T) {
 	err := ledger.Commit(1, accounts, journal)
 	assert.Nil(t, err)
 	assert.Equal(t, uint64(1), ledger.Version())
-	assert.Equal(t, "0xA1a6d35708Fa6Cf804B6cF9479F3a55d9A87FbFB83c55a64685AeaBdBa6116B1", journal.ChangedHash.String())
+	assert.Equal(t, "0x9E8c4eD892f5b154c3ff0aFF26A9c87063217e430447A12d3C1eda99873fA895", journal.ChangedHash.String())
 
 	accounts, journal = ledger.FlushDirtyDataAndComputeJournal()
 	err = ledger.Commit(2, accounts, journal)
 	assert.Nil(t, err)
 	assert.Equal(t, uint64(2), ledger.Version())
-	assert.Equal(t, "0xF09F0198C06D549316D4ee7C497C9eaeF9D24f5b1075e7bCEF3D0a82DfA742cF", journal.ChangedHash.String())
+	// nothing changed, the state root stays the same
+	assert.Equal(t, "0x9E8c4eD892f5b154c3ff0aFF26A9c87063217e430447A12d3C1eda99873fA895", journal.ChangedHash.String())
 
 	ledger.SetState(account, []byte("a"), []byte("3"))
 	ledger.SetState(account, []byte("a"), []byte("2"))
@@ -167,14 +170,14 @@ func TestChainLedger_Commit(t *testing.T) {
 	err = ledger.Commit(3, accounts, journal)
 	assert.Nil(t, err)
 	assert.Equal(t, uint64(3), ledger.Version())
-	assert.Equal(t, "0xe9FC370DD36C9BD5f67cCfbc031C909F53A3d8bC7084C01362c55f2D42bA841c", journal.ChangedHash.String())
+	assert.Equal(t, "0x62f0bFA9B3Dd931f195e284f9856763453C68A31CF743b32cfCbb5b57Ee22F7a", journal.ChangedHash.String())
 
 	ledger.SetBalance(account, 100)
 	accounts, journal = ledger.FlushDirtyDataAndComputeJournal()
 	err = ledger.Commit(4, accounts, journal)
 	assert.Nil(t, err)
 	assert.Equal(t, uint64(4), ledger.Version())
-	assert.Equal(t, "0xC179056204BA33eD6CFC0bfE94ca03319BEb522fd7B0773A589899817B49ec08", journal.ChangedHash.String())
+	assert.Equal(t, "0xB22aDB72733e3bbA2335908A11Fbda4547ec88ea8C9CB5154182A0b12029e020", journal.ChangedHash.String())
 
 	code := bytesutil.RightPadBytes([]byte{100}, 100)
 	ledger.SetCode(account, code)
@@ -283,10 +286,10 @@ func TestChainLedger_Rollback(t *testing.T) {
 	assert.Equal(t, uint64(2), ledger.minJnlHeight)
 
 	err = ledger.Rollback(0)
-	assert.Equal(t, ErrorRollbackTooMuch, err)
+	assert.True(t, errors.Is(err, ErrorRollbackPruned))
 
 	err = ledger.Rollback(1)
-	assert.Equal(t, ErrorRollbackTooMuch, err)
+	assert.True(t, errors.Is(err, ErrorRollbackPruned))
 	assert.Equal(t, uint64(3), ledger.chainMeta.Height)
 
 	err = ledger.Rollback(3)
@@ -331,7 +334,252 @@ func TestChainLedger_Rollback(t *testing.T) {
 	assert.Equal(t, uint64(2), ledger.maxJnlHeight)
 
 	err = ledger.Rollback(1)
-	assert.Equal(t, ErrorRollbackTooMuch, err)
+	assert.True(t, errors.Is(err, ErrorRollbackPruned))
+}
+
+func TestChainLedger_VerifyJournals(t *testing.T) {
+	ledger, _ := initLedger(t, "")
+	require.Nil(t, ledger.VerifyJournals())
+
+	addr := types.NewAddress(bytesutil.LeftPadBytes([]byte{100}, 20))
+	for i := uint64(1); i <= 3; i++ {
+		ledger.SetBalance(addr, i)
+		accounts, journal := ledger.FlushDirtyDataAndComputeJournal()
+		blockData := genBlockData(i, accounts, journal)
+		blockData.Block.BlockHeader.StateRoot = journal.ChangedHash
+		ledger.PersistBlockData(blockData)
+	}
+	require.Nil(t, ledger.VerifyJournals())
+
+	// a block left over in the blockfile is removed by rollback
+	require.Nil(t, ledger.bf.AppendBlock(3, nil, nil, nil, nil, nil))
+	require.Nil(t, ledger.Rollback(3))
+	blocks, err := ledger.bf.Blocks()
+	require.Nil(t, err)
+	require.Equal(t, uint64(3), blocks)
+
+	ledger.ldb.Delete(compositeKey(journalKey, 2))
+	require.NotNil(t, ledger.VerifyJournals())
+}
+
+func TestNew_BuildStateTrie(t *testing.T) {
+	ledger, repoRoot := initLedger(t, "")
+	legacyRoot := func(height uint64) *types.Hash {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("legacy-%d", height)))
+		return types.NewHash(hash[:])
+	}
+
+	addr := types.NewAddress(bytesutil.LeftPadBytes([]byte{100}, 20))
+	roots := make(map[uint64]*types.Hash)
+	for i := uint64(1); i <= 3; i++ {
+		ledger.SetBalance(addr, i)
+		ledger.SetState(addr, []byte("a"), []byte(fmt.Sprintf("%d", i)))
+		accounts, journal := ledger.FlushDirtyDataAndComputeJournal()
+		blockData := genBlockData(i, accounts, journal)
+		blockData.Block.BlockHeader.StateRoot = legacyRoot(i)
+		ledger.PersistBlockData(blockData)
+		roots[i] = journal.ChangedHash
+	}
+
+	// journals written by older versions hold no trie roots
+	it := ledger.ldb.Iterator([]byte(trieNodeKey), nil)
+	for it.Next() && bytes.HasPrefix(it.Key(), []byte(trieNodeKey)) {
+		ledger.ldb.Delete(append([]byte{}, it.Key()...))
+	}
+	for i := uint64(1); i <= 3; i++ {
+		journal := getBlockJournal(i, ledger.ldb)
+		journal.ChangedHash = legacyRoot(i)
+		data, err := json.Marshal(journal)
+		require.Nil(t, err)
+		ledger.ldb.Put(compositeKey(journalKey, i), data)
+	}
+	ledger.Close()
+
+	ledger, _ = initLedger(t, repoRoot)
+	require.Equal(t, roots[3].String(), ledger.prevJnlHash.String())
+	require.Nil(t, ledger.VerifyJournals())
+
+	// the trie is built only once
+	ledger.Close()
+	ledger, _ = initLedger(t, repoRoot)
+	require.Equal(t, roots[3].String(), ledger.prevJnlHash.String())
+
+	require.Nil(t, ledger.Rollback(2))
+	require.Equal(t, roots[2].String(), ledger.prevJnlHash.String())
+
+	ledger.SetBalance(addr, 4)
+	accounts, journal := ledger.FlushDirtyDataAndComputeJournal()
+	blockData := genBlockData(3, accounts, journal)
+	blockData.Block.BlockHeader.StateRoot = journal.ChangedHash
+	ledger.PersistBlockData(blockData)
+
+	proof, err := ledger.GetStateProof(addr, []byte("a"), 0)
+	require.Nil(t, err)
+	require.Equal(t, []byte("2"), proof.Value)
+}
+
+func TestDiffStates(t *testing.T) {
+	expected, _ := initLedger(t, "")
+	actual, _ := initLedger(t, "")
+
+	addr := types.NewAddress(bytesutil.LeftPadBytes([]byte{100}, 20))
+	commit := func(ledger *ChainLedger, balance uint64, val []byte) *BlockJournal {
+		ledger.SetBalance(addr, balance)
+		ledger.SetState(addr, []byte("a"), []byte("1"))
+		ledger.SetState(addr, []byte("b"), val)
+		accounts, journal := ledger.FlushDirtyDataAndComputeJournal()
+		ledger.PersistBlockData(genBlockData(1, accounts, journal))
+		return journal
+	}
+
+	expectedJournal := commit(expected, 1, []byte("2"))
+	actualJournal := commit(actual, 2, []byte("3"))
+
+	diffs, err := DiffStates(expected, actual, expected.GetBlockJournal(1), actualJournal)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(diffs))
+	require.Equal(t, addr.String(), diffs[0].Address.String())
+	require.Equal(t, "", diffs[0].Key)
+	require.Contains(t, string(diffs[0].Expected), `"balance":1`)
+	require.Contains(t, string(diffs[0].Actual), `"balance":2`)
+	require.Equal(t, "b", diffs[1].Key)
+	require.Equal(t, []byte("2"), diffs[1].Expected)
+	require.Equal(t, []byte("3"), diffs[1].Actual)
+
+	diffs, err = DiffStates(expected, expected, expectedJournal)
+	require.Nil(t, err)
+	require.Empty(t, diffs)
+}
+
+func TestChainLedger_GetStateProof(t *testing.T) {
+	ledger, _ := initLedger(t, "")
+
+	addr := types.NewAddress(bytesutil.LeftPadBytes([]byte{100}, 20))
+
+	ledger.SetBalance(addr, 1)
+	ledger.SetState(addr, []byte("a"), []byte("1"))
+	accounts, journal1 := ledger.FlushDirtyDataAndComputeJournal()
+	blockData := genBlockData(1, accounts, journal1)
+	blockData.Block.BlockHeader.StateRoot = journal1.ChangedHash
+	ledger.PersistBlockData(blockData)
+
+	ledger.SetState(addr, []byte("a"), []byte("2"))
+	ledger.SetState(addr, []byte("b"), []byte("3"))
+	accounts, journal2 := ledger.FlushDirtyDataAndComputeJournal()
+	blockData = genBlockData(2, accounts, journal2)
+	blockData.Block.BlockHeader.StateRoot = journal2.ChangedHash
+	ledger.PersistBlockData(blockData)
+
+	proof, err := ledger.GetStateProof(addr, []byte("a"), 1)
+	require.Nil(t, err)
+	require.True(t, proof.Exists)
+	require.Equal(t, []byte("1"), proof.Value)
+	require.Nil(t, proof.Verify(journal1.ChangedHash))
+	require.NotNil(t, proof.Verify(journal2.ChangedHash))
+
+	proof, err = ledger.GetStateProof(addr, []byte("b"), 1)
+	require.Nil(t, err)
+	require.False(t, proof.Exists)
+	require.Nil(t, proof.Verify(journal1.ChangedHash))
+
+	proof, err = ledger.GetStateProof(addr, []byte("a"), 0)
+	require.Nil(t, err)
+	require.True(t, proof.Exists)
+	require.Equal(t, []byte("2"), proof.Value)
+	require.Nil(t, proof.Verify(journal2.ChangedHash))
+
+	proof, err = ledger.GetStateProof(addr, nil, 2)
+	require.Nil(t, err)
+	require.True(t, proof.Exists)
+	account := &innerAccount{}
+	require.Nil(t, account.Unmarshal(proof.Value))
+	require.Equal(t, uint64(1), account.Balance)
+	require.Nil(t, proof.Verify(journal2.ChangedHash))
+
+	_, err = ledger.GetStateProof(addr, []byte("a"), 3)
+	require.NotNil(t, err)
+}
+
+func TestChainLedger_StateAt(t *testing.T) {
+	ledger, _ := initLedger(t, "")
+
+	addr := types.NewAddress(bytesutil.LeftPadBytes([]byte{100}, 20))
+
+	ledger.SetBalance(addr, 1)
+	ledger.SetState(addr, []byte("a1"), []byte("1"))
+	ledger.SetState(addr, []byte("a2"), []byte("2"))
+	accounts, journal := ledger.FlushDirtyDataAndComputeJournal()
+	ledger.PersistBlockData(genBlockData(1, accounts, journal))
+
+	ledger.SetBalance(addr, 2)
+	ledger.SetState(addr, []byte("a1"), []byte("3"))
+	ledger.SetState(addr, []byte("a2"), nil)
+	ledger.SetState(addr, []byte("a3"), []byte("4"))
+	ledger.SetCode(addr, []byte("code"))
+	accounts, journal = ledger.FlushDirtyDataAndComputeJournal()
+	ledger.PersistBlockData(genBlockData(2, accounts, journal))
+
+	history, err := ledger.StateAt(1)
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), history.GetBalance(addr))
+	require.Nil(t, history.GetCode(addr))
+	ok, val := history.GetState(addr, []byte("a1"))
+	require.True(t, ok)
+	require.Equal(t, []byte("1"), val)
+	ok, _ = history.GetState(addr, []byte("a3"))
+	require.False(t, ok)
+	ok, vals := history.QueryByPrefix(addr, "a")
+	require.True(t, ok)
+	require.Equal(t, [][]byte{[]byte("1"), []byte("2")}, vals)
+
+	// blocks committed after the history ledger is created are reverted too
+	ledger.SetBalance(addr, 3)
+	ledger.SetState(addr, []byte("a2"), []byte("5"))
+	accounts, journal = ledger.FlushDirtyDataAndComputeJournal()
+	ledger.PersistBlockData(genBlockData(3, accounts, journal))
+
+	ok, val = history.GetState(addr, []byte("a2"))
+	require.True(t, ok)
+	require.Equal(t, []byte("2"), val)
+	require.Equal(t, uint64(1), history.GetAccount(addr).GetBalance())
+
+	// writes stay in the history ledger
+	history.SetState(addr, []byte("a1"), []byte("6"))
+	ok, val = ledger.GetState(addr, []byte("a1"))
+	require.True(t, ok)
+	require.Equal(t, []byte("3"), val)
+
+	history, err = ledger.StateAt(2)
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), history.GetBalance(addr))
+	require.Equal(t, []byte("code"), history.GetCode(addr))
+	ok, vals = history.QueryByPrefix(addr, "a")
+	require.True(t, ok)
+	require.Equal(t, [][]byte{[]byte("3"), []byte("4")}, vals)
+
+	history, err = ledger.StateAt(0)
+	require.Nil(t, err)
+	require.Equal(t, uint64(3), history.GetBalance(addr))
+
+	_, err = ledger.StateAt(4)
+	require.NotNil(t, err)
+
+	require.Nil(t, ledger.RemoveJournalsBeforeBlock(3))
+	_, err = ledger.StateAt(1)
+	require.NotNil(t, err)
+	history, err = ledger.StateAt(2)
+	require.Nil(t, err)
+	require.Nil(t, history.StateErr())
+
+	// journals removed after the history ledger is created fail the reads
+	ledger.SetBalance(addr, 4)
+	accounts, journal = ledger.FlushDirtyDataAndComputeJournal()
+	ledger.PersistBlockData(genBlockData(4, accounts, journal))
+	ledger.ldb.Delete(compositeKey(journalKey, 4))
+
+	require.Equal(t, uint64(0), history.GetBalance(addr))
+	require.NotNil(t, history.StateErr())
+	require.Nil(t, ledger.StateErr())
 }
 
 func TestChainLedger_RemoveJournalsBeforeBlock(t *testing.T) {
@@ -694,6 +942,45 @@ func TestChainLedger_AddEvent(t *testing.T) {
 	assert.Equal(t, 0, len(events))
 }
 
+func TestChainLedger_RevertToSnapshot(t *testing.T) {
+	ledger, _ := initLedger(t, "")
+
+	account := types.NewAddress(bytesutil.LeftPadBytes([]byte{100}, 20))
+	hash := types.NewHash([]byte{1})
+	ledger.SetBalance(account, 100)
+	ledger.SetState(account, []byte("a"), []byte("1"))
+	ledger.AddEvent(&pb.Event{TxHash: hash, Data: []byte{1}})
+
+	snapshot := ledger.Snapshot()
+	ledger.SetBalance(account, 50)
+	ledger.SetNonce(account, 1)
+	ledger.SetCode(account, []byte("code"))
+	ledger.SetState(account, []byte("a"), []byte("2"))
+	ledger.AddState(account, []byte("b"), []byte("1"))
+	ledger.AddEvent(&pb.Event{TxHash: hash, Data: []byte{2}})
+	ledger.AddEvent(&pb.Event{TxHash: types.NewHash([]byte{2}), Data: []byte{1}})
+
+	ledger.RevertToSnapshot(snapshot)
+	assert.Equal(t, uint64(100), ledger.GetBalance(account))
+	assert.Equal(t, uint64(0), ledger.GetNonce(account))
+	assert.Nil(t, ledger.GetCode(account))
+
+	ok, val := ledger.GetState(account, []byte("a"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), val)
+	ok, _ = ledger.GetState(account, []byte("b"))
+	assert.False(t, ok)
+
+	assert.Equal(t, 1, len(ledger.Events(hash.String())))
+	assert.Equal(t, 0, len(ledger.Events(types.NewHash([]byte{2}).String())))
+
+	accounts, journal := ledger.FlushDirtyDataAndComputeJournal()
+	ledger.PersistBlockData(genBlockData(1, accounts, journal))
+	assert.Equal(t, uint64(100), ledger.GetBalance(account))
+	ok, _ = ledger.GetState(account, []byte("b"))
+	assert.False(t, ok)
+}
+
 func TestPutBlock(t *testing.T) {
 	repoRoot, err := ioutil.TempDir("", "TestPutBlock")
 	require.Nil(t, err)
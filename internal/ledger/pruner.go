@@ -0,0 +1,135 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/meshplus/bitxhub/internal/repo"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FullMode keeps the state journals of the latest blocks only
+	FullMode = "full"
+	// ArchiveMode keeps the state journals of all blocks
+	ArchiveMode = "archive"
+
+	pruneInterval = time.Minute
+)
+
+// Pruner removes the state journals and the transaction meta of the blocks
+// older than the retention in full mode. Rollback, history queries and state
+// proofs are not available for the blocks whose journals are removed, and
+// their transactions can not be queried by hash. The state trie nodes only
+// reachable from the removed journals are swept once the journals of another
+// retention of blocks are removed.
+//
+// The bloom filter of the order is not pruned, it has a fixed size and can
+// not remove the transactions added to it.
+type Pruner struct {
+	ledger    Ledger
+	mode      string
+	retention uint64
+	logger    logrus.FieldLogger
+
+	// journals before it were removed when the state trie was last pruned
+	triePrunedAt uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewPruner creates the journal pruner of the ledger
+func NewPruner(ledger Ledger, config repo.Ledger, logger logrus.FieldLogger) (*Pruner, error) {
+	switch config.Mode {
+	case FullMode:
+		if config.JournalRetention == 0 {
+			return nil, fmt.Errorf("journal retention of full mode should be greater than 0")
+		}
+	case ArchiveMode:
+	default:
+		return nil, fmt.Errorf("unsupported ledger mode: %s", config.Mode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Pruner{
+		ledger:    ledger,
+		mode:      config.Mode,
+		retention: config.JournalRetention,
+		logger:    logger,
+		ctx:       ctx,
+		cancel:    cancel,
+	}, nil
+}
+
+// Start starts pruning in background, it does nothing in archive mode
+func (p *Pruner) Start() error {
+	if p.mode != FullMode {
+		return nil
+	}
+
+	go func() {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := p.prune(); err != nil {
+				p.logger.WithField("err", err).Error("Prune ledger journals")
+			}
+
+			select {
+			case <-ticker.C:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops pruning
+func (p *Pruner) Stop() error {
+	p.cancel()
+
+	return nil
+}
+
+func (p *Pruner) prune() error {
+	height := p.ledger.Version()
+	if height <= p.retention {
+		return nil
+	}
+
+	before := height - p.retention + 1
+	if err := p.ledger.RemoveJournalsBeforeBlock(before); err != nil {
+		return err
+	}
+	if err := p.ledger.RemoveTxMetasBeforeBlock(before); err != nil {
+		return err
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"height": height,
+		"before": before,
+	}).Debug("Pruned ledger journals")
+
+	if before < p.triePrunedAt+p.retention {
+		return nil
+	}
+
+	removed, err := p.ledger.PruneStateTrie()
+	if err != nil {
+		return err
+	}
+	p.triePrunedAt = before
+
+	p.logger.WithFields(logrus.Fields{
+		"before":  before,
+		"removed": removed,
+	}).Info("Pruned state trie")
+
+	return nil
+}
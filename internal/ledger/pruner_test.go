@@ -0,0 +1,81 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/meshplus/bitxhub-kit/bytesutil"
+	"github.com/meshplus/bitxhub-kit/log"
+	"github.com/meshplus/bitxhub-kit/storage"
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruner_Prune(t *testing.T) {
+	ledger, _ := initLedger(t, "")
+
+	addr := types.NewAddress(bytesutil.LeftPadBytes([]byte{100}, 20))
+	txs := make([]*pb.Transaction, 0, 5)
+	for i := uint64(1); i <= 5; i++ {
+		ledger.SetBalance(addr, i)
+		ledger.SetState(addr, []byte(fmt.Sprintf("key-%d", i)), []byte("value"))
+		accounts, journal := ledger.FlushDirtyDataAndComputeJournal()
+		blockData := genBlockData(i, accounts, journal)
+		tx := &pb.Transaction{Nonce: i}
+		tx.TransactionHash = tx.Hash()
+		blockData.Block.Transactions = []*pb.Transaction{tx}
+		ledger.PersistBlockData(blockData)
+		txs = append(txs, tx)
+	}
+	countTrieNodes := func() int {
+		count := 0
+		it := ledger.ldb.Prefix([]byte(trieNodeKey))
+		for it.Next() {
+			count++
+		}
+		return count
+	}
+	nodes := countTrieNodes()
+
+	_, err := NewPruner(ledger, repo.Ledger{Mode: "light"}, log.NewWithModule("pruner"))
+	require.NotNil(t, err)
+	_, err = NewPruner(ledger, repo.Ledger{Mode: FullMode}, log.NewWithModule("pruner"))
+	require.NotNil(t, err)
+
+	pruner, err := NewPruner(ledger, repo.Ledger{Mode: FullMode, JournalRetention: 10}, log.NewWithModule("pruner"))
+	require.Nil(t, err)
+	require.Nil(t, pruner.prune())
+	require.Equal(t, uint64(1), ledger.minJnlHeight)
+
+	pruner, err = NewPruner(ledger, repo.Ledger{Mode: FullMode, JournalRetention: 2}, log.NewWithModule("pruner"))
+	require.Nil(t, err)
+	require.Nil(t, pruner.prune())
+	require.Equal(t, uint64(4), ledger.minJnlHeight)
+	require.Nil(t, getBlockJournal(3, ledger.ldb))
+	require.NotNil(t, getBlockJournal(4, ledger.ldb))
+
+	// transactions of the pruned blocks are only kept in the blocks
+	_, err = ledger.GetTransactionMeta(txs[2].TransactionHash)
+	require.Equal(t, storage.ErrorNotFound, err)
+	_, err = ledger.GetTransactionMeta(txs[3].TransactionHash)
+	require.Nil(t, err)
+
+	// state tries of the retained journals are kept
+	require.True(t, countTrieNodes() < nodes)
+	for i := uint64(4); i <= 5; i++ {
+		val, err := ledger.stateTrie(getBlockJournal(i, ledger.ldb).ChangedHash).Get(composeStateKey(addr, []byte("key-1")))
+		require.Nil(t, err)
+		require.Equal(t, []byte("value"), val)
+	}
+	removed, err := ledger.PruneStateTrie()
+	require.Nil(t, err)
+	require.Equal(t, 0, removed)
+
+	err = ledger.Rollback(2)
+	require.True(t, errors.Is(err, ErrorRollbackPruned))
+	require.Nil(t, ledger.Rollback(4))
+	require.Equal(t, uint64(4), ledger.GetBalance(addr))
+}
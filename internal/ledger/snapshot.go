@@ -0,0 +1,260 @@
+package ledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+	"github.com/meshplus/bitxhub-kit/storage/blockfile"
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/pkg/trie"
+)
+
+const snapshotVersion = 1
+
+// SnapshotHeader is the first line of a ledger snapshot, the chain meta and
+// the block (without transactions) are protobuf encoded
+type SnapshotHeader struct {
+	Version   int    `json:"version"`
+	Height    uint64 `json:"height"`
+	ChainMeta []byte `json:"chain_meta"`
+	Block     []byte `json:"block"`
+}
+
+// SnapshotEntry is an account, code or state key with its value, each entry
+// takes one line after the header
+type SnapshotEntry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type nodeReaderFunc func(hash []byte) []byte
+
+func (f nodeReaderFunc) GetNode(hash []byte) []byte {
+	return f(hash)
+}
+
+func isStateKey(key []byte) bool {
+	return !bytes.HasPrefix(key, []byte(journalKey)) && !bytes.HasPrefix(key, []byte(trieNodeKey))
+}
+
+// ExportSnapshot writes all the account, code and state keys after the block
+// of the given height with the chain meta and the block header. Height 0
+// means the latest block.
+func (l *ChainLedger) ExportSnapshot(height uint64, w io.Writer) error {
+	meta := l.GetChainMeta()
+	if height == 0 {
+		height = meta.Height
+	}
+	if height == 0 || height > meta.Height {
+		return fmt.Errorf("block %d not found, current height is %d", height, meta.Height)
+	}
+
+	block, err := l.GetBlock(height)
+	if err != nil {
+		return fmt.Errorf("get block %d: %w", height, err)
+	}
+
+	// chain meta as of the block
+	for i := meta.Height; i > height; i-- {
+		interchainMeta, err := l.GetInterchainMeta(i)
+		if err != nil {
+			return fmt.Errorf("get interchain meta of block %d: %w", i, err)
+		}
+		meta.InterchainTxCount -= getInterchainTxCount(interchainMeta)
+	}
+	meta.Height = height
+	meta.BlockHash = block.BlockHash
+
+	state, err := newHistoryStorage(l.ldb, height)
+	if err != nil {
+		return err
+	}
+
+	metaData, err := meta.Marshal()
+	if err != nil {
+		return err
+	}
+
+	block.Transactions = nil
+	blockData, err := block.Marshal()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(&SnapshotHeader{
+		Version:   snapshotVersion,
+		Height:    height,
+		ChainMeta: metaData,
+		Block:     blockData,
+	}); err != nil {
+		return err
+	}
+
+	exported := make(map[string]bool)
+	it := l.ldb.Iterator(nil, nil)
+	for it.Next() {
+		if !isStateKey(it.Key()) {
+			continue
+		}
+
+		val := it.Value()
+		if prev, ok := state.reverted[string(it.Key())]; ok {
+			val = prev
+			exported[string(it.Key())] = true
+		}
+		if val == nil {
+			continue
+		}
+
+		if err := enc.Encode(&SnapshotEntry{Key: it.Key(), Value: val}); err != nil {
+			return err
+		}
+	}
+
+	// keys removed after the block
+	var removed []string
+	for key, prev := range state.reverted {
+		if !exported[key] && prev != nil {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		if err := enc.Encode(&SnapshotEntry{Key: []byte(key), Value: state.reverted[key]}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportSnapshot loads a ledger snapshot into the storages of a new repo, the
+// ledger created on them starts at the height of the snapshot. The block in
+// the snapshot must have the trusted hash got from the chain out of band, and
+// the state is checked against the state root of its header.
+func ImportSnapshot(r io.Reader, trustedHash *types.Hash, blockchainStore storage.Storage, ldb storage.Storage, bf *blockfile.BlockFile) (*pb.ChainMeta, error) {
+	if trustedHash == nil || *trustedHash == (types.Hash{}) {
+		return nil, fmt.Errorf("trusted block hash is required")
+	}
+
+	current, err := loadChainMeta(blockchainStore)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := bf.Blocks()
+	if err != nil {
+		return nil, err
+	}
+	if _, maxHeight := getJournalRange(ldb); current.Height != 0 || blocks != 0 || maxHeight != 0 {
+		return nil, fmt.Errorf("ledger is not empty")
+	}
+
+	dec := json.NewDecoder(r)
+	header := &SnapshotHeader{}
+	if err := dec.Decode(header); err != nil {
+		return nil, fmt.Errorf("decode snapshot header: %w", err)
+	}
+	if header.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version: %d", header.Version)
+	}
+
+	meta := &pb.ChainMeta{}
+	if err := meta.Unmarshal(header.ChainMeta); err != nil {
+		return nil, fmt.Errorf("unmarshal chain meta: %w", err)
+	}
+	block := &pb.Block{}
+	if err := block.Unmarshal(header.Block); err != nil {
+		return nil, fmt.Errorf("unmarshal block: %w", err)
+	}
+	if block.BlockHeader == nil || block.BlockHeader.Number != header.Height || meta.Height != header.Height || header.Height == 0 {
+		return nil, fmt.Errorf("snapshot height mismatch")
+	}
+	if block.Hash().String() != block.BlockHash.String() || meta.BlockHash.String() != block.BlockHash.String() {
+		return nil, fmt.Errorf("snapshot block hash mismatch")
+	}
+	if block.BlockHash.String() != trustedHash.String() {
+		return nil, fmt.Errorf("snapshot block hash %s does not match the trusted block hash %s", block.BlockHash, trustedHash)
+	}
+
+	stateTrie := trie.New(nil, nodeReaderFunc(func([]byte) []byte { return nil }))
+	batch := ldb.NewBatch()
+	for dec.More() {
+		entry := &SnapshotEntry{}
+		if err := dec.Decode(entry); err != nil {
+			return nil, fmt.Errorf("decode snapshot entry: %w", err)
+		}
+		if !isStateKey(entry.Key) || entry.Value == nil {
+			return nil, fmt.Errorf("invalid snapshot entry: %x", entry.Key)
+		}
+
+		batch.Put(entry.Key, entry.Value)
+		if !bytes.HasPrefix(entry.Key, []byte(codeKey)) {
+			if err := stateTrie.Update(entry.Key, entry.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	root := stateTrie.Root()
+	if root.String() != block.BlockHeader.StateRoot.String() {
+		return nil, fmt.Errorf("state root %s of snapshot does not match the block header %s", root, block.BlockHeader.StateRoot)
+	}
+
+	for hash, node := range stateTrie.Nodes() {
+		batch.Put(composeTrieNodeKey([]byte(hash)), node)
+	}
+
+	journal, err := json.Marshal(&BlockJournal{ChangedHash: root})
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(compositeKey(journalKey, header.Height), journal)
+	batch.Put(compositeKey(journalKey, minHeightStr), marshalHeight(header.Height))
+	batch.Put(compositeKey(journalKey, maxHeightStr), marshalHeight(header.Height))
+
+	// blocks before the snapshot are not available, reads of them are
+	// rejected by the snapshot height
+	for i := uint64(0); i < header.Height-1; i++ {
+		if err := bf.AppendBlock(i, nil, nil, nil, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	rs, err := (&pb.Receipts{}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	ts, err := (&pb.Transactions{}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	im, err := (&pb.InterchainMeta{}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := bf.AppendBlock(header.Height-1, block.BlockHash.Bytes(), header.Block, rs, ts, im); err != nil {
+		return nil, err
+	}
+
+	batch.Commit()
+
+	txHashes, err := json.Marshal([]types.Hash{})
+	if err != nil {
+		return nil, err
+	}
+
+	bcBatch := blockchainStore.NewBatch()
+	bcBatch.Put(compositeKey(blockTxSetKey, header.Height), txHashes)
+	bcBatch.Put(compositeKey(blockHashKey, block.BlockHash.String()), []byte(fmt.Sprintf("%d", header.Height)))
+	bcBatch.Put([]byte(chainMetaKey), header.ChainMeta)
+	bcBatch.Put([]byte(snapshotHeightKey), marshalHeight(header.Height))
+	bcBatch.Commit()
+
+	return meta, nil
+}
@@ -0,0 +1,131 @@
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/meshplus/bitxhub-kit/bytesutil"
+	"github.com/meshplus/bitxhub-kit/log"
+	"github.com/meshplus/bitxhub-kit/storage/blockfile"
+	"github.com/meshplus/bitxhub-kit/storage/leveldb"
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainLedger_Snapshot(t *testing.T) {
+	ledger, _ := initLedger(t, "")
+
+	addr := types.NewAddress(bytesutil.LeftPadBytes([]byte{100}, 20))
+	contract := types.NewAddress(bytesutil.LeftPadBytes([]byte{101}, 20))
+	commit := func(height uint64) {
+		accounts, journal := ledger.FlushDirtyDataAndComputeJournal()
+		blockData := genBlockData(height, accounts, journal)
+		blockData.Block.BlockHeader.StateRoot = journal.ChangedHash
+		blockData.Block.BlockHash = blockData.Block.Hash()
+		ledger.PersistBlockData(blockData)
+	}
+
+	ledger.SetBalance(addr, 1)
+	ledger.SetState(addr, []byte("a"), []byte("1"))
+	ledger.SetCode(contract, []byte("code"))
+	commit(1)
+
+	ledger.SetBalance(addr, 2)
+	ledger.SetState(addr, []byte("b"), []byte("2"))
+	commit(2)
+
+	ledger.SetBalance(addr, 3)
+	ledger.SetState(addr, []byte("a"), nil)
+	ledger.SetState(addr, []byte("b"), []byte("3"))
+	commit(3)
+
+	_, err := exportSnapshot(ledger, 4)
+	require.NotNil(t, err)
+
+	data, err := exportSnapshot(ledger, 2)
+	require.Nil(t, err)
+
+	repoRoot, err := ioutil.TempDir("", "TestChainLedger_Snapshot")
+	require.Nil(t, err)
+	blockStorage, err := leveldb.New(filepath.Join(repoRoot, "storage"))
+	require.Nil(t, err)
+	ldb, err := leveldb.New(filepath.Join(repoRoot, "ledger"))
+	require.Nil(t, err)
+	blockFile, err := blockfile.NewBlockFile(repoRoot, log.NewWithModule("blockfile"))
+	require.Nil(t, err)
+
+	trusted, err := ledger.GetBlock(2)
+	require.Nil(t, err)
+
+	// tampered snapshot is rejected
+	tampered := bytes.Replace(data, []byte(`"value":"Mg=="`), []byte(`"value":"NA=="`), 1)
+	require.NotEqual(t, data, tampered)
+	_, err = ImportSnapshot(bytes.NewReader(tampered), trusted.BlockHash, blockStorage, ldb, blockFile)
+	require.NotNil(t, err)
+
+	// snapshot of a block other than the trusted one is rejected
+	_, err = ImportSnapshot(bytes.NewReader(data), nil, blockStorage, ldb, blockFile)
+	require.NotNil(t, err)
+	other, err := ledger.GetBlock(3)
+	require.Nil(t, err)
+	_, err = ImportSnapshot(bytes.NewReader(data), other.BlockHash, blockStorage, ldb, blockFile)
+	require.NotNil(t, err)
+
+	meta, err := ImportSnapshot(bytes.NewReader(data), trusted.BlockHash, blockStorage, ldb, blockFile)
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), meta.Height)
+
+	_, err = ImportSnapshot(bytes.NewReader(data), trusted.BlockHash, blockStorage, ldb, blockFile)
+	require.NotNil(t, err)
+
+	imported, err := New(createMockRepo(t), blockStorage, ldb, blockFile, nil, log.NewWithModule("executor"))
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), imported.GetChainMeta().Height)
+	require.Equal(t, uint64(2), imported.GetBalance(addr))
+	require.Equal(t, []byte("code"), imported.GetCode(contract))
+	ok, val := imported.GetState(addr, []byte("a"))
+	require.True(t, ok)
+	require.Equal(t, []byte("1"), val)
+	ok, val = imported.GetState(addr, []byte("b"))
+	require.True(t, ok)
+	require.Equal(t, []byte("2"), val)
+
+	block, err := imported.GetBlock(2)
+	require.Nil(t, err)
+	expected, err := ledger.GetBlock(2)
+	require.Nil(t, err)
+	require.Equal(t, expected.BlockHash.String(), block.BlockHash.String())
+	_, err = imported.GetBlock(1)
+	require.True(t, errors.Is(err, ErrorBlockBeforeSnapshot))
+	_, err = imported.GetInterchainMeta(1)
+	require.True(t, errors.Is(err, ErrorBlockBeforeSnapshot))
+
+	// the imported ledger goes on from the snapshot
+	imported.SetBalance(addr, 3)
+	imported.SetState(addr, []byte("a"), nil)
+	imported.SetState(addr, []byte("b"), []byte("3"))
+	accounts, journal := imported.FlushDirtyDataAndComputeJournal()
+	expected, err = ledger.GetBlock(3)
+	require.Nil(t, err)
+	require.Equal(t, expected.BlockHeader.StateRoot.String(), journal.ChangedHash.String())
+	imported.PersistBlockData(&BlockData{
+		Block:          expected,
+		Accounts:       accounts,
+		Journal:        journal,
+		InterchainMeta: &pb.InterchainMeta{},
+	})
+	require.Equal(t, uint64(3), imported.GetChainMeta().Height)
+}
+
+func exportSnapshot(ledger *ChainLedger, height uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := ledger.ExportSnapshot(height, &buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -2,8 +2,8 @@ package ledger
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"sort"
 	"sync"
 
@@ -60,6 +60,7 @@ func (l *ChainLedger) GetBalance(addr *types.Address) uint64 {
 // SetBalance set account balance
 func (l *ChainLedger) SetBalance(addr *types.Address, value uint64) {
 	account := l.GetOrCreateAccount(addr)
+	l.recordAccountChange(account)
 	account.SetBalance(value)
 }
 
@@ -72,18 +73,21 @@ func (l *ChainLedger) GetState(addr *types.Address, key []byte) (bool, []byte) {
 // SetState set account state value using account Address and key
 func (l *ChainLedger) SetState(addr *types.Address, key []byte, v []byte) {
 	account := l.GetOrCreateAccount(addr)
+	l.recordStateChange(account, key)
 	account.SetState(key, v)
 }
 
 // AddState add account state value using account Address and key
 func (l *ChainLedger) AddState(addr *types.Address, key []byte, v []byte) {
 	account := l.GetOrCreateAccount(addr)
+	l.recordStateChange(account, key)
 	account.AddState(key, v)
 }
 
 // SetCode set contract code
 func (l *ChainLedger) SetCode(addr *types.Address, code []byte) {
 	account := l.GetOrCreateAccount(addr)
+	l.recordAccountChange(account)
 	account.SetCodeAndHash(code)
 }
 
@@ -102,6 +106,7 @@ func (l *ChainLedger) GetNonce(addr *types.Address) uint64 {
 // SetNonce set account nonce
 func (l *ChainLedger) SetNonce(addr *types.Address, nonce uint64) {
 	account := l.GetOrCreateAccount(addr)
+	l.recordAccountChange(account)
 	account.SetNonce(nonce)
 }
 
@@ -114,38 +119,82 @@ func (l *ChainLedger) QueryByPrefix(addr *types.Address, prefix string) (bool, [
 func (l *ChainLedger) Clear() {
 	l.events = sync.Map{}
 	l.accounts = make(map[string]*Account)
+	l.reverts = nil
 }
 
-// FlushDirtyDataAndComputeJournal gets dirty accounts and computes block journal
+// recordAccountChange keeps the dirty account and code to be restored by
+// RevertToSnapshot
+func (l *ChainLedger) recordAccountChange(account *Account) {
+	var prev *innerAccount
+	if account.dirtyAccount != nil {
+		inner := *account.dirtyAccount
+		prev = &inner
+	}
+	prevCode := account.dirtyCode
+
+	l.reverts = append(l.reverts, func() {
+		account.dirtyAccount = prev
+		account.dirtyCode = prevCode
+	})
+}
+
+// recordStateChange keeps the dirty state of the key to be restored by
+// RevertToSnapshot
+func (l *ChainLedger) recordStateChange(account *Account, key []byte) {
+	k := string(key)
+	prev, ok := account.dirtyState.Load(k)
+
+	l.reverts = append(l.reverts, func() {
+		if ok {
+			account.dirtyState.Store(k, prev)
+		} else {
+			account.dirtyState.Delete(k)
+		}
+	})
+}
+
+// FlushDirtyDataAndComputeJournal gets dirty accounts and computes block journal,
+// the changed hash of the journal is the root of the state trie
 func (l *ChainLedger) FlushDirtyDataAndComputeJournal() (map[string]*Account, *BlockJournal) {
 	dirtyAccounts := make(map[string]*Account)
-	var dirtyAccountData []byte
 	var journals []*journal
 	var sortedAddr []string
-	accountData := make(map[string][]byte)
+	trieEntries := make(map[string]map[string][]byte)
 
 	for addr, account := range l.accounts {
 		journal := account.getJournalIfModified()
 		if journal != nil {
 			journals = append(journals, journal)
 			sortedAddr = append(sortedAddr, addr)
-			accountData[addr] = account.getDirtyData()
+			trieEntries[addr] = account.getTrieEntries()
 			dirtyAccounts[addr] = account
 		}
 	}
 
+	stateTrie := l.stateTrie(l.prevJnlHash)
 	sort.Strings(sortedAddr)
 	for _, addr := range sortedAddr {
-		dirtyAccountData = append(dirtyAccountData, accountData[addr]...)
+		entries := trieEntries[addr]
+		keys := make([]string, 0, len(entries))
+		for key := range entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if err := stateTrie.Update([]byte(key), entries[key]); err != nil {
+				panic(err)
+			}
+		}
 	}
-	dirtyAccountData = append(dirtyAccountData, l.prevJnlHash.Bytes()...)
-	journalHash := sha256.Sum256(dirtyAccountData)
 
 	blockJournal := &BlockJournal{
 		Journals:    journals,
-		ChangedHash: types.NewHash(journalHash[:]),
+		ChangedHash: stateTrie.Root(),
+		trieNodes:   stateTrie.Nodes(),
 	}
 
+	l.addTrieNodes(blockJournal.trieNodes)
 	l.prevJnlHash = blockJournal.ChangedHash
 	l.Clear()
 	l.accountCache.add(dirtyAccounts)
@@ -202,6 +251,11 @@ func (l *ChainLedger) Commit(height uint64, accounts map[string]*Account, blockJ
 	ldbBatch.Put(compositeKey(journalKey, height), data)
 	ldbBatch.Put(compositeKey(journalKey, maxHeightStr), marshalHeight(height))
 
+	for hash, node := range blockJournal.trieNodes {
+		ldbBatch.Put(composeTrieNodeKey([]byte(hash)), node)
+	}
+	l.keepCommittedTrieNodes(blockJournal.trieNodes)
+
 	l.journalMutex.Lock()
 
 	if l.minJnlHeight == 0 {
@@ -216,6 +270,7 @@ func (l *ChainLedger) Commit(height uint64, accounts map[string]*Account, blockJ
 	l.journalMutex.Unlock()
 
 	l.accountCache.remove(accounts)
+	l.removeTrieNodes(blockJournal.trieNodes)
 
 	return nil
 }
@@ -228,6 +283,44 @@ func (l *ChainLedger) Version() uint64 {
 	return l.maxJnlHeight
 }
 
+// VerifyJournals checks that the journals of all the retained blocks exist and
+// their state roots match the block headers, and that the state trie of the
+// latest block is available
+func (l *ChainLedger) VerifyJournals() error {
+	l.journalMutex.RLock()
+	defer l.journalMutex.RUnlock()
+
+	meta := l.GetChainMeta()
+	if l.maxJnlHeight != meta.Height {
+		return fmt.Errorf("latest journal height %d does not match the chain height %d", l.maxJnlHeight, meta.Height)
+	}
+
+	if l.maxJnlHeight == 0 {
+		return nil
+	}
+
+	for i := l.minJnlHeight; i <= l.maxJnlHeight; i++ {
+		journal := getBlockJournal(i, l.ldb)
+		if journal == nil {
+			return fmt.Errorf("journal of block %d is missing", i)
+		}
+
+		block, err := l.GetBlock(i)
+		if err != nil {
+			return fmt.Errorf("get block %d: %w", i, err)
+		}
+		if journal.ChangedHash.String() != block.BlockHeader.StateRoot.String() {
+			return fmt.Errorf("state root %s of journal %d does not match the block header %s", journal.ChangedHash, i, block.BlockHeader.StateRoot)
+		}
+	}
+
+	if !l.hasTrieRoot(l.prevJnlHash) {
+		return fmt.Errorf("state trie root %s of block %d not found", l.prevJnlHash, l.maxJnlHeight)
+	}
+
+	return nil
+}
+
 func (l *ChainLedger) rollbackState(height uint64) error {
 	l.journalMutex.Lock()
 	defer l.journalMutex.Unlock()
@@ -237,7 +330,7 @@ func (l *ChainLedger) rollbackState(height uint64) error {
 	}
 
 	if l.minJnlHeight > height && !(l.minJnlHeight == 1 && height == 0) {
-		return ErrorRollbackTooMuch
+		return fmt.Errorf("%w: journals before block %d are removed, can not rollback to block %d", ErrorRollbackPruned, l.minJnlHeight, height)
 	}
 
 	if l.maxJnlHeight == height {
@@ -247,6 +340,7 @@ func (l *ChainLedger) rollbackState(height uint64) error {
 	// clean cache account
 	l.Clear()
 	l.accountCache.clear()
+	l.clearTrieNodes()
 
 	for i := l.maxJnlHeight; i > height; i-- {
 		batch := l.ldb.NewBatch()
@@ -267,7 +361,11 @@ func (l *ChainLedger) rollbackState(height uint64) error {
 
 	if height != 0 {
 		journal := getBlockJournal(height, l.ldb)
-		l.prevJnlHash = journal.ChangedHash
+		root, err := l.resolveStateRoot(height, journal.ChangedHash)
+		if err != nil {
+			return fmt.Errorf("resolve state trie root: %w", err)
+		}
+		l.prevJnlHash = root
 	} else {
 		l.prevJnlHash = &types.Hash{}
 		l.minJnlHeight = 0
@@ -0,0 +1,274 @@
+package ledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub/pkg/trie"
+	"github.com/sirupsen/logrus"
+)
+
+// trieNodeReader reads state trie nodes of the ledger. Nodes created by
+// blocks which are executed but not committed yet are kept in memory.
+type trieNodeReader ChainLedger
+
+var _ trie.NodeReader = (*trieNodeReader)(nil)
+
+func (r *trieNodeReader) GetNode(hash []byte) []byte {
+	r.trieMutex.RLock()
+	node, ok := r.trieNodes[string(hash)]
+	r.trieMutex.RUnlock()
+	if ok {
+		return node
+	}
+
+	return r.ldb.Get(composeTrieNodeKey(hash))
+}
+
+func (l *ChainLedger) stateTrie(root *types.Hash) *trie.Trie {
+	return trie.New(root, (*trieNodeReader)(l))
+}
+
+// trieMigrationKey records the state trie built over the state of a ledger
+// created before the state trie, whose journals hold no trie roots
+var trieMigrationKey = compositeKey(journalKey, "trie-migration")
+
+type trieMigration struct {
+	Height uint64      `json:"height"`
+	Root   *types.Hash `json:"root"`
+}
+
+// resolveStateRoot returns the state trie root after the block of the given
+// height whose journal records root, the state in ldb must be the state after
+// that block. If the journal is written by an older version without the state
+// trie, the trie is built once over the current state.
+func (l *ChainLedger) resolveStateRoot(height uint64, root *types.Hash) (*types.Hash, error) {
+	if l.hasTrieRoot(root) {
+		return root, nil
+	}
+
+	if data := l.ldb.Get(trieMigrationKey); data != nil {
+		migration := &trieMigration{}
+		if err := json.Unmarshal(data, migration); err != nil {
+			return nil, fmt.Errorf("unmarshal state trie migration: %w", err)
+		}
+		if migration.Height == height && l.hasTrieRoot(migration.Root) {
+			return migration.Root, nil
+		}
+	}
+
+	return l.buildStateTrie(height)
+}
+
+func (l *ChainLedger) hasTrieRoot(root *types.Hash) bool {
+	return root == nil || *root == (types.Hash{}) || l.ldb.Get(composeTrieNodeKey(root.Bytes())) != nil
+}
+
+// buildStateTrie builds the state trie over all the account and state keys in
+// ldb, only the nodes reachable from the root are written
+func (l *ChainLedger) buildStateTrie(height uint64) (*types.Hash, error) {
+	l.logger.WithField("height", height).Info("Build state trie over the state of the ledger created by an older version")
+
+	stateTrie := trie.New(nil, nodeReaderFunc(func([]byte) []byte { return nil }))
+	it := l.ldb.Iterator(nil, nil)
+	for it.Next() {
+		key := it.Key()
+		if !isStateKey(key) || bytes.HasPrefix(key, []byte(codeKey)) {
+			continue
+		}
+
+		if err := stateTrie.Update(append([]byte{}, key...), append([]byte{}, it.Value()...)); err != nil {
+			return nil, err
+		}
+	}
+
+	batch := l.ldb.NewBatch()
+	nodes := make(map[string][]byte)
+	if err := stateTrie.Walk(func(hash, data []byte) (bool, error) {
+		batch.Put(composeTrieNodeKey(hash), data)
+		nodes[string(hash)] = data
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	l.keepCommittedTrieNodes(nodes)
+
+	root := stateTrie.Root()
+	data, err := json.Marshal(&trieMigration{Height: height, Root: root})
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(trieMigrationKey, data)
+	batch.Commit()
+
+	l.logger.WithFields(logrus.Fields{
+		"height": height,
+		"root":   root,
+	}).Info("State trie is built")
+
+	return root, nil
+}
+
+// PruneStateTrie removes the state trie nodes which are not reachable from
+// the roots of the retained journals and returns the number of them. Blocks
+// can be committed while pruning, the nodes written by them are kept.
+func (l *ChainLedger) PruneStateTrie() (int, error) {
+	l.trieMutex.Lock()
+	if l.trieCommitted != nil {
+		l.trieMutex.Unlock()
+		return 0, fmt.Errorf("state trie is being pruned")
+	}
+	l.trieCommitted = make(map[string]struct{})
+	l.trieMutex.Unlock()
+
+	defer func() {
+		l.trieMutex.Lock()
+		l.trieCommitted = nil
+		l.trieMutex.Unlock()
+	}()
+
+	reachable := make(map[string]struct{})
+	for _, root := range l.retainedTrieRoots() {
+		if err := l.stateTrie(root).Walk(func(hash, _ []byte) (bool, error) {
+			if _, ok := reachable[string(hash)]; ok {
+				return false, nil
+			}
+			reachable[string(hash)] = struct{}{}
+			return true, nil
+		}); err != nil {
+			return 0, fmt.Errorf("walk state trie %s: %w", root, err)
+		}
+	}
+
+	removed := 0
+	var garbage [][]byte
+	it := l.ldb.Prefix([]byte(trieNodeKey))
+	for it.Next() {
+		hash := it.Key()[len(trieNodeKey):]
+		if _, ok := reachable[string(hash)]; ok {
+			continue
+		}
+
+		garbage = append(garbage, append([]byte{}, hash...))
+		if len(garbage) == trieSweepBatchSize {
+			removed += l.removeTrieGarbage(garbage)
+			garbage = nil
+		}
+	}
+	removed += l.removeTrieGarbage(garbage)
+
+	return removed, nil
+}
+
+const trieSweepBatchSize = 1000
+
+// retainedTrieRoots returns the state trie roots of the retained journals
+// and the pending blocks
+func (l *ChainLedger) retainedTrieRoots() []*types.Hash {
+	l.journalMutex.RLock()
+	defer l.journalMutex.RUnlock()
+
+	var migration *trieMigration
+	if data := l.ldb.Get(trieMigrationKey); data != nil {
+		migration = &trieMigration{}
+		if err := json.Unmarshal(data, migration); err != nil {
+			migration = nil
+		}
+	}
+
+	roots := []*types.Hash{l.prevJnlHash}
+	for i := l.minJnlHeight; i <= l.maxJnlHeight && i != 0; i++ {
+		journal := getBlockJournal(i, l.ldb)
+		if journal == nil {
+			continue
+		}
+
+		if l.hasTrieRoot(journal.ChangedHash) {
+			roots = append(roots, journal.ChangedHash)
+		} else if migration != nil && migration.Height == i {
+			roots = append(roots, migration.Root)
+		}
+	}
+
+	return roots
+}
+
+// keepCommittedTrieNodes protects the nodes written to ldb from being removed
+// by the pruning in progress, it is called before the nodes are written
+func (l *ChainLedger) keepCommittedTrieNodes(nodes map[string][]byte) {
+	l.trieMutex.Lock()
+	defer l.trieMutex.Unlock()
+
+	if l.trieCommitted == nil {
+		return
+	}
+	for hash := range nodes {
+		l.trieCommitted[hash] = struct{}{}
+	}
+}
+
+func (l *ChainLedger) removeTrieGarbage(hashes [][]byte) int {
+	l.trieMutex.Lock()
+	defer l.trieMutex.Unlock()
+
+	batch := l.ldb.NewBatch()
+	removed := 0
+	for _, hash := range hashes {
+		if _, ok := l.trieCommitted[string(hash)]; ok {
+			continue
+		}
+		batch.Delete(composeTrieNodeKey(hash))
+		removed++
+	}
+	batch.Commit()
+
+	return removed
+}
+
+func (l *ChainLedger) addTrieNodes(nodes map[string][]byte) {
+	l.trieMutex.Lock()
+	defer l.trieMutex.Unlock()
+
+	for hash, node := range nodes {
+		l.trieNodes[hash] = node
+	}
+}
+
+func (l *ChainLedger) removeTrieNodes(nodes map[string][]byte) {
+	l.trieMutex.Lock()
+	defer l.trieMutex.Unlock()
+
+	for hash := range nodes {
+		delete(l.trieNodes, hash)
+	}
+}
+
+func (l *ChainLedger) clearTrieNodes() {
+	l.trieMutex.Lock()
+	defer l.trieMutex.Unlock()
+
+	l.trieNodes = make(map[string][]byte)
+}
+
+// GetStateProof returns the value of the state key of the account at the given
+// block height with the proof of it against the state root in the block header.
+// A nil key proves the account itself. Height 0 means the latest block.
+func (l *ChainLedger) GetStateProof(addr *types.Address, key []byte, height uint64) (*trie.Proof, error) {
+	if height == 0 {
+		height = l.GetChainMeta().Height
+	}
+
+	block, err := l.GetBlock(height)
+	if err != nil {
+		return nil, fmt.Errorf("get block %d: %w", height, err)
+	}
+
+	trieKey := compositeKey(accountKey, addr)
+	if key != nil {
+		trieKey = composeStateKey(addr, key)
+	}
+
+	return l.stateTrie(block.BlockHeader.StateRoot).Prove(trieKey)
+}
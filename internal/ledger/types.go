@@ -3,6 +3,8 @@ package ledger
 import (
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/pkg/merkle"
+	"github.com/meshplus/bitxhub/pkg/trie"
 )
 
 //go:generate mockgen -destination mock_ledger/mock_ledger.go -package mock_ledger -source types.go
@@ -21,12 +23,33 @@ type Ledger interface {
 	// Events
 	Events(txHash string) []*pb.Event
 
+	// Snapshot returns the id of the current state and events, which can be restored with RevertToSnapshot
+	Snapshot() int
+
+	// RevertToSnapshot discards the state changes and events made after the snapshot
+	RevertToSnapshot(id int)
+
 	// Rollback
 	Rollback(height uint64) error
 
 	// RemoveJournalsBeforeBlock
 	RemoveJournalsBeforeBlock(height uint64) error
 
+	// RemoveTxMetasBeforeBlock removes the transaction meta of the blocks whose number < height
+	RemoveTxMetasBeforeBlock(height uint64) error
+
+	// PruneStateTrie removes the state trie nodes unreachable from the retained journals
+	PruneStateTrie() (int, error)
+
+	// GetStateProof get the state value with its proof against the state root of the block
+	GetStateProof(addr *types.Address, key []byte, height uint64) (*trie.Proof, error)
+
+	// StateAt returns a read only ledger with the state after the block of the given height
+	StateAt(height uint64) (Ledger, error)
+
+	// StateErr returns the error occurred in reading the state of the ledger created by StateAt
+	StateErr() error
+
 	// Close release resource
 	Close()
 }
@@ -82,6 +105,13 @@ type StateAccessor interface {
 	Clear()
 }
 
+// ReceiptProof proves a receipt is committed in the ReceiptRoot of the block header
+type ReceiptProof struct {
+	Receipt     *pb.Receipt     `json:"receipt"`
+	BlockHeader *pb.BlockHeader `json:"block_header"`
+	Path        *merkle.Path    `json:"path"`
+}
+
 // BlockchainLedger handles block, transaction and receipt data.
 type BlockchainLedger interface {
 	// PutBlock put block into store
@@ -105,6 +135,9 @@ type BlockchainLedger interface {
 	// GetReceipt get the transaction receipt
 	GetReceipt(hash *types.Hash) (*pb.Receipt, error)
 
+	// GetReceiptProof get the transaction receipt with its merkle path to the receipt root
+	GetReceiptProof(hash *types.Hash) (*ReceiptProof, error)
+
 	// GetInterchainMeta get interchain meta data
 	GetInterchainMeta(height uint64) (*pb.InterchainMeta, error)
 
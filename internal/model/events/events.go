@@ -11,6 +11,13 @@ type ExecutedEvent struct {
 	TxHashList     []*types.Hash
 }
 
+// NodeEvent is an approved change of the consensus nodes, Operation is either
+// add or remove
+type NodeEvent struct {
+	Operation string
+	VpInfo    *pb.VpInfo
+}
+
 type CheckpointEvent struct {
 	Index  uint64
 	Digest types.Hash
@@ -41,6 +41,7 @@ type Config struct {
 	Txpool   `json:"txpool"`
 	Order    `json:"order"`
 	Executor `json:"executor"`
+	Ledger   `json:"ledger"`
 	Genesis  `json:"genesis"`
 	Security Security `toml:"security" json:"security"`
 }
@@ -104,8 +105,12 @@ type LogModule struct {
 }
 
 type Genesis struct {
-	Admins   []*Admin          `json:"admins" toml:"admins"`
-	Strategy map[string]string `json:"strategy" toml:"strategy"`
+	Admins      []*Admin          `json:"admins" toml:"admins"`
+	Strategy    map[string]string `json:"strategy" toml:"strategy"`
+	Permissions []*Permission     `json:"permissions" toml:"permissions"`
+	// Nodes are the consensus nodes of the genesis, they are recorded by the
+	// node manager contract
+	Nodes []*NetworkNodes `json:"nodes" toml:"nodes"`
 }
 
 type Admin struct {
@@ -113,6 +118,13 @@ type Admin struct {
 	Weight  uint64 `json:"weight" toml:"weight"`
 }
 
+// Permission lists the roles allowed to call the method of a bolt contract
+type Permission struct {
+	Contract string   `json:"contract" toml:"contract"`
+	Method   string   `json:"method" toml:"method"`
+	Roles    []string `json:"roles" toml:"roles"`
+}
+
 type Cert struct {
 	Verify         bool   `toml:"verify" json:"verify"`
 	NodeCertPath   string `mapstructure:"node_cert_path" json:"node_cert_path"`
@@ -133,6 +145,11 @@ type Executor struct {
 	Type string `toml:"type" json:"type"`
 }
 
+type Ledger struct {
+	Mode             string `toml:"mode" json:"mode"`
+	JournalRetention uint64 `mapstructure:"journal_retention" json:"journal_retention"`
+}
+
 func (c *Config) Bytes() ([]byte, error) {
 	ret, err := json.Marshal(c)
 	if err != nil {
@@ -184,6 +201,10 @@ func DefaultConfig() (*Config, error) {
 		Executor: Executor{
 			Type: "serial",
 		},
+		Ledger: Ledger{
+			Mode:             "archive",
+			JournalRetention: 10000,
+		},
 	}, nil
 }
 
@@ -36,8 +36,14 @@ func TestReadConfig(t *testing.T) {
 	_, err = cfg.Bytes()
 	require.Nil(t, err)
 
-	_, err = UnmarshalConfig("../../config")
+	config, err := UnmarshalConfig("../../config")
 	require.Nil(t, err)
+	require.NotEmpty(t, config.Genesis.Permissions)
+	for _, perm := range config.Genesis.Permissions {
+		require.NotEmpty(t, perm.Contract)
+		require.NotEmpty(t, perm.Method)
+		require.NotEmpty(t, perm.Roles)
+	}
 
 	pathRoot, err := PathRoot()
 	require.Nil(t, err)
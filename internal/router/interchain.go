@@ -2,11 +2,15 @@ package router
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync"
 
+	appchain_mgr "github.com/meshplus/bitxhub-core/appchain-mgr"
 	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/constant"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/executor/contracts"
 	"github.com/meshplus/bitxhub/internal/ledger"
 	"github.com/meshplus/bitxhub/internal/repo"
 	"github.com/meshplus/bitxhub/pkg/peermgr"
@@ -28,6 +32,11 @@ type InterchainRouter struct {
 	peerMgr    peermgr.PeerManager
 	quorum     uint64
 
+	// held records the height of the first block held back from the pier of
+	// a frozen or logged out appchain
+	held     map[string]uint64
+	heldLock sync.Mutex
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
@@ -41,6 +50,7 @@ func New(logger logrus.FieldLogger, repo *repo.Repo, ledger ledger.Ledger, peerM
 		peerMgr: peerMgr,
 		quorum:  quorum,
 		repo:    repo,
+		held:    make(map[string]uint64),
 		ctx:     ctx,
 		cancel:  cancel,
 	}, nil
@@ -95,6 +105,16 @@ func (router *InterchainRouter) PutBlockAndMeta(block *pb.Block, meta *pb.Interc
 	router.piers.Range(func(k, value interface{}) bool {
 		key := k.(string)
 		w := value.(chan *pb.InterchainTxWrappers)
+		if router.isHeldBack(key, block.Height()) {
+			router.heldLock.Lock()
+			if _, ok := router.held[key]; !ok {
+				router.held[key] = block.Height()
+			}
+			router.heldLock.Unlock()
+			return true
+		}
+		router.releaseHeld(key, block.Height(), w)
+
 		wrappers := make([]*pb.InterchainTxWrapper, 0)
 		_, ok := ret[key]
 		if ok {
@@ -157,6 +177,12 @@ func (router *InterchainRouter) GetInterchainTxWrappers(pid string, begin, end u
 			return fmt.Errorf("get interchain meta data: %w", err)
 		}
 
+		_, isUnion := router.unionPiers.Load(pid)
+		if !isUnion && router.isHeldBack(pid, i) {
+			// the pier fetches the held wrappers once the appchain is activated
+			return nil
+		}
+
 		ret := router.classify(block, meta)
 		wrappers := make([]*pb.InterchainTxWrapper, 0)
 		if ret[pid] != nil {
@@ -166,8 +192,7 @@ func (router *InterchainRouter) GetInterchainTxWrappers(pid string, begin, end u
 			}
 			continue
 		} else {
-			_, ok := router.unionPiers.Load(pid)
-			if !ok {
+			if !isUnion {
 				// empty interchain tx in this block
 				emptyWrapper := &pb.InterchainTxWrapper{
 					Height:  block.Height(),
@@ -188,6 +213,87 @@ func (router *InterchainRouter) GetInterchainTxWrappers(pid string, begin, end u
 	return nil
 }
 
+// isHeldBack returns whether the wrappers of the block at the height are held
+// back from the pier of the appchain, which is the case if the appchain is
+// frozen or logged out both at that height and now
+func (router *InterchainRouter) isHeldBack(id string, height uint64) bool {
+	if !router.isInterchainDisabled(router.ledger, id) {
+		return false
+	}
+
+	state, err := router.ledger.StateAt(height)
+	if err != nil {
+		router.logger.WithFields(logrus.Fields{
+			"id":     id,
+			"height": height,
+		}).Errorf("Get state at height error: %v", err)
+		return true
+	}
+	disabled := router.isInterchainDisabled(state, id)
+	if err := state.StateErr(); err != nil {
+		router.logger.WithFields(logrus.Fields{
+			"id":     id,
+			"height": height,
+		}).Errorf("Read state at height error: %v", err)
+		return true
+	}
+
+	return disabled
+}
+
+// releaseHeld delivers the wrappers held back from the pier of the appchain
+// before the block at the height
+func (router *InterchainRouter) releaseHeld(id string, height uint64, w chan *pb.InterchainTxWrappers) {
+	router.heldLock.Lock()
+	begin, ok := router.held[id]
+	delete(router.held, id)
+	router.heldLock.Unlock()
+	if !ok {
+		return
+	}
+
+	for i := begin; i < height; i++ {
+		block, err := router.ledger.GetBlock(i)
+		if err != nil {
+			router.logger.Errorf("Get held block %d error: %v", i, err)
+			return
+		}
+		meta, err := router.ledger.GetInterchainMeta(i)
+		if err != nil {
+			router.logger.Errorf("Get held interchain meta %d error: %v", i, err)
+			return
+		}
+
+		wrapper, ok := router.classify(block, meta)[id]
+		if !ok {
+			wrapper = &pb.InterchainTxWrapper{
+				Height:  block.Height(),
+				L2Roots: meta.L2Roots,
+			}
+		}
+		w <- &pb.InterchainTxWrappers{
+			InterchainTxWrappers: []*pb.InterchainTxWrapper{wrapper},
+		}
+	}
+}
+
+// isInterchainDisabled returns whether the appchain is frozen or logged out in
+// the state of the ledger
+func (router *InterchainRouter) isInterchainDisabled(ldg ledger.Ledger, id string) bool {
+	ok, data := ldg.GetState(constant.AppchainMgrContractAddr.Address(), []byte(contracts.AppchainKey(id)))
+	if !ok {
+		return false
+	}
+
+	chain := &appchain_mgr.Appchain{}
+	if err := json.Unmarshal(data, chain); err != nil {
+		router.logger.Errorf("unmarshal appchain error:%v", err)
+		return false
+	}
+
+	return contracts.IsInterchainDisabled(chain.Status)
+}
+
 func (router *InterchainRouter) fetchSigns(height uint64) (map[string][]byte, error) {
 	// TODO(xcc): fetch block sign from other nodes
 	return nil, nil
@@ -51,6 +51,7 @@ func TestInterchainRouter_GetInterchainTxWrappers(t *testing.T) {
 	mockLedger.EXPECT().GetInterchainMeta(uint64(1)).Return(im, nil).AnyTimes()
 	mockLedger.EXPECT().GetInterchainMeta(uint64(2)).Return(im, nil).AnyTimes()
 	mockLedger.EXPECT().GetInterchainMeta(uint64(3)).Return(nil, fmt.Errorf("get interchain meta error")).AnyTimes()
+	mockLedger.EXPECT().GetState(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
 
 	mockPeerMgr := mock_peermgr.NewMockPeerManager(mockCtl)
 
@@ -84,6 +85,62 @@ func TestInterchainRouter_GetInterchainTxWrappers(t *testing.T) {
 	}
 }
 
+func TestInterchainRouter_FrozenAppchain(t *testing.T) {
+	ibtp := mockIBTP(t, 1, pb.IBTP_INTERCHAIN)
+	txs := []*pb.Transaction{mockTx(mockTxData(t, pb.TransactionData_INVOKE, pb.TransactionData_BVM, ibtp))}
+	im := &pb.InterchainMeta{
+		Counter: map[string]*pb.Uint64Slice{to: {Slice: []uint64{0}}},
+	}
+
+	frozen, err := json.Marshal(&appchain_mgr.Appchain{ID: to, Status: appchain_mgr.AppchainFrozen})
+	require.Nil(t, err)
+	available, err := json.Marshal(&appchain_mgr.Appchain{ID: to, Status: appchain_mgr.AppchainAvailable})
+	require.Nil(t, err)
+
+	mockCtl := gomock.NewController(t)
+	mockLedger := mock_ledger.NewMockLedger(mockCtl)
+	frozenState := mock_ledger.NewMockLedger(mockCtl)
+	availableState := mock_ledger.NewMockLedger(mockCtl)
+	frozenState.EXPECT().GetState(gomock.Any(), []byte(appchain_mgr.PREFIX+to)).Return(true, frozen).AnyTimes()
+	frozenState.EXPECT().StateErr().Return(nil).AnyTimes()
+	availableState.EXPECT().GetState(gomock.Any(), []byte(appchain_mgr.PREFIX+to)).Return(true, available).AnyTimes()
+	availableState.EXPECT().StateErr().Return(nil).AnyTimes()
+
+	mockLedger.EXPECT().GetBlock(uint64(1)).Return(mockBlock(1, txs), nil).AnyTimes()
+	mockLedger.EXPECT().GetBlock(uint64(2)).Return(mockBlock(2, nil), nil).AnyTimes()
+	mockLedger.EXPECT().GetInterchainMeta(uint64(1)).Return(im, nil).AnyTimes()
+	mockLedger.EXPECT().GetInterchainMeta(uint64(2)).Return(&pb.InterchainMeta{}, nil).AnyTimes()
+	mockLedger.EXPECT().StateAt(uint64(1)).Return(availableState, nil).AnyTimes()
+	mockLedger.EXPECT().StateAt(uint64(2)).Return(frozenState, nil).AnyTimes()
+	mockLedger.EXPECT().StateAt(uint64(3)).Return(availableState, nil).AnyTimes()
+	mockLedger.EXPECT().QueryByPrefix(gomock.Any(), appchain_mgr.PREFIX).Return(false, nil).AnyTimes()
+	latest := mockLedger.EXPECT().GetState(gomock.Any(), []byte(appchain_mgr.PREFIX+to)).Return(true, frozen).Times(3)
+	mockLedger.EXPECT().GetState(gomock.Any(), []byte(appchain_mgr.PREFIX+to)).Return(true, available).After(latest).AnyTimes()
+
+	router, err := New(log.NewWithModule("router"), nil, mockLedger, mock_peermgr.NewMockPeerManager(mockCtl), 1)
+	require.Nil(t, err)
+
+	// the wrappers of the blocks before the appchain is frozen are delivered
+	ch := make(chan *pb.InterchainTxWrappers, 2)
+	require.Nil(t, router.GetInterchainTxWrappers(to, 1, 2, ch))
+	wrappers := <-ch
+	require.Equal(t, 1, len(wrappers.InterchainTxWrappers[0].Transactions))
+	require.Equal(t, uint64(1), wrappers.InterchainTxWrappers[0].Height)
+	_, ok := <-ch
+	require.False(t, ok)
+
+	// the wrappers are held back until the appchain is activated
+	pierC, err := router.AddPier(to, false)
+	require.Nil(t, err)
+	router.PutBlockAndMeta(mockBlock(2, nil), &pb.InterchainMeta{})
+	require.Equal(t, 0, len(pierC))
+
+	router.PutBlockAndMeta(mockBlock(3, nil), &pb.InterchainMeta{})
+	require.Equal(t, 2, len(pierC))
+	require.Equal(t, uint64(2), (<-pierC).InterchainTxWrappers[0].Height)
+	require.Equal(t, uint64(3), (<-pierC).InterchainTxWrappers[0].Height)
+}
+
 func TestInterchainRouter_GetBlockHeader(t *testing.T) {
 	mockCtl := gomock.NewController(t)
 	mockLedger := mock_ledger.NewMockLedger(mockCtl)
@@ -265,6 +322,7 @@ func testStartRouter(t *testing.T) *InterchainRouter {
 	mockCtl := gomock.NewController(t)
 	mockLedger := mock_ledger.NewMockLedger(mockCtl)
 	mockLedger.EXPECT().QueryByPrefix(constant.AppchainMgrContractAddr.Address(), appchain_mgr.PREFIX).Return(true, ret)
+	mockLedger.EXPECT().GetState(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
 
 	mockPeerMgr := mock_peermgr.NewMockPeerManager(mockCtl)
 
@@ -0,0 +1,75 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/cbergoon/merkletree"
+	"github.com/meshplus/bitxhub-kit/types"
+)
+
+// Path is the path from a leaf to the root of a merkle tree built from
+// hashes with sha256, the way the executor builds block roots. Index tells
+// for every level whether the sibling is on the right (1) or on the left (0)
+// of the current node.
+type Path struct {
+	Hashes [][]byte `json:"hashes"`
+	Index  []int64  `json:"index"`
+}
+
+// Root computes the merkle root of contents, the root of no content is the
+// zero hash
+func Root(contents []merkletree.Content) (*types.Hash, error) {
+	if len(contents) == 0 {
+		return &types.Hash{}, nil
+	}
+
+	tree, err := merkletree.NewTree(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	return types.NewHash(tree.MerkleRoot()), nil
+}
+
+// NewPath returns the path of target in the merkle tree of contents
+func NewPath(contents []merkletree.Content, target merkletree.Content) (*Path, error) {
+	tree, err := merkletree.NewTree(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes, index, err := tree.GetMerklePath(target)
+	if err != nil {
+		return nil, err
+	}
+	if hashes == nil {
+		return nil, fmt.Errorf("content is not in the merkle tree")
+	}
+
+	return &Path{
+		Hashes: hashes,
+		Index:  index,
+	}, nil
+}
+
+// Root computes the merkle root from the leaf along the path
+func (p *Path) Root(leaf []byte) ([]byte, error) {
+	if len(p.Hashes) != len(p.Index) {
+		return nil, fmt.Errorf("invalid merkle path")
+	}
+
+	current := leaf
+	for i, hash := range p.Hashes {
+		var data []byte
+		if p.Index[i] == 1 {
+			data = append(append(data, current...), hash...)
+		} else {
+			data = append(append(data, hash...), current...)
+		}
+		sum := sha256.Sum256(data)
+		current = sum[:]
+	}
+
+	return current, nil
+}
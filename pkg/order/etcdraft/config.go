@@ -15,6 +15,7 @@ type RAFTConfig struct {
 
 type MempoolConfig struct {
 	BatchSize      uint64        `mapstructure:"batch_size"`
+	BlockGasLimit  uint64        `mapstructure:"block_gas_limit"`
 	PoolSize       uint64        `mapstructure:"pool_size"`
 	TxSliceSize    uint64        `mapstructure:"tx_slice_size"`
 	TxSliceTimeout time.Duration `mapstructure:"tx_slice_timeout"`
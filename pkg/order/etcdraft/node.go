@@ -41,6 +41,8 @@ type Node struct {
 
 	proposeC          chan *raftproto.RequestBatch // proposed ready, input channel
 	confChangeC       chan raftpb.ConfChange       // proposed cluster config changes
+	approvedConfC     chan raftpb.ConfChange       // cluster config changes approved by the governance
+	pendingConfs      map[uint64]raftpb.ConfChange // approved config changes not applied yet, keyed by node id
 	commitC           chan *pb.CommitEvent         // the hash commit channel
 	errorC            chan<- error                 // errors from raft session
 	tickTimeout       time.Duration                // tick timeout
@@ -56,6 +58,7 @@ type Node struct {
 	snapshotIndex     uint64               // current snapshot apply index in raft log
 	lastIndex         uint64               // last apply index in raft log
 	lastExec          uint64               // the index of the last-applied block
+	lastReported      uint64               // the index of the last block persisted by the executor
 	readyPool         *sync.Pool           // ready pool, avoiding memory growth fast
 	justElected       bool                 // track new leader status
 	getChainMetaFunc  func() *pb.ChainMeta // current chain meta
@@ -99,6 +102,7 @@ func NewNode(opts ...order.Option) (order.Order, error) {
 		StoragePath: config.StoragePath,
 
 		BatchSize:      raftConfig.RAFT.MempoolConfig.BatchSize,
+		BlockGasLimit:  raftConfig.RAFT.MempoolConfig.BlockGasLimit,
 		PoolSize:       raftConfig.RAFT.MempoolConfig.PoolSize,
 		TxSliceSize:    raftConfig.RAFT.MempoolConfig.TxSliceSize,
 		TxSliceTimeout: raftConfig.RAFT.MempoolConfig.TxSliceTimeout,
@@ -136,7 +140,10 @@ func NewNode(opts ...order.Option) (order.Order, error) {
 	node := &Node{
 		id:               config.ID,
 		lastExec:         config.Applied,
+		lastReported:     config.Applied,
 		confChangeC:      make(chan raftpb.ConfChange),
+		approvedConfC:    make(chan raftpb.ConfChange),
+		pendingConfs:     make(map[uint64]raftpb.ConfChange),
 		commitC:          make(chan *pb.CommitEvent, 1024),
 		errorC:           make(chan<- error),
 		msgC:             make(chan []byte),
@@ -249,9 +256,84 @@ func (n *Node) GetPendingNonceByAccount(account string) uint64 {
 	return n.mempool.GetPendingNonceByAccount(account)
 }
 
+// AddNode sends an add vp request by given id.
+func (n *Node) AddNode(newNodeID uint64) error {
+	return n.proposeConfChange(raftpb.ConfChange{
+		Type:   raftpb.ConfChangeAddNode,
+		NodeID: newNodeID,
+	})
+}
+
 // DelNode sends a delete vp request by given id.
 func (n *Node) DelNode(delID uint64) error {
-	return nil
+	return n.proposeConfChange(raftpb.ConfChange{
+		Type:   raftpb.ConfChangeRemoveNode,
+		NodeID: delID,
+	})
+}
+
+// proposeConfChange hands the conf change approved by the governance to the
+// main loop. Every node applies the same approved change, so every node keeps
+// proposing it until it appears in the conf state, which survives leader
+// changes and proposals dropped by raft. The minimum size of the cluster is
+// enforced by the node manager contract before the change is approved.
+func (n *Node) proposeConfChange(cc raftpb.ConfChange) error {
+	select {
+	case n.approvedConfC <- cc:
+		return nil
+	case <-n.ctx.Done():
+		return n.ctx.Err()
+	}
+}
+
+// addPendingConf records the approved conf change, a later change of the same
+// node replaces it. The change is only proposed if the node is not catching up,
+// since the changes approved in historical blocks may have been reverted.
+func (n *Node) addPendingConf(cc raftpb.ConfChange) {
+	n.pendingConfs[cc.NodeID] = cc
+	if !n.isCatchingUp() {
+		n.tryProposeConf(cc)
+	}
+}
+
+// retryPendingConfs proposes again the approved conf changes which are not
+// applied yet
+func (n *Node) retryPendingConfs() {
+	for id, cc := range n.pendingConfs {
+		if n.isClusterNode(id) == (cc.Type == raftpb.ConfChangeAddNode) {
+			delete(n.pendingConfs, id)
+			continue
+		}
+		if !n.isCatchingUp() {
+			n.tryProposeConf(cc)
+		}
+	}
+}
+
+// isCatchingUp reports whether the executor is still persisting historical
+// blocks, the up-to-date nodes propose the conf changes in the meantime
+func (n *Node) isCatchingUp() bool {
+	return n.lastExec > n.lastReported+maxConfChangeLag
+}
+
+// tryProposeConf proposes the conf change without blocking the main loop, it
+// is retried later if raft is busy
+func (n *Node) tryProposeConf(cc raftpb.ConfChange) {
+	select {
+	case n.confChangeC <- cc:
+	default:
+		n.logger.Debugf("Raft is busy, propose the change of node %d later", cc.NodeID)
+	}
+}
+
+func (n *Node) isClusterNode(id uint64) bool {
+	for _, node := range n.confState.Nodes {
+		if node == id {
+			return true
+		}
+	}
+
+	return false
 }
 
 // main work loop
@@ -265,8 +347,10 @@ func (n *Node) run() {
 	n.appliedIndex = snap.Metadata.Index
 	ticker := time.NewTicker(n.tickTimeout)
 	rebroadcastTicker := time.NewTicker(n.checkInterval)
+	confTicker := time.NewTicker(confChangeRetryInterval)
 	defer ticker.Stop()
 	defer rebroadcastTicker.Stop()
+	defer confTicker.Stop()
 
 	// handle input request
 	go func() {
@@ -330,6 +414,12 @@ func (n *Node) run() {
 		case state := <-n.stateC:
 			n.reportState(state)
 
+		case cc := <-n.approvedConfC:
+			n.addPendingConf(cc)
+
+		case <-confTicker.C:
+			n.retryPendingConfs()
+
 		case <-rebroadcastTicker.C:
 			// check periodically if there are long-pending txs in mempool
 			rebroadcastTxs := n.mempool.GetTimeoutTransactions(n.checkInterval)
@@ -483,14 +573,13 @@ func (n *Node) publishEntries(ents []raftpb.Entry) bool {
 			n.confState = *n.node.ApplyConfChange(cc)
 			switch cc.Type {
 			case raftpb.ConfChangeAddNode:
-				//if len(cc.Context) > 0 {
-				//	_ := types.Bytes2Address(cc.Context)
-				//}
+				n.logger.Infof("Node %d joined the raft cluster", cc.NodeID)
 			case raftpb.ConfChangeRemoveNode:
-				//if cc.NodeID == n.id {
-				//	n.logger.Infoln("I've been removed from the cluster! Shutting down.")
-				//	continue
-				//}
+				if cc.NodeID == n.id {
+					n.logger.Warningln("This node has been removed from the raft cluster, it no longer takes part in the consensus")
+				} else {
+					n.logger.Infof("Node %d left the raft cluster", cc.NodeID)
+				}
 			}
 		}
 
@@ -556,6 +645,7 @@ func (n *Node) maybeTriggerSnapshot() {
 
 func (n *Node) reportState(state *mempool.ChainState) {
 	height := state.Height
+	n.lastReported = height
 	if height%10 == 0 {
 		n.logger.WithFields(logrus.Fields{
 			"height": height,
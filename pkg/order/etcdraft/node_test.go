@@ -244,3 +244,37 @@ func TestRun(t *testing.T) {
 	node.mempool.ProcessTransactions(txs, false, true)
 	time.Sleep(250 * time.Millisecond)
 }
+
+func TestAddPendingConf(t *testing.T) {
+	ast := assert.New(t)
+	defer os.RemoveAll("./testdata/storage")
+	node, err := mockRaftNode(t)
+	ast.Nil(err)
+	node.confChangeC = make(chan raftpb.ConfChange, 10)
+
+	node.confState.Nodes = []uint64{1, 2, 3, 4}
+	node.addPendingConf(raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: 5})
+	ast.Equal(1, len(node.pendingConfs))
+	ast.Equal(1, len(node.confChangeC))
+	<-node.confChangeC
+
+	// the changes approved in historical blocks are not proposed while catching up
+	node.lastExec = node.lastReported + maxConfChangeLag + 1
+	node.addPendingConf(raftpb.ConfChange{Type: raftpb.ConfChangeRemoveNode, NodeID: 5})
+	node.addPendingConf(raftpb.ConfChange{Type: raftpb.ConfChangeRemoveNode, NodeID: 1})
+	ast.Equal(2, len(node.pendingConfs))
+	ast.Equal(0, len(node.confChangeC))
+	node.retryPendingConfs()
+	// node 5 is not in the cluster, the removal replacing its addition is done
+	ast.Equal(1, len(node.pendingConfs))
+	ast.Equal(0, len(node.confChangeC))
+
+	node.lastReported = node.lastExec
+	node.retryPendingConfs()
+	ast.Equal(1, len(node.pendingConfs))
+	ast.Equal(raftpb.ConfChange{Type: raftpb.ConfChangeRemoveNode, NodeID: 1}, <-node.confChangeC)
+
+	node.confState.Nodes = []uint64{2, 3, 4}
+	node.retryPendingConfs()
+	ast.Equal(0, len(node.pendingConfs))
+}
@@ -80,6 +80,8 @@ func mockRaftNode(t *testing.T) (*Node, error) {
 		repoRoot:         repoRoot,
 		logger:           logger,
 		confChangeC:      make(chan raftpb.ConfChange),
+		approvedConfC:    make(chan raftpb.ConfChange),
+		pendingConfs:     make(map[uint64]raftpb.ConfChange),
 		commitC:          make(chan *pb.CommitEvent, 1024),
 		errorC:           make(chan<- error),
 		msgC:             make(chan []byte),
@@ -17,6 +17,13 @@ const (
 	DefaultBatchTick     = 500 * time.Millisecond
 	DefaultSnapshotCount = 1000
 	DefaultCheckInterval = 3 * time.Minute
+
+	// confChangeRetryInterval is the interval to propose again the approved
+	// conf changes which are not applied yet
+	confChangeRetryInterval = 5 * time.Second
+	// maxConfChangeLag is the number of blocks the executor may lag behind the
+	// raft log while the approved conf changes are still proposed
+	maxConfChangeLag = 10
 )
 
 func generateRaftPeers(config *order.Config) ([]raft.Peer, error) {
@@ -14,6 +14,7 @@ import (
 	"github.com/meshplus/bitxhub-kit/storage/leveldb"
 	"github.com/meshplus/bitxhub-model/pb"
 	raftproto "github.com/meshplus/bitxhub/pkg/order/etcdraft/proto"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -21,6 +22,7 @@ import (
 type mempoolImpl struct {
 	localID     uint64
 	batchSize   uint64
+	gasLimit    uint64 // the sum of the gas limits of txs in a batch
 	txSliceSize uint64
 	batchSeqNo  uint64 // track the sequence number of block
 	poolSize    uint64
@@ -45,6 +47,11 @@ func newMempoolImpl(config *Config) (*mempoolImpl, error) {
 	} else {
 		mpi.batchSize = config.BatchSize
 	}
+	if config.BlockGasLimit == 0 {
+		mpi.gasLimit = DefaultBlockGasLimit
+	} else {
+		mpi.gasLimit = config.BlockGasLimit
+	}
 	if config.PoolSize == 0 {
 		mpi.poolSize = DefaultPoolSize
 	} else {
@@ -57,6 +64,7 @@ func newMempoolImpl(config *Config) (*mempoolImpl, error) {
 	}
 	mpi.logger.Infof("MemPool batch size = %d", mpi.batchSize)
 	mpi.logger.Infof("MemPool tx slice size = %d", mpi.batchSize)
+	mpi.logger.Infof("MemPool block gas limit = %d", mpi.gasLimit)
 	mpi.logger.Infof("MemPool batch seqNo = %d", mpi.batchSeqNo)
 	mpi.logger.Infof("MemPool pool size = %d", mpi.poolSize)
 	return mpi, nil
@@ -148,6 +156,22 @@ func (mpi *mempoolImpl) generateBlock() (*raftproto.RequestBatch, error) {
 
 	skippedTxs := make(map[orderedIndexKey]bool)
 	result := make([]orderedIndexKey, 0, mpi.batchSize)
+	batchGas := uint64(0)
+	// fitGas reports whether the gas limit declared by the tx fits in the block
+	// gas limit, the first tx of a batch always fits so that a limit below the
+	// tx gas limit can't stall the pool
+	fitGas := func(key orderedIndexKey) bool {
+		limit, err := gas.TxGasLimit(mpi.txStore.getTxByOrderKey(key.account, key.nonce))
+		if err != nil {
+			// the tx fails without being applied, it is charged the most
+			limit = gas.MaxTxGasLimit
+		}
+		if len(result) != 0 && (batchGas >= mpi.gasLimit || limit > mpi.gasLimit-batchGas) {
+			return false
+		}
+		batchGas += limit
+		return true
+	}
 	mpi.txStore.priorityIndex.data.Ascend(func(a btree.Item) bool {
 		tx := a.(*orderedTimeoutKey)
 		// if tx has existed in bathedTxs, ignore this tx
@@ -164,6 +188,9 @@ func (mpi *mempoolImpl) generateBlock() (*raftproto.RequestBatch, error) {
 		// we've already sent its ancestor to Consensus
 		if seenPrevious || (txSeq == commitNonce) {
 			ptr := orderedIndexKey{account: tx.account, nonce: txSeq}
+			if !fitGas(ptr) {
+				return false
+			}
 			mpi.txStore.batchedTxs[ptr] = true
 			result = append(result, ptr)
 			if uint64(len(result)) == batchSize {
@@ -176,6 +203,9 @@ func (mpi *mempoolImpl) generateBlock() (*raftproto.RequestBatch, error) {
 				if _, ok := skippedTxs[skippedTxn]; !ok {
 					break
 				}
+				if !fitGas(skippedTxn) {
+					return false
+				}
 				mpi.txStore.batchedTxs[skippedTxn] = true
 				result = append(result, skippedTxn)
 				if uint64(len(result)) == batchSize {
@@ -9,6 +9,7 @@ import (
 
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -450,3 +451,58 @@ func TestRestore(t *testing.T) {
 	ast.Equal(uint64(3), newMpi.txStore.nonceCache.getPendingNonce(account1.String()))
 	ast.Equal(uint64(3), newMpi.txStore.nonceCache.getPendingNonce(account2.String()))
 }
+
+func TestGenerateBlockWithGasLimit(t *testing.T) {
+	ast := assert.New(t)
+	storePath, err := ioutil.TempDir("", "mempool")
+	ast.Nil(err)
+	defer os.RemoveAll(storePath)
+	mpi, _ := mockMempoolImpl(storePath)
+	mpi.gasLimit = 2 * gas.DefaultTxGasLimit
+
+	privKey1 := genPrivKey()
+	txList := make([]*pb.Transaction, 0)
+	for i := 1; i <= 4; i++ {
+		txList = append(txList, constructTx(uint64(i), &privKey1))
+	}
+	batch := mpi.ProcessTransactions(txList, true, true)
+	ast.Equal(2, len(batch.TxList))
+	ast.Equal(uint64(1), batch.TxList[0].Nonce)
+	ast.Equal(uint64(2), batch.TxList[1].Nonce)
+	ast.Equal(uint64(2), mpi.txStore.priorityNonBatchSize)
+
+	// a tx above the block gas limit is packed alone
+	mpi.gasLimit = gas.DefaultTxGasLimit / 2
+	batch, err = mpi.generateBlock()
+	ast.Nil(err)
+	ast.Equal(1, len(batch.TxList))
+	ast.Equal(uint64(3), batch.TxList[0].Nonce)
+}
+
+func TestGenerateBlockWithDeclaredGasLimit(t *testing.T) {
+	ast := assert.New(t)
+	storePath, err := ioutil.TempDir("", "mempool")
+	ast.Nil(err)
+	defer os.RemoveAll(storePath)
+	mpi, _ := mockMempoolImpl(storePath)
+	mpi.gasLimit = gas.DefaultTxGasLimit
+
+	privKey1 := genPrivKey()
+	txList := make([]*pb.Transaction, 0)
+	for i := 1; i <= 4; i++ {
+		tx := constructTx(uint64(i), &privKey1)
+		data := &pb.TransactionData{Extra: gas.EncodeTxGasLimit(gas.DefaultTxGasLimit / 3)}
+		tx.Payload, err = data.Marshal()
+		ast.Nil(err)
+		sig, err := privKey1.Sign(tx.SignHash().Bytes())
+		ast.Nil(err)
+		tx.Signature = sig
+		tx.TransactionHash = tx.Hash()
+		txList = append(txList, tx)
+	}
+
+	// the declared limits of the txs are summed up against the block gas limit
+	batch := mpi.ProcessTransactions(txList, true, true)
+	ast.Equal(3, len(batch.TxList))
+	ast.Equal(uint64(1), mpi.txStore.priorityNonBatchSize)
+}
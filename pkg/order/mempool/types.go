@@ -5,6 +5,7 @@ import (
 
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,11 +19,15 @@ const (
 	DefaultBatchSize   = 500
 	DefaultTxSetSize   = 10
 	DefaultTxSetTick   = 100 * time.Millisecond
+
+	// DefaultBlockGasLimit lets a batch of DefaultBatchSize txs with the default gas limit
+	DefaultBlockGasLimit = DefaultBatchSize * gas.DefaultTxGasLimit
 )
 
 type Config struct {
 	ID                 uint64
 	BatchSize          uint64
+	BlockGasLimit      uint64
 	PoolSize           uint64
 	RebroadcastTimeout time.Duration
 	TxSliceSize        uint64
@@ -34,6 +34,9 @@ type Order interface {
 	// GetPendingNonce will return the latest pending nonce of a given account
 	GetPendingNonceByAccount(account string) uint64
 
+	// AddNode sends an add vp request by given id.
+	AddNode(newNodeID uint64) error
+
 	// DelNode sends a delete vp request by given id.
 	DelNode(delID uint64) error
 }
@@ -18,6 +18,7 @@ type SOLO struct {
 
 type MempoolConfig struct {
 	BatchSize      uint64        `mapstructure:"batch_size"`
+	BlockGasLimit  uint64        `mapstructure:"block_gas_limit"`
 	PoolSize       uint64        `mapstructure:"pool_size"`
 	TxSliceSize    uint64        `mapstructure:"tx_slice_size"`
 	TxSliceTimeout time.Duration `mapstructure:"tx_slice_timeout"`
@@ -30,6 +31,7 @@ func generateSoloConfig(repoRoot string) (time.Duration, MempoolConfig, error) {
 	}
 	mempoolConf := MempoolConfig{}
 	mempoolConf.BatchSize = readConfig.SOLO.MempoolConfig.BatchSize
+	mempoolConf.BlockGasLimit = readConfig.SOLO.MempoolConfig.BlockGasLimit
 	mempoolConf.PoolSize = readConfig.SOLO.MempoolConfig.PoolSize
 	mempoolConf.TxSliceSize = readConfig.SOLO.MempoolConfig.TxSliceSize
 	mempoolConf.TxSliceTimeout = readConfig.SOLO.MempoolConfig.TxSliceTimeout
@@ -49,6 +49,10 @@ func (n *Node) GetPendingNonceByAccount(account string) uint64 {
 	return n.mempool.GetPendingNonceByAccount(account)
 }
 
+func (n *Node) AddNode(newNodeID uint64) error {
+	return nil
+}
+
 func (n *Node) DelNode(delID uint64) error {
 	return nil
 }
@@ -104,6 +108,7 @@ func NewNode(opts ...order.Option) (order.Order, error) {
 		StoragePath: config.StoragePath,
 
 		BatchSize:      memConfig.BatchSize,
+		BlockGasLimit:  memConfig.BlockGasLimit,
 		PoolSize:       memConfig.PoolSize,
 		TxSliceSize:    memConfig.TxSliceSize,
 		TxSliceTimeout: memConfig.TxSliceTimeout,
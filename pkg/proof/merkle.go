@@ -0,0 +1,202 @@
+package proof
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/cbergoon/merkletree"
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/bitxhub/internal/ledger"
+	"github.com/meshplus/bitxhub/pkg/merkle"
+)
+
+// TxProof proves a transaction is committed in a block. The transaction
+// hash leads to the L2 root of its group, which leads to the TxRoot of the
+// block header.
+type TxProof struct {
+	TxHash *types.Hash  `json:"tx_hash"`
+	Height uint64       `json:"height"`
+	L2Root *types.Hash  `json:"l2_root"`
+	L2Path *merkle.Path `json:"l2_path"`
+	L1Path *merkle.Path `json:"l1_path"`
+}
+
+// NewTxProof builds the proof of the transaction at the index of the block
+// from the interchain meta of the block, the same way the executor builds
+// the tx root: interchain transactions are grouped by destination and the
+// other transactions form one more group.
+func NewTxProof(block *pb.Block, meta *pb.InterchainMeta, index uint64) (*TxProof, error) {
+	txs := block.Transactions
+	if index >= uint64(len(txs)) {
+		return nil, fmt.Errorf("transaction index %d out of range", index)
+	}
+	txHash := txs[index].TransactionHash
+
+	var group []uint64
+	groups := txGroups(block, meta)
+	for _, g := range groups {
+		for _, i := range g {
+			if i == index {
+				group = g
+				break
+			}
+		}
+		if group != nil {
+			break
+		}
+	}
+
+	contents := make([]merkletree.Content, 0, len(group))
+	for _, i := range group {
+		if i >= uint64(len(txs)) {
+			return nil, fmt.Errorf("transaction index %d out of range", i)
+		}
+		contents = append(contents, txs[i].TransactionHash)
+	}
+
+	l2Path, err := merkle.NewPath(contents, txHash)
+	if err != nil {
+		return nil, fmt.Errorf("build L2 merkle path: %w", err)
+	}
+	l2Root, err := l2Path.Root(txHash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	l2Roots := make([]merkletree.Content, 0, len(meta.L2Roots))
+	for i := range meta.L2Roots {
+		l2Roots = append(l2Roots, &meta.L2Roots[i])
+	}
+
+	l1Path, err := merkle.NewPath(l2Roots, types.NewHash(l2Root))
+	if err != nil {
+		return nil, fmt.Errorf("build L1 merkle path: %w", err)
+	}
+
+	return &TxProof{
+		TxHash: txHash,
+		Height: block.BlockHeader.Number,
+		L2Root: types.NewHash(l2Root),
+		L2Path: l2Path,
+		L1Path: l1Path,
+	}, nil
+}
+
+// txGroups splits the transactions of the block into the groups of interchain
+// transactions to each destination, sorted by destination, and the group of
+// other transactions at last
+func txGroups(block *pb.Block, meta *pb.InterchainMeta) [][]uint64 {
+	dests := make([]string, 0, len(meta.Counter))
+	for dest := range meta.Counter {
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+
+	groups := make([][]uint64, 0, len(dests)+1)
+	interchain := make(map[uint64]bool)
+	for _, dest := range dests {
+		groups = append(groups, meta.Counter[dest].Slice)
+		for _, i := range meta.Counter[dest].Slice {
+			interchain[i] = true
+		}
+	}
+
+	var normal []uint64
+	for i := range block.Transactions {
+		if !interchain[uint64(i)] {
+			normal = append(normal, uint64(i))
+		}
+	}
+
+	return append(groups, normal)
+}
+
+// TxRoot computes the tx root of the block from its interchain meta the same
+// way the executor does
+func TxRoot(block *pb.Block, meta *pb.InterchainMeta) (*types.Hash, error) {
+	txs := block.Transactions
+	groups := txGroups(block, meta)
+	l2Roots := make([]*types.Hash, 0, len(groups))
+	for _, group := range groups {
+		contents := make([]merkletree.Content, 0, len(group))
+		for _, i := range group {
+			if i >= uint64(len(txs)) {
+				return nil, fmt.Errorf("transaction index %d out of range", i)
+			}
+			contents = append(contents, txs[i].TransactionHash)
+		}
+
+		l2Root, err := merkle.Root(contents)
+		if err != nil {
+			return nil, err
+		}
+		l2Roots = append(l2Roots, l2Root)
+	}
+
+	sort.Slice(l2Roots, func(i, j int) bool {
+		return bytes.Compare(l2Roots[i].Bytes(), l2Roots[j].Bytes()) < 0
+	})
+
+	contents := make([]merkletree.Content, 0, len(l2Roots))
+	for _, l2Root := range l2Roots {
+		contents = append(contents, l2Root)
+	}
+
+	return merkle.Root(contents)
+}
+
+// ReceiptRoot computes the receipt root of the receipts of a block
+func ReceiptRoot(receipts []*pb.Receipt) (*types.Hash, error) {
+	contents := make([]merkletree.Content, 0, len(receipts))
+	for _, receipt := range receipts {
+		contents = append(contents, receipt.Hash())
+	}
+
+	return merkle.Root(contents)
+}
+
+// VerifyTxProof checks the transaction proof against the TxRoot of the block
+func VerifyTxProof(proof *TxProof, txRoot *types.Hash) error {
+	if proof == nil || proof.TxHash == nil || proof.L2Root == nil || proof.L2Path == nil || proof.L1Path == nil {
+		return fmt.Errorf("incomplete transaction proof")
+	}
+
+	l2Root, err := proof.L2Path.Root(proof.TxHash.Bytes())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(l2Root, proof.L2Root.Bytes()) {
+		return fmt.Errorf("transaction %s does not lead to L2 root %s", proof.TxHash, proof.L2Root)
+	}
+
+	l1Root, err := proof.L1Path.Root(l2Root)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(l1Root, txRoot.Bytes()) {
+		return fmt.Errorf("L2 root %s does not lead to tx root %s", proof.L2Root, txRoot)
+	}
+
+	return nil
+}
+
+// VerifyReceiptProof checks the receipt proof against the ReceiptRoot of the
+// block header carried in it. The header itself is to be checked against a
+// trusted block hash by the caller.
+func VerifyReceiptProof(proof *ledger.ReceiptProof) error {
+	if proof == nil || proof.Receipt == nil || proof.BlockHeader == nil || proof.Path == nil {
+		return fmt.Errorf("incomplete receipt proof")
+	}
+
+	root, err := proof.Path.Root(proof.Receipt.Hash().Bytes())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, proof.BlockHeader.ReceiptRoot.Bytes()) {
+		return fmt.Errorf("receipt of %s does not lead to receipt root %s", proof.Receipt.TxHash, proof.BlockHeader.ReceiptRoot)
+	}
+
+	return nil
+}
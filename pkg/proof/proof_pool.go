@@ -8,11 +8,8 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/meshplus/bitxhub-kit/crypto"
-
 	appchainMgr "github.com/meshplus/bitxhub-core/appchain-mgr"
 	"github.com/meshplus/bitxhub-core/validator"
-	"github.com/meshplus/bitxhub-kit/crypto/asym"
 	"github.com/meshplus/bitxhub-kit/log"
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/constant"
@@ -67,53 +64,17 @@ func (pl *VerifyPool) CheckProof(tx *pb.Transaction) (bool, error) {
 	return true, nil
 }
 
-type bxhValidators struct {
-	Addresses []string `json:"addresses"`
-}
-
-// verifyMultiSign .
-func verifyMultiSign(app *appchainMgr.Appchain, ibtp *pb.IBTP, proof []byte) (bool, error) {
-	if "" == app.Validators {
-		return false, fmt.Errorf("empty validators in relay chain:%s", app.ID)
-	}
-	var validators bxhValidators
-	if err := json.Unmarshal([]byte(app.Validators), &validators); err != nil {
-		return false, err
-	}
-
-	m := make(map[string]struct{}, 0)
-	for _, validator := range validators.Addresses {
-		m[validator] = struct{}{}
-	}
-
-	var signs pb.SignResponse
-	if err := signs.Unmarshal(ibtp.Proof); err != nil {
-		return false, err
-	}
-
-	threshold := (len(validators.Addresses) - 1) / 3 // TODO be dynamic
-	counter := 0
-
-	ibtpHash := ibtp.Hash()
-	hash := sha256.Sum256([]byte(ibtpHash.String()))
-	for v, sign := range signs.Sign {
-		if _, ok := m[v]; !ok {
-			return false, fmt.Errorf("wrong validator: %s", v)
-		}
-		delete(m, v)
-		addr := types.NewAddressByStr(v)
-		ok, _ := asym.Verify(crypto.Secp256k1, sign, hash[:], *addr)
-		if ok {
-			counter++
-		}
-		if counter > threshold {
-			return true, nil
+func (pl *VerifyPool) verifyProof(ibtp *pb.IBTP, proof []byte) (bool, error) {
+	// union ibtp carries the signs of the validators of the source relay chain
+	// in its proof, which are verified the same way as the interchain contract
+	if strs := strings.Split(ibtp.From, "-"); len(strs) == 2 {
+		app, err := pl.getAppchain(strs[0])
+		if err != nil {
+			return false, err
 		}
+		return contracts.VerifyMultiSign(app, ibtp, ibtp.Proof)
 	}
-	return false, fmt.Errorf("multi signs verify fail, counter: %d", counter)
-}
 
-func (pl *VerifyPool) verifyProof(ibtp *pb.IBTP, proof []byte) (bool, error) {
 	if proof == nil {
 		return false, fmt.Errorf("empty proof")
 	}
@@ -122,39 +83,26 @@ func (pl *VerifyPool) verifyProof(ibtp *pb.IBTP, proof []byte) (bool, error) {
 		return false, fmt.Errorf("proof hash is not correct")
 	}
 
-	// get real appchain id for union ibtp
 	from := ibtp.From
-	if len(strings.Split(ibtp.From, "-")) == 2 {
-		from = strings.Split(ibtp.From, "-")[1]
-		return true, nil
-	}
-
-	app := &appchainMgr.Appchain{}
-	ok, data := pl.getAccountState(constant.AppchainMgrContractAddr, contracts.AppchainKey(from)) // ibtp.From
-	if !ok {
-		return false, fmt.Errorf("cannot get registered appchain")
-	}
-	err := json.Unmarshal(data, app)
+	app, err := pl.getAppchain(from)
 	if err != nil {
-		return false, fmt.Errorf("unmarshal appchain data fail: %w", err)
-	}
-
-	if len(strings.Split(ibtp.From, "-")) == 2 {
-		return verifyMultiSign(app, ibtp, proof)
+		return false, err
 	}
 
-	validateAddr := validator.FabricRuleAddr
-	rl := &contracts.Rule{}
-	ok, data = pl.getAccountState(constant.RuleManagerContractAddr, contracts.RuleKey(from))
+	var rules []*contracts.Rule
+	ok, data := pl.getAccountState(constant.RuleManagerContractAddr, contracts.RuleKey(from))
 	if ok {
-		if err := json.Unmarshal(data, rl); err != nil {
+		rules, err = contracts.UnmarshalRules(data)
+		if err != nil {
 			return false, fmt.Errorf("unmarshal rule data error: %w", err)
 		}
+	}
+
+	validateAddr := validator.FabricRuleAddr
+	if rl := contracts.BoundRule(rules); rl != nil {
 		validateAddr = rl.Address
-	} else {
-		if app.ChainType != appchainMgr.FabricType {
-			return false, fmt.Errorf("appchain didn't register rule")
-		}
+	} else if len(rules) != 0 || app.ChainType != appchainMgr.FabricType {
+		return false, fmt.Errorf("appchain didn't bind rule")
 	}
 
 	ok, err = pl.ve.Validate(validateAddr, from, proof, ibtp.Payload, app.Validators) // ibtp.From
@@ -164,6 +112,19 @@ func (pl *VerifyPool) verifyProof(ibtp *pb.IBTP, proof []byte) (bool, error) {
 	return ok, nil
 }
 
+func (pl *VerifyPool) getAppchain(id string) (*appchainMgr.Appchain, error) {
+	app := &appchainMgr.Appchain{}
+	ok, data := pl.getAccountState(constant.AppchainMgrContractAddr, contracts.AppchainKey(id))
+	if !ok {
+		return nil, fmt.Errorf("cannot get registered appchain")
+	}
+	if err := json.Unmarshal(data, app); err != nil {
+		return nil, fmt.Errorf("unmarshal appchain data fail: %w", err)
+	}
+
+	return app, nil
+}
+
 func (pl *VerifyPool) getAccountState(address constant.BoltContractAddress, key string) (bool, []byte) {
 	return pl.ledger.GetState(address.Address(), []byte(key))
 }
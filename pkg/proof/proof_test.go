@@ -8,6 +8,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	appchainMgr "github.com/meshplus/bitxhub-core/appchain-mgr"
+	"github.com/meshplus/bitxhub-core/validator"
 	"github.com/meshplus/bitxhub-core/validator/mock_validator"
 	"github.com/meshplus/bitxhub-kit/crypto"
 	"github.com/meshplus/bitxhub-kit/crypto/asym"
@@ -45,15 +46,21 @@ func TestVerifyPool_CheckProof(t *testing.T) {
 	chainData, err := json.Marshal(chain)
 	require.Nil(t, err)
 
-	rl := &contracts.Rule{
-		Address: contract,
+	rules := []*contracts.Rule{
+		{Address: from, Status: contracts.RuleUnbound},
+		{Address: contract, Status: contracts.RuleBound},
 	}
-	rlData, err := json.Marshal(rl)
+	rlData, err := json.Marshal(rules)
+	require.Nil(t, err)
+	unboundData, err := json.Marshal(rules[:1])
 	require.Nil(t, err)
 
-	mockLedger.EXPECT().GetState(constant.AppchainMgrContractAddr.Address(), gomock.Any()).Return(true, chainData)
-	mockLedger.EXPECT().GetState(constant.RuleManagerContractAddr.Address(), gomock.Any()).Return(false, rlData)
-	mockEngine.EXPECT().Validate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
+	// addresses are not compared as their cached string may differ
+	mockLedger.EXPECT().GetState(gomock.Any(), []byte(contracts.AppchainKey(from))).Return(true, chainData).AnyTimes()
+	boundC := mockLedger.EXPECT().GetState(gomock.Any(), []byte(contracts.RuleKey(from))).Return(true, rlData)
+	unboundC := mockLedger.EXPECT().GetState(gomock.Any(), []byte(contracts.RuleKey(from))).Return(true, unboundData)
+	gomock.InOrder(boundC, unboundC)
+	mockEngine.EXPECT().Validate(contract, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
 
 	vp := New(mockLedger, log.NewWithModule("test_verify"))
 	vp = &VerifyPool{
@@ -112,6 +119,11 @@ func TestVerifyPool_CheckProof(t *testing.T) {
 	require.Nil(t, err)
 	require.True(t, ok)
 
+	// only the bound rule verifies the proof
+	ok, err = vp.CheckProof(txWithIBTP)
+	require.NotNil(t, err)
+	require.False(t, ok)
+
 	proofData, ok := vp.GetProof(*txWithIBTP.Hash())
 	require.Nil(t, proofData)
 	require.False(t, ok)
@@ -120,17 +132,64 @@ func TestVerifyPool_CheckProof(t *testing.T) {
 
 }
 
+func TestVerifyPool_CheckProofLegacyRule(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	mockLedger := mock_ledger.NewMockLedger(mockCtl)
+	mockEngine := mock_validator.NewMockEngine(mockCtl)
+
+	chainData, err := json.Marshal(&appchainMgr.Appchain{ID: from, ChainType: appchainMgr.FabricType})
+	require.Nil(t, err)
+	legacyData, err := json.Marshal(map[string]interface{}{"address": contract, "status": 0})
+	require.Nil(t, err)
+
+	mockLedger.EXPECT().GetState(gomock.Any(), []byte(contracts.AppchainKey(from))).Return(true, chainData).AnyTimes()
+	legacyC := mockLedger.EXPECT().GetState(gomock.Any(), []byte(contracts.RuleKey(from))).Return(true, legacyData)
+	noneC := mockLedger.EXPECT().GetState(gomock.Any(), []byte(contracts.RuleKey(from))).Return(false, nil)
+	gomock.InOrder(legacyC, noneC)
+	legacyV := mockEngine.EXPECT().Validate(contract, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil)
+	fabricV := mockEngine.EXPECT().Validate(validator.FabricRuleAddr, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil)
+	gomock.InOrder(legacyV, fabricV)
+
+	vp := &VerifyPool{
+		ledger: mockLedger,
+		ve:     mockEngine,
+		logger: log.NewWithModule("test_verify"),
+	}
+
+	proof := []byte("test_proof")
+	proofHash := sha256.Sum256(proof)
+	tx := &pb.Transaction{
+		From:  types.NewAddressByStr(from),
+		To:    types.NewAddressByStr(to),
+		IBTP:  getIBTP(t, 1, pb.IBTP_RECEIPT_SUCCESS, proofHash[:]),
+		Extra: proof,
+	}
+	tx.TransactionHash = tx.Hash()
+
+	// the rule stored in the legacy format is used as the bound rule
+	ok, err := vp.CheckProof(tx)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	// fabric appchains registering no rule use the default fabric rule
+	ok, err = vp.CheckProof(tx)
+	require.Nil(t, err)
+	require.True(t, ok)
+}
+
 func TestVerifyPool_CheckProof2(t *testing.T) {
 	mockCtl := gomock.NewController(t)
+	mockLedger := mock_ledger.NewMockLedger(mockCtl)
 	mockEngine := mock_validator.NewMockEngine(mockCtl)
 
+	relayChainID := "relay"
 	chain := &appchainMgr.Appchain{
 		Status:        appchainMgr.AppchainAvailable,
-		ID:            from,
-		Name:          "appchain" + from,
+		ID:            relayChainID,
+		Name:          "appchain" + relayChainID,
 		Validators:    "",
 		ConsensusType: int32(1),
-		ChainType:     "fabric",
+		ChainType:     appchainMgr.RelaychainType,
 		Desc:          "",
 		Version:       "",
 		PublicKey:     "pubkey",
@@ -152,13 +211,40 @@ func TestVerifyPool_CheckProof2(t *testing.T) {
 	addrsData, err := json.Marshal(bv)
 	require.Nil(t, err)
 
-	mockEngine.EXPECT().Validate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
+	chainData, err := json.Marshal(chain)
+	require.Nil(t, err)
+	chain.Validators = string(addrsData)
+	validChainData, err := json.Marshal(chain)
+	require.Nil(t, err)
+	for _, v := range bv.Addresses {
+		bv.Validators = append(bv.Validators, &contracts.RelayValidator{Address: v, Weight: 1})
+	}
+	bv.Addresses = nil
+	bv.Policy = contracts.BftTwoFPlusOne
+	bftData, err := json.Marshal(bv)
+	require.Nil(t, err)
+	chain.Validators = string(bftData)
+	bftChainData, err := json.Marshal(chain)
+	require.Nil(t, err)
+
+	relayKey := []byte(contracts.AppchainKey(relayChainID))
+	emptyC := mockLedger.EXPECT().GetState(constant.AppchainMgrContractAddr.Address(), relayKey).Return(true, chainData)
+	validC := mockLedger.EXPECT().GetState(constant.AppchainMgrContractAddr.Address(), relayKey).Return(true, validChainData)
+	bftC := mockLedger.EXPECT().GetState(constant.AppchainMgrContractAddr.Address(), relayKey).Return(true, bftChainData).AnyTimes()
+	gomock.InOrder(emptyC, validC, bftC)
+
+	vp := VerifyPool{
+		ledger: mockLedger,
+		ve:     mockEngine,
+		logger: log.NewWithModule("test_verify"),
+	}
 
 	ibtp := getIBTP(t, 1, pb.IBTP_RECEIPT_SUCCESS, nil)
+	ibtp.From = relayChainID + "-" + from
 	ibtpHash := ibtp.Hash()
 	hash := sha256.Sum256([]byte(ibtpHash.String()))
 	sign := &pb.SignResponse{Sign: make(map[string][]byte)}
-	for _, key := range keys {
+	for _, key := range keys[:2] {
 		signData, err := key.Sign(hash[:])
 		require.Nil(t, err)
 
@@ -173,14 +259,26 @@ func TestVerifyPool_CheckProof2(t *testing.T) {
 	require.Nil(t, err)
 	ibtp.Proof = signData
 
-	ok, err := verifyMultiSign(chain, ibtp, nil)
+	tx := &pb.Transaction{
+		From: types.NewAddressByStr(from),
+		To:   types.NewAddressByStr(to),
+		IBTP: ibtp,
+	}
+	tx.TransactionHash = tx.Hash()
+
+	// union ibtp is verified by the signs in its proof without the tx proof
+	ok, err := vp.CheckProof(tx)
 	require.NotNil(t, err)
 	require.False(t, ok)
 
-	chain.Validators = string(addrsData)
-	ok, err = verifyMultiSign(chain, ibtp, nil)
+	ok, err = vp.CheckProof(tx)
 	require.Nil(t, err)
 	require.True(t, ok)
+
+	// the signs of 2 validators are not enough for the policy 2f+1
+	ok, err = vp.CheckProof(tx)
+	require.NotNil(t, err)
+	require.False(t, ok)
 }
 
 func TestVerifyPool_CheckProof3(t *testing.T) {
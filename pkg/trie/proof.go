@@ -0,0 +1,72 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/meshplus/bitxhub-kit/types"
+)
+
+// Proof proves that a key is or is not in the trie with a given root.
+// Siblings are ordered from the root down to the node the key ends at,
+// which is its own leaf, an empty subtree, or the leaf of another key
+// sharing the same path.
+type Proof struct {
+	Key           []byte   `json:"key"`
+	Exists        bool     `json:"exists"`
+	Value         []byte   `json:"value,omitempty"`
+	Siblings      [][]byte `json:"siblings"`
+	LeafKeyHash   []byte   `json:"leaf_key_hash,omitempty"`
+	LeafValueHash []byte   `json:"leaf_value_hash,omitempty"`
+}
+
+// Verify checks the proof against the trie root
+func (p *Proof) Verify(root *types.Hash) error {
+	if len(p.Siblings) > hashLength*8 {
+		return fmt.Errorf("proof is too long: %d", len(p.Siblings))
+	}
+
+	for _, sibling := range p.Siblings {
+		if len(sibling) != hashLength {
+			return fmt.Errorf("invalid sibling length: %d", len(sibling))
+		}
+	}
+
+	keyHash := hashKey(p.Key)
+	depth := len(p.Siblings)
+
+	var current []byte
+	switch {
+	case p.Exists:
+		current = leafHash(keyHash, hash(p.Value))
+	case p.LeafKeyHash != nil:
+		if len(p.LeafKeyHash) != hashLength || len(p.LeafValueHash) != hashLength {
+			return fmt.Errorf("invalid leaf in proof")
+		}
+		if bytes.Equal(p.LeafKeyHash, keyHash) {
+			return fmt.Errorf("proof leaf holds the proved key")
+		}
+		for i := 0; i < depth; i++ {
+			if bit(p.LeafKeyHash, i) != bit(keyHash, i) {
+				return fmt.Errorf("proof leaf is not on the path of the key")
+			}
+		}
+		current = leafHash(p.LeafKeyHash, p.LeafValueHash)
+	default:
+		current = emptyHash
+	}
+
+	for i := depth - 1; i >= 0; i-- {
+		if bit(keyHash, i) == 0 {
+			current = internalHash(current, p.Siblings[i])
+		} else {
+			current = internalHash(p.Siblings[i], current)
+		}
+	}
+
+	if !bytes.Equal(current, root.Bytes()) {
+		return fmt.Errorf("proof does not match root %s", root.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,396 @@
+package trie
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/meshplus/bitxhub-kit/types"
+)
+
+// Trie is a sparse merkle tree over sha256(key). A subtree holding a single
+// entry is replaced by its leaf, so the depth of the tree only grows with the
+// length of the common prefixes of the hashed keys.
+//
+// Nodes are addressed by their hashes and never modified, so every root
+// ever computed stays readable as long as its nodes are stored.
+type Trie struct {
+	root  []byte
+	db    NodeReader
+	nodes map[string][]byte
+}
+
+// NodeReader loads a trie node by its hash, returning nil if not found
+type NodeReader interface {
+	GetNode(hash []byte) []byte
+}
+
+const (
+	leafPrefix     = byte(0)
+	internalPrefix = byte(1)
+
+	hashLength = sha256.Size
+)
+
+var emptyHash = make([]byte, hashLength)
+
+type node struct {
+	leaf bool
+
+	// leaf fields
+	keyHash []byte
+	value   []byte
+
+	// internal fields
+	left  []byte
+	right []byte
+}
+
+// New creates a trie with the given root, an empty root is the empty trie
+func New(root *types.Hash, db NodeReader) *Trie {
+	r := emptyHash
+	if root != nil {
+		r = root.Bytes()
+	}
+
+	return &Trie{
+		root:  r,
+		db:    db,
+		nodes: make(map[string][]byte),
+	}
+}
+
+// Root returns the current root hash of the trie
+func (t *Trie) Root() *types.Hash {
+	return types.NewHash(t.root)
+}
+
+// Nodes returns the nodes created since the trie was loaded, keyed by hash
+func (t *Trie) Nodes() map[string][]byte {
+	return t.nodes
+}
+
+// Get returns the value stored under key, or nil if not found
+func (t *Trie) Get(key []byte) ([]byte, error) {
+	keyHash := hashKey(key)
+	current := t.root
+	for depth := 0; ; depth++ {
+		if isEmpty(current) {
+			return nil, nil
+		}
+
+		n, err := t.load(current)
+		if err != nil {
+			return nil, err
+		}
+
+		if n.leaf {
+			if bytes.Equal(n.keyHash, keyHash) {
+				return n.value, nil
+			}
+			return nil, nil
+		}
+
+		if bit(keyHash, depth) == 0 {
+			current = n.left
+		} else {
+			current = n.right
+		}
+	}
+}
+
+// Update sets the value of key, a nil value removes the key from the trie
+func (t *Trie) Update(key, value []byte) error {
+	var (
+		root []byte
+		err  error
+	)
+
+	keyHash := hashKey(key)
+	if value == nil {
+		root, err = t.delete(t.root, 0, keyHash)
+	} else {
+		root, err = t.insert(t.root, 0, keyHash, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	t.root = root
+
+	return nil
+}
+
+func (t *Trie) insert(current []byte, depth int, keyHash, value []byte) ([]byte, error) {
+	if isEmpty(current) {
+		return t.putLeaf(keyHash, value), nil
+	}
+
+	n, err := t.load(current)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.leaf {
+		if bytes.Equal(n.keyHash, keyHash) {
+			return t.putLeaf(keyHash, value), nil
+		}
+
+		return t.split(depth, current, n.keyHash, t.putLeaf(keyHash, value), keyHash), nil
+	}
+
+	left, right := n.left, n.right
+	if bit(keyHash, depth) == 0 {
+		left, err = t.insert(left, depth+1, keyHash, value)
+	} else {
+		right, err = t.insert(right, depth+1, keyHash, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return t.putInternal(left, right), nil
+}
+
+// split creates the internal nodes above two leaves down to the first bit
+// their key hashes differ at
+func (t *Trie) split(depth int, oldLeaf, oldKeyHash, newLeaf, newKeyHash []byte) []byte {
+	oldBit, newBit := bit(oldKeyHash, depth), bit(newKeyHash, depth)
+	if oldBit != newBit {
+		if newBit == 0 {
+			return t.putInternal(newLeaf, oldLeaf)
+		}
+		return t.putInternal(oldLeaf, newLeaf)
+	}
+
+	child := t.split(depth+1, oldLeaf, oldKeyHash, newLeaf, newKeyHash)
+	if newBit == 0 {
+		return t.putInternal(child, emptyHash)
+	}
+
+	return t.putInternal(emptyHash, child)
+}
+
+func (t *Trie) delete(current []byte, depth int, keyHash []byte) ([]byte, error) {
+	if isEmpty(current) {
+		return current, nil
+	}
+
+	n, err := t.load(current)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.leaf {
+		if bytes.Equal(n.keyHash, keyHash) {
+			return emptyHash, nil
+		}
+		return current, nil
+	}
+
+	child, sibling := n.left, n.right
+	if bit(keyHash, depth) == 1 {
+		child, sibling = n.right, n.left
+	}
+
+	newChild, err := t.delete(child, depth+1, keyHash)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(newChild, child) {
+		return current, nil
+	}
+
+	// a single leaf left in the subtree moves up to take its place
+	if isEmpty(newChild) && isEmpty(sibling) {
+		return emptyHash, nil
+	} else if isEmpty(newChild) {
+		sn, err := t.load(sibling)
+		if err != nil {
+			return nil, err
+		}
+		if sn.leaf {
+			return sibling, nil
+		}
+	} else if isEmpty(sibling) {
+		cn, err := t.load(newChild)
+		if err != nil {
+			return nil, err
+		}
+		if cn.leaf {
+			return newChild, nil
+		}
+	}
+
+	if bit(keyHash, depth) == 0 {
+		return t.putInternal(newChild, sibling), nil
+	}
+
+	return t.putInternal(sibling, newChild), nil
+}
+
+// Prove returns the proof of the inclusion or exclusion of key
+func (t *Trie) Prove(key []byte) (*Proof, error) {
+	proof := &Proof{Key: key}
+	keyHash := hashKey(key)
+	current := t.root
+
+	for depth := 0; ; depth++ {
+		if isEmpty(current) {
+			return proof, nil
+		}
+
+		n, err := t.load(current)
+		if err != nil {
+			return nil, err
+		}
+
+		if n.leaf {
+			if bytes.Equal(n.keyHash, keyHash) {
+				proof.Exists = true
+				proof.Value = n.value
+			} else {
+				proof.LeafKeyHash = n.keyHash
+				proof.LeafValueHash = hash(n.value)
+			}
+			return proof, nil
+		}
+
+		if bit(keyHash, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, n.right)
+			current = n.left
+		} else {
+			proof.Siblings = append(proof.Siblings, n.left)
+			current = n.right
+		}
+	}
+}
+
+// Walk calls fn with the hash and the data of every node reachable from the
+// root, parents before their children. The children of a node are skipped
+// if fn returns false for it.
+func (t *Trie) Walk(fn func(hash, data []byte) (bool, error)) error {
+	return t.walk(t.root, fn)
+}
+
+func (t *Trie) walk(current []byte, fn func(hash, data []byte) (bool, error)) error {
+	if isEmpty(current) {
+		return nil
+	}
+
+	data, err := t.loadData(current)
+	if err != nil {
+		return err
+	}
+
+	descend, err := fn(current, data)
+	if err != nil || !descend {
+		return err
+	}
+
+	n, err := decodeNode(data)
+	if err != nil {
+		return err
+	}
+	if n.leaf {
+		return nil
+	}
+
+	if err := t.walk(n.left, fn); err != nil {
+		return err
+	}
+
+	return t.walk(n.right, fn)
+}
+
+func (t *Trie) load(h []byte) (*node, error) {
+	data, err := t.loadData(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeNode(data)
+}
+
+func (t *Trie) loadData(h []byte) ([]byte, error) {
+	data, ok := t.nodes[string(h)]
+	if !ok {
+		data = t.db.GetNode(h)
+	}
+	if data == nil {
+		return nil, fmt.Errorf("trie node %x not found", h)
+	}
+
+	return data, nil
+}
+
+func (t *Trie) putLeaf(keyHash, value []byte) []byte {
+	data := make([]byte, 0, 1+hashLength+len(value))
+	data = append(data, leafPrefix)
+	data = append(data, keyHash...)
+	data = append(data, value...)
+
+	h := leafHash(keyHash, hash(value))
+	t.nodes[string(h)] = data
+
+	return h
+}
+
+func (t *Trie) putInternal(left, right []byte) []byte {
+	data := make([]byte, 0, 1+2*hashLength)
+	data = append(data, internalPrefix)
+	data = append(data, left...)
+	data = append(data, right...)
+
+	h := internalHash(left, right)
+	t.nodes[string(h)] = data
+
+	return h
+}
+
+func decodeNode(data []byte) (*node, error) {
+	switch {
+	case len(data) >= 1+hashLength && data[0] == leafPrefix:
+		return &node{
+			leaf:    true,
+			keyHash: data[1 : 1+hashLength],
+			value:   data[1+hashLength:],
+		}, nil
+	case len(data) == 1+2*hashLength && data[0] == internalPrefix:
+		return &node{
+			left:  data[1 : 1+hashLength],
+			right: data[1+hashLength:],
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid trie node")
+	}
+}
+
+func hash(data ...[]byte) []byte {
+	h := sha256.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+
+	return h.Sum(nil)
+}
+
+func hashKey(key []byte) []byte {
+	return hash(key)
+}
+
+func leafHash(keyHash, valueHash []byte) []byte {
+	return hash([]byte{leafPrefix}, keyHash, valueHash)
+}
+
+func internalHash(left, right []byte) []byte {
+	return hash([]byte{internalPrefix}, left, right)
+}
+
+func isEmpty(h []byte) bool {
+	return bytes.Equal(h, emptyHash)
+}
+
+func bit(keyHash []byte, i int) byte {
+	return (keyHash[i/8] >> (7 - uint(i%8))) & 1
+}
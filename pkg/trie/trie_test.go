@@ -0,0 +1,165 @@
+package trie
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/stretchr/testify/require"
+)
+
+type memDB map[string][]byte
+
+func (db memDB) GetNode(hash []byte) []byte {
+	return db[string(hash)]
+}
+
+func (db memDB) commit(t *Trie) {
+	for h, data := range t.Nodes() {
+		db[h] = data
+	}
+}
+
+func TestTrie_Update(t *testing.T) {
+	db := memDB{}
+	tr := New(nil, db)
+	require.Equal(t, &types.Hash{}, tr.Root())
+
+	entries := make(map[string][]byte)
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		value := []byte(fmt.Sprintf("value-%d", i))
+		entries[string(key)] = value
+		require.Nil(t, tr.Update(key, value))
+	}
+	db.commit(tr)
+
+	for key, value := range entries {
+		ret, err := tr.Get([]byte(key))
+		require.Nil(t, err)
+		require.Equal(t, value, ret)
+	}
+
+	ret, err := tr.Get([]byte("not-exist"))
+	require.Nil(t, err)
+	require.Nil(t, ret)
+
+	// the root does not depend on the order of updates
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	rand.Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+	other := New(nil, memDB{})
+	for _, key := range keys {
+		require.Nil(t, other.Update([]byte(key), entries[key]))
+	}
+	require.Equal(t, tr.Root(), other.Root())
+
+	// removing entries gives the root of the trie never holding them
+	reloaded := New(tr.Root(), db)
+	for i := 0; i < 100; i++ {
+		require.Nil(t, reloaded.Update([]byte(fmt.Sprintf("key-%d", i)), nil))
+	}
+	expected := New(nil, memDB{})
+	for i := 100; i < 200; i++ {
+		require.Nil(t, expected.Update([]byte(fmt.Sprintf("key-%d", i)), entries[fmt.Sprintf("key-%d", i)]))
+	}
+	require.Equal(t, expected.Root(), reloaded.Root())
+
+	for i := 100; i < 200; i++ {
+		require.Nil(t, reloaded.Update([]byte(fmt.Sprintf("key-%d", i)), nil))
+	}
+	require.Equal(t, &types.Hash{}, reloaded.Root())
+
+	// the old root is still readable
+	old := New(tr.Root(), db)
+	ret, err = old.Get([]byte("key-1"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("value-1"), ret)
+
+	_, err = New(types.NewHash([]byte("missing")), db).Get([]byte("key-1"))
+	require.NotNil(t, err)
+}
+
+func TestTrie_Prove(t *testing.T) {
+	db := memDB{}
+	tr := New(nil, db)
+
+	proof, err := tr.Prove([]byte("key"))
+	require.Nil(t, err)
+	require.Nil(t, proof.Verify(tr.Root()))
+
+	for i := 0; i < 100; i++ {
+		require.Nil(t, tr.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	db.commit(tr)
+	root := tr.Root()
+
+	for i := 0; i < 100; i++ {
+		proof, err := tr.Prove([]byte(fmt.Sprintf("key-%d", i)))
+		require.Nil(t, err)
+		require.True(t, proof.Exists)
+		require.Equal(t, []byte(fmt.Sprintf("value-%d", i)), proof.Value)
+		require.Nil(t, proof.Verify(root))
+	}
+
+	for i := 100; i < 200; i++ {
+		proof, err := tr.Prove([]byte(fmt.Sprintf("key-%d", i)))
+		require.Nil(t, err)
+		require.False(t, proof.Exists)
+		require.Nil(t, proof.Verify(root))
+	}
+
+	proof, err = tr.Prove([]byte("key-1"))
+	require.Nil(t, err)
+
+	proof.Value = []byte("fake")
+	require.NotNil(t, proof.Verify(root))
+
+	proof.Exists = false
+	proof.Value = nil
+	require.NotNil(t, proof.Verify(root))
+
+	proof, err = tr.Prove([]byte("key-1"))
+	require.Nil(t, err)
+	proof.Siblings[0] = make([]byte, hashLength)
+	require.NotNil(t, proof.Verify(root))
+}
+
+func TestTrie_Walk(t *testing.T) {
+	db := memDB{}
+	tr := New(nil, db)
+	for i := 0; i < 100; i++ {
+		require.Nil(t, tr.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+
+	// only the nodes of the latest root are reachable
+	reachable := memDB{}
+	require.Nil(t, tr.Walk(func(hash, data []byte) (bool, error) {
+		reachable[string(hash)] = data
+		return true, nil
+	}))
+	require.True(t, len(reachable) < len(tr.Nodes()))
+
+	reloaded := New(tr.Root(), reachable)
+	for i := 0; i < 100; i++ {
+		ret, err := reloaded.Get([]byte(fmt.Sprintf("key-%d", i)))
+		require.Nil(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("value-%d", i)), ret)
+	}
+
+	count := 0
+	require.Nil(t, tr.Walk(func(hash, data []byte) (bool, error) {
+		count++
+		return false, nil
+	}))
+	require.Equal(t, 1, count)
+
+	require.NotNil(t, New(tr.Root(), memDB{}).Walk(func(hash, data []byte) (bool, error) {
+		return true, nil
+	}))
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/pb"
 	"github.com/meshplus/bitxhub/pkg/vm"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 	"github.com/sirupsen/logrus"
 )
 
@@ -27,6 +28,15 @@ func (b *BoltStubImpl) Callee() string {
 	return b.ctx.Callee.String()
 }
 
+// CurrentCaller returns the immediate caller of the contract, which is the
+// invoking contract in case of cross contract invocations
+func (b *BoltStubImpl) CurrentCaller() string {
+	if b.ctx.CurrentCaller == nil {
+		return b.ctx.Caller.String()
+	}
+	return b.ctx.CurrentCaller.String()
+}
+
 func (b *BoltStubImpl) Logger() logrus.FieldLogger {
 	return b.ctx.Logger
 }
@@ -41,16 +51,37 @@ func (b *BoltStubImpl) GetTxIndex() uint64 {
 	return b.ctx.TransactionIndex
 }
 
+// GetCurrentHeight returns the height of the block executing the transaction
+func (b *BoltStubImpl) GetCurrentHeight() uint64 {
+	return b.ctx.CurrentHeight
+}
+
+// RemainingGas returns the gas left to the transaction
+func (b *BoltStubImpl) RemainingGas() uint64 {
+	return b.ctx.Gas.Remaining()
+}
+
+// useGas charges the gas of a host operation, running out of gas aborts the
+// contract call with gas.ErrOutOfGas
+func (b *BoltStubImpl) useGas(amount uint64) {
+	if err := b.ctx.Gas.Consume(amount); err != nil {
+		panic(err)
+	}
+}
+
 func (b *BoltStubImpl) Has(key string) bool {
+	b.useGas(gas.GetGas)
 	exist, _ := b.ctx.Ledger.GetState(b.ctx.Callee, []byte(key))
 	return exist
 }
 
 func (b *BoltStubImpl) Get(key string) (bool, []byte) {
+	b.useGas(gas.GetGas)
 	return b.ctx.Ledger.GetState(b.ctx.Callee, []byte(key))
 }
 
 func (b *BoltStubImpl) Delete(key string) {
+	b.useGas(gas.SetGas)
 	b.ctx.Ledger.SetState(b.ctx.Callee, []byte(key), nil)
 }
 
@@ -65,10 +96,12 @@ func (b *BoltStubImpl) GetObject(key string, ret interface{}) bool {
 }
 
 func (b *BoltStubImpl) Set(key string, value []byte) {
+	b.useGas(gas.SetGas + gas.ByteGas*uint64(len(value)))
 	b.ctx.Ledger.SetState(b.ctx.Callee, []byte(key), value)
 }
 
 func (b *BoltStubImpl) Add(key string, value []byte) {
+	b.useGas(gas.SetGas + gas.ByteGas*uint64(len(value)))
 	b.ctx.Ledger.AddState(b.ctx.Callee, []byte(key), value)
 }
 
@@ -91,7 +124,16 @@ func (b *BoltStubImpl) AddObject(key string, value interface{}) {
 }
 
 func (b *BoltStubImpl) Query(prefix string) (bool, [][]byte) {
-	return b.ctx.Ledger.QueryByPrefix(b.ctx.Callee, prefix)
+	b.useGas(gas.QueryGas)
+	ok, ret := b.ctx.Ledger.QueryByPrefix(b.ctx.Callee, prefix)
+
+	size := uint64(0)
+	for _, v := range ret {
+		size += uint64(len(v))
+	}
+	b.useGas(gas.ByteGas * size)
+
+	return ok, ret
 }
 
 func (b *BoltStubImpl) PostEvent(event interface{}) {
@@ -108,6 +150,7 @@ func (b *BoltStubImpl) postEvent(interchain bool, event interface{}) {
 		panic(err)
 	}
 
+	b.useGas(gas.EventGas + gas.ByteGas*uint64(len(data)))
 	b.ctx.Ledger.AddEvent(&pb.Event{
 		Interchain: interchain,
 		Data:       data,
@@ -116,6 +159,7 @@ func (b *BoltStubImpl) postEvent(interchain bool, event interface{}) {
 }
 
 func (b *BoltStubImpl) CrossInvoke(address, method string, args ...*pb.Arg) *boltvm.Response {
+	b.useGas(gas.CrossInvokeGas)
 	addr := types.NewAddressByStr(address)
 
 	payload := &pb.InvokePayload{
@@ -130,6 +174,9 @@ func (b *BoltStubImpl) CrossInvoke(address, method string, args ...*pb.Arg) *bol
 		TransactionIndex: b.bvm.ctx.TransactionIndex,
 		TransactionHash:  b.bvm.ctx.TransactionHash,
 		Logger:           b.bvm.ctx.Logger,
+		Gas:              b.bvm.ctx.Gas,
+		CurrentHeight:    b.bvm.ctx.CurrentHeight,
+		CurrentCaller:    b.bvm.ctx.Callee,
 	}
 
 	data, err := payload.Marshal()
@@ -11,6 +11,7 @@ import (
 	"github.com/meshplus/bitxhub-model/pb"
 	"github.com/meshplus/bitxhub/internal/executor/contracts"
 	"github.com/meshplus/bitxhub/pkg/vm"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 )
 
 var _ vm.VM = (*BoltVM)(nil)
@@ -35,6 +36,9 @@ func (bvm *BoltVM) Run(input []byte) (ret []byte, err error) {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("%v", e)
 		}
+		if bvm.ctx.Gas.Exhausted() {
+			ret, err = nil, gas.ErrOutOfGas
+		}
 	}()
 
 	payload := &pb.InvokePayload{}
@@ -67,6 +71,10 @@ func (bvm *BoltVM) Run(input []byte) (ret []byte, err error) {
 		return nil, fmt.Errorf("not such method `%s`", payload.Method)
 	}
 
+	if err := bvm.checkPermission(payload.Method); err != nil {
+		return nil, fmt.Errorf("check permission: %w", err)
+	}
+
 	fnArgs, err := parseArgs(payload.Args)
 	if err != nil {
 		return nil, fmt.Errorf("parse args: %w", err)
@@ -85,6 +93,9 @@ func (bvm *BoltVM) HandleIBTP(ibtp *pb.IBTP) (ret []byte, err error) {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("%v", e)
 		}
+		if bvm.ctx.Gas.Exhausted() {
+			ret, err = nil, gas.ErrOutOfGas
+		}
 	}()
 
 	con := &contracts.InterchainManager{}
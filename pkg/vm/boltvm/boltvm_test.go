@@ -16,7 +16,9 @@ import (
 	"github.com/meshplus/bitxhub-model/pb"
 	"github.com/meshplus/bitxhub/internal/executor/contracts"
 	"github.com/meshplus/bitxhub/internal/ledger/mock_ledger"
+	"github.com/meshplus/bitxhub/internal/repo"
 	"github.com/meshplus/bitxhub/pkg/vm"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -76,6 +78,12 @@ func GetBoltContracts() map[string]agency.Contract {
 			Address:  constant.GovernanceContractAddr.Address().String(),
 			Contract: &contracts.Governance{},
 		},
+		{
+			Enabled:  true,
+			Name:     "service manager service",
+			Address:  constant.ServiceMgrContractAddr.Address().String(),
+			Contract: &contracts.ServiceManager{},
+		},
 	}
 
 	ContractsInfo := agency.GetRegisteredContractInfo()
@@ -92,7 +100,7 @@ func GetBoltContracts() map[string]agency.Contract {
 
 func TestRegister(t *testing.T) {
 	registers := GetBoltContracts()
-	require.Equal(t, len(registers), 8)
+	require.Equal(t, len(registers), 9)
 
 	contract, err := GetBoltContract(constant.StoreContractAddr.Address().String(), registers)
 	require.Nil(t, err)
@@ -130,6 +138,10 @@ func TestBoltVM_Run(t *testing.T) {
 	proposals = append(proposals, proposalData)
 	mockLedger.EXPECT().QueryByPrefix(gomock.Any(), contracts.PROPOSAL_PREFIX).Return(true, proposals).AnyTimes()
 	mockLedger.EXPECT().QueryByPrefix(gomock.Any(), appchain_mgr.PREFIX).Return(true, data).AnyTimes()
+	mockLedger.EXPECT().GetState(addressEq(contracts.PermissionContractAddr), gomock.Any()).Return(false, nil).AnyTimes()
+	serviceData, err := json.Marshal(&contracts.Service{ChainID: from, ServiceID: from, Whitelist: []string{from}})
+	require.Nil(t, err)
+	mockLedger.EXPECT().GetState(addressEq(constant.ServiceMgrContractAddr), []byte(contracts.ServiceKey(from, from))).Return(true, serviceData).AnyTimes()
 	mockLedger.EXPECT().GetState(gomock.Any(), gomock.Any()).DoAndReturn(func(addr *types.Address, key []byte) (bool, []byte) {
 		switch addr.String() {
 		case constant.AppchainMgrContractAddr.String():
@@ -138,7 +150,7 @@ func TestBoltVM_Run(t *testing.T) {
 			return false, nil
 		}
 		return false, nil
-	}).Times(1)
+	}).Times(2)
 	mockLedger.EXPECT().GetState(gomock.Any(), gomock.Any()).DoAndReturn(func(addr *types.Address, key []byte) (bool, []byte) {
 		switch addr.String() {
 		case constant.AppchainMgrContractAddr.String():
@@ -157,7 +169,7 @@ func TestBoltVM_Run(t *testing.T) {
 		To:   constant.AppchainMgrContractAddr.Address(),
 	}
 	tx.TransactionHash = tx.Hash()
-	ctx := vm.NewContext(tx, 1, nil, mockLedger, log.NewWithModule("vm"))
+	ctx := vm.NewContext(tx, 1, nil, mockLedger, log.NewWithModule("vm"), gas.NewMeter(gas.DefaultTxGasLimit))
 	boltVM := New(ctx, mockEngine, GetBoltContracts())
 
 	ip := &pb.InvokePayload{
@@ -274,3 +286,165 @@ func mockIBTP(t *testing.T, index uint64, typ pb.IBTP_Type) *pb.IBTP {
 		Timestamp: time.Now().UnixNano(),
 	}
 }
+
+func TestBoltVM_RunOutOfGas(t *testing.T) {
+	ctr := gomock.NewController(t)
+	mockEngine := mock_validator.NewMockEngine(ctr)
+	mockLedger := mock_ledger.NewMockLedger(ctr)
+
+	data := [][]byte{[]byte("1")}
+	mockLedger.EXPECT().QueryByPrefix(gomock.Any(), appchain_mgr.PREFIX).Return(true, data).AnyTimes()
+	mockLedger.EXPECT().GetState(addressEq(contracts.PermissionContractAddr), gomock.Any()).Return(false, nil).AnyTimes()
+
+	tx := &pb.Transaction{
+		From: types.NewAddressByStr(from),
+		To:   constant.AppchainMgrContractAddr.Address(),
+	}
+	tx.TransactionHash = tx.Hash()
+
+	ip := &pb.InvokePayload{
+		Method: "CountAppchains",
+	}
+	input, err := ip.Marshal()
+	require.Nil(t, err)
+
+	meter := gas.NewMeter(gas.GetGas + gas.QueryGas + gas.ByteGas)
+	boltVM := New(vm.NewContext(tx, 1, nil, mockLedger, log.NewWithModule("vm"), meter), mockEngine, GetBoltContracts())
+	ret, err := boltVM.Run(input)
+	require.Nil(t, err)
+	require.Equal(t, "1", string(ret))
+	require.Equal(t, gas.GetGas+gas.QueryGas+gas.ByteGas, meter.Used())
+
+	meter = gas.NewMeter(gas.QueryGas)
+	boltVM = New(vm.NewContext(tx, 1, nil, mockLedger, log.NewWithModule("vm"), meter), mockEngine, GetBoltContracts())
+	_, err = boltVM.Run(input)
+	require.Equal(t, gas.ErrOutOfGas, err)
+	require.True(t, meter.Exhausted())
+}
+
+// addressMatcher matches addresses by their raw bytes
+type addressMatcher struct {
+	addr *types.Address
+}
+
+func addressEq(addr constant.BoltContractAddress) gomock.Matcher {
+	return addressMatcher{addr: addr.Address()}
+}
+
+func (m addressMatcher) Matches(x interface{}) bool {
+	addr, ok := x.(*types.Address)
+	return ok && addr.RawAddress == m.addr.RawAddress
+}
+
+func (m addressMatcher) String() string {
+	return "is address " + m.addr.String()
+}
+
+func TestBoltVM_RunPermission(t *testing.T) {
+	ctr := gomock.NewController(t)
+	mockEngine := mock_validator.NewMockEngine(ctr)
+	mockLedger := mock_ledger.NewMockLedger(ctr)
+
+	admin := types.NewAddress([]byte{1}).String()
+	adminsData, err := json.Marshal([]*repo.Admin{{Address: admin, Weight: 1}})
+	require.Nil(t, err)
+	permData, err := json.Marshal(&repo.Permission{
+		Contract: constant.AppchainMgrContractAddr.String(),
+		Method:   "CountAppchains",
+		Roles:    []string{contracts.RoleAdmin, contracts.RoleContract},
+	})
+	require.Nil(t, err)
+
+	data := [][]byte{[]byte("1")}
+	mockLedger.EXPECT().QueryByPrefix(gomock.Any(), appchain_mgr.PREFIX).Return(true, data).AnyTimes()
+	mockLedger.EXPECT().GetState(contracts.PermissionContractAddr.Address(),
+		[]byte(contracts.PermissionKey(constant.AppchainMgrContractAddr.String(), "CountAppchains"))).Return(true, permData).AnyTimes()
+	mockLedger.EXPECT().GetState(addressEq(contracts.PermissionContractAddr), gomock.Any()).Return(false, nil).AnyTimes()
+	mockLedger.EXPECT().GetState(addressEq(constant.RoleContractAddr), []byte(contracts.AdminRolesKey)).Return(true, adminsData).AnyTimes()
+
+	ip := &pb.InvokePayload{
+		Method: "CountAppchains",
+	}
+	input, err := ip.Marshal()
+	require.Nil(t, err)
+
+	run := func(caller *types.Address) ([]byte, error) {
+		tx := &pb.Transaction{
+			From: caller,
+			To:   constant.AppchainMgrContractAddr.Address(),
+		}
+		tx.TransactionHash = tx.Hash()
+		ctx := vm.NewContext(tx, 1, nil, mockLedger, log.NewWithModule("vm"), gas.NewMeter(gas.DefaultTxGasLimit))
+		return New(ctx, mockEngine, GetBoltContracts()).Run(input)
+	}
+
+	_, err = run(types.NewAddressByStr(from))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "no permission")
+
+	ret, err := run(types.NewAddressByStr(admin))
+	require.Nil(t, err)
+	require.Equal(t, "1", string(ret))
+
+	// cross invocations from bolt contracts
+	ret, err = run(constant.GovernanceContractAddr.Address())
+	require.Nil(t, err)
+	require.Equal(t, "1", string(ret))
+}
+
+func TestBoltVM_RunDefaultPermission(t *testing.T) {
+	ctr := gomock.NewController(t)
+	mockEngine := mock_validator.NewMockEngine(ctr)
+	mockLedger := mock_ledger.NewMockLedger(ctr)
+
+	admin := types.NewAddress([]byte{1}).String()
+	adminsData, err := json.Marshal([]*repo.Admin{{Address: admin, Weight: 1}})
+	require.Nil(t, err)
+	permData, err := json.Marshal(&repo.Permission{
+		Contract: constant.StoreContractAddr.String(),
+		Method:   "Set",
+		Roles:    []string{contracts.RoleAnyone},
+	})
+	require.Nil(t, err)
+
+	storeSet := mockLedger.EXPECT().GetState(addressEq(contracts.PermissionContractAddr),
+		[]byte(contracts.PermissionKey(constant.StoreContractAddr.String(), "Set"))).Return(false, nil).Times(2)
+	mockLedger.EXPECT().GetState(addressEq(contracts.PermissionContractAddr),
+		[]byte(contracts.PermissionKey(constant.StoreContractAddr.String(), "Set"))).Return(true, permData).After(storeSet).AnyTimes()
+	mockLedger.EXPECT().GetState(addressEq(contracts.PermissionContractAddr), gomock.Any()).Return(false, nil).AnyTimes()
+	mockLedger.EXPECT().GetState(addressEq(constant.RoleContractAddr), []byte(contracts.AdminRolesKey)).Return(true, adminsData).AnyTimes()
+	mockLedger.EXPECT().SetState(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	run := func(caller *types.Address, to *types.Address, method string, args ...*pb.Arg) error {
+		ip := &pb.InvokePayload{
+			Method: method,
+			Args:   args,
+		}
+		input, err := ip.Marshal()
+		require.Nil(t, err)
+
+		tx := &pb.Transaction{
+			From: caller,
+			To:   to,
+		}
+		tx.TransactionHash = tx.Hash()
+		ctx := vm.NewContext(tx, 1, nil, mockLedger, log.NewWithModule("vm"), gas.NewMeter(gas.DefaultTxGasLimit))
+		_, err = New(ctx, mockEngine, GetBoltContracts()).Run(input)
+		return err
+	}
+
+	// Store.Set is only callable from the admins by default
+	err = run(types.NewAddressByStr(from), constant.StoreContractAddr.Address(), "Set", pb.String("a"), pb.String("1"))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "no permission")
+	require.Nil(t, run(types.NewAddressByStr(admin), constant.StoreContractAddr.Address(), "Set", pb.String("a"), pb.String("1")))
+
+	// the permission overrides the default roles
+	require.Nil(t, run(types.NewAddressByStr(from), constant.StoreContractAddr.Address(), "Set", pb.String("a"), pb.String("1")))
+
+	// Manager is only callable from the bolt contracts by default
+	err = run(types.NewAddressByStr(admin), constant.RoleContractAddr.Address(), "Manager",
+		pb.String(contracts.AdminAdd), pb.String(string(contracts.APPOVED)), pb.Bytes([]byte("{}")))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "no permission")
+}
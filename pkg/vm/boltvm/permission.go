@@ -0,0 +1,78 @@
+package boltvm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/constant"
+	"github.com/meshplus/bitxhub/internal/executor/contracts"
+	"github.com/meshplus/bitxhub/internal/repo"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
+)
+
+// checkPermission checks whether the immediate caller has one of the roles
+// allowed to call the method of the callee, methods without permission in
+// the permission manager contract fall back to their default roles
+func (bvm *BoltVM) checkPermission(method string) error {
+	if err := bvm.ctx.Gas.Consume(gas.GetGas); err != nil {
+		return err
+	}
+
+	callee := bvm.ctx.Callee.String()
+	roles := contracts.DefaultRoles(callee, method)
+	ok, data := bvm.ctx.Ledger.GetState(contracts.PermissionContractAddr.Address(), []byte(contracts.PermissionKey(callee, method)))
+	if ok {
+		perm := &repo.Permission{}
+		if err := json.Unmarshal(data, perm); err != nil {
+			return fmt.Errorf("unmarshal permission: %w", err)
+		}
+		roles = perm.Roles
+	}
+	if roles == nil {
+		return nil
+	}
+
+	caller := bvm.ctx.CurrentCaller
+	if caller == nil {
+		caller = bvm.ctx.Caller
+	}
+	for _, role := range roles {
+		if bvm.hasRole(caller, role) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("caller %s has no permission to call `%s` of contract %s", caller.String(), method, callee)
+}
+
+func (bvm *BoltVM) hasRole(caller *types.Address, role string) bool {
+	switch role {
+	case contracts.RoleAnyone:
+		return true
+	case contracts.RoleContract:
+		_, ok := bvm.contracts[caller.String()]
+		return ok
+	case contracts.RoleAdmin:
+		ok, data := bvm.ctx.Ledger.GetState(constant.RoleContractAddr.Address(), []byte(contracts.AdminRolesKey))
+		if !ok {
+			return false
+		}
+		var admins []*repo.Admin
+		if err := json.Unmarshal(data, &admins); err != nil {
+			return false
+		}
+		for _, admin := range admins {
+			if strings.EqualFold(admin.Address, caller.String()) {
+				return true
+			}
+		}
+		return false
+	case contracts.RoleAppchainAdmin:
+		ok, _ := bvm.ctx.Ledger.GetState(constant.AppchainMgrContractAddr.Address(), []byte(contracts.AppchainKey(caller.String())))
+		return ok
+	default:
+		return strings.EqualFold(role, caller.String())
+	}
+}
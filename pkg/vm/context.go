@@ -4,6 +4,7 @@ import (
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/pb"
 	"github.com/meshplus/bitxhub/internal/ledger"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 	"github.com/sirupsen/logrus"
 )
 
@@ -17,18 +18,26 @@ type Context struct {
 	TransactionData  *pb.TransactionData
 	Nonce            uint64
 	Logger           logrus.FieldLogger
+	Gas              *gas.Meter
+	// CurrentHeight is the height of the block executing the transaction
+	CurrentHeight uint64
+	// CurrentCaller is the immediate caller of the contract, it is the
+	// invoking contract for cross contract invocations
+	CurrentCaller *types.Address
 }
 
 // NewContext creates a context of wasm instance
-func NewContext(tx *pb.Transaction, txIndex uint64, data *pb.TransactionData, ledger ledger.Ledger, logger logrus.FieldLogger) *Context {
+func NewContext(tx *pb.Transaction, txIndex uint64, data *pb.TransactionData, ledger ledger.Ledger, logger logrus.FieldLogger, meter *gas.Meter) *Context {
 	return &Context{
 		Caller:           tx.From,
 		Callee:           tx.To,
+		CurrentCaller:    tx.From,
 		Ledger:           ledger,
 		TransactionIndex: txIndex,
 		TransactionHash:  tx.TransactionHash,
 		TransactionData:  data,
 		Nonce:            tx.Nonce,
 		Logger:           logger,
+		Gas:              meter,
 	}
 }
@@ -0,0 +1,181 @@
+package gas
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/meshplus/bitxhub-kit/types"
+	"github.com/meshplus/bitxhub-model/pb"
+)
+
+const (
+	// TxGas is charged for every transaction before it is applied
+	TxGas uint64 = 21000
+
+	// GetGas is charged for reading a state key
+	GetGas uint64 = 200
+
+	// SetGas is charged for writing a state key
+	SetGas uint64 = 5000
+
+	// ByteGas is charged for every byte of a written state value, a posted
+	// event or a deployed contract
+	ByteGas uint64 = 10
+
+	// QueryGas is charged for a prefix query of the states
+	QueryGas uint64 = 1000
+
+	// EventGas is charged for posting an event
+	EventGas uint64 = 375
+
+	// CrossInvokeGas is charged for invoking another contract
+	CrossInvokeGas uint64 = 700
+
+	// InstructionGas is charged for every executed wasm instruction
+	InstructionGas uint64 = 1
+
+	// MaxTxGasLimit bounds the gas limit declared by a transaction
+	MaxTxGasLimit uint64 = 5000000
+
+	// DefaultTxGasLimit is the gas limit of the transactions declaring none
+	DefaultTxGasLimit = MaxTxGasLimit
+)
+
+// ErrOutOfGas is returned when a transaction uses up its gas limit
+var ErrOutOfGas = fmt.Errorf("out of gas")
+
+// Meter counts the gas used by a transaction against its limit, a nil meter
+// has no limit
+type Meter struct {
+	limit     uint64
+	used      uint64
+	exhausted bool
+}
+
+// NewMeter creates a gas meter with the given limit
+func NewMeter(limit uint64) *Meter {
+	return &Meter{limit: limit}
+}
+
+// Consume charges the amount of gas, it uses up the remaining gas and returns
+// ErrOutOfGas if the amount exceeds it
+func (m *Meter) Consume(amount uint64) error {
+	if m == nil {
+		return nil
+	}
+
+	if amount > m.limit-m.used {
+		m.used = m.limit
+		m.exhausted = true
+		return ErrOutOfGas
+	}
+
+	m.used += amount
+
+	return nil
+}
+
+// Used returns the gas used so far
+func (m *Meter) Used() uint64 {
+	if m == nil {
+		return 0
+	}
+
+	return m.used
+}
+
+// Remaining returns the gas left
+func (m *Meter) Remaining() uint64 {
+	if m == nil {
+		return math.MaxUint64
+	}
+
+	return m.limit - m.used
+}
+
+// Exhausted returns whether the meter ran out of gas
+func (m *Meter) Exhausted() bool {
+	if m == nil {
+		return false
+	}
+
+	return m.exhausted
+}
+
+// EncodeTxGasLimit encodes the gas limit a transaction declares in the Extra
+// of its data
+func EncodeTxGasLimit(limit uint64) []byte {
+	extra := make([]byte, 8)
+	binary.BigEndian.PutUint64(extra, limit)
+	return extra
+}
+
+// TxGasLimit returns the gas limit declared in the Extra of the transaction
+// data, the IBTP transactions and the ones declaring none get DefaultTxGasLimit
+func TxGasLimit(tx *pb.Transaction) (uint64, error) {
+	if tx.IsIBTP() || tx.Payload == nil {
+		return DefaultTxGasLimit, nil
+	}
+
+	data := &pb.TransactionData{}
+	if err := data.Unmarshal(tx.Payload); err != nil {
+		return 0, fmt.Errorf("unmarshal tx data: %w", err)
+	}
+	if len(data.Extra) == 0 {
+		return DefaultTxGasLimit, nil
+	}
+	if len(data.Extra) != 8 {
+		return 0, fmt.Errorf("illegal gas limit of %d bytes", len(data.Extra))
+	}
+
+	limit := binary.BigEndian.Uint64(data.Extra)
+	if limit < TxGas || limit > MaxTxGasLimit {
+		return 0, fmt.Errorf("gas limit %d is out of range [%d, %d]", limit, TxGas, MaxTxGasLimit)
+	}
+
+	return limit, nil
+}
+
+// UsedEvent is added to the receipt of every applied transaction to record the
+// gas it used, pb.Receipt has no field for it
+type UsedEvent struct {
+	GasUsed uint64 `json:"gas_used"`
+}
+
+// NewUsedEvent returns the event recording the gas used by the transaction
+func NewUsedEvent(txHash *types.Hash, used uint64) *pb.Event {
+	data, err := json.Marshal(&UsedEvent{GasUsed: used})
+	if err != nil {
+		panic(err)
+	}
+
+	return &pb.Event{
+		TxHash: txHash,
+		Data:   data,
+	}
+}
+
+// GasUsed returns the gas used recorded in the receipt, false if the receipt
+// records none
+func GasUsed(receipt *pb.Receipt) (uint64, bool) {
+	for _, ev := range receipt.Events {
+		if ev.Interchain {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(ev.Data, &fields); err != nil || len(fields) != 1 || fields["gas_used"] == nil {
+			continue
+		}
+
+		e := &UsedEvent{}
+		if err := json.Unmarshal(ev.Data, e); err != nil {
+			continue
+		}
+		return e.GasUsed, true
+	}
+
+	return 0, false
+}
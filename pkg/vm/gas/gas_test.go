@@ -0,0 +1,63 @@
+package gas
+
+import (
+	"testing"
+
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeter(t *testing.T) {
+	m := NewMeter(100)
+	require.Nil(t, m.Consume(60))
+	require.Equal(t, uint64(60), m.Used())
+	require.Equal(t, uint64(40), m.Remaining())
+
+	require.Equal(t, ErrOutOfGas, m.Consume(41))
+	require.Equal(t, uint64(100), m.Used())
+	require.True(t, m.Exhausted())
+
+	var unlimited *Meter
+	require.Nil(t, unlimited.Consume(1<<62))
+	require.False(t, unlimited.Exhausted())
+}
+
+func TestTxGasLimit(t *testing.T) {
+	txWithExtra := func(extra []byte) *pb.Transaction {
+		data := &pb.TransactionData{Extra: extra}
+		payload, err := data.Marshal()
+		require.Nil(t, err)
+		return &pb.Transaction{Payload: payload}
+	}
+
+	limit, err := TxGasLimit(txWithExtra(nil))
+	require.Nil(t, err)
+	require.Equal(t, DefaultTxGasLimit, limit)
+	limit, err = TxGasLimit(&pb.Transaction{IBTP: &pb.IBTP{}})
+	require.Nil(t, err)
+	require.Equal(t, DefaultTxGasLimit, limit)
+	limit, err = TxGasLimit(txWithExtra(EncodeTxGasLimit(TxGas)))
+	require.Nil(t, err)
+	require.Equal(t, TxGas, limit)
+
+	_, err = TxGasLimit(txWithExtra(EncodeTxGasLimit(TxGas - 1)))
+	require.NotNil(t, err)
+	_, err = TxGasLimit(txWithExtra(EncodeTxGasLimit(MaxTxGasLimit + 1)))
+	require.NotNil(t, err)
+	_, err = TxGasLimit(txWithExtra([]byte{1}))
+	require.NotNil(t, err)
+}
+
+func TestGasUsed(t *testing.T) {
+	receipt := &pb.Receipt{Events: []*pb.Event{
+		{Interchain: true, Data: []byte(`{"gas_used":1}`)},
+		{Data: []byte(`{"node_operation":"add","node":{}}`)},
+	}}
+	_, ok := GasUsed(receipt)
+	require.False(t, ok)
+
+	receipt.Events = append(receipt.Events, NewUsedEvent(nil, 30000))
+	used, ok := GasUsed(receipt)
+	require.True(t, ok)
+	require.Equal(t, uint64(30000), used)
+}
@@ -0,0 +1,36 @@
+package wasm
+
+// #include <stdlib.h>
+//
+// extern int32_t use_gas(void *context, long long amount);
+import "C"
+import (
+	"unsafe"
+
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
+	"github.com/wasmerio/go-ext-wasm/wasmer"
+)
+
+// ContextGas is the key of the gas meter in the context data of the instance
+const ContextGas = "gas"
+
+//export use_gas
+func use_gas(context unsafe.Pointer, amount int64) int32 {
+	ctx := wasmer.IntoInstanceContext(context)
+	ctxMap, ok := ctx.Data().(map[string]interface{})
+	if !ok {
+		return 0
+	}
+
+	meter, _ := ctxMap[ContextGas].(*gas.Meter)
+	if amount < 0 || meter.Consume(uint64(amount)) != nil {
+		return 1
+	}
+
+	return 0
+}
+
+// appendGasImports adds the use_gas function called by metered contracts
+func appendGasImports(imports *wasmer.Imports) (*wasmer.Imports, error) {
+	return imports.Namespace(gasModule).Append(gasFunction, use_gas, C.use_gas)
+}
@@ -0,0 +1,704 @@
+package wasm
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
+)
+
+const (
+	gasModule   = "env"
+	gasFunction = "use_gas"
+)
+
+const (
+	sectionCustom  = 0
+	sectionType    = 1
+	sectionImport  = 2
+	sectionMemory  = 5
+	sectionExport  = 7
+	sectionStart   = 8
+	sectionElement = 9
+	sectionCode    = 10
+)
+
+var wasmHeader = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+type section struct {
+	id      byte
+	payload []byte
+}
+
+// InjectMeter instruments the wasm module with gas metering. Every straight
+// line sequence of instructions is prefixed with a call to the imported
+// env.use_gas function charging the instructions of the sequence, the module
+// traps once use_gas reports the gas is exhausted.
+func InjectMeter(code []byte) ([]byte, error) {
+	if len(code) < len(wasmHeader) || !bytes.Equal(code[:len(wasmHeader)], wasmHeader) {
+		return nil, fmt.Errorf("invalid wasm header")
+	}
+
+	sections, err := parseSections(code[len(wasmHeader):])
+	if err != nil {
+		return nil, err
+	}
+
+	// the type of use_gas is (i64) -> i32
+	typeIdx := uint32(0)
+	sections, err = updateSection(sections, sectionType, func(payload []byte) ([]byte, error) {
+		r := &reader{buf: payload}
+		count, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		typeIdx = count
+
+		out := appendULEB(nil, uint64(count+1))
+		out = append(out, r.rest()...)
+
+		return append(out, 0x60, 0x01, 0x7e, 0x01, 0x7f), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("inject gas type: %w", err)
+	}
+
+	var (
+		gasFunc   uint32
+		hasMemory bool
+	)
+	sections, err = updateSection(sections, sectionImport, func(payload []byte) ([]byte, error) {
+		var err error
+		gasFunc, hasMemory, err = parseImports(payload)
+		if err != nil {
+			return nil, err
+		}
+
+		r := &reader{buf: payload}
+		count, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+
+		out := appendULEB(nil, uint64(count+1))
+		out = append(out, r.rest()...)
+		out = appendName(out, gasModule)
+		out = appendName(out, gasFunction)
+		out = append(out, 0x00)
+
+		return appendULEB(out, uint64(typeIdx)), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("inject gas import: %w", err)
+	}
+
+	// wasmer resolves the memory of the instance whenever use_gas is called,
+	// modules without memory get an empty one
+	for _, s := range sections {
+		if s.id == sectionMemory {
+			hasMemory = true
+		}
+	}
+	if !hasMemory {
+		sections, err = updateSection(sections, sectionMemory, func(payload []byte) ([]byte, error) {
+			return []byte{0x01, 0x00, 0x00}, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("inject memory: %w", err)
+		}
+	}
+
+	out := append([]byte{}, wasmHeader...)
+	for _, s := range sections {
+		payload := s.payload
+		switch s.id {
+		case sectionCustom:
+			// the name section indexes functions which are shifted by the import
+			r := &reader{buf: payload}
+			name, err := r.name()
+			if err == nil && name == "name" {
+				continue
+			}
+		case sectionExport:
+			payload, err = shiftExports(payload, gasFunc)
+		case sectionStart:
+			payload, err = shiftStart(payload, gasFunc)
+		case sectionElement:
+			payload, err = shiftElements(payload, gasFunc)
+		case sectionCode:
+			payload, err = meterCode(payload, gasFunc)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("inject gas meter into section %d: %w", s.id, err)
+		}
+
+		out = append(out, s.id)
+		out = appendULEB(out, uint64(len(payload)))
+		out = append(out, payload...)
+	}
+
+	return out, nil
+}
+
+func parseSections(buf []byte) ([]*section, error) {
+	var sections []*section
+	r := &reader{buf: buf}
+	for !r.eof() {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		payload, err := r.vec()
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, &section{id: id, payload: payload})
+	}
+
+	return sections, nil
+}
+
+// updateSection rewrites the payload of the section with the given id, an
+// empty section is created in place if the module lacks it
+func updateSection(sections []*section, id byte, update func([]byte) ([]byte, error)) ([]*section, error) {
+	pos := len(sections)
+	for i, s := range sections {
+		if s.id == id {
+			payload, err := update(s.payload)
+			if err != nil {
+				return nil, err
+			}
+			s.payload = payload
+			return sections, nil
+		}
+		if s.id != sectionCustom && s.id > id && pos == len(sections) {
+			pos = i
+		}
+	}
+
+	payload, err := update([]byte{0x00})
+	if err != nil {
+		return nil, err
+	}
+
+	sections = append(sections, nil)
+	copy(sections[pos+1:], sections[pos:])
+	sections[pos] = &section{id: id, payload: payload}
+
+	return sections, nil
+}
+
+// parseImports returns the number of imported functions and whether a memory
+// is imported
+func parseImports(payload []byte) (uint32, bool, error) {
+	r := &reader{buf: payload}
+	count, err := r.u32()
+	if err != nil {
+		return 0, false, err
+	}
+
+	funcs := uint32(0)
+	hasMemory := false
+	for i := uint32(0); i < count; i++ {
+		module, err := r.name()
+		if err != nil {
+			return 0, false, err
+		}
+		name, err := r.name()
+		if err != nil {
+			return 0, false, err
+		}
+		if module == gasModule && name == gasFunction {
+			return 0, false, fmt.Errorf("module already imports %s.%s", gasModule, gasFunction)
+		}
+
+		kind, err := r.byte()
+		if err != nil {
+			return 0, false, err
+		}
+		switch kind {
+		case 0x00:
+			funcs++
+			_, err = r.u32()
+		case 0x01:
+			if _, err = r.byte(); err == nil {
+				err = r.skipLimits()
+			}
+		case 0x02:
+			hasMemory = true
+			err = r.skipLimits()
+		case 0x03:
+			_, err = r.bytes(2)
+		default:
+			err = fmt.Errorf("unknown import kind %d", kind)
+		}
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	return funcs, hasMemory, nil
+}
+
+func shiftFunc(idx, gasFunc uint32) uint32 {
+	if idx >= gasFunc {
+		return idx + 1
+	}
+
+	return idx
+}
+
+func shiftExports(payload []byte, gasFunc uint32) ([]byte, error) {
+	r := &reader{buf: payload}
+	count, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+
+	out := appendULEB(nil, uint64(count))
+	for i := uint32(0); i < count; i++ {
+		name, err := r.name()
+		if err != nil {
+			return nil, err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		idx, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		if kind == 0x00 {
+			idx = shiftFunc(idx, gasFunc)
+		}
+
+		out = appendName(out, name)
+		out = append(out, kind)
+		out = appendULEB(out, uint64(idx))
+	}
+
+	return out, nil
+}
+
+func shiftStart(payload []byte, gasFunc uint32) ([]byte, error) {
+	r := &reader{buf: payload}
+	idx, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+
+	return appendULEB(nil, uint64(shiftFunc(idx, gasFunc))), nil
+}
+
+func shiftElements(payload []byte, gasFunc uint32) ([]byte, error) {
+	r := &reader{buf: payload}
+	count, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+
+	out := appendULEB(nil, uint64(count))
+	for i := uint32(0); i < count; i++ {
+		start := r.pos
+		flags, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+
+		switch flags {
+		case 0:
+			err = r.skipExpr()
+		case 1, 3:
+			_, err = r.byte()
+		case 2:
+			if _, err = r.u32(); err == nil {
+				if err = r.skipExpr(); err == nil {
+					_, err = r.byte()
+				}
+			}
+		default:
+			err = fmt.Errorf("unsupported element segment flags %d", flags)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r.buf[start:r.pos]...)
+
+		n, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		out = appendULEB(out, uint64(n))
+		for j := uint32(0); j < n; j++ {
+			idx, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			out = appendULEB(out, uint64(shiftFunc(idx, gasFunc)))
+		}
+	}
+
+	return out, nil
+}
+
+func meterCode(payload []byte, gasFunc uint32) ([]byte, error) {
+	r := &reader{buf: payload}
+	count, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+
+	out := appendULEB(nil, uint64(count))
+	for i := uint32(0); i < count; i++ {
+		body, err := r.vec()
+		if err != nil {
+			return nil, err
+		}
+
+		body, err = meterBody(body, gasFunc)
+		if err != nil {
+			return nil, fmt.Errorf("function body %d: %w", i, err)
+		}
+
+		out = appendULEB(out, uint64(len(body)))
+		out = append(out, body...)
+	}
+
+	return out, nil
+}
+
+// meterBody splits the function body into sequences ended by control
+// instructions and charges every sequence at its beginning
+func meterBody(body []byte, gasFunc uint32) ([]byte, error) {
+	r := &reader{buf: body}
+	locals, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < locals; i++ {
+		if _, err := r.u32(); err != nil {
+			return nil, err
+		}
+		if _, err := r.byte(); err != nil {
+			return nil, err
+		}
+	}
+
+	out := append([]byte{}, body[:r.pos]...)
+	var seq []byte
+	n := uint64(0)
+	for !r.eof() {
+		ins, err := r.instruction()
+		if err != nil {
+			return nil, err
+		}
+
+		if ins.hasFunc {
+			seq = append(seq, r.buf[ins.start:ins.immStart]...)
+			seq = appendULEB(seq, uint64(shiftFunc(ins.funcIdx, gasFunc)))
+			seq = append(seq, r.buf[ins.immEnd:r.pos]...)
+		} else {
+			seq = append(seq, r.buf[ins.start:r.pos]...)
+		}
+		n++
+
+		if ins.endsSequence() || r.eof() {
+			out = appendCharge(out, n*gas.InstructionGas, gasFunc)
+			out = append(out, seq...)
+			seq = seq[:0]
+			n = 0
+		}
+	}
+
+	return out, nil
+}
+
+// appendCharge appends `if (use_gas(amount)) unreachable`
+func appendCharge(out []byte, amount uint64, gasFunc uint32) []byte {
+	out = append(out, 0x42)
+	out = appendSLEB(out, int64(amount))
+	out = append(out, 0x10)
+	out = appendULEB(out, uint64(gasFunc))
+
+	return append(out, 0x04, 0x40, 0x00, 0x0b)
+}
+
+type instruction struct {
+	opcode   byte
+	start    int
+	hasFunc  bool
+	funcIdx  uint32
+	immStart int
+	immEnd   int
+}
+
+func (ins *instruction) endsSequence() bool {
+	switch ins.opcode {
+	case 0x00, 0x02, 0x03, 0x04, 0x05, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11:
+		return true
+	default:
+		return false
+	}
+}
+
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func (r *reader) eof() bool {
+	return r.pos >= len(r.buf)
+}
+
+func (r *reader) rest() []byte {
+	return r.buf[r.pos:]
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.eof() {
+		return 0, fmt.Errorf("unexpected end of wasm")
+	}
+	b := r.buf[r.pos]
+	r.pos++
+
+	return b, nil
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.buf) {
+		return nil, fmt.Errorf("unexpected end of wasm")
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+
+	return b, nil
+}
+
+func (r *reader) uleb(bits uint) (uint64, error) {
+	var (
+		ret   uint64
+		shift uint
+	)
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		ret |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+		if shift >= bits+7 {
+			return 0, fmt.Errorf("integer representation too long")
+		}
+	}
+
+	return ret, nil
+}
+
+func (r *reader) sleb(bits uint) (int64, error) {
+	var (
+		ret   int64
+		shift uint
+		b     byte
+		err   error
+	)
+	for {
+		b, err = r.byte()
+		if err != nil {
+			return 0, err
+		}
+		ret |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+		if shift >= bits+7 {
+			return 0, fmt.Errorf("integer representation too long")
+		}
+	}
+	if shift < 64 && b&0x40 != 0 {
+		ret |= -1 << shift
+	}
+
+	return ret, nil
+}
+
+func (r *reader) u32() (uint32, error) {
+	v, err := r.uleb(32)
+	return uint32(v), err
+}
+
+func (r *reader) vec() ([]byte, error) {
+	n, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.bytes(int(n))
+}
+
+func (r *reader) name() (string, error) {
+	b, err := r.vec()
+	return string(b), err
+}
+
+func (r *reader) skipLimits() error {
+	flag, err := r.byte()
+	if err != nil {
+		return err
+	}
+	if _, err := r.u32(); err != nil {
+		return err
+	}
+	if flag&0x01 != 0 {
+		_, err = r.u32()
+	}
+
+	return err
+}
+
+func (r *reader) skipExpr() error {
+	for {
+		ins, err := r.instruction()
+		if err != nil {
+			return err
+		}
+		if ins.opcode == 0x0b {
+			return nil
+		}
+	}
+}
+
+func (r *reader) blockType() error {
+	b, err := r.byte()
+	if err != nil {
+		return err
+	}
+	switch b {
+	case 0x40, 0x7f, 0x7e, 0x7d, 0x7c, 0x7b, 0x70, 0x6f:
+		return nil
+	}
+	r.pos--
+	_, err = r.sleb(33)
+
+	return err
+}
+
+func (r *reader) instruction() (*instruction, error) {
+	ins := &instruction{start: r.pos}
+	op, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	ins.opcode = op
+
+	switch {
+	case op == 0x02 || op == 0x03 || op == 0x04:
+		err = r.blockType()
+	case op == 0x0c || op == 0x0d:
+		_, err = r.u32()
+	case op == 0x0e:
+		var n uint32
+		if n, err = r.u32(); err == nil {
+			for i := uint32(0); i <= n && err == nil; i++ {
+				_, err = r.u32()
+			}
+		}
+	case op == 0x10 || op == 0xd2:
+		ins.hasFunc = true
+		ins.immStart = r.pos
+		ins.funcIdx, err = r.u32()
+		ins.immEnd = r.pos
+	case op == 0x11:
+		if _, err = r.u32(); err == nil {
+			_, err = r.u32()
+		}
+	case op == 0x1c:
+		_, err = r.vec()
+	case op >= 0x20 && op <= 0x26:
+		_, err = r.u32()
+	case op >= 0x28 && op <= 0x3e:
+		if _, err = r.u32(); err == nil {
+			_, err = r.u32()
+		}
+	case op == 0x3f || op == 0x40 || op == 0xd0:
+		_, err = r.byte()
+	case op == 0x41:
+		_, err = r.sleb(32)
+	case op == 0x42:
+		_, err = r.sleb(64)
+	case op == 0x43:
+		_, err = r.bytes(4)
+	case op == 0x44:
+		_, err = r.bytes(8)
+	case op == 0xfc:
+		err = r.miscInstruction()
+	case op == 0x00 || op == 0x01 || op == 0x05 || op == 0x0b || op == 0x0f ||
+		op == 0x1a || op == 0x1b || (op >= 0x45 && op <= 0xc4) || op == 0xd1:
+	default:
+		err = fmt.Errorf("unsupported opcode 0x%x", op)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ins, nil
+}
+
+func (r *reader) miscInstruction() error {
+	sub, err := r.u32()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case sub <= 7:
+		return nil
+	case sub == 8 || sub == 12 || sub == 14:
+		if _, err := r.u32(); err != nil {
+			return err
+		}
+		_, err = r.u32()
+	case sub == 9 || sub == 11 || sub == 13 || (sub >= 15 && sub <= 17):
+		_, err = r.u32()
+	case sub == 10:
+		_, err = r.bytes(2)
+	default:
+		err = fmt.Errorf("unsupported opcode 0xfc 0x%x", sub)
+	}
+
+	return err
+}
+
+func appendULEB(out []byte, v uint64) []byte {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			out = append(out, b|0x80)
+			continue
+		}
+
+		return append(out, b)
+	}
+}
+
+func appendSLEB(out []byte, v int64) []byte {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func appendName(out []byte, name string) []byte {
+	out = appendULEB(out, uint64(len(name)))
+
+	return append(out, name...)
+}
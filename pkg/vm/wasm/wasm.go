@@ -8,14 +8,23 @@ import (
 	"fmt"
 	"sync"
 
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/meshplus/bitxhub-core/wasm"
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub/pkg/vm"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 	"github.com/wasmerio/go-ext-wasm/wasmer"
 )
 
+const meteredCacheSize = 1024
+
 var (
 	errorLackOfMethod = fmt.Errorf("wasm execute: lack of method name")
+
+	// meteredCache caches the metered contract bytes by the hash of the
+	// deployed code, the deployed code stays unmetered for the validation
+	// engine which instantiates it with its own imports
+	meteredCache, _ = lru.New(meteredCacheSize)
 )
 
 var _ vm.VM = (*WasmVM)(nil)
@@ -48,7 +57,14 @@ func New(ctx *vm.Context, imports *wasmer.Imports, instances map[string]wasmer.I
 		return wasmVM, nil
 	}
 
-	contractByte := ctx.Ledger.GetCode(ctx.Callee)
+	contractByte, err := meteredContract(ctx.Ledger.GetCode(ctx.Callee))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := appendGasImports(imports); err != nil {
+		return nil, err
+	}
 
 	syncInstances := sync.Map{}
 	for k, instance := range instances {
@@ -69,19 +85,66 @@ func EmptyImports() (*wasmer.Imports, error) {
 	return wasmer.NewImports(), nil
 }
 
+// meteredContract returns the contract bytes with the metered code, the hash
+// of the metered code keys its instances apart from the unmetered ones
+func meteredContract(contractByte []byte) ([]byte, error) {
+	contract := &Contract{}
+	if err := json.Unmarshal(contractByte, contract); err != nil {
+		return nil, fmt.Errorf("contract byte not correct")
+	}
+
+	if v, ok := meteredCache.Get(contract.Hash.String()); ok {
+		return v.([]byte), nil
+	}
+
+	code, err := InjectMeter(contract.Code)
+	if err != nil {
+		return nil, fmt.Errorf("inject gas meter: %w", err)
+	}
+
+	metered, err := json.Marshal(&Contract{
+		Code: code,
+		Hash: *types.NewHash(code),
+	})
+	if err != nil {
+		return nil, err
+	}
+	meteredCache.Add(contract.Hash.String(), metered)
+
+	return metered, nil
+}
+
 // Run let the wasm vm excute or deploy the smart contract which depends on whether the callee is empty
 func (w *WasmVM) Run(input []byte) (ret []byte, err error) {
 	if w.ctx.Callee == nil || bytes.Equal(w.ctx.Callee.Bytes(), (&types.Address{}).Bytes()) {
 		return w.deploy()
 	}
 
-	return w.w.Execute(input)
+	// the metered code calls use_gas while the arguments are allocated, which
+	// happens before Execute sets the context data
+	w.w.SetContext(ContextGas, w.ctx.Gas)
+	w.w.Instance.SetContextData(map[string]interface{}{ContextGas: w.ctx.Gas})
+
+	ret, err = w.w.Execute(input)
+	if w.ctx.Gas.Exhausted() {
+		return nil, gas.ErrOutOfGas
+	}
+
+	return ret, err
 }
 
 func (w *WasmVM) deploy() ([]byte, error) {
 	if len(w.ctx.TransactionData.Payload) == 0 {
 		return nil, fmt.Errorf("contract cannot be empty")
 	}
+
+	if err := w.ctx.Gas.Consume(gas.ByteGas * uint64(len(w.ctx.TransactionData.Payload))); err != nil {
+		return nil, err
+	}
+
+	if _, err := InjectMeter(w.ctx.TransactionData.Payload); err != nil {
+		return nil, fmt.Errorf("inject gas meter: %w", err)
+	}
 	contractNonce := w.ctx.Ledger.GetNonce(w.ctx.Caller)
 
 	contractAddr := createAddress(w.ctx.Caller, contractNonce)
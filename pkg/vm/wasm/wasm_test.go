@@ -19,6 +19,7 @@ import (
 	"github.com/meshplus/bitxhub/internal/ledger"
 	"github.com/meshplus/bitxhub/internal/repo"
 	"github.com/meshplus/bitxhub/pkg/vm"
+	"github.com/meshplus/bitxhub/pkg/vm/gas"
 	libp2pcert "github.com/meshplus/go-libp2p-cert"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -198,6 +199,56 @@ func TestExecute(t *testing.T) {
 	require.Equal(t, "336", string(result))
 }
 
+func TestExecuteWithGas(t *testing.T) {
+	ctx := initCreateContext(t, "execute_with_gas")
+	instances := make(map[string]wasmer.Instance)
+	imports, err := EmptyImports()
+	require.Nil(t, err)
+	wasm, err := New(ctx, imports, instances)
+	require.Nil(t, err)
+
+	ret, err := wasm.deploy()
+	require.Nil(t, err)
+
+	invokePayload := &pb.InvokePayload{
+		Method: "a",
+		Args: []*pb.Arg{
+			{Type: pb.Arg_I32, Value: []byte(fmt.Sprintf("%d", 1))},
+			{Type: pb.Arg_I32, Value: []byte(fmt.Sprintf("%d", 2))},
+		},
+	}
+	payload, err := invokePayload.Marshal()
+	require.Nil(t, err)
+
+	meter := gas.NewMeter(gas.DefaultTxGasLimit)
+	ctx1 := &vm.Context{
+		Caller:          ctx.Caller,
+		Callee:          types.NewAddress(ret),
+		TransactionData: &pb.TransactionData{Payload: payload},
+		Ledger:          ctx.Ledger,
+		Gas:             meter,
+	}
+	imports1, err := validatorlib.New()
+	require.Nil(t, err)
+	wasm1, err := New(ctx1, imports1, instances)
+	require.Nil(t, err)
+
+	result, err := wasm1.Run(payload)
+	require.Nil(t, err)
+	require.Equal(t, "336", string(result))
+	require.True(t, meter.Used() > 0)
+
+	ctx1.Gas = gas.NewMeter(meter.Used() - 1)
+	imports2, err := validatorlib.New()
+	require.Nil(t, err)
+	wasm2, err := New(ctx1, imports2, instances)
+	require.Nil(t, err)
+
+	_, err = wasm2.Run(payload)
+	require.Equal(t, gas.ErrOutOfGas, err)
+	require.True(t, ctx1.Gas.Exhausted())
+}
+
 func TestWasm_RunFabValidation(t *testing.T) {
 	ctx := initFabricContext(t, "execute")
 	instances := make(map[string]wasmer.Instance)
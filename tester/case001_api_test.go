@@ -27,7 +27,8 @@ type API struct {
 }
 
 func (suite *API) SetupSuite() {
-	privKey, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	// Store.Set is only callable from the admins
+	privKey, err := asym.RestorePrivateKey("./test_data/config/node1/key.json", "bitxhub")
 	suite.Assert().Nil(err)
 
 	from, err := privKey.PublicKey().Address()
@@ -55,7 +56,7 @@ func (suite *API) TestSend() {
 }
 
 func testSendTransaction(suite *API) *types.Hash {
-	tx, err := genContractTransaction(pb.TransactionData_BVM, suite.privKey, 1,
+	tx, err := genContractTransaction(pb.TransactionData_BVM, suite.privKey, suite.api.Broker().GetPendingNonceByAccount(suite.from.String()),
 		constant.StoreContractAddr.Address(), "Set", pb.String("key"), pb.String(value))
 	suite.Nil(err)
 
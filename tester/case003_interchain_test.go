@@ -5,12 +5,8 @@ import (
 	"io/ioutil"
 	"time"
 
-	"github.com/meshplus/bitxhub/internal/executor/contracts"
-
 	"github.com/tidwall/gjson"
 
-	appchain_mgr "github.com/meshplus/bitxhub-core/appchain-mgr"
-
 	"github.com/meshplus/bitxhub-kit/crypto"
 	"github.com/meshplus/bitxhub-kit/crypto/asym"
 	"github.com/meshplus/bitxhub-model/constant"
@@ -58,21 +54,13 @@ func (suite *Interchain) TestHandleIBTP() {
 	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
 	k1Nonce++
 	id1 := gjson.Get(string(ret.Ret), "chain_id").String()
+	suite.Require().Nil(approveProposal(suite.api, gjson.Get(string(ret.Ret), "proposal_id").String()))
 
 	ret, err = invokeBVMContract(suite.api, k1, k1Nonce, constant.AppchainMgrContractAddr.Address(), "GetAppchain", pb.String(id1))
 	suite.Require().Nil(err)
 	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
 	k1Nonce++
 
-	ret, err = invokeBVMContract(suite.api, k1, k1Nonce, constant.AppchainMgrContractAddr.Address(), "Manager",
-		pb.String(string(appchain_mgr.EventRegister)),
-		pb.String(string(contracts.APPOVED)),
-		pb.Bytes(ret.Ret),
-	)
-	suite.Require().Nil(err)
-	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
-	k1Nonce++
-
 	ret, err = invokeBVMContract(suite.api, k2, k2Nonce, constant.AppchainMgrContractAddr.Address(), "Register",
 		pb.String(""),
 		pb.Int32(0),
@@ -86,21 +74,13 @@ func (suite *Interchain) TestHandleIBTP() {
 	suite.Require().True(ret.IsSuccess())
 	k2Nonce++
 	id2 := gjson.Get(string(ret.Ret), "chain_id").String()
+	suite.Require().Nil(approveProposal(suite.api, gjson.Get(string(ret.Ret), "proposal_id").String()))
 
 	ret, err = invokeBVMContract(suite.api, k2, k2Nonce, constant.AppchainMgrContractAddr.Address(), "GetAppchain", pb.String(id2))
 	suite.Require().Nil(err)
 	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
 	k2Nonce++
 
-	ret, err = invokeBVMContract(suite.api, k2, k2Nonce, constant.AppchainMgrContractAddr.Address(), "Manager",
-		pb.String(string(appchain_mgr.EventRegister)),
-		pb.String(string(contracts.APPOVED)),
-		pb.Bytes(ret.Ret),
-	)
-	suite.Require().Nil(err)
-	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
-	k2Nonce++
-
 	// deploy rule
 	bytes, err := ioutil.ReadFile("./test_data/hpc_rule.wasm")
 	suite.Require().Nil(err)
@@ -113,10 +93,18 @@ func (suite *Interchain) TestHandleIBTP() {
 	suite.Require().Nil(err)
 	suite.Require().True(ret.IsSuccess())
 	k1Nonce++
+	suite.Require().Nil(bindRule(suite.api, k1, k1Nonce, f.String(), addr.String()))
+	k1Nonce++
+
+	// register the destination service open to the source chain
+	suite.Require().Nil(registerService(suite.api, k2, k2Nonce, t.String(), "transfer", f.String()))
+	k2Nonce++
+	payload, err := genIBTPPayload("transfer")
+	suite.Require().Nil(err)
 
 	proof := []byte("true")
 	proofHash := sha256.Sum256(proof)
-	ib := &pb.IBTP{From: f.String(), To: t.String(), Index: ibtpNonce, Timestamp: time.Now().UnixNano(), Proof: proofHash[:]}
+	ib := &pb.IBTP{From: f.String(), To: t.String(), Index: ibtpNonce, Payload: payload, Timestamp: time.Now().UnixNano(), Proof: proofHash[:]}
 	tx, err := genIBTPTransaction(k1, ib)
 	suite.Require().Nil(err)
 
@@ -161,21 +149,13 @@ func (suite *Interchain) TestGetIBTPByID() {
 	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
 	k1Nonce++
 	id1 := gjson.Get(string(ret.Ret), "chain_id").String()
+	suite.Require().Nil(approveProposal(suite.api, gjson.Get(string(ret.Ret), "proposal_id").String()))
 
 	ret, err = invokeBVMContract(suite.api, k1, k1Nonce, constant.AppchainMgrContractAddr.Address(), "GetAppchain", pb.String(id1))
 	suite.Require().Nil(err)
 	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
 	k1Nonce++
 
-	ret, err = invokeBVMContract(suite.api, k1, k1Nonce, constant.AppchainMgrContractAddr.Address(), "Manager",
-		pb.String(string(appchain_mgr.EventRegister)),
-		pb.String(string(contracts.APPOVED)),
-		pb.Bytes(ret.Ret),
-	)
-	suite.Require().Nil(err)
-	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
-	k1Nonce++
-
 	ret, err = invokeBVMContract(suite.api, k2, k2Nonce, constant.AppchainMgrContractAddr.Address(), "Register",
 		pb.String(""),
 		pb.Int32(0),
@@ -189,21 +169,13 @@ func (suite *Interchain) TestGetIBTPByID() {
 	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
 	k2Nonce++
 	id2 := gjson.Get(string(ret.Ret), "chain_id").String()
+	suite.Require().Nil(approveProposal(suite.api, gjson.Get(string(ret.Ret), "proposal_id").String()))
 
 	ret, err = invokeBVMContract(suite.api, k2, k2Nonce, constant.AppchainMgrContractAddr.Address(), "GetAppchain", pb.String(id2))
 	suite.Require().Nil(err)
 	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
 	k2Nonce++
 
-	ret, err = invokeBVMContract(suite.api, k2, k2Nonce, constant.AppchainMgrContractAddr.Address(), "Manager",
-		pb.String(string(appchain_mgr.EventRegister)),
-		pb.String(string(contracts.APPOVED)),
-		pb.Bytes(ret.Ret),
-	)
-	suite.Require().Nil(err)
-	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
-	k2Nonce++
-
 	contractByte, err := ioutil.ReadFile("./test_data/fabric_policy.wasm")
 	suite.Require().Nil(err)
 	addr, err := deployContract(suite.api, k1, k1Nonce, contractByte)
@@ -214,12 +186,19 @@ func (suite *Interchain) TestGetIBTPByID() {
 	_, err = invokeBVMContract(suite.api, k1, k1Nonce, constant.RuleManagerContractAddr.Address(), "RegisterRule", pb.String(f.String()), pb.String(addr.String()))
 	suite.Require().Nil(err)
 	k1Nonce++
+	suite.Require().Nil(bindRule(suite.api, k1, k1Nonce, f.String(), addr.String()))
+	k1Nonce++
+
+	suite.Require().Nil(registerService(suite.api, k2, k2Nonce, t.String(), "transfer", f.String()))
+	k2Nonce++
+	payload, err := genIBTPPayload("transfer")
+	suite.Require().Nil(err)
 
 	proof, err := ioutil.ReadFile("./test_data/proof")
 	suite.Require().Nil(err)
 
 	proofHash := sha256.Sum256(proof)
-	ib := &pb.IBTP{From: f.String(), To: t.String(), Index: ibtpNonce, Payload: []byte("111"), Timestamp: time.Now().UnixNano(), Proof: proofHash[:]}
+	ib := &pb.IBTP{From: f.String(), To: t.String(), Index: ibtpNonce, Payload: payload, Timestamp: time.Now().UnixNano(), Proof: proofHash[:]}
 	tx, err := genIBTPTransaction(k1, ib)
 	suite.Require().Nil(err)
 	tx.Extra = proof
@@ -228,7 +207,7 @@ func (suite *Interchain) TestGetIBTPByID() {
 	suite.Require().EqualValues(true, receipt.IsSuccess(), string(receipt.Ret))
 	ibtpNonce++
 
-	ib2 := &pb.IBTP{From: f.String(), To: t.String(), Index: ibtpNonce, Payload: []byte("111"), Timestamp: time.Now().UnixNano(), Proof: proofHash[:]}
+	ib2 := &pb.IBTP{From: f.String(), To: t.String(), Index: ibtpNonce, Payload: payload, Timestamp: time.Now().UnixNano(), Proof: proofHash[:]}
 	tx, err = genIBTPTransaction(k1, ib2)
 	suite.Require().Nil(err)
 	tx.Extra = proof
@@ -237,7 +216,7 @@ func (suite *Interchain) TestGetIBTPByID() {
 	suite.Require().EqualValues(true, receipt.IsSuccess(), string(receipt.Ret))
 	ibtpNonce++
 
-	ib3 := &pb.IBTP{From: f.String(), To: t.String(), Index: ibtpNonce, Payload: []byte("111"), Timestamp: time.Now().UnixNano(), Proof: proofHash[:]}
+	ib3 := &pb.IBTP{From: f.String(), To: t.String(), Index: ibtpNonce, Payload: payload, Timestamp: time.Now().UnixNano(), Proof: proofHash[:]}
 	tx, err = genIBTPTransaction(k1, ib3)
 	suite.Require().Nil(err)
 	tx.Extra = proof
@@ -273,21 +252,13 @@ func (suite *Interchain) TestInterchain() {
 	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
 	k1Nonce++
 	id1 := gjson.Get(string(ret.Ret), "chain_id").String()
+	suite.Require().Nil(approveProposal(suite.api, gjson.Get(string(ret.Ret), "proposal_id").String()))
 
 	ret, err = invokeBVMContract(suite.api, k1, k1Nonce, constant.AppchainMgrContractAddr.Address(), "GetAppchain", pb.String(id1))
 	suite.Require().Nil(err)
 	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
 	k1Nonce++
 
-	ret, err = invokeBVMContract(suite.api, k1, k1Nonce, constant.AppchainMgrContractAddr.Address(), "Manager",
-		pb.String(string(appchain_mgr.EventRegister)),
-		pb.String(string(contracts.APPOVED)),
-		pb.Bytes(ret.Ret),
-	)
-	suite.Require().Nil(err)
-	suite.Require().True(ret.IsSuccess(), string(ret.Ret))
-	k1Nonce++
-
 	ret, err = invokeBVMContract(suite.api, k1, k1Nonce, constant.InterchainContractAddr.Address(), "Interchain")
 	suite.Require().Nil(err)
 	suite.Require().True(ret.IsSuccess())
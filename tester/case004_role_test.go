@@ -1,7 +1,6 @@
 package tester
 
 import (
-	"encoding/json"
 	"io/ioutil"
 	"path/filepath"
 	"strconv"
@@ -178,6 +177,17 @@ func (suite *Role) TestGetRuleAddress() {
 	suite.Require().True(ret.IsSuccess())
 	k2Nonce++
 
+	// only bound rules are returned
+	ret, err = invokeBVMContract(suite.api, k1, k1Nonce, constant.RuleManagerContractAddr.Address(), "GetRuleAddress", pb.String(string(id1)), pb.String("hyperchain"))
+	suite.Assert().Nil(err)
+	suite.Require().False(ret.IsSuccess())
+	k1Nonce++
+
+	suite.Require().Nil(bindRule(suite.api, k1, k1Nonce, f1.String(), addr1.String()))
+	k1Nonce++
+	suite.Require().Nil(bindRule(suite.api, k2, k2Nonce, f2.String(), addr2.String()))
+	k2Nonce++
+
 	// get role address
 	ret, err = invokeBVMContract(suite.api, k1, k1Nonce, constant.RuleManagerContractAddr.Address(), "GetRuleAddress", pb.String(string(id1)), pb.String("hyperchain"))
 	suite.Assert().Nil(err)
@@ -191,101 +201,3 @@ func (suite *Role) TestGetRuleAddress() {
 	suite.Require().Equal(addr2.String(), string(ret.Ret))
 	k2Nonce++
 }
-
-func (suite *Role) TestSetAdminRoles() {
-	// admin chain
-	path1 := "./test_data/config/node1/key.json"
-	keyPath1 := filepath.Join(path1)
-	priAdmin, err := asym.RestorePrivateKey(keyPath1, "bitxhub")
-	suite.Require().Nil(err)
-	fromAdmin, err := priAdmin.PublicKey().Address()
-	suite.Require().Nil(err)
-	pubAdmin, err := priAdmin.PublicKey().Bytes()
-	suite.Require().Nil(err)
-	adminNonce := suite.api.Broker().GetPendingNonceByAccount(fromAdmin.String())
-
-	// register
-	retReg, err := invokeBVMContract(suite.api, priAdmin, adminNonce, constant.AppchainMgrContractAddr.Address(), "Register",
-		pb.String(""),
-		pb.Int32(0),
-		pb.String("hyperchain"),
-		pb.String("管理链"),
-		pb.String("趣链管理链"),
-		pb.String("1.8"),
-		pb.String(string(pubAdmin)),
-	)
-	suite.Require().Nil(err)
-	suite.Require().True(retReg.IsSuccess(), string(retReg.Ret))
-	adminNonce++
-
-	// is admin
-	retIsAdmin, err := invokeBVMContract(suite.api, priAdmin, adminNonce, constant.RoleContractAddr.Address(), "IsAdmin", pb.String(fromAdmin.String()))
-	suite.Require().Nil(err)
-	suite.Require().True(retIsAdmin.IsSuccess())
-	adminNonce++
-
-	// get admin roles
-	r1, err := invokeBVMContract(suite.api, priAdmin, adminNonce, constant.RoleContractAddr.Address(), "GetAdminRoles")
-	suite.Assert().Nil(err)
-	ret1 := gjson.ParseBytes(r1.Ret)
-	suite.EqualValues(4, len(ret1.Array()))
-	adminNonce++
-
-	as := make([]string, 0)
-	as = append(as, fromAdmin.String())
-	data, err := json.Marshal(as)
-	suite.Nil(err)
-
-	// set admin roles
-	r, err := invokeBVMContract(suite.api, priAdmin, adminNonce, constant.RoleContractAddr.Address(), "SetAdminRoles", pb.String(string(data)))
-	suite.Require().Nil(err)
-	suite.Require().True(r.IsSuccess())
-	adminNonce++
-
-	// get admin roles
-	r2, err := invokeBVMContract(suite.api, priAdmin, adminNonce, constant.RoleContractAddr.Address(), "GetAdminRoles")
-	suite.Assert().Nil(err)
-	ret2 := gjson.ParseBytes(r2.Ret)
-	suite.EqualValues(1, len(ret2.Array()))
-	adminNonce++
-
-	// set more admin roles
-	path2 := "./test_data/config/node2/key.json"
-	path3 := "./test_data/config/node3/key.json"
-	path4 := "./test_data/config/node4/key.json"
-
-	keyPath2 := filepath.Join(path2)
-	keyPath3 := filepath.Join(path3)
-	keyPath4 := filepath.Join(path4)
-
-	priAdmin2, err := asym.RestorePrivateKey(keyPath2, "bitxhub")
-	suite.Require().Nil(err)
-	priAdmin3, err := asym.RestorePrivateKey(keyPath3, "bitxhub")
-	suite.Require().Nil(err)
-	priAdmin4, err := asym.RestorePrivateKey(keyPath4, "bitxhub")
-	suite.Require().Nil(err)
-
-	fromAdmin2, err := priAdmin2.PublicKey().Address()
-	suite.Require().Nil(err)
-	fromAdmin3, err := priAdmin3.PublicKey().Address()
-	suite.Require().Nil(err)
-	fromAdmin4, err := priAdmin4.PublicKey().Address()
-	suite.Require().Nil(err)
-
-	// set admin roles
-	as2 := make([]string, 0)
-	as2 = append(as2, fromAdmin.String(), fromAdmin2.String(), fromAdmin3.String(), fromAdmin4.String())
-	data2, err := json.Marshal(as2)
-	suite.Nil(err)
-	r, err = invokeBVMContract(suite.api, priAdmin, adminNonce, constant.RoleContractAddr.Address(), "SetAdminRoles", pb.String(string(data2)))
-	suite.Require().Nil(err)
-	suite.Require().True(r.IsSuccess())
-	adminNonce++
-
-	// get Admin Roles
-	r3, err := invokeBVMContract(suite.api, priAdmin, adminNonce, constant.RoleContractAddr.Address(), "GetAdminRoles")
-	suite.Assert().Nil(err)
-	ret3 := gjson.ParseBytes(r3.Ret)
-	suite.EqualValues(4, len(ret3.Array()))
-	adminNonce++
-}
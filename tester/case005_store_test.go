@@ -25,9 +25,12 @@ func (suite *Store) SetupSuite() {
 }
 
 func (suite *Store) TestStore() {
-	k, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	// Store.Set is only callable from the admins
+	k, err := asym.RestorePrivateKey("./test_data/config/node1/key.json", "bitxhub")
 	suite.Require().Nil(err)
-	kNonce := uint64(1)
+	from, err := k.PublicKey().Address()
+	suite.Require().Nil(err)
+	kNonce := suite.api.Broker().GetPendingNonceByAccount(from.String())
 
 	args := []*pb.Arg{
 		pb.String("123"),
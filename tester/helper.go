@@ -2,15 +2,18 @@ package tester
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/crypto/asym"
 	"github.com/meshplus/bitxhub-kit/types"
 	"github.com/meshplus/bitxhub-model/constant"
 	"github.com/meshplus/bitxhub-model/pb"
 	"github.com/meshplus/bitxhub/internal/coreapi/api"
+	"github.com/meshplus/bitxhub/internal/executor/contracts"
 )
 
 func genBVMContractTransaction(privateKey crypto.PrivateKey, nonce uint64, address *types.Address, method string, args ...*pb.Arg) (*pb.Transaction, error) {
@@ -80,6 +83,93 @@ func invokeBVMContract(api api.CoreAPI, privateKey crypto.PrivateKey, nonce uint
 	return sendTransactionWithReceipt(api, tx)
 }
 
+// bindRule proposes to bind the registered rule of the appchain of the private
+// key and approves the proposal with the votes of the admins, it takes one nonce
+func bindRule(api api.CoreAPI, privateKey crypto.PrivateKey, nonce uint64, chainID, rule string) error {
+	ret, err := invokeBVMContract(api, privateKey, nonce, constant.RuleManagerContractAddr.Address(), "BindRule", pb.String(chainID), pb.String(rule))
+	if err != nil {
+		return err
+	}
+	if !ret.IsSuccess() {
+		return fmt.Errorf("bind rule: %s", string(ret.Ret))
+	}
+
+	if err := approveProposal(api, string(ret.Ret)); err != nil {
+		return fmt.Errorf("approve rule binding: %w", err)
+	}
+
+	return nil
+}
+
+// registerService registers the service of the appchain of the private key
+// and approves the proposal with the votes of the admins, it takes one nonce
+func registerService(api api.CoreAPI, privateKey crypto.PrivateKey, nonce uint64, chainID, serviceID, whitelist string) error {
+	ret, err := invokeBVMContract(api, privateKey, nonce, constant.ServiceMgrContractAddr.Address(), "RegisterService",
+		pb.String(chainID), pb.String(serviceID), pb.String(""), pb.String(whitelist))
+	if err != nil {
+		return err
+	}
+	if !ret.IsSuccess() {
+		return fmt.Errorf("register service: %s", string(ret.Ret))
+	}
+
+	if err := approveProposal(api, string(ret.Ret)); err != nil {
+		return fmt.Errorf("approve service registration: %w", err)
+	}
+
+	return nil
+}
+
+// approveProposal votes for the proposal with the keys of the admin nodes
+// until it is approved
+func approveProposal(api api.CoreAPI, proposalID string) error {
+	for i := 1; i <= 4; i++ {
+		admin, err := asym.RestorePrivateKey(fmt.Sprintf("./test_data/config/node%d/key.json", i), "bitxhub")
+		if err != nil {
+			return err
+		}
+		from, err := admin.PublicKey().Address()
+		if err != nil {
+			return err
+		}
+
+		nonce := api.Broker().GetPendingNonceByAccount(from.String())
+		ret, err := invokeBVMContract(api, admin, nonce, constant.GovernanceContractAddr.Address(), "Vote",
+			pb.String(proposalID), pb.String(contracts.BallotApprove), pb.String("approve"))
+		if err != nil {
+			return err
+		}
+		if !ret.IsSuccess() {
+			return fmt.Errorf("vote: %s", string(ret.Ret))
+		}
+
+		ret, err = invokeBVMContract(api, admin, nonce+1, constant.GovernanceContractAddr.Address(), "GetStatus", pb.String(proposalID))
+		if err != nil {
+			return err
+		}
+		if contracts.ProposalStatus(ret.Ret) == contracts.APPOVED {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("proposal %s is not approved", proposalID)
+}
+
+// genIBTPPayload returns the plain payload calling the service of the
+// destination chain
+func genIBTPPayload(serviceID string) ([]byte, error) {
+	content := &pb.Content{
+		DstContractId: serviceID,
+		Func:          "set",
+	}
+	data, err := content.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&pb.Payload{Content: data})
+}
+
 func sendTransactionWithReceipt(api api.CoreAPI, tx *pb.Transaction) (*pb.Receipt, error) {
 	err := api.Broker().HandleTransaction(tx)
 	if err != nil {